@@ -0,0 +1,377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing"
+	"github.com/lusis/apithings/internal/statusthing/manifest"
+	"github.com/lusis/apithings/statusthing/client"
+)
+
+const (
+	serveCommand  = "serve"
+	configCommand = "config"
+	defaultURL    = "http://localhost:9000" + statusthing.DefaultHTTPBasePath
+
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+const (
+	lsUsage    = "ls"
+	setUsage   = "set <name|id> <red|yellow|green> [description]"
+	rmUsage    = "rm <name|id>"
+	watchUsage = "watch"
+	applyUsage = "apply -f <manifest>"
+)
+
+var urlEnvKey = fmt.Sprintf("%s_URL", envPrefix)
+
+// cliCommand is a subcommand that talks to a remote statusthing
+type cliCommand struct {
+	usage string
+	help  string
+	run   func(ctx context.Context, cc *cliContext, args []string) error
+	// flags registers any command specific flags
+	flags func(fs *flag.FlagSet, cc *cliContext)
+}
+
+// cliContext is the state shared by all subcommands
+type cliContext struct {
+	stdout   io.Writer
+	stderr   io.Writer
+	url      string
+	apikey   string
+	output   string
+	interval time.Duration
+	client   *client.Client
+	// flags for apply
+	manifestFile string
+	prune        bool
+	dryRun       bool
+}
+
+var cliCommands = map[string]*cliCommand{
+	"ls": {
+		usage: lsUsage,
+		help:  "list all things",
+		run:   runList,
+	},
+	"set": {
+		usage: setUsage,
+		help:  "set the status (and optionally description) of a thing, creating it if it does not exist",
+		run:   runSet,
+	},
+	"rm": {
+		usage: rmUsage,
+		help:  "remove a thing",
+		run:   runRemove,
+	},
+	"apply": {
+		usage: applyUsage,
+		help:  "create and update things to match a yaml or json manifest",
+		run:   runApply,
+		flags: func(fs *flag.FlagSet, cc *cliContext) {
+			fs.StringVar(&cc.manifestFile, "f", "", "path to the manifest")
+			fs.BoolVar(&cc.prune, "prune", false, "delete things that are not in the manifest")
+			fs.BoolVar(&cc.dryRun, "dry-run", false, "only show the changes that would be made")
+		},
+	},
+	"watch": {
+		usage: watchUsage,
+		help:  "print changes to things as they happen",
+		run:   runWatch,
+		flags: func(fs *flag.FlagSet, cc *cliContext) {
+			fs.DurationVar(&cc.interval, "interval", 5*time.Second, "how often to poll for changes")
+		},
+	},
+}
+
+// runCLI runs the subcommand named by the first element of args
+func runCLI(ctx context.Context, args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 {
+		cliUsage(stderr)
+		return fmt.Errorf("a command must be provided")
+	}
+	cmd, ok := cliCommands[args[0]]
+	if !ok {
+		cliUsage(stderr)
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+	cc := &cliContext{stdout: stdout, stderr: stderr}
+	fs := flag.NewFlagSet(args[0], flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprintf(stderr, "usage: statusthing %s [flags]\n\n%s\n\nflags:\n", cmd.usage, cmd.help)
+		fs.PrintDefaults()
+	}
+	fs.StringVar(&cc.url, "url", envOrDefault(urlEnvKey, defaultURL), fmt.Sprintf("base url of the statusthing instance (env: %s)", urlEnvKey))
+	fs.StringVar(&cc.apikey, "apikey", os.Getenv(apiKeyEnvKey), fmt.Sprintf("api key for the statusthing instance (env: %s)", apiKeyEnvKey))
+	fs.StringVar(&cc.output, "o", outputTable, "output format: table or json")
+	if cmd.flags != nil {
+		cmd.flags(fs, cc)
+	}
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if cc.output != outputTable && cc.output != outputJSON {
+		return fmt.Errorf("unknown output format: %s", cc.output)
+	}
+	opts := []client.Option{}
+	if cc.apikey != "" {
+		opts = append(opts, client.WithAPIKey(cc.apikey))
+	}
+	c, err := client.New(cc.url, opts...)
+	if err != nil {
+		return err
+	}
+	cc.client = c
+	return cmd.run(ctx, cc, fs.Args())
+}
+
+func cliUsage(w io.Writer) {
+	fmt.Fprintln(w, "usage: statusthing [command]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "commands:")
+	fmt.Fprintf(w, "  %-50s %s\n", serveCommand+" [flags]", "run the statusthing server (default)")
+	fmt.Fprintf(w, "  %-50s %s\n", configCommand+" print [flags]", "print the server config after applying the config file, env vars and flags")
+	names := make([]string, 0, len(cliCommands))
+	for n := range cliCommands {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(w, "  %-50s %s\n", cliCommands[n].usage, cliCommands[n].help)
+	}
+}
+
+func runList(ctx context.Context, cc *cliContext, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: statusthing %s", lsUsage)
+	}
+	things, err := cc.client.List(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Slice(things, func(i, j int) bool { return things[i].Name < things[j].Name })
+	return cc.printThings(things...)
+}
+
+func runSet(ctx context.Context, cc *cliContext, args []string) error {
+	if len(args) < 2 || len(args) > 3 {
+		return fmt.Errorf("usage: statusthing %s", setUsage)
+	}
+	status, err := parseStatus(args[1])
+	if err != nil {
+		return err
+	}
+	description := ""
+	if len(args) == 3 {
+		description = args[2]
+	}
+	existing, err := cc.findThing(ctx, args[0])
+	if errors.Is(err, client.ErrNotFound) {
+		if description == "" {
+			return fmt.Errorf("a description is required to create %s", args[0])
+		}
+		created, err := cc.client.Create(ctx, client.Params{Name: args[0], Description: description, Status: status})
+		if err != nil {
+			return err
+		}
+		return cc.printThings(created)
+	}
+	if err != nil {
+		return err
+	}
+	if err := cc.client.Update(ctx, existing.ID, client.Params{Status: status, Description: description}); err != nil {
+		return err
+	}
+	updated, err := cc.client.Get(ctx, existing.ID)
+	if err != nil {
+		return err
+	}
+	return cc.printThings(updated)
+}
+
+func runRemove(ctx context.Context, cc *cliContext, args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("usage: statusthing %s", rmUsage)
+	}
+	existing, err := cc.findThing(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	removed, err := cc.client.Delete(ctx, existing.ID)
+	if err != nil {
+		return err
+	}
+	return cc.printThings(removed)
+}
+
+func runWatch(ctx context.Context, cc *cliContext, args []string) error {
+	if len(args) != 0 {
+		return fmt.Errorf("usage: statusthing %s", watchUsage)
+	}
+	var printErr error
+	err := cc.client.Watch(ctx, cc.interval, func(e client.Event) {
+		if printErr == nil {
+			printErr = cc.printEvent(e)
+		}
+	})
+	if printErr != nil {
+		return printErr
+	}
+	// being interrupted is how watch is expected to end
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return nil
+	}
+	return err
+}
+
+func runApply(ctx context.Context, cc *cliContext, args []string) error {
+	if len(args) != 0 || cc.manifestFile == "" {
+		return fmt.Errorf("usage: statusthing %s", applyUsage)
+	}
+	m, err := manifest.Load(cc.manifestFile)
+	if err != nil {
+		return err
+	}
+	provider := &remoteProvider{client: cc.client}
+	plan, err := manifest.NewPlan(ctx, provider, m, cc.prune)
+	if err != nil {
+		return err
+	}
+	if err := cc.printPlan(plan); err != nil {
+		return err
+	}
+	if cc.dryRun {
+		return nil
+	}
+	return plan.Apply(ctx, provider)
+}
+
+// findThing finds a thing by its id or name
+func (cc *cliContext) findThing(ctx context.Context, nameOrID string) (*client.StatusThing, error) {
+	things, err := cc.client.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, t := range things {
+		if t.ID == nameOrID || t.Name == nameOrID {
+			return t, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", nameOrID, client.ErrNotFound)
+}
+
+// cliThing is the json output representation of a thing
+type cliThing struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Group       string `json:"group,omitempty"`
+	Status      string `json:"status"`
+	Version     int64  `json:"version"`
+}
+
+func toCLIThing(t *client.StatusThing) *cliThing {
+	return &cliThing{ID: t.ID, Name: t.Name, Description: t.Description, Group: t.Group, Status: t.Status.String(), Version: t.Version}
+}
+
+func (cc *cliContext) printThings(things ...*client.StatusThing) error {
+	if cc.output == outputJSON {
+		res := make([]*cliThing, 0, len(things))
+		for _, t := range things {
+			res = append(res, toCLIThing(t))
+		}
+		return json.NewEncoder(cc.stdout).Encode(res)
+	}
+	tw := tabwriter.NewWriter(cc.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tGROUP\tSTATUS\tDESCRIPTION")
+	for _, t := range things {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", t.ID, t.Name, t.Group, shortStatus(t.Status), t.Description)
+	}
+	return tw.Flush()
+}
+
+func (cc *cliContext) printEvent(e client.Event) error {
+	if cc.output == outputJSON {
+		out := struct {
+			Event    string    `json:"event"`
+			Time     time.Time `json:"time"`
+			Thing    *cliThing `json:"thing"`
+			Previous *cliThing `json:"previous,omitempty"`
+		}{Event: e.Type.String(), Time: time.Now().UTC(), Thing: toCLIThing(e.Thing)}
+		if e.Previous != nil {
+			out.Previous = toCLIThing(e.Previous)
+		}
+		return json.NewEncoder(cc.stdout).Encode(out)
+	}
+	_, err := fmt.Fprintf(cc.stdout, "%s  %-8s %-7s %s  %s\n", time.Now().Format(time.RFC3339), e.Type, shortStatus(e.Thing.Status), e.Thing.Name, e.Thing.Description)
+	return err
+}
+
+func (cc *cliContext) printPlan(plan *manifest.Plan) error {
+	if cc.output != outputJSON {
+		return plan.Diff(cc.stdout)
+	}
+	type change struct {
+		Action string    `json:"action"`
+		Name   string    `json:"name"`
+		Before *cliThing `json:"before,omitempty"`
+		After  *cliThing `json:"after,omitempty"`
+	}
+	res := []change{}
+	for _, c := range plan.Changes {
+		out := change{Action: c.Action.String()}
+		if c.Existing != nil {
+			out.Name = c.Existing.Name
+			out.Before = toCLIThing(c.Existing)
+		}
+		if c.Desired != nil {
+			out.Name = c.Desired.Name
+			out.After = &cliThing{Name: c.Desired.Name, Description: c.Desired.Description, Group: c.Desired.Group, Status: c.Desired.InitialStatus().String()}
+			if c.Existing != nil {
+				out.After.ID = c.Existing.ID
+				out.After.Status = c.Existing.Status.String()
+			}
+		}
+		res = append(res, out)
+	}
+	return json.NewEncoder(cc.stdout).Encode(res)
+}
+
+// parseStatus parses a status from either its short (green) or full (STATUS_GREEN) form
+func parseStatus(s string) (client.Status, error) {
+	full := strings.ToUpper(s)
+	if !strings.HasPrefix(full, "STATUS_") {
+		full = "STATUS_" + full
+	}
+	status := client.StatusFromString(full)
+	if status == client.StatusUnknown {
+		return status, fmt.Errorf("unknown status %q: must be one of red, yellow or green", s)
+	}
+	return status, nil
+}
+
+// shortStatus returns the short lowercase form of a status i.e. green
+func shortStatus(s client.Status) string {
+	return strings.ToLower(strings.TrimPrefix(s.String(), "STATUS_"))
+}
+
+func envOrDefault(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
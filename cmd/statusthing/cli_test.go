@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lusis/apithings/internal/statusthing/handlers"
+	"github.com/lusis/apithings/internal/statusthing/statusthingtest"
+)
+
+func TestCLI(t *testing.T) {
+	srv := statusthingtest.NewServer(t, t.Name())
+	run := func(args ...string) (string, error) {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		common := []string{"-url", srv.URL + handlers.DefaultBasePath, "-apikey", "TestCLI"}
+		err := runCLI(context.Background(), append(append([]string{args[0]}, common...), args[1:]...), stdout, stderr)
+		return stdout.String(), err
+	}
+
+	out, err := run("ls")
+	require.NoError(t, err)
+	require.Equal(t, "ID  NAME  GROUP  STATUS  DESCRIPTION\n", out, "should only print the header")
+
+	_, err = run("set", "api", "green")
+	require.ErrorContains(t, err, "description is required", "should need a description to create")
+
+	out, err = run("set", "api", "green", "all good")
+	require.NoError(t, err)
+	require.Contains(t, out, "api")
+	require.Contains(t, out, "green")
+	require.Contains(t, out, "all good")
+
+	out, err = run("set", "-o", "json", "api", "STATUS_RED", "on fire")
+	require.NoError(t, err)
+	res := []cliThing{}
+	require.NoError(t, json.Unmarshal([]byte(out), &res))
+	require.Len(t, res, 1)
+	require.Equal(t, "api", res[0].Name)
+	require.Equal(t, "STATUS_RED", res[0].Status)
+	require.Equal(t, "on fire", res[0].Description)
+	require.Equal(t, int64(2), res[0].Version)
+
+	// setting without a description keeps the existing one
+	_, err = run("set", res[0].ID, "yellow")
+	require.NoError(t, err)
+	out, err = run("ls", "-o", "json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(out), &res))
+	require.Len(t, res, 1)
+	require.Equal(t, "STATUS_YELLOW", res[0].Status)
+	require.Equal(t, "on fire", res[0].Description)
+
+	_, err = run("set", "api", "purple")
+	require.ErrorContains(t, err, "unknown status")
+
+	out, err = run("rm", "api")
+	require.NoError(t, err)
+	require.Contains(t, out, "api")
+
+	_, err = run("rm", "api")
+	require.ErrorContains(t, err, "not found")
+
+	_, err = run("ls", "-o", "yaml")
+	require.ErrorContains(t, err, "unknown output format")
+}
+
+func TestCLIErrors(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	require.Error(t, runCLI(context.Background(), []string{}, stdout, stderr), "should require a command")
+	require.Error(t, runCLI(context.Background(), []string{"snarf"}, stdout, stderr), "should reject unknown commands")
+	require.Contains(t, stderr.String(), "usage: statusthing")
+	require.Error(t, runCLI(context.Background(), []string{"set", "-url", "http://localhost:1", "onlyname"}, stdout, stderr), "should validate arguments")
+}
+
+func TestCLIWatch(t *testing.T) {
+	srv := statusthingtest.NewServer(t, t.Name())
+	stdout := &bytes.Buffer{}
+	stderr := &bytes.Buffer{}
+	base := []string{"-url", srv.URL + handlers.DefaultBasePath, "-apikey", t.Name()}
+	require.NoError(t, runCLI(context.Background(), append([]string{"set"}, append(base, "api", "green", "all good")...), stdout, stderr))
+
+	stdout.Reset()
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	err := runCLI(ctx, append([]string{"watch"}, append(base, "-interval", "10ms", "-o", "json")...), stdout, stderr)
+	require.NoError(t, err, "watch should end cleanly when the context is done")
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 1, "should only see the existing thing")
+	event := map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &event))
+	require.Equal(t, "added", event["event"])
+}
+
+func TestParseStatus(t *testing.T) {
+	for _, s := range []string{"green", "GREEN", "status_green", "STATUS_GREEN"} {
+		status, err := parseStatus(s)
+		require.NoError(t, err)
+		require.Equal(t, "STATUS_GREEN", status.String())
+	}
+	_, err := parseStatus("unknown")
+	require.Error(t, err)
+}
+
+func TestCLIApply(t *testing.T) {
+	srv := statusthingtest.NewServer(t, t.Name())
+	base := []string{"-url", srv.URL + handlers.DefaultBasePath, "-apikey", t.Name()}
+	run := func(args ...string) (string, error) {
+		stdout := &bytes.Buffer{}
+		stderr := &bytes.Buffer{}
+		err := runCLI(context.Background(), append(append([]string{args[0]}, base...), args[1:]...), stdout, stderr)
+		return stdout.String(), err
+	}
+	manifestPath := filepath.Join(t.TempDir(), "things.yaml")
+	require.NoError(t, os.WriteFile(manifestPath, []byte("things:\n  - name: api\n    description: the api\n    group: core\n"), 0o600))
+
+	_, err := run("set", "legacy", "red", "going away")
+	require.NoError(t, err)
+
+	_, err = run("apply")
+	require.ErrorContains(t, err, "usage", "should require a manifest")
+
+	out, err := run("apply", "-f", manifestPath, "-prune", "-dry-run")
+	require.NoError(t, err)
+	require.Contains(t, out, "+ api")
+	require.Contains(t, out, "- legacy")
+	out, err = run("ls", "-o", "json")
+	require.NoError(t, err)
+	res := []cliThing{}
+	require.NoError(t, json.Unmarshal([]byte(out), &res))
+	require.Len(t, res, 1, "dry run should not change anything")
+
+	_, err = run("apply", "-f", manifestPath, "-prune")
+	require.NoError(t, err)
+	out, err = run("ls", "-o", "json")
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal([]byte(out), &res))
+	require.Len(t, res, 1)
+	require.Equal(t, "api", res[0].Name)
+	require.Equal(t, "core", res[0].Group)
+	require.Equal(t, "STATUS_GREEN", res[0].Status)
+
+	// change the description and group
+	require.NoError(t, os.WriteFile(manifestPath, []byte("things:\n  - name: api\n    description: the new api\n"), 0o600))
+	out, err = run("apply", "-f", manifestPath, "-o", "json")
+	require.NoError(t, err)
+	changes := []map[string]any{}
+	require.NoError(t, json.Unmarshal([]byte(out), &changes))
+	require.Len(t, changes, 1)
+	require.Equal(t, "update", changes[0]["action"])
+	out, err = run("ls", "-o", "json")
+	require.NoError(t, err)
+	res = []cliThing{}
+	require.NoError(t, json.Unmarshal([]byte(out), &res))
+	require.Equal(t, "the new api", res[0].Description)
+	require.Equal(t, "", res[0].Group)
+
+	out, err = run("apply", "-f", manifestPath)
+	require.NoError(t, err)
+	require.Equal(t, "no changes\n", out)
+}
@@ -0,0 +1,766 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing"
+	"github.com/lusis/apithings/internal/statusthing/notifiers"
+	"github.com/lusis/apithings/statusthing/client"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	envPrefix = "STATUSTHING"
+	// redacted replaces secrets when printing the config
+	redacted = "<redacted>"
+)
+
+var (
+	configEnvKey     = fmt.Sprintf("%s_CONFIG", envPrefix)
+	basePathEnvKey   = fmt.Sprintf("%s_BASEPATH", envPrefix)
+	addrEnvKey       = fmt.Sprintf("%s_ADDR", envPrefix)
+	apiKeyEnvKey     = fmt.Sprintf("%s_APIKEY", envPrefix)
+	apiKeysEnvKey    = fmt.Sprintf("%s_APIKEYS", envPrefix)
+	dbFileNameEnvKey = fmt.Sprintf("%s_DBFILE", envPrefix)
+	debugEnvKey      = fmt.Sprintf("%s_DEBUG", envPrefix)
+	enableDashEnvKey = fmt.Sprintf("%s_ENABLE_DASH", envPrefix)
+	manifestEnvKey   = fmt.Sprintf("%s_MANIFEST", envPrefix)
+	pruneEnvKey      = fmt.Sprintf("%s_MANIFEST_PRUNE", envPrefix)
+
+	alertmanagerEnvKey           = fmt.Sprintf("%s_ALERTMANAGER", envPrefix)
+	alertmanagerLabelEnvKey      = fmt.Sprintf("%s_ALERTMANAGER_LABEL", envPrefix)
+	alertmanagerSeveritiesEnvKey = fmt.Sprintf("%s_ALERTMANAGER_SEVERITIES", envPrefix)
+
+	githubSecretEnvKey = fmt.Sprintf("%s_GITHUB_SECRET", envPrefix)
+	gitlabTokenEnvKey  = fmt.Sprintf("%s_GITLAB_TOKEN", envPrefix)
+	deploymentsEnvKey  = fmt.Sprintf("%s_DEPLOYMENTS", envPrefix)
+	hooksEnvKey        = fmt.Sprintf("%s_HOOKS", envPrefix)
+	notifiersEnvKey    = fmt.Sprintf("%s_NOTIFIERS", envPrefix)
+
+	publicURLEnvKey    = fmt.Sprintf("%s_PUBLIC_URL", envPrefix)
+	smtpAddrEnvKey     = fmt.Sprintf("%s_SMTP_ADDR", envPrefix)
+	smtpUsernameEnvKey = fmt.Sprintf("%s_SMTP_USERNAME", envPrefix)
+	smtpPasswordEnvKey = fmt.Sprintf("%s_SMTP_PASSWORD", envPrefix)
+	smtpFromEnvKey     = fmt.Sprintf("%s_SMTP_FROM", envPrefix)
+	emailDigestEnvKey  = fmt.Sprintf("%s_EMAIL_DIGEST", envPrefix)
+
+	flapDwellEnvKey     = fmt.Sprintf("%s_FLAP_DWELL", envPrefix)
+	flapWindowEnvKey    = fmt.Sprintf("%s_FLAP_WINDOW", envPrefix)
+	flapThresholdEnvKey = fmt.Sprintf("%s_FLAP_THRESHOLD", envPrefix)
+
+	uptimeYellowWeightEnvKey = fmt.Sprintf("%s_UPTIME_YELLOW_WEIGHT", envPrefix)
+
+	otelExporterEnvKey = fmt.Sprintf("%s_OTEL_EXPORTER", envPrefix)
+
+	shutdownTimeoutEnvKey  = fmt.Sprintf("%s_SHUTDOWN_TIMEOUT", envPrefix)
+	shutdownDelayEnvKey    = fmt.Sprintf("%s_SHUTDOWN_DELAY", envPrefix)
+	httpReadTimeoutEnvKey  = fmt.Sprintf("%s_HTTP_READ_TIMEOUT", envPrefix)
+	httpWriteTimeoutEnvKey = fmt.Sprintf("%s_HTTP_WRITE_TIMEOUT", envPrefix)
+	httpIdleTimeoutEnvKey  = fmt.Sprintf("%s_HTTP_IDLE_TIMEOUT", envPrefix)
+
+	rateLimitIPEnvKey          = fmt.Sprintf("%s_RATE_LIMIT_IP", envPrefix)
+	rateLimitIPBurstEnvKey     = fmt.Sprintf("%s_RATE_LIMIT_IP_BURST", envPrefix)
+	rateLimitAPIKeyEnvKey      = fmt.Sprintf("%s_RATE_LIMIT_APIKEY", envPrefix)
+	rateLimitAPIKeyBurstEnvKey = fmt.Sprintf("%s_RATE_LIMIT_APIKEY_BURST", envPrefix)
+	maxBodyBytesEnvKey         = fmt.Sprintf("%s_MAX_BODY_BYTES", envPrefix)
+
+	corsOriginsEnvKey = fmt.Sprintf("%s_CORS_ORIGINS", envPrefix)
+	corsMethodsEnvKey = fmt.Sprintf("%s_CORS_METHODS", envPrefix)
+	corsHeadersEnvKey = fmt.Sprintf("%s_CORS_HEADERS", envPrefix)
+	corsMaxAgeEnvKey  = fmt.Sprintf("%s_CORS_MAX_AGE", envPrefix)
+
+	tlsCertEnvKey           = fmt.Sprintf("%s_TLS_CERT", envPrefix)
+	tlsKeyEnvKey            = fmt.Sprintf("%s_TLS_KEY", envPrefix)
+	tlsClientCAEnvKey       = fmt.Sprintf("%s_TLS_CLIENT_CA", envPrefix)
+	tlsClientRequiredEnvKey = fmt.Sprintf("%s_TLS_CLIENT_REQUIRED", envPrefix)
+	tlsClientSubjectsEnvKey = fmt.Sprintf("%s_TLS_CLIENT_SUBJECTS", envPrefix)
+
+	// we support the native ngrok env vars
+	ngrokAuthtokenEnvKey = "NGROK_AUTHTOKEN"
+	ngrokEndpointEnvKey  = "NGROK_ENDPOINT"
+)
+
+type config struct {
+	basepath          string
+	addr              string
+	apikey            string
+	apikeys           map[string]string
+	dbfile            string
+	debug             bool
+	enableDash        bool
+	enableNgrok       bool
+	ngrokAuthtoken    string
+	ngrokEndpointName string
+	manifest          string
+	pruneManifest     bool
+	// alertmanager enables the alertmanager webhook receiver
+	alertmanager           bool
+	alertmanagerLabel      string
+	alertmanagerSeverities map[string]client.Status
+	// githubSecret and gitlabToken enable the deployment webhook receivers
+	githubSecret string
+	gitlabToken  string
+	deployments  []deploymentTarget
+	// hooks is the path to templated webhook definitions
+	hooks string
+	// notifiers is the path to notification channel definitions
+	notifiers string
+	// publicURL is where the base path can be reached from outside i.e. in emails
+	publicURL string
+	// smtp enables email notifications if an address is set
+	smtp        notifiers.SMTPConfig
+	emailDigest time.Duration
+	// flapDwell and flapWindow enable flap detection if either is set
+	flapDwell     time.Duration
+	flapWindow    time.Duration
+	flapThreshold int
+	// uptimeYellowWeight is how much time spent yellow counts as up
+	uptimeYellowWeight float64
+	// otelExporter enables tracing with the named exporter
+	otelExporter string
+	// shutdownTimeout is how long in-flight requests and notifications have to finish on shutdown
+	shutdownTimeout time.Duration
+	// shutdownDelay is how long requests are still served after readiness starts failing on shutdown
+	shutdownDelay time.Duration
+	// httpReadTimeout, httpWriteTimeout and httpIdleTimeout are passed to the http server if set
+	httpReadTimeout  time.Duration
+	httpWriteTimeout time.Duration
+	httpIdleTimeout  time.Duration
+	// rateLimitIP and rateLimitAPIKey limit api requests per second if set
+	// bursts default to a second's worth of requests
+	rateLimitIP          float64
+	rateLimitIPBurst     int
+	rateLimitAPIKey      float64
+	rateLimitAPIKeyBurst int
+	// maxBodyBytes is the largest json body the api accepts
+	maxBodyBytes int
+	// corsOrigins allow browsers on other origins to call the api if set
+	corsOrigins []string
+	corsMethods []string
+	corsHeaders []string
+	corsMaxAge  time.Duration
+	// tlsCert and tlsKey serve https if both are set
+	tlsCert string
+	tlsKey  string
+	// tlsClientCA verifies client certificates which can be used in place of an api key
+	tlsClientCA       string
+	tlsClientRequired bool
+	tlsClientSubjects []string
+
+	// sources is where each setting was set by name
+	sources map[string]string
+}
+
+// deploymentTarget maps deployments of a repository and optionally an environment to a thing
+type deploymentTarget struct {
+	repository  string
+	environment string
+	thing       string
+}
+
+func defaultConfig() *config {
+	return &config{
+		basepath:           statusthing.DefaultHTTPBasePath,
+		addr:               ":9000",
+		dbfile:             "statusthing.db",
+		enableDash:         true,
+		flapThreshold:      5,
+		uptimeYellowWeight: 1,
+		shutdownTimeout:    30 * time.Second,
+		maxBodyBytes:       1 << 20,
+		sources:            map[string]string{},
+	}
+}
+
+// setting is a single value that can be set in the config file, the environment or with a flag
+type setting struct {
+	// name is the key in the config file and, with dashes instead of underscores, the flag
+	name string
+	env  string
+	help string
+	// secret settings are redacted when printed
+	secret bool
+	// reloadable settings are applied on SIGHUP without a restart
+	reloadable bool
+	// isBool flags don't need a value
+	isBool bool
+	// scalar values are printed without quotes i.e. numbers
+	scalar bool
+	set    func(c *config, v string) error
+	get    func(c *config) string
+}
+
+// flag returns the name of the setting's flag
+func (s *setting) flag() string {
+	return strings.ReplaceAll(s.name, "_", "-")
+}
+
+func secret(s *setting) *setting {
+	s.secret = true
+	return s
+}
+
+func reloadable(s *setting) *setting {
+	s.reloadable = true
+	return s
+}
+
+func stringSetting(name, env, help string, field func(*config) *string) *setting {
+	return &setting{
+		name: name, env: env, help: help,
+		set: func(c *config, v string) error { *field(c) = v; return nil },
+		get: func(c *config) string { return *field(c) },
+	}
+}
+
+// listSetting is a comma separated list or a list in the config file
+func listSetting(name, env, help string, field func(*config) *[]string) *setting {
+	return &setting{
+		name: name, env: env, help: help,
+		set: func(c *config, v string) error { *field(c) = splitList(v); return nil },
+		get: func(c *config) string { return strings.Join(*field(c), ",") },
+	}
+}
+
+// boolSetting accepts anything [strconv.ParseBool] does i.e. 1, true, 0 or false
+// anything else is an error rather than a guess since some of these i.e. manifest_prune are destructive
+func boolSetting(name, env, help string, field func(*config) *bool) *setting {
+	return &setting{
+		name: name, env: env, help: help, isBool: true, scalar: true,
+		set: func(c *config, v string) error {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("must be true or false")
+			}
+			*field(c) = b
+			return nil
+		},
+		get: func(c *config) string { return strconv.FormatBool(*field(c)) },
+	}
+}
+
+func durationSetting(name, env, help string, field func(*config) *time.Duration) *setting {
+	return &setting{
+		name: name, env: env, help: help,
+		set: func(c *config, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("must be a duration like 30s or 10m")
+			}
+			*field(c) = d
+			return nil
+		},
+		get: func(c *config) string { return field(c).String() },
+	}
+}
+
+func intSetting(name, env, help string, field func(*config) *int) *setting {
+	return &setting{
+		name: name, env: env, help: help, scalar: true,
+		set: func(c *config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("must be a whole number")
+			}
+			*field(c) = n
+			return nil
+		},
+		get: func(c *config) string { return strconv.Itoa(*field(c)) },
+	}
+}
+
+func floatSetting(name, env, help string, field func(*config) *float64) *setting {
+	return &setting{
+		name: name, env: env, help: help, scalar: true,
+		set: func(c *config, v string) error {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("must be a number")
+			}
+			*field(c) = f
+			return nil
+		},
+		get: func(c *config) string { return strconv.FormatFloat(*field(c), 'g', -1, 64) },
+	}
+}
+
+// settings are every configurable value in the order they are printed
+var settings = []*setting{
+	stringSetting("addr", addrEnvKey, "address to listen on", func(c *config) *string { return &c.addr }),
+	stringSetting("basepath", basePathEnvKey, "path the app is served under", func(c *config) *string { return &c.basepath }),
+	stringSetting("dbfile", dbFileNameEnvKey, "path to the sqlite database", func(c *config) *string { return &c.dbfile }),
+	reloadable(boolSetting("debug", debugEnvKey, "log at debug level", func(c *config) *bool { return &c.debug })),
+	boolSetting("enable_dash", enableDashEnvKey, "serve the dashboard", func(c *config) *bool { return &c.enableDash }),
+	reloadable(secret(stringSetting("apikey", apiKeyEnvKey, "api key required to make changes", func(c *config) *string { return &c.apikey }))),
+	reloadable(secret(&setting{
+		name: "apikeys", env: apiKeysEnvKey, help: "comma separated name=key api keys",
+		set: func(c *config, v string) error {
+			keys, err := parseAPIKeys(v)
+			c.apikeys = keys
+			return err
+		},
+		get: func(c *config) string { return joinPairs(c.apikeys, func(v string) string { return v }) },
+	})),
+	durationSetting("shutdown_timeout", shutdownTimeoutEnvKey, "how long to wait for in-flight requests on shutdown", func(c *config) *time.Duration { return &c.shutdownTimeout }),
+	durationSetting("shutdown_delay", shutdownDelayEnvKey, "how long to keep serving requests after failing readiness on shutdown", func(c *config) *time.Duration { return &c.shutdownDelay }),
+	durationSetting("http_read_timeout", httpReadTimeoutEnvKey, "maximum duration for reading a request", func(c *config) *time.Duration { return &c.httpReadTimeout }),
+	durationSetting("http_write_timeout", httpWriteTimeoutEnvKey, "maximum duration for writing a response", func(c *config) *time.Duration { return &c.httpWriteTimeout }),
+	durationSetting("http_idle_timeout", httpIdleTimeoutEnvKey, "how long idle keep-alive connections are kept open", func(c *config) *time.Duration { return &c.httpIdleTimeout }),
+	floatSetting("rate_limit_ip", rateLimitIPEnvKey, "api requests per second allowed from each address", func(c *config) *float64 { return &c.rateLimitIP }),
+	intSetting("rate_limit_ip_burst", rateLimitIPBurstEnvKey, "api requests allowed at once from each address", func(c *config) *int { return &c.rateLimitIPBurst }),
+	floatSetting("rate_limit_apikey", rateLimitAPIKeyEnvKey, "api requests per second allowed with each api key or client certificate", func(c *config) *float64 { return &c.rateLimitAPIKey }),
+	intSetting("rate_limit_apikey_burst", rateLimitAPIKeyBurstEnvKey, "api requests allowed at once with each api key or client certificate", func(c *config) *int { return &c.rateLimitAPIKeyBurst }),
+	intSetting("max_body_bytes", maxBodyBytesEnvKey, "largest json body the api accepts", func(c *config) *int { return &c.maxBodyBytes }),
+	listSetting("cors_origins", corsOriginsEnvKey, "comma separated origins browsers can call the api from or *", func(c *config) *[]string { return &c.corsOrigins }),
+	listSetting("cors_methods", corsMethodsEnvKey, "comma separated methods browsers on other origins can use", func(c *config) *[]string { return &c.corsMethods }),
+	listSetting("cors_headers", corsHeadersEnvKey, "comma separated headers browsers on other origins can send", func(c *config) *[]string { return &c.corsHeaders }),
+	durationSetting("cors_max_age", corsMaxAgeEnvKey, "how long browsers can cache preflight responses", func(c *config) *time.Duration { return &c.corsMaxAge }),
+	stringSetting("tls_cert", tlsCertEnvKey, "certificate file to serve https with", func(c *config) *string { return &c.tlsCert }),
+	stringSetting("tls_key", tlsKeyEnvKey, "key file to serve https with", func(c *config) *string { return &c.tlsKey }),
+	stringSetting("tls_client_ca", tlsClientCAEnvKey, "CA bundle to verify client certificates with", func(c *config) *string { return &c.tlsClientCA }),
+	boolSetting("tls_client_required", tlsClientRequiredEnvKey, "reject connections without a client certificate", func(c *config) *bool { return &c.tlsClientRequired }),
+	listSetting("tls_client_subjects", tlsClientSubjectsEnvKey, "comma separated common names of client certificates accepted in place of an api key", func(c *config) *[]string { return &c.tlsClientSubjects }),
+	secret(stringSetting("ngrok_authtoken", ngrokAuthtokenEnvKey, "serve over an ngrok tunnel with this authtoken", func(c *config) *string { return &c.ngrokAuthtoken })),
+	stringSetting("ngrok_endpoint", ngrokEndpointEnvKey, "ngrok domain to use", func(c *config) *string { return &c.ngrokEndpointName }),
+	stringSetting("manifest", manifestEnvKey, "manifest of things to apply on start", func(c *config) *string { return &c.manifest }),
+	boolSetting("manifest_prune", pruneEnvKey, "delete things that aren't in the manifest", func(c *config) *bool { return &c.pruneManifest }),
+	boolSetting("alertmanager", alertmanagerEnvKey, "accept alertmanager webhooks", func(c *config) *bool { return &c.alertmanager }),
+	stringSetting("alertmanager_label", alertmanagerLabelEnvKey, "alert label naming the thing", func(c *config) *string { return &c.alertmanagerLabel }),
+	{
+		name: "alertmanager_severities", env: alertmanagerSeveritiesEnvKey, help: "comma separated severity=status mappings",
+		set: func(c *config, v string) error {
+			severities, err := parseSeverities(v)
+			c.alertmanagerSeverities = severities
+			return err
+		},
+		get: func(c *config) string { return joinPairs(c.alertmanagerSeverities, shortStatus) },
+	},
+	secret(stringSetting("github_secret", githubSecretEnvKey, "secret github deployment webhooks are signed with", func(c *config) *string { return &c.githubSecret })),
+	secret(stringSetting("gitlab_token", gitlabTokenEnvKey, "token gitlab webhooks are sent with", func(c *config) *string { return &c.gitlabToken })),
+	{
+		name: "deployments", env: deploymentsEnvKey, help: "comma separated repository[@environment]=thing deployment targets",
+		set: func(c *config, v string) error {
+			deployments, err := parseDeployments(v)
+			c.deployments = deployments
+			return err
+		},
+		get: func(c *config) string {
+			targets := make([]string, 0, len(c.deployments))
+			for _, d := range c.deployments {
+				source := d.repository
+				if d.environment != "" {
+					source += "@" + d.environment
+				}
+				targets = append(targets, source+"="+d.thing)
+			}
+			return strings.Join(targets, ",")
+		},
+	},
+	stringSetting("hooks", hooksEnvKey, "file of templated webhook definitions", func(c *config) *string { return &c.hooks }),
+	stringSetting("notifiers", notifiersEnvKey, "file of notification channel definitions", func(c *config) *string { return &c.notifiers }),
+	stringSetting("public_url", publicURLEnvKey, "where the base path can be reached from outside for links in emails and feeds", func(c *config) *string { return &c.publicURL }),
+	stringSetting("smtp_addr", smtpAddrEnvKey, "host:port of the smtp server to send email with", func(c *config) *string { return &c.smtp.Addr }),
+	stringSetting("smtp_username", smtpUsernameEnvKey, "smtp username", func(c *config) *string { return &c.smtp.Username }),
+	secret(stringSetting("smtp_password", smtpPasswordEnvKey, "smtp password", func(c *config) *string { return &c.smtp.Password })),
+	stringSetting("smtp_from", smtpFromEnvKey, "address email is sent from", func(c *config) *string { return &c.smtp.From }),
+	durationSetting("email_digest", emailDigestEnvKey, "batch emails sent within this long of each other", func(c *config) *time.Duration { return &c.emailDigest }),
+	durationSetting("flap_dwell", flapDwellEnvKey, "only notify once a status has been kept this long", func(c *config) *time.Duration { return &c.flapDwell }),
+	durationSetting("flap_window", flapWindowEnvKey, "window flapping is detected within", func(c *config) *time.Duration { return &c.flapWindow }),
+	intSetting("flap_threshold", flapThresholdEnvKey, "changes within the flap window that mean a thing is flapping", func(c *config) *int { return &c.flapThreshold }),
+	floatSetting("uptime_yellow_weight", uptimeYellowWeightEnvKey, "how much time spent yellow counts as up between 0 and 1", func(c *config) *float64 { return &c.uptimeYellowWeight }),
+	stringSetting("otel_exporter", otelExporterEnvKey, "trace with the otlp or stdout exporter", func(c *config) *string { return &c.otelExporter }),
+}
+
+// settingFlag records a flag so it can be applied after the config file and environment
+type settingFlag struct {
+	s     *setting
+	flags *[]flagValue
+}
+
+type flagValue struct {
+	s     *setting
+	value string
+}
+
+// String returns the default value for flag usage
+func (sf *settingFlag) String() string {
+	if sf == nil || sf.s == nil || sf.s.secret {
+		return ""
+	}
+	return sf.s.get(defaultConfig())
+}
+
+// Set records the flag's value
+func (sf *settingFlag) Set(v string) error {
+	*sf.flags = append(*sf.flags, flagValue{s: sf.s, value: v})
+	return nil
+}
+
+// IsBoolFlag lets boolean settings be set with just the flag
+func (sf *settingFlag) IsBoolFlag() bool {
+	return sf.s.isBool
+}
+
+// loadConfig builds the config from the defaults, then the config file, then the environment and finally flags in args
+func loadConfig(name string, args []string, stderr io.Writer) (*config, error) {
+	cfg := defaultConfig()
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	var configFile string
+	fs.StringVar(&configFile, "config", os.Getenv(configEnvKey), fmt.Sprintf("yaml or json config file (env: %s)", configEnvKey))
+	flags := []flagValue{}
+	for _, s := range settings {
+		fs.Var(&settingFlag{s: s, flags: &flags}, s.flag(), fmt.Sprintf("%s (env: %s)", s.help, s.env))
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf("unexpected arguments: %s", strings.Join(fs.Args(), " "))
+	}
+
+	var errs []error
+	if configFile != "" {
+		if err := cfg.loadFile(configFile); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range settings {
+		if v := os.Getenv(s.env); v != "" {
+			errs = append(errs, cfg.apply(s, v, "env "+s.env))
+		}
+	}
+	for _, f := range flags {
+		errs = append(errs, cfg.apply(f.s, f.value, "flag -"+f.s.flag()))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return nil, err
+	}
+	cfg.enableNgrok = cfg.ngrokAuthtoken != ""
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// apply sets a setting and records where it came from
+func (c *config) apply(s *setting, v, source string) error {
+	if err := s.set(c, v); err != nil {
+		return fmt.Errorf("invalid %s from %s: %w", s.name, source, err)
+	}
+	c.sources[s.name] = source
+	return nil
+}
+
+// loadFile applies the settings in a yaml or json config file
+func (c *config) loadFile(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("unable to read config file: %w", err)
+	}
+	values := map[string]any{}
+	if err := yaml.Unmarshal(b, &values); err != nil {
+		return fmt.Errorf("unable to parse config file %s: %w", path, err)
+	}
+	byName := make(map[string]*setting, len(settings))
+	for _, s := range settings {
+		byName[s.name] = s
+	}
+	var errs []error
+	for name, raw := range values {
+		s, ok := byName[name]
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown setting %s in %s", name, path))
+			continue
+		}
+		v, err := fileValue(raw)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("invalid %s in %s: %w", name, path, err))
+			continue
+		}
+		errs = append(errs, c.apply(s, v, "file "+path))
+	}
+	return errors.Join(errs...)
+}
+
+// fileValue converts a value from the config file to the same form as the env var
+// lists are comma separated and maps are comma separated key=value pairs
+func fileValue(raw any) (string, error) {
+	switch v := raw.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, float64:
+		return fmt.Sprint(v), nil
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			s, err := fileValue(item)
+			if err != nil {
+				return "", err
+			}
+			items = append(items, s)
+		}
+		return strings.Join(items, ","), nil
+	case map[string]any:
+		pairs := make(map[string]string, len(v))
+		for k, item := range v {
+			s, err := fileValue(item)
+			if err != nil {
+				return "", err
+			}
+			pairs[k] = s
+		}
+		return joinPairs(pairs, func(s string) string { return s }), nil
+	default:
+		return "", fmt.Errorf("unsupported value %v", raw)
+	}
+}
+
+// validate checks settings that depend on each other
+func (c *config) validate() error {
+	var errs []error
+	invalid := func(name, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("invalid %s from %s: %s", name, c.source(name), fmt.Sprintf(format, args...)))
+	}
+	if c.addr == "" {
+		invalid("addr", "an address to listen on is required")
+	}
+	if !strings.HasPrefix(c.basepath, "/") {
+		invalid("basepath", "must start with /")
+	}
+	if c.dbfile == "" {
+		invalid("dbfile", "a database file is required")
+	}
+	if _, ok := c.apikeys["default"]; ok && c.apikey != "" {
+		invalid("apikeys", "default is the name of apikey so can't be used when apikey is set")
+	}
+	if c.shutdownTimeout <= 0 {
+		invalid("shutdown_timeout", "must be positive")
+	}
+	if c.shutdownDelay >= c.shutdownTimeout {
+		invalid("shutdown_delay", "must be less than shutdown_timeout")
+	}
+	for name, d := range map[string]time.Duration{
+		"http_read_timeout":  c.httpReadTimeout,
+		"http_write_timeout": c.httpWriteTimeout,
+		"http_idle_timeout":  c.httpIdleTimeout,
+		"email_digest":       c.emailDigest,
+		"cors_max_age":       c.corsMaxAge,
+		"flap_dwell":         c.flapDwell,
+		"flap_window":        c.flapWindow,
+		"shutdown_delay":     c.shutdownDelay,
+	} {
+		if d < 0 {
+			invalid(name, "cannot be negative")
+		}
+	}
+	for name, n := range map[string]float64{
+		"rate_limit_ip":           c.rateLimitIP,
+		"rate_limit_ip_burst":     float64(c.rateLimitIPBurst),
+		"rate_limit_apikey":       c.rateLimitAPIKey,
+		"rate_limit_apikey_burst": float64(c.rateLimitAPIKeyBurst),
+	} {
+		if n < 0 {
+			invalid(name, "cannot be negative")
+		}
+	}
+	if c.maxBodyBytes < 1 {
+		invalid("max_body_bytes", "must be positive")
+	}
+	if (len(c.corsMethods) > 0 || len(c.corsHeaders) > 0) && len(c.corsOrigins) == 0 {
+		invalid("cors_origins", "cors settings need at least one origin")
+	}
+	if (c.tlsCert == "") != (c.tlsKey == "") {
+		invalid("tls_cert", "tls_cert and tls_key must be set together")
+	}
+	if c.tlsClientCA != "" && c.tlsCert == "" {
+		invalid("tls_client_ca", "client certificates need tls_cert and tls_key")
+	}
+	if c.tlsClientRequired && c.tlsClientCA == "" {
+		invalid("tls_client_required", "requiring client certificates needs tls_client_ca")
+	}
+	if len(c.tlsClientSubjects) > 0 && c.tlsClientCA == "" {
+		invalid("tls_client_subjects", "client certificate subjects need tls_client_ca")
+	}
+	if len(c.deployments) > 0 && c.githubSecret == "" && c.gitlabToken == "" {
+		invalid("deployments", "deployments need github_secret or gitlab_token")
+	}
+	if c.smtp.Addr != "" {
+		if c.smtp.From == "" {
+			invalid("smtp_from", "email needs an address to send from")
+		}
+		if c.publicURL == "" {
+			invalid("public_url", "email needs an absolute url to link to")
+		}
+	}
+	if c.publicURL != "" {
+		if u, err := url.Parse(c.publicURL); err != nil || u.Scheme == "" || u.Host == "" {
+			invalid("public_url", "must be an absolute url")
+		}
+	}
+	if c.flapWindow > 0 && c.flapThreshold < 2 {
+		invalid("flap_threshold", "must be at least 2")
+	}
+	if c.uptimeYellowWeight < 0 || c.uptimeYellowWeight > 1 {
+		invalid("uptime_yellow_weight", "must be between 0 and 1")
+	}
+	if c.otelExporter != "" && c.otelExporter != "otlp" && c.otelExporter != "stdout" {
+		invalid("otel_exporter", "must be otlp or stdout")
+	}
+	return errors.Join(errs...)
+}
+
+// burst returns the burst for a rate limit defaulting to a second's worth of requests
+func burst(rate float64, burst int) int {
+	if burst > 0 {
+		return burst
+	}
+	return int(math.Max(1, math.Ceil(rate)))
+}
+
+// source returns where a setting was set
+func (c *config) source(name string) string {
+	if s, ok := c.sources[name]; ok {
+		return s
+	}
+	return "default"
+}
+
+// namedAPIKeys returns every api key by name
+func (c *config) namedAPIKeys() map[string]string {
+	keys := make(map[string]string, len(c.apikeys)+1)
+	for name, key := range c.apikeys {
+		keys[name] = key
+	}
+	if c.apikey != "" {
+		keys["default"] = c.apikey
+	}
+	return keys
+}
+
+// changed returns the settings that are different in next
+func (c *config) changed(next *config) []*setting {
+	res := []*setting{}
+	for _, s := range settings {
+		if s.get(c) != s.get(next) {
+			res = append(res, s)
+		}
+	}
+	return res
+}
+
+// print writes the config as yaml noting where each setting came from
+func (c *config) print(w io.Writer) error {
+	for _, s := range settings {
+		v := s.get(c)
+		if s.secret && v != "" {
+			v = redacted
+		}
+		if !s.scalar {
+			out, err := yaml.Marshal(v)
+			if err != nil {
+				return err
+			}
+			v = strings.TrimSpace(string(out))
+		}
+		if _, err := fmt.Fprintf(w, "%s: %s # %s\n", s.name, v, c.source(s.name)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runConfig runs the config subcommands
+func runConfig(args []string, stdout, stderr io.Writer) error {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprintln(stderr, "usage: statusthing config print [flags]")
+		return fmt.Errorf("unknown config command")
+	}
+	cfg, err := loadConfig("config print", args[1:], stderr)
+	if err != nil {
+		return err
+	}
+	return cfg.print(stdout)
+}
+
+// joinPairs formats a map as sorted comma separated key=value pairs
+func joinPairs[V any](m map[string]V, format func(V) string) string {
+	pairs := make([]string, 0, len(m))
+	for k, v := range m {
+		pairs = append(pairs, k+"="+format(v))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+// splitList splits a comma separated list ignoring empty items
+func splitList(s string) []string {
+	res := []string{}
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+	return res
+}
+
+// parseAPIKeys parses a comma separated list of name=key pairs i.e. ci=abc123,grafana=def456
+func parseAPIKeys(s string) (map[string]string, error) {
+	res := map[string]string{}
+	for _, pair := range splitList(s) {
+		name, key, ok := strings.Cut(pair, "=")
+		if !ok || name == "" || key == "" {
+			return nil, fmt.Errorf("%q is not in the form name=key", pair)
+		}
+		if _, ok := res[name]; ok {
+			return nil, fmt.Errorf("api key %s is set more than once", name)
+		}
+		res[name] = key
+	}
+	return res, nil
+}
+
+// parseSeverities parses a comma separated list of severity=status pairs i.e. critical=red,warning=yellow
+func parseSeverities(s string) (map[string]client.Status, error) {
+	res := map[string]client.Status{}
+	for _, pair := range splitList(s) {
+		severity, status, ok := strings.Cut(pair, "=")
+		if !ok || severity == "" {
+			return nil, fmt.Errorf("%q is not in the form severity=status", pair)
+		}
+		st, err := parseStatus(status)
+		if err != nil {
+			return nil, err
+		}
+		res[severity] = st
+	}
+	return res, nil
+}
+
+// parseDeployments parses a comma separated list of repository[@environment]=thing targets
+// i.e. lusis/apithings@production=api,lusis/website=website
+func parseDeployments(s string) ([]deploymentTarget, error) {
+	res := []deploymentTarget{}
+	for _, target := range splitList(s) {
+		source, thing, ok := strings.Cut(target, "=")
+		if !ok || source == "" || thing == "" {
+			return nil, fmt.Errorf("%q is not in the form repository[@environment]=thing", target)
+		}
+		repository, environment, _ := strings.Cut(source, "@")
+		res = append(res, deploymentTarget{repository: repository, environment: environment, thing: thing})
+	}
+	return res, nil
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lusis/apithings/statusthing/client"
+
+	"golang.org/x/exp/slog"
+)
+
+const testConfigFile = `
+addr: ":8000"
+basepath: /status
+debug: true
+flap_window: 10m
+apikeys:
+  ci: abc
+  grafana: def
+alertmanager_severities:
+  critical: red
+github_secret: sekret
+deployments:
+  lusis/apithings@production: api
+tls_cert: tls.crt
+tls_key: tls.key
+tls_client_ca: ca.crt
+tls_client_subjects: [ci, deploy]
+`
+
+func writeConfig(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "statusthing.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+	return path
+}
+
+func TestLoadConfig(t *testing.T) {
+	path := writeConfig(t, testConfigFile)
+	cfg, err := loadConfig(serveCommand, []string{"-config", path}, io.Discard)
+	require.NoError(t, err)
+	require.Equal(t, ":8000", cfg.addr)
+	require.Equal(t, "/status", cfg.basepath)
+	require.Equal(t, "statusthing.db", cfg.dbfile, "unset settings should keep their defaults")
+	require.True(t, cfg.debug)
+	require.True(t, cfg.enableDash, "the dashboard should be served by default")
+	require.Equal(t, 10*time.Minute, cfg.flapWindow)
+	require.Equal(t, 5, cfg.flapThreshold)
+	require.Equal(t, float64(1), cfg.uptimeYellowWeight)
+	require.Equal(t, map[string]string{"ci": "abc", "grafana": "def"}, cfg.apikeys)
+	require.Equal(t, map[string]client.Status{"critical": client.StatusRed}, cfg.alertmanagerSeverities)
+	require.Equal(t, []deploymentTarget{{repository: "lusis/apithings", environment: "production", thing: "api"}}, cfg.deployments)
+	require.Equal(t, []string{"ci", "deploy"}, cfg.tlsClientSubjects)
+
+	// env beats the file and flags beat env
+	t.Setenv(configEnvKey, path)
+	t.Setenv(addrEnvKey, ":8001")
+	t.Setenv(debugEnvKey, "false")
+	t.Setenv(dbFileNameEnvKey, "env.db")
+	cfg, err = loadConfig(serveCommand, []string{"-addr", ":8002", "-flap-threshold", "3"}, io.Discard)
+	require.NoError(t, err)
+	require.Equal(t, ":8002", cfg.addr)
+	require.Equal(t, "env.db", cfg.dbfile)
+	require.False(t, cfg.debug)
+	require.Equal(t, 3, cfg.flapThreshold)
+	require.Equal(t, "flag -addr", cfg.source("addr"))
+	require.Equal(t, "env "+dbFileNameEnvKey, cfg.source("dbfile"))
+	require.Equal(t, "file "+path, cfg.source("flap_window"))
+	require.Equal(t, "default", cfg.source("otel_exporter"))
+}
+
+func TestBurst(t *testing.T) {
+	require.Equal(t, 20, burst(2, 20), "an explicit burst should be used")
+	require.Equal(t, 3, burst(2.5, 0), "bursts should default to a second of requests")
+	require.Equal(t, 1, burst(0.1, 0), "bursts should allow at least one request")
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for name, tc := range map[string]struct {
+		file string
+		args []string
+		want string
+	}{
+		"unknown-setting":   {file: "adr: :9000", want: "unknown setting adr"},
+		"bad-file-value":    {file: "flap_window: soon", want: "invalid flap_window from file"},
+		"bad-flag-value":    {args: []string{"-flap-threshold", "many"}, want: "invalid flap_threshold from flag -flap-threshold: must be a whole number"},
+		"extra-args":        {args: []string{"ls"}, want: "unexpected arguments: ls"},
+		"unknown-flag":      {args: []string{"-nope"}, want: "flag provided but not defined"},
+		"tls-without-key":   {args: []string{"-tls-cert", "tls.crt"}, want: "tls_cert and tls_key must be set together"},
+		"ca-without-tls":    {args: []string{"-tls-client-ca", "ca.crt"}, want: "client certificates need tls_cert and tls_key"},
+		"deploy-no-secret":  {args: []string{"-deployments", "lusis/apithings=api"}, want: "deployments need github_secret or gitlab_token"},
+		"email-without-url": {args: []string{"-smtp-addr", "localhost:25", "-smtp-from", "me@example.com"}, want: "invalid public_url from default"},
+		"relative-url":      {args: []string{"-public-url", "/statusthings"}, want: "invalid public_url from flag -public-url: must be an absolute url"},
+		"bad-weight":        {args: []string{"-uptime-yellow-weight", "2"}, want: "must be between 0 and 1"},
+		"bad-exporter":      {args: []string{"-otel-exporter", "jaeger"}, want: "must be otlp or stdout"},
+		"default-key-name":  {args: []string{"-apikey", "abc", "-apikeys", "default=def"}, want: "default is the name of apikey"},
+		"negative-rate":     {args: []string{"-rate-limit-ip", "-1"}, want: "invalid rate_limit_ip from flag -rate-limit-ip: cannot be negative"},
+		"cors-no-origin":    {args: []string{"-cors-methods", "GET"}, want: "cors settings need at least one origin"},
+		"no-body":           {file: "max_body_bytes: 0", want: "invalid max_body_bytes from file"},
+		"bool-no":           {file: "manifest_prune: no", want: "invalid manifest_prune from file"},
+		"bool-off":          {file: "manifest_prune: off", want: "must be true or false"},
+		"long-delay":        {args: []string{"-shutdown-delay", "30s"}, want: "invalid shutdown_delay from flag -shutdown-delay: must be less than shutdown_timeout"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			args := tc.args
+			if tc.file != "" {
+				args = append([]string{"-config", writeConfig(t, tc.file)}, args...)
+			}
+			_, err := loadConfig(serveCommand, args, io.Discard)
+			require.ErrorContains(t, err, tc.want)
+		})
+	}
+	_, err := loadConfig(serveCommand, []string{"-config", filepath.Join(t.TempDir(), "missing.yaml")}, io.Discard)
+	require.Error(t, err)
+
+	// values that aren't true or false shouldn't turn anything on
+	t.Setenv(pruneEnvKey, "no")
+	_, err = loadConfig(serveCommand, nil, io.Discard)
+	require.ErrorContains(t, err, "invalid manifest_prune from env "+pruneEnvKey+": must be true or false")
+}
+
+func TestPrintConfig(t *testing.T) {
+	stdout := &bytes.Buffer{}
+	require.Error(t, runConfig(nil, stdout, io.Discard), "should require a subcommand")
+	require.NoError(t, runConfig([]string{"print", "-config", writeConfig(t, testConfigFile), "-smtp-password", "hunter2"}, stdout, io.Discard))
+	out := stdout.String()
+	require.Contains(t, out, "addr: :8000 # file ")
+	require.Contains(t, out, "debug: true # file ")
+	require.Contains(t, out, "flap_threshold: 5 # default\n")
+	require.Contains(t, out, "dbfile: statusthing.db # default\n")
+	require.Contains(t, out, "smtp_password: <redacted> # flag -smtp-password\n")
+	require.Contains(t, out, "apikey: \"\" # default\n", "unset secrets aren't redacted")
+	require.NotContains(t, out, "hunter2")
+	require.NotContains(t, out, "abc")
+}
+
+// testKeys records the api keys it is given
+type testKeys struct {
+	keys map[string]string
+}
+
+func (tk *testKeys) SetAPIKeys(keys map[string]string) error {
+	tk.keys = keys
+	return nil
+}
+
+func TestReload(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(io.Discard))
+	level := &slog.LevelVar{}
+	keys := &testKeys{}
+	t.Setenv(apiKeyEnvKey, "first")
+	current, err := loadConfig(serveCommand, nil, io.Discard)
+	require.NoError(t, err)
+
+	t.Setenv(apiKeyEnvKey, "second")
+	t.Setenv(apiKeysEnvKey, "ci=abc")
+	t.Setenv(debugEnvKey, "1")
+	t.Setenv(addrEnvKey, ":8000")
+	next := reload(logger, nil, current, level, keys)
+	require.Equal(t, slog.LevelDebug, level.Level())
+	require.Equal(t, map[string]string{"default": "second", "ci": "abc"}, keys.keys)
+	require.Equal(t, "second", next.apikey)
+	require.Equal(t, ":9000", next.addr, "settings that need a restart shouldn't change")
+
+	// invalid config keeps what we have
+	t.Setenv(flapThresholdEnvKey, "many")
+	require.Equal(t, next, reload(logger, nil, next, level, keys))
+}
@@ -4,15 +4,28 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/lusis/apithings/internal/statusthing"
+	"github.com/lusis/apithings/internal/statusthing/flap"
+	"github.com/lusis/apithings/internal/statusthing/handlers"
+	"github.com/lusis/apithings/internal/statusthing/notifiers"
+	"github.com/lusis/apithings/internal/statusthing/receivers"
 	"github.com/lusis/apithings/internal/statusthing/storers/sqlite3"
+	"github.com/lusis/apithings/internal/statusthing/tlsconfig"
+	"github.com/lusis/apithings/internal/statusthing/tracing"
+	"github.com/lusis/apithings/internal/statusthing/uptime"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 
 	"golang.ngrok.com/ngrok"
 	ngrokconfig "golang.ngrok.com/ngrok/config"
@@ -20,82 +33,47 @@ import (
 	"golang.org/x/exp/slog"
 )
 
-const (
-	envPrefix = "STATUSTHING"
-)
-
-var (
-	basePathEnvKey   = fmt.Sprintf("%s_BASEPATH", envPrefix)
-	addrEnvKey       = fmt.Sprintf("%s_ADDR", envPrefix)
-	apiKeyEnvKey     = fmt.Sprintf("%s_APIKEY", envPrefix)
-	dbFileNameEnvKey = fmt.Sprintf("%s_DBFILE", envPrefix)
-	debugEnvKey      = fmt.Sprintf("%s_DEBUG", envPrefix)
-	enableDashEnvKey = fmt.Sprintf("%s_ENABLE_DASH", envPrefix)
-)
-
-type config struct {
-	basepath          string
-	addr              string
-	apikey            string
-	dbfile            string
-	debug             bool
-	enableNgrok       bool
-	ngrokEndpointName string
-	enableDash        bool
-}
-
-func configFromEnv() (*config, error) { // nolint: unparam
-	cfg := &config{
-		basepath:          statusthing.DefaultHTTPBasePath,
-		addr:              ":9000",
-		dbfile:            "statusthing.db",
-		debug:             false,
-		enableNgrok:       false,
-		ngrokEndpointName: "",
-		enableDash:        false,
-		apikey:            "",
-	}
-	if os.Getenv(debugEnvKey) != "" {
-		cfg.debug = true
-	}
-	if os.Getenv(basePathEnvKey) != "" {
-		cfg.basepath = os.Getenv(basePathEnvKey)
-	}
-	if os.Getenv(addrEnvKey) != "" {
-		cfg.addr = os.Getenv(addrEnvKey)
-	}
-	if os.Getenv(dbFileNameEnvKey) != "" {
-		cfg.dbfile = os.Getenv(dbFileNameEnvKey)
-	}
-	if os.Getenv(enableDashEnvKey) != "" {
-		cfg.enableDash = true
+func main() {
+	args := os.Args[1:]
+	var err error
+	switch {
+	case len(args) == 0 || strings.HasPrefix(args[0], "-"):
+		serve(args)
+	case args[0] == serveCommand:
+		serve(args[1:])
+	case args[0] == configCommand:
+		err = runConfig(args[1:], os.Stdout, os.Stderr)
+	default:
+		ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+		err = runCLI(ctx, args, os.Stdout, os.Stderr)
+		stop()
 	}
-	if os.Getenv(apiKeyEnvKey) != "" {
-		cfg.apikey = os.Getenv(apiKeyEnvKey)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-	// We support the native ngrok env var here
-	// if you set it, we map it
-	if os.Getenv("NGROK_AUTHTOKEN") != "" {
-		cfg.enableNgrok = true
-		if os.Getenv("NGROK_ENDPOINT") != "" {
-			cfg.ngrokEndpointName = os.Getenv("NGROK_ENDPOINT")
-		}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		os.Exit(1)
 	}
-	return cfg, nil
 }
 
-func main() {
-	h := slog.HandlerOptions{Level: slog.LevelInfo, AddSource: true}.NewJSONHandler(os.Stdout)
+// serve runs the statusthing server configured with args
+func serve(args []string) {
+	// the level can be changed on reload
+	level := &slog.LevelVar{}
+	h := slog.HandlerOptions{Level: level, AddSource: true}.NewJSONHandler(os.Stdout)
 	logger := slog.New(h)
 
-	cfg, err := configFromEnv()
+	cfg, err := loadConfig(serveCommand, args, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		logger.Error("unable to build configuration", "err", err)
 		os.Exit(1)
 	}
 	if cfg.debug {
-		h := slog.HandlerOptions{Level: slog.LevelDebug, AddSource: true}.NewJSONHandler(os.Stdout)
-		logger = slog.New(h)
+		level.Set(slog.LevelDebug)
 	}
 
 	db, err := sql.Open("sqlite", cfg.dbfile)
@@ -107,20 +85,126 @@ func main() {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
-	store, err := sqlite3.New(db, true)
+	storeOptions := []sqlite3.Option{}
+	appOptions := []statusthing.AppOption{}
+	var tracerProvider *sdktrace.TracerProvider
+	if cfg.otelExporter != "" {
+		tracerProvider, err = tracing.NewTracerProvider(context.Background(), cfg.otelExporter)
+		if err != nil {
+			logger.Error("unable to configure tracing", "err", err)
+			os.Exit(1)
+		}
+		storeOptions = append(storeOptions, sqlite3.WithTracerProvider(tracerProvider))
+		appOptions = append(appOptions, statusthing.WithTracerProvider(tracerProvider))
+	}
+	store, err := sqlite3.New(db, true, storeOptions...)
 	if err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
-	appOptions := []statusthing.AppOption{
+	appOptions = append(appOptions,
 		statusthing.WithStorer(store),
-	}
+		statusthing.WithHistory(store),
+		statusthing.WithUptimeOptions(uptime.WithYellowWeight(cfg.uptimeYellowWeight)),
+	)
 	if cfg.basepath != "" {
 		appOptions = append(appOptions, statusthing.WithBasePath(cfg.basepath))
 	}
+	if cfg.publicURL != "" {
+		appOptions = append(appOptions, statusthing.WithPublicURL(cfg.publicURL))
+	}
+	if !cfg.enableDash {
+		appOptions = append(appOptions, statusthing.WithoutDashboard())
+	}
+	appOptions = append(appOptions, statusthing.WithListenAddr(cfg.addr), statusthing.WithHTTPServer(&http.Server{
+		ReadTimeout:  cfg.httpReadTimeout,
+		WriteTimeout: cfg.httpWriteTimeout,
+		IdleTimeout:  cfg.httpIdleTimeout,
+	}))
+	appOptions = append(appOptions, statusthing.WithMaxBodyBytes(int64(cfg.maxBodyBytes)))
+	if cfg.shutdownDelay > 0 {
+		appOptions = append(appOptions, statusthing.WithShutdownDelay(cfg.shutdownDelay))
+	}
+	if len(cfg.corsOrigins) > 0 {
+		appOptions = append(appOptions, statusthing.WithCORS(handlers.CORS{
+			AllowedOrigins: cfg.corsOrigins,
+			AllowedMethods: cfg.corsMethods,
+			AllowedHeaders: cfg.corsHeaders,
+			MaxAge:         cfg.corsMaxAge,
+		}))
+	}
+	if cfg.rateLimitIP > 0 {
+		appOptions = append(appOptions, statusthing.WithIPRateLimit(cfg.rateLimitIP, burst(cfg.rateLimitIP, cfg.rateLimitIPBurst)))
+	}
+	if cfg.rateLimitAPIKey > 0 {
+		appOptions = append(appOptions, statusthing.WithAPIKeyRateLimit(cfg.rateLimitAPIKey, burst(cfg.rateLimitAPIKey, cfg.rateLimitAPIKeyBurst)))
+	}
+	if cfg.tlsCert != "" || cfg.tlsKey != "" {
+		tlsOpts := []tlsconfig.Option{}
+		if cfg.tlsClientCA != "" {
+			tlsOpts = append(tlsOpts, tlsconfig.WithClientCAs(cfg.tlsClientCA))
+			appOptions = append(appOptions, statusthing.WithClientCertAuth(cfg.tlsClientSubjects...))
+		}
+		if cfg.tlsClientRequired {
+			tlsOpts = append(tlsOpts, tlsconfig.RequireClientCert())
+		}
+		appOptions = append(appOptions, statusthing.WithTLS(cfg.tlsCert, cfg.tlsKey, tlsOpts...))
+	}
 	if cfg.apikey != "" {
 		appOptions = append(appOptions, statusthing.WithAPIKey(cfg.apikey))
 	}
+	for name, key := range cfg.apikeys {
+		appOptions = append(appOptions, statusthing.WithNamedAPIKey(name, key))
+	}
+	if cfg.manifest != "" {
+		appOptions = append(appOptions, statusthing.WithManifest(cfg.manifest, cfg.pruneManifest))
+	}
+	if cfg.alertmanager {
+		amOpts := []receivers.AlertmanagerOption{}
+		if cfg.alertmanagerLabel != "" {
+			amOpts = append(amOpts, receivers.WithNameLabel(cfg.alertmanagerLabel))
+		}
+		for severity, status := range cfg.alertmanagerSeverities {
+			amOpts = append(amOpts, receivers.WithSeverityStatus(severity, status))
+		}
+		appOptions = append(appOptions, statusthing.WithAlertmanager(amOpts...))
+	}
+	deployments := make([]receivers.DeploymentOption, 0, len(cfg.deployments))
+	for _, d := range cfg.deployments {
+		deployments = append(deployments, receivers.WithDeploymentTarget(d.repository, d.environment, d.thing))
+	}
+	if cfg.githubSecret != "" {
+		appOptions = append(appOptions, statusthing.WithGitHubDeployments(cfg.githubSecret, deployments...))
+	}
+	if cfg.gitlabToken != "" {
+		appOptions = append(appOptions, statusthing.WithGitLabDeployments(cfg.gitlabToken, deployments...))
+	}
+	if cfg.hooks != "" {
+		appOptions = append(appOptions, statusthing.WithTemplateHooks(cfg.hooks))
+	}
+	if cfg.notifiers != "" {
+		channels, err := notifiers.Load(cfg.notifiers)
+		if err != nil {
+			logger.Error("unable to load notifiers", "err", err)
+			os.Exit(1)
+		}
+		appOptions = append(appOptions, statusthing.WithNotifiers(channels...))
+	}
+	if cfg.smtp.Addr != "" {
+		en, err := notifiers.NewEmailNotifier(store, cfg.smtp, cfg.publicURL, notifiers.WithDigest(cfg.emailDigest))
+		if err != nil {
+			logger.Error("unable to configure email notifications", "err", err)
+			os.Exit(1)
+		}
+		appOptions = append(appOptions, statusthing.WithEmailNotifier(en))
+	}
+	if cfg.flapDwell > 0 || cfg.flapWindow > 0 {
+		flapOpts := []flap.Option{flap.WithDwell(cfg.flapDwell)}
+		if cfg.flapWindow > 0 {
+			flapOpts = append(flapOpts, flap.WithFlapping(cfg.flapWindow, cfg.flapThreshold))
+		}
+		appOptions = append(appOptions, statusthing.WithFlapDetection(flapOpts...))
+	}
 	if cfg.enableNgrok {
 		logger.Debug("creating ngrok tunnel")
 		opts := []ngrokconfig.HTTPEndpointOption{
@@ -130,7 +214,7 @@ func main() {
 		if cfg.ngrokEndpointName != "" {
 			opts = append(opts, ngrokconfig.WithDomain(cfg.ngrokEndpointName))
 		}
-		ngrokTunnel, err := ngrok.Listen(context.Background(), ngrokconfig.HTTPEndpoint(opts...), ngrok.WithAuthtokenFromEnv())
+		ngrokTunnel, err := ngrok.Listen(context.Background(), ngrokconfig.HTTPEndpoint(opts...), ngrok.WithAuthtoken(cfg.ngrokAuthtoken))
 		if err != nil {
 			logger.Error("unable to create ngrok tunnel", "err", err)
 			return
@@ -146,36 +230,90 @@ func main() {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
+	// package level log calls get the same request and trace ids as the app's
+	slog.SetDefault(app.Logger())
+
+	hups := make(chan os.Signal, 1)
+	signal.Notify(hups, syscall.SIGHUP)
+	go func() {
+		current := cfg
+		for range hups {
+			current = reload(logger, args, current, level, app)
+		}
+	}()
 
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
+	stopped := make(chan struct{})
 	go func() {
+		defer close(stopped)
 		<-sigs
-		var wg sync.WaitGroup
-		logger.Debug("shutting down")
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if err := app.Stop(); err != nil {
-				logger.Error("unable to shut down http server", "err", err)
-			}
-		}()
-
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if err := db.Close(); err != nil {
-				logger.Error("unable to close db", "err", err)
-			}
-		}()
-		wg.Wait()
+		logger.Info("shutting down", "timeout", cfg.shutdownTimeout.String())
+		ctx, cancel := context.WithTimeout(context.Background(), cfg.shutdownTimeout)
+		defer cancel()
+		if err := app.Shutdown(ctx); err != nil {
+			logger.Error("unable to shut down cleanly", "err", err)
+		}
+		// only close the db once nothing can use it
+		if err := db.Close(); err != nil {
+			logger.Error("unable to close db", "err", err)
+		}
 	}()
 	logger.Info("starting application", "addr", cfg.addr, "basepath", cfg.basepath)
 	if err := app.Start(); err != nil && err.Error() != http.ErrServerClosed.Error() {
 		logger.Error("error attempting to start application: %s", err.Error())
 		os.Exit(1)
 	}
+	// start returns as soon as shutdown begins so wait for it to finish
+	<-stopped
+	if tracerProvider != nil {
+		// export any spans that are still buffered
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := tracerProvider.Shutdown(ctx); err != nil {
+			logger.Error("unable to shut down tracing", "err", err)
+		}
+	}
 	logger.Info("stopped application")
 }
+
+// apiKeySetter replaces the accepted api keys
+type apiKeySetter interface {
+	SetAPIKeys(keys map[string]string) error
+}
+
+// reload loads the config again and applies the settings that are safe to change while running
+// it returns the config that is now in effect
+func reload(logger *slog.Logger, args []string, current *config, level *slog.LevelVar, keys apiKeySetter) *config {
+	next, err := loadConfig(serveCommand, args, io.Discard)
+	if err != nil {
+		logger.Error("unable to reload configuration", "err", err)
+		return current
+	}
+	applied := *current
+	applied.sources = next.sources
+	for _, s := range current.changed(next) {
+		if !s.reloadable {
+			logger.Warn("setting changed but needs a restart", "setting", s.name)
+			continue
+		}
+		switch s.name {
+		case "debug":
+			applied.debug = next.debug
+			if next.debug {
+				level.Set(slog.LevelDebug)
+			} else {
+				level.Set(slog.LevelInfo)
+			}
+		case "apikey", "apikeys":
+			if err := keys.SetAPIKeys(next.namedAPIKeys()); err != nil {
+				logger.Error("unable to reload api keys", "err", err)
+				continue
+			}
+			applied.apikey, applied.apikeys = next.apikey, next.apikeys
+		}
+		logger.Info("reloaded setting", "setting", s.name)
+	}
+	return &applied
+}
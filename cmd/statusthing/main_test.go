@@ -1,22 +1,55 @@
 package main
 
 import (
+	"io"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/lusis/apithings/internal/statusthing/notifiers"
+	"github.com/lusis/apithings/statusthing/client"
 	"github.com/stretchr/testify/require"
 )
 
 func TestFromEnv(t *testing.T) {
 	envVars := map[string]string{
-		basePathEnvKey:    t.Name() + "basepath",
-		addrEnvKey:        t.Name() + "addr",
-		apiKeyEnvKey:      t.Name() + "apikey",
-		dbFileNameEnvKey:  t.Name() + "dbfile",
-		debugEnvKey:       t.Name() + "debug",
-		enableDashEnvKey:  t.Name() + "dash",
-		"NGROK_AUTHTOKEN": t.Name() + "ngrok_token",
-		"NGROK_ENDPOINT":  t.Name() + "ngrok_endpoint",
+		basePathEnvKey:               "/" + t.Name() + "basepath",
+		addrEnvKey:                   t.Name() + "addr",
+		apiKeyEnvKey:                 t.Name() + "apikey",
+		apiKeysEnvKey:                "ci=abc, grafana=def",
+		dbFileNameEnvKey:             t.Name() + "dbfile",
+		debugEnvKey:                  "true",
+		enableDashEnvKey:             "false",
+		manifestEnvKey:               t.Name() + "manifest",
+		pruneEnvKey:                  "1",
+		alertmanagerEnvKey:           "1",
+		alertmanagerLabelEnvKey:      "service",
+		alertmanagerSeveritiesEnvKey: "critical=red, page=yellow",
+		githubSecretEnvKey:           "ghsecret",
+		gitlabTokenEnvKey:            "gltoken",
+		deploymentsEnvKey:            "lusis/apithings@production=api,lusis/website=website",
+		hooksEnvKey:                  t.Name() + "hooks",
+		notifiersEnvKey:              t.Name() + "notifiers",
+		publicURLEnvKey:              "https://status.example.com/statusthings",
+		smtpAddrEnvKey:               "localhost:25",
+		smtpUsernameEnvKey:           "user",
+		smtpPasswordEnvKey:           "pass",
+		smtpFromEnvKey:               "status@example.com",
+		emailDigestEnvKey:            "5m",
+		flapDwellEnvKey:              "30s",
+		flapWindowEnvKey:             "10m",
+		flapThresholdEnvKey:          "4",
+		uptimeYellowWeightEnvKey:     "0.5",
+		otelExporterEnvKey:           "stdout",
+		shutdownTimeoutEnvKey:        "5s",
+		shutdownDelayEnvKey:          "2s",
+		tlsCertEnvKey:                "tls.crt",
+		tlsKeyEnvKey:                 "tls.key",
+		tlsClientCAEnvKey:            "ca.crt",
+		tlsClientRequiredEnvKey:      "1",
+		tlsClientSubjectsEnvKey:      "ci, deploy",
+		"NGROK_AUTHTOKEN":            t.Name() + "ngrok_token",
+		"NGROK_ENDPOINT":             t.Name() + "ngrok_endpoint",
 	}
 	defer func() {
 		for k := range envVars {
@@ -30,15 +63,65 @@ func TestFromEnv(t *testing.T) {
 		err := os.Setenv(k, v)
 		require.NoError(t, err, "env vars should get set")
 	}
-	cfg, err := configFromEnv()
+	cfg, err := loadConfig(serveCommand, nil, io.Discard)
 	require.NoError(t, err)
 	require.NotNil(t, cfg)
 	require.Equal(t, envVars[basePathEnvKey], cfg.basepath)
 	require.Equal(t, envVars[addrEnvKey], cfg.addr)
 	require.Equal(t, envVars[apiKeyEnvKey], cfg.apikey)
+	require.Equal(t, map[string]string{"ci": "abc", "grafana": "def"}, cfg.apikeys)
 	require.Equal(t, envVars[dbFileNameEnvKey], cfg.dbfile)
 	require.True(t, cfg.enableNgrok)
 	require.Equal(t, envVars["NGROK_ENDPOINT"], cfg.ngrokEndpointName)
 	require.True(t, cfg.debug)
-	require.True(t, cfg.enableDash)
+	require.Equal(t, envVars[manifestEnvKey], cfg.manifest)
+	require.True(t, cfg.pruneManifest)
+	require.True(t, cfg.alertmanager)
+	require.Equal(t, "service", cfg.alertmanagerLabel)
+	require.Equal(t, map[string]client.Status{"critical": client.StatusRed, "page": client.StatusYellow}, cfg.alertmanagerSeverities)
+	require.Equal(t, "ghsecret", cfg.githubSecret)
+	require.Equal(t, "gltoken", cfg.gitlabToken)
+	require.Len(t, cfg.deployments, 2)
+	require.Equal(t, envVars[hooksEnvKey], cfg.hooks)
+	require.Equal(t, envVars[notifiersEnvKey], cfg.notifiers)
+	require.Equal(t, envVars[publicURLEnvKey], cfg.publicURL)
+	require.False(t, cfg.enableDash)
+	require.Equal(t, notifiers.SMTPConfig{Addr: "localhost:25", Username: "user", Password: "pass", From: "status@example.com"}, cfg.smtp)
+	require.Equal(t, 5*time.Minute, cfg.emailDigest)
+	require.Equal(t, 30*time.Second, cfg.flapDwell)
+	require.Equal(t, 10*time.Minute, cfg.flapWindow)
+	require.Equal(t, 4, cfg.flapThreshold)
+	require.Equal(t, 0.5, cfg.uptimeYellowWeight)
+	require.Equal(t, "stdout", cfg.otelExporter)
+	require.Equal(t, 5*time.Second, cfg.shutdownTimeout)
+	require.Equal(t, 2*time.Second, cfg.shutdownDelay)
+	require.Equal(t, "tls.crt", cfg.tlsCert)
+	require.Equal(t, "tls.key", cfg.tlsKey)
+	require.Equal(t, "ca.crt", cfg.tlsClientCA)
+	require.True(t, cfg.tlsClientRequired)
+	require.Equal(t, []string{"ci", "deploy"}, cfg.tlsClientSubjects)
+}
+
+func TestParseDeployments(t *testing.T) {
+	t.Parallel()
+	for _, s := range []string{"lusis/apithings", "=api", "lusis/apithings@production="} {
+		_, err := parseDeployments(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestParseAPIKeys(t *testing.T) {
+	t.Parallel()
+	for _, s := range []string{"ci", "=abc", "ci=", "ci=abc,ci=def"} {
+		_, err := parseAPIKeys(s)
+		require.Error(t, err, s)
+	}
+}
+
+func TestParseSeverities(t *testing.T) {
+	t.Parallel()
+	for _, s := range []string{"critical", "=red", "critical=purple"} {
+		_, err := parseSeverities(s)
+		require.Error(t, err, s)
+	}
 }
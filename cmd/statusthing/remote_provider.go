@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/types"
+	"github.com/lusis/apithings/statusthing/client"
+)
+
+// remoteProvider is a [providers.Provider] backed by a remote statusthing
+// this lets the cli reuse logic written against providers such as manifest reconciliation
+type remoteProvider struct {
+	client *client.Client
+}
+
+// ensure we always satisfy
+var _ providers.Provider = (*remoteProvider)(nil)
+
+// All gets all [types.StatusThing]
+func (rp *remoteProvider) All(ctx context.Context) ([]*types.StatusThing, error) {
+	return rp.client.List(ctx)
+}
+
+// Get gets a [types.StatusThing] by its id
+func (rp *remoteProvider) Get(ctx context.Context, id string) (*types.StatusThing, error) {
+	return rp.client.Get(ctx, id)
+}
+
+// Add adds a [types.StatusThing]
+func (rp *remoteProvider) Add(ctx context.Context, newThing providers.Params) (*types.StatusThing, error) {
+	params := client.Params{Name: newThing.Name, Description: newThing.Description, Status: newThing.Status}
+	if newThing.Group != "" {
+		params.Group = client.String(newThing.Group)
+	}
+	return rp.client.Create(ctx, params)
+}
+
+// Remove removes a [types.StatusThing] by its id
+func (rp *remoteProvider) Remove(ctx context.Context, id string, opts ...dbfilters.Option) error {
+	f, err := dbfilters.New(opts...)
+	if err != nil {
+		return err
+	}
+	_, err = rp.client.Delete(ctx, id, requestOptions(f)...)
+	return err
+}
+
+// SetStatus sets the status of a [types.StatusThing] by its id
+// the api doesn't report the state it replaced so previous is read first and the update is made conditional on it
+// updated is read back afterwards so it may already include a later change
+func (rp *remoteProvider) SetStatus(ctx context.Context, id string, status types.Status, opts ...dbfilters.Option) (*types.StatusThing, *types.StatusThing, error) {
+	f, err := dbfilters.New(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	previous, err := rp.client.Get(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get %s: %w", id, err)
+	}
+	if f.Version() != 0 && f.Version() != previous.Version {
+		return nil, nil, fmt.Errorf("unable to update %s: %w", id, client.ErrVersionMismatch)
+	}
+	params := client.Params{Status: status, Description: f.Description()}
+	if group, ok := f.Group(); ok {
+		params.Group = client.String(group)
+	}
+	if err := rp.client.Update(ctx, id, params, client.IfVersion(previous.Version)); err != nil {
+		return nil, nil, fmt.Errorf("unable to update %s: %w", id, err)
+	}
+	updated, err := rp.client.Get(ctx, id)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to get %s: %w", id, err)
+	}
+	return previous, updated, nil
+}
+
+// requestOptions converts the filters the api understands to client request options
+func requestOptions(f *dbfilters.Filters) []client.RequestOption {
+	opts := []client.RequestOption{}
+	if f.Version() != 0 {
+		opts = append(opts, client.IfVersion(f.Version()))
+	}
+	return opts
+}
@@ -1,12 +1,28 @@
 package statusthing
 
 import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/lusis/apithings/internal/statusthing/flap"
 	"github.com/lusis/apithings/internal/statusthing/handlers"
+	"github.com/lusis/apithings/internal/statusthing/manifest"
+	"github.com/lusis/apithings/internal/statusthing/metrics"
+	"github.com/lusis/apithings/internal/statusthing/notifiers"
 	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/ratelimit"
+	"github.com/lusis/apithings/internal/statusthing/receivers"
 	"github.com/lusis/apithings/internal/statusthing/storers"
+	"github.com/lusis/apithings/internal/statusthing/types"
+	"github.com/lusis/apithings/internal/statusthing/uptime"
+
+	"go.opentelemetry.io/otel/trace"
 
 	"golang.ngrok.com/ngrok"
 
@@ -22,6 +38,14 @@ const (
 type App struct {
 	config             *AppConfig
 	statusThingHandler *handlers.StatusThingHandler
+	// dispatcher sends notifications if any notifiers are configured
+	dispatcher *notifiers.Dispatcher
+	// detector debounces notifications if flap detection is enabled
+	detector *flap.Detector
+	// ngrokServer serves the ngrok tunnel if there is one
+	ngrokServer *http.Server
+	// shuttingDown is set once [App.Shutdown] is called so the app stops reporting it is ready
+	shuttingDown atomic.Bool
 }
 
 // New returns a new [App] with the provided options
@@ -31,79 +55,357 @@ func New(opts ...AppOption) (*App, error) {
 	if err != nil {
 		return nil, err
 	}
+	m, err := metrics.New(cfg.provider)
+	if err != nil {
+		return nil, err
+	}
+	// published are called for changes that make it through flap detection
+	published := []providers.TransitionFunc{}
+	var dispatcher *notifiers.Dispatcher
+	if len(cfg.notifiers) > 0 {
+		dispatcher, err = notifiers.NewDispatcher(cfg.notifiers...)
+		if err != nil {
+			return nil, err
+		}
+		published = append(published, dispatcher.Observe)
+	}
+	transitionFuncs := []providers.TransitionFunc{m.ObserveTransition}
+	// history records every change for uptime and what was published separately for feeds
+	if cfg.history != nil {
+		transitionFuncs = append(transitionFuncs, recordTransition(cfg.history, false))
+		published = append(published, recordTransition(cfg.history, true))
+	}
+	var detector *flap.Detector
+	if cfg.flapOpts != nil {
+		detector, err = flap.New(func(ctx context.Context, t types.Transition) {
+			for _, fn := range published {
+				fn(ctx, t)
+			}
+		}, cfg.flapOpts...)
+		if err != nil {
+			return nil, err
+		}
+		transitionFuncs = append(transitionFuncs, detector.Observe)
+	} else {
+		transitionFuncs = append(transitionFuncs, published...)
+	}
+	if cfg.tracerProvider != nil {
+		traced, err := providers.NewTracingProvider(cfg.provider, cfg.tracerProvider)
+		if err != nil {
+			return nil, err
+		}
+		cfg.provider = traced
+	}
+	// wrap the provider so changes made through the api and the manifest are all observed
+	tp, err := providers.NewTransitionProvider(cfg.provider, transitionFuncs...)
+	if err != nil {
+		return nil, err
+	}
+	cfg.provider = tp
+	if cfg.history != nil {
+		// description updates are published straight away as they don't change the status
+		dp, err := providers.NewDescriptionProvider(cfg.provider, recordDescription(cfg.history))
+		if err != nil {
+			return nil, err
+		}
+		cfg.provider = dp
+	}
+	if detector != nil {
+		// the detector keeps state for every thing it has seen so it has to be told when one goes away
+		rp, err := providers.NewRemoveProvider(cfg.provider, detector.Forget)
+		if err != nil {
+			return nil, err
+		}
+		cfg.provider = rp
+	}
+	app := &App{config: cfg, dispatcher: dispatcher, detector: detector}
 	// for now we'll use the api path until we get the handler logic updated
-	handlerOpts := []handlers.HandlerOption{}
+	handlerOpts := []handlers.HandlerOption{handlers.WithMetrics(m), handlers.WithAccessLog(cfg.logger)}
 	if cfg.apiKey != "" {
 		handlerOpts = append(handlerOpts, handlers.WithAPIKey(cfg.apiKey))
 	}
+	for name, key := range cfg.apiKeys {
+		handlerOpts = append(handlerOpts, handlers.WithNamedAPIKey(name, key))
+	}
+	handlerOpts = append(handlerOpts, handlers.WithReadinessCheck(shutdownCheck, app.notShuttingDown))
+	if dispatcher != nil {
+		handlerOpts = append(handlerOpts, handlers.WithReadinessCheck(notificationsCheck, dispatcher.Check))
+	}
+	if p, ok := cfg.store.(storers.Pinger); ok {
+		handlerOpts = append(handlerOpts, handlers.WithReadinessCheck(storeCheck, p.Ping))
+	}
+	for name, check := range cfg.readinessChecks {
+		handlerOpts = append(handlerOpts, handlers.WithReadinessCheck(name, check))
+	}
+	if cfg.cors != nil {
+		handlerOpts = append(handlerOpts, handlers.WithCORS(*cfg.cors))
+	}
+	if cfg.ipLimiter != nil {
+		handlerOpts = append(handlerOpts, handlers.WithIPRateLimit(cfg.ipLimiter))
+	}
+	if cfg.apiKeyLimiter != nil {
+		handlerOpts = append(handlerOpts, handlers.WithAPIKeyRateLimit(cfg.apiKeyLimiter))
+	}
+	if cfg.maxBodyBytes > 0 {
+		handlerOpts = append(handlerOpts, handlers.WithMaxBodyBytes(cfg.maxBodyBytes))
+	}
+	if cfg.clientCertAuth {
+		handlerOpts = append(handlerOpts, handlers.WithClientCertAuth(cfg.clientCertSubjects...))
+	}
 	if cfg.basePath != "" {
 		handlerOpts = append(handlerOpts, handlers.WithBasePath(cfg.basePath))
 	}
+	if cfg.publicURL != "" {
+		handlerOpts = append(handlerOpts, handlers.WithPublicURL(cfg.publicURL))
+	}
+	if cfg.noDashboard {
+		handlerOpts = append(handlerOpts, handlers.WithoutDashboard())
+	}
+	if cfg.tracerProvider != nil {
+		handlerOpts = append(handlerOpts, handlers.WithTracerProvider(cfg.tracerProvider))
+	}
+	if detector != nil {
+		handlerOpts = append(handlerOpts, handlers.WithFlapping(detector))
+	}
+	if cfg.history != nil {
+		calc, err := uptime.New(cfg.history, cfg.uptimeOpts...)
+		if err != nil {
+			return nil, err
+		}
+		handlerOpts = append(handlerOpts, handlers.WithHistory(cfg.history), handlers.WithUptime(calc))
+	}
+	if cfg.subscriptions != nil {
+		handlerOpts = append(handlerOpts, handlers.WithSubscriptions(cfg.subscriptions))
+	}
+	for _, rf := range cfg.receivers {
+		r, err := rf(cfg.provider)
+		if err != nil {
+			return nil, err
+		}
+		handlerOpts = append(handlerOpts, handlers.WithReceiver(r))
+	}
 	stHandler, err := handlers.NewStatusThingHandler(cfg.provider, handlerOpts...)
 	if err != nil {
 		return nil, err
 	}
-	return &App{config: cfg, statusThingHandler: stHandler}, nil
+	// a server with its own handler has mounted the app itself
+	if cfg.httpServer.Handler == nil {
+		cfg.httpServer.Handler = stHandler
+	}
+	app.statusThingHandler = stHandler
+	if cfg.ngrokTunnel != nil {
+		app.ngrokServer = &http.Server{Handler: stHandler}
+	}
+	return app, nil
 }
 
 // AppConfig is the config for [App]
 type AppConfig struct {
-	lock        *sync.RWMutex
-	provider    providers.Provider
-	store       storers.StatusThingStorer
-	basePath    string
+	lock     *sync.RWMutex
+	provider providers.Provider
+	store    storers.StatusThingStorer
+	basePath string
+	// publicURL is where basePath can be reached from outside
+	publicURL string
+	// noDashboard skips serving the dashboard
+	noDashboard bool
 	logger      *slog.Logger
 	logHandler  slog.Handler
 	apiKey      string
+	// apiKeys are additional api keys by name
+	apiKeys     map[string]string
 	httpServer  *http.Server
 	listenAddr  string
 	ngrokTunnel ngrok.Tunnel
+	// manifest is reconciled with the provider on start if provided
+	manifest      *manifest.Manifest
+	pruneManifest bool
+	// receivers are built once the provider is known
+	receivers []receiverFunc
+	notifiers []notifiers.Channel
+	// subscriptions manages email subscribers if email notifications are enabled
+	subscriptions handlers.Subscriptions
+	// flapOpts enable flap detection if not nil
+	flapOpts []flap.Option
+	// history records status changes if provided
+	history storers.HistoryStorer
+	// uptimeOpts are used to calculate uptime from the history
+	uptimeOpts []uptime.Option
+	// tracerProvider traces requests and provider calls if provided
+	tracerProvider trace.TracerProvider
+	// cors allows cross-origin api requests if provided
+	cors *handlers.CORS
+	// ipLimiter and apiKeyLimiter limit api requests if provided
+	ipLimiter     *ratelimit.Limiter
+	apiKeyLimiter *ratelimit.Limiter
+	// maxBodyBytes is the largest json body the api accepts if set
+	maxBodyBytes int64
+	// readinessChecks are added to the built in readiness checks by name
+	readinessChecks map[string]handlers.ReadinessCheck
+	// tlsConfig serves https if provided
+	tlsConfig *tls.Config
+	// clientCertAuth accepts verified client certificates in place of an api key
+	clientCertAuth     bool
+	clientCertSubjects []string
+	// shutdownDelay is how long requests are still served once readiness starts failing on shutdown
+	shutdownDelay time.Duration
 }
 
-func appRequestLogger(logger *slog.Logger, next http.Handler) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		logger.Debug("handling request", "http.path", r.URL.Path, "http.method", r.Method)
-		next.ServeHTTP(w, r)
+// recordTransition returns a [providers.TransitionFunc] that stores changes in the history
+func recordTransition(hs storers.HistoryStorer, published bool) providers.TransitionFunc {
+	return func(ctx context.Context, t types.Transition) {
+		t.Published = published
+		if err := hs.InsertTransition(ctx, t); err != nil {
+			slog.ErrorCtx(ctx, "unable to record status change", "thing", t.Thing.Name, "err", err)
+		}
 	}
 }
 
+// recordDescription returns a [providers.DescriptionFunc] that stores description updates in the history for feeds
+func recordDescription(hs storers.HistoryStorer) providers.DescriptionFunc {
+	return func(ctx context.Context, _, updated *types.StatusThing) {
+		t := types.Transition{Thing: updated, Previous: updated.Status, At: time.Now(), Published: true}
+		if err := hs.InsertTransition(ctx, t); err != nil {
+			slog.ErrorCtx(ctx, "unable to record description update", "thing", updated.Name, "err", err)
+		}
+	}
+}
+
+// names of the built in readiness checks
+const (
+	storeCheck         = "store"
+	shutdownCheck      = "shutdown"
+	notificationsCheck = "notifications"
+)
+
+// notShuttingDown fails once the app has started shutting down so traffic moves elsewhere first
+func (a *App) notShuttingDown(_ context.Context) error {
+	if a.shuttingDown.Load() {
+		return fmt.Errorf("shutting down")
+	}
+	return nil
+}
+
+// receiverFunc builds a webhook receiver for the provider
+type receiverFunc func(providers.Provider) (receivers.Receiver, error)
+
+// reconcile applies the configured manifest if any
+func (a *App) reconcile(ctx context.Context) error {
+	if a.config.manifest == nil {
+		return nil
+	}
+	plan, err := manifest.NewPlan(ctx, a.config.provider, a.config.manifest, a.config.pruneManifest)
+	if err != nil {
+		return err
+	}
+	if plan.Empty() {
+		a.config.logger.Debug("things match manifest")
+		return nil
+	}
+	for _, c := range plan.Changes {
+		name := ""
+		if c.Desired != nil {
+			name = c.Desired.Name
+		} else {
+			name = c.Existing.Name
+		}
+		a.config.logger.Info("reconciling thing with manifest", "action", c.Action.String(), "name", name)
+	}
+	return plan.Apply(ctx, a.config.provider)
+}
+
+// SetAPIKeys replaces the accepted api keys with keys by name
+// it is safe to call while the app is serving
+func (a *App) SetAPIKeys(keys map[string]string) error {
+	return a.statusThingHandler.SetAPIKeys(keys)
+}
+
+// Logger returns the app's logger with request ids, and trace ids when tracing, added
+// the global default logger isn't changed by [New] so pass this to [slog.SetDefault] if wanted
+func (a *App) Logger() *slog.Logger {
+	return a.config.logger
+}
+
+// Handler returns the app's [http.Handler] for mounting in another router
+// routes are served under the base path so it should be mounted at the root
+func (a *App) Handler() http.Handler {
+	return a.statusThingHandler
+}
+
 // Start starts the app
 func (a *App) Start() error {
-	http.HandleFunc("/", appRequestLogger(a.config.logger, a.statusThingHandler))
-
-	if a.config.ngrokTunnel != nil {
+	if err := a.reconcile(context.Background()); err != nil {
+		return fmt.Errorf("unable to apply manifest: %w", err)
+	}
+	if a.ngrokServer != nil {
 		go func() {
-			if err := http.Serve(a.config.ngrokTunnel, appRequestLogger(a.config.logger, a.statusThingHandler)); err != nil {
+			if err := a.ngrokServer.Serve(a.config.ngrokTunnel); err != nil && !errors.Is(err, http.ErrServerClosed) {
 				a.config.logger.Error("unable to start ngrok tunnel", "err", err)
 			}
 		}()
 	}
-	if err := a.config.httpServer.ListenAndServe(); err != nil && err.Error() != http.ErrServerClosed.Error() {
+	listen := a.config.httpServer.ListenAndServe
+	if a.config.httpServer.TLSConfig != nil {
+		// the certificate comes from the tls config
+		listen = func() error { return a.config.httpServer.ListenAndServeTLS("", "") }
+	}
+	if err := listen(); err != nil && err.Error() != http.ErrServerClosed.Error() {
 		return err
 	}
 	return nil
 }
 
-// Stop stops the app
+// defaultShutdownTimeout is how long [App.Stop] waits for the app to shut down
+const defaultShutdownTimeout = 30 * time.Second
+
+// Stop stops the app waiting up to 30 seconds for in-flight requests and notifications
 func (a *App) Stop() error {
-	var wg sync.WaitGroup
+	ctx, cancel := context.WithTimeout(context.Background(), defaultShutdownTimeout)
+	defer cancel()
+	return a.Shutdown(ctx)
+}
 
-	if a.config.ngrokTunnel != nil {
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			if err := a.config.ngrokTunnel.Close(); err != nil {
-				slog.Error("unable to stop ngrok tunnel", "err", err)
-			}
-		}()
+// Shutdown gracefully stops the app
+//
+// Readiness fails straight away and requests are still served for the shutdown delay so load balancers can stop sending them.
+// New requests are then refused and in-flight requests are drained before pending notifications are sent.
+// If ctx is done first, remaining connections are closed and the error is returned.
+// Nothing uses the provider once Shutdown returns so it is safe to close the store.
+func (a *App) Shutdown(ctx context.Context) error {
+	a.shuttingDown.Store(true)
+	var errs []error
+	if a.config.shutdownDelay > 0 {
+		delay := time.NewTimer(a.config.shutdownDelay)
+		select {
+		case <-delay.C:
+		case <-ctx.Done():
+			delay.Stop()
+		}
 	}
-	wg.Add(1)
-	go func() {
-		defer wg.Done()
-		if err := a.config.httpServer.Close(); err != nil {
-			slog.Error("unable to stop http server", "err", err)
+	// stop accepting requests over ngrok first so all traffic drains through the same path
+	// shutting down the server closes the tunnel
+	if a.ngrokServer != nil {
+		if err := a.ngrokServer.Shutdown(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("unable to stop ngrok tunnel: %w", err))
+			_ = a.ngrokServer.Close()
 		}
-	}()
-	wg.Wait()
-	return nil
+	}
+	if err := a.config.httpServer.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("unable to stop http server: %w", err))
+		_ = a.config.httpServer.Close()
+	}
+	// changes that are still debouncing are dropped
+	if a.detector != nil {
+		a.detector.Stop()
+	}
+	// let notifications for changes made before stopping finish
+	if a.dispatcher != nil {
+		if err := a.dispatcher.Wait(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("unable to wait for notifications: %w", err))
+		}
+		if err := a.dispatcher.Flush(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("unable to flush notifications: %w", err))
+		}
+	}
+	return errors.Join(errs...)
 }
@@ -5,10 +5,21 @@ import (
 	"net/http"
 	"os"
 	"sync"
+	"time"
 
+	"github.com/lusis/apithings/internal/statusthing/flap"
 	"github.com/lusis/apithings/internal/statusthing/handlers"
+	"github.com/lusis/apithings/internal/statusthing/manifest"
+	"github.com/lusis/apithings/internal/statusthing/notifiers"
 	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/ratelimit"
+	"github.com/lusis/apithings/internal/statusthing/receivers"
 	"github.com/lusis/apithings/internal/statusthing/storers"
+	"github.com/lusis/apithings/internal/statusthing/tlsconfig"
+	"github.com/lusis/apithings/internal/statusthing/tracing"
+	"github.com/lusis/apithings/internal/statusthing/uptime"
+
+	"go.opentelemetry.io/otel/trace"
 
 	"golang.ngrok.com/ngrok"
 	"golang.org/x/exp/slog"
@@ -84,6 +95,25 @@ func WithBasePath(p string) AppOption {
 	}
 }
 
+// WithPublicURL sets the absolute url the base path can be reached at from outside for feed links
+func WithPublicURL(u string) AppOption {
+	return func(ac *AppConfig) error {
+		if u == "" {
+			return fmt.Errorf("public url cannot be empty")
+		}
+		ac.publicURL = u
+		return nil
+	}
+}
+
+// WithoutDashboard only serves the api, feeds, badges and webhooks without the dashboard
+func WithoutDashboard() AppOption {
+	return func(ac *AppConfig) error {
+		ac.noDashboard = true
+		return nil
+	}
+}
+
 // WithAPIKey sets the optional key to protect the api
 func WithAPIKey(p string) AppOption {
 	return func(ac *AppConfig) error {
@@ -95,6 +125,84 @@ func WithAPIKey(p string) AppOption {
 	}
 }
 
+// WithNamedAPIKey adds an accepted api key
+// the name is logged with each request instead of the key
+func WithNamedAPIKey(name, key string) AppOption {
+	return func(ac *AppConfig) error {
+		if name == "" || key == "" {
+			return fmt.Errorf("api key name and key cannot be empty")
+		}
+		if ac.apiKeys == nil {
+			ac.apiKeys = map[string]string{}
+		}
+		if _, ok := ac.apiKeys[name]; ok {
+			return fmt.Errorf("api key %s is already set", name)
+		}
+		ac.apiKeys[name] = key
+		return nil
+	}
+}
+
+// WithListenAddr sets the address the http server listens on
+// the default is :9000
+func WithListenAddr(addr string) AppOption {
+	return func(ac *AppConfig) error {
+		if addr == "" {
+			return fmt.Errorf("listen address cannot be empty")
+		}
+		ac.listenAddr = addr
+		return nil
+	}
+}
+
+// WithHTTPServer serves the app with a custom [http.Server] i.e. to set timeouts
+// the app's handler is used if the server has no handler and the listen address is used if it has no address
+func WithHTTPServer(srv *http.Server) AppOption {
+	return func(ac *AppConfig) error {
+		if srv == nil {
+			return fmt.Errorf("http server cannot be nil")
+		}
+		ac.httpServer = srv
+		return nil
+	}
+}
+
+// WithShutdownDelay keeps serving requests for d after [App.Shutdown] starts failing readiness checks
+// this gives load balancers polling /readyz time to stop sending requests before the server stops accepting them
+// the delay comes out of the time the context passed to [App.Shutdown] allows
+func WithShutdownDelay(d time.Duration) AppOption {
+	return func(ac *AppConfig) error {
+		if d < 0 {
+			return fmt.Errorf("shutdown delay cannot be negative")
+		}
+		ac.shutdownDelay = d
+		return nil
+	}
+}
+
+// WithTLS serves https with the certificate and key files
+// the files are reloaded when they change so renewed certificates don't need a restart
+func WithTLS(certFile, keyFile string, opts ...tlsconfig.Option) AppOption {
+	return func(ac *AppConfig) error {
+		cfg, err := tlsconfig.New(certFile, keyFile, opts...)
+		if err != nil {
+			return err
+		}
+		ac.tlsConfig = cfg
+		return nil
+	}
+}
+
+// WithClientCertAuth accepts client certificates verified with [tlsconfig.WithClientCAs] in place of an api key
+// the certificate's subject common name is logged as the caller and, if any subjects are provided, must be one of them
+func WithClientCertAuth(subjects ...string) AppOption {
+	return func(ac *AppConfig) error {
+		ac.clientCertAuth = true
+		ac.clientCertSubjects = subjects
+		return nil
+	}
+}
+
 // WithNgrok serves the app from the provided ngrok tunnel as well
 func WithNgrok(tun ngrok.Tunnel) AppOption {
 	return func(ac *AppConfig) error {
@@ -106,6 +214,206 @@ func WithNgrok(tun ngrok.Tunnel) AppOption {
 	}
 }
 
+// WithManifest reconciles things with the manifest at path when the app starts
+// things not in the manifest are deleted if prune is true
+func WithManifest(path string, prune bool) AppOption {
+	return func(ac *AppConfig) error {
+		if path == "" {
+			return fmt.Errorf("manifest path cannot be empty")
+		}
+		m, err := manifest.Load(path)
+		if err != nil {
+			return err
+		}
+		ac.manifest = m
+		ac.pruneManifest = prune
+		return nil
+	}
+}
+
+// WithAlertmanager accepts alertmanager webhooks at <basepath>/hooks/alertmanager
+func WithAlertmanager(opts ...receivers.AlertmanagerOption) AppOption {
+	return func(ac *AppConfig) error {
+		ac.receivers = append(ac.receivers, func(p providers.Provider) (receivers.Receiver, error) {
+			return receivers.NewAlertmanagerReceiver(p, opts...)
+		})
+		return nil
+	}
+}
+
+// WithGitHubDeployments accepts github deployment_status webhooks signed with secret at <basepath>/hooks/github
+func WithGitHubDeployments(secret string, opts ...receivers.DeploymentOption) AppOption {
+	return func(ac *AppConfig) error {
+		if secret == "" {
+			return fmt.Errorf("secret cannot be empty")
+		}
+		ac.receivers = append(ac.receivers, func(p providers.Provider) (receivers.Receiver, error) {
+			return receivers.NewGitHubReceiver(p, secret, opts...)
+		})
+		return nil
+	}
+}
+
+// WithGitLabDeployments accepts gitlab pipeline and deployment webhooks sending token at <basepath>/hooks/gitlab
+func WithGitLabDeployments(token string, opts ...receivers.DeploymentOption) AppOption {
+	return func(ac *AppConfig) error {
+		if token == "" {
+			return fmt.Errorf("token cannot be empty")
+		}
+		ac.receivers = append(ac.receivers, func(p providers.Provider) (receivers.Receiver, error) {
+			return receivers.NewGitLabReceiver(p, token, opts...)
+		})
+		return nil
+	}
+}
+
+// WithTemplateHooks accepts webhooks for each hook defined in the file at path at <basepath>/hooks/<id>
+func WithTemplateHooks(path string) AppOption {
+	return func(ac *AppConfig) error {
+		if path == "" {
+			return fmt.Errorf("hooks path cannot be empty")
+		}
+		hooks, err := receivers.LoadTemplateHooks(path)
+		if err != nil {
+			return err
+		}
+		for _, hook := range hooks {
+			hook := hook
+			ac.receivers = append(ac.receivers, func(p providers.Provider) (receivers.Receiver, error) {
+				return receivers.NewTemplateReceiver(p, hook)
+			})
+		}
+		return nil
+	}
+}
+
+// WithNotifiers sends notifications to the channels when things change status
+func WithNotifiers(channels ...notifiers.Channel) AppOption {
+	return func(ac *AppConfig) error {
+		for i, c := range channels {
+			if c.Notifier == nil {
+				return fmt.Errorf("channels[%d]: notifier cannot be nil", i)
+			}
+		}
+		ac.notifiers = append(ac.notifiers, channels...)
+		return nil
+	}
+}
+
+// WithEmailNotifier emails subscribers when things change status and serves the subscription routes under <basepath>/subscriptions
+func WithEmailNotifier(n *notifiers.EmailNotifier) AppOption {
+	return func(ac *AppConfig) error {
+		if n == nil {
+			return fmt.Errorf("email notifier cannot be nil")
+		}
+		ac.notifiers = append(ac.notifiers, notifiers.Channel{Notifier: n})
+		ac.subscriptions = n
+		return nil
+	}
+}
+
+// WithFlapDetection debounces status changes and suppresses them while things are flapping before they are notified about
+func WithFlapDetection(opts ...flap.Option) AppOption {
+	return func(ac *AppConfig) error {
+		ac.flapOpts = append([]flap.Option{}, opts...)
+		return nil
+	}
+}
+
+// WithHistory records status changes in hs and serves feeds of them
+func WithHistory(hs storers.HistoryStorer) AppOption {
+	return func(ac *AppConfig) error {
+		if hs == nil {
+			return fmt.Errorf("history cannot be nil")
+		}
+		ac.history = hs
+		return nil
+	}
+}
+
+// WithUptimeOptions configures how uptime is calculated from the history
+func WithUptimeOptions(opts ...uptime.Option) AppOption {
+	return func(ac *AppConfig) error {
+		ac.uptimeOpts = append(ac.uptimeOpts, opts...)
+		return nil
+	}
+}
+
+// WithTracerProvider traces requests and provider calls with tp and adds trace ids to log records
+func WithTracerProvider(tp trace.TracerProvider) AppOption {
+	return func(ac *AppConfig) error {
+		if tp == nil {
+			return fmt.Errorf("tracer provider cannot be nil")
+		}
+		ac.tracerProvider = tp
+		return nil
+	}
+}
+
+// WithCORS allows browsers on other origins to call the api
+func WithCORS(c handlers.CORS) AppOption {
+	return func(ac *AppConfig) error {
+		if len(c.AllowedOrigins) == 0 {
+			return fmt.Errorf("at least one allowed origin must be provided")
+		}
+		ac.cors = &c
+		return nil
+	}
+}
+
+// WithIPRateLimit limits each client address to rate api requests per second with bursts of up to burst requests
+func WithIPRateLimit(rate float64, burst int) AppOption {
+	return func(ac *AppConfig) error {
+		l, err := ratelimit.New(rate, burst)
+		if err != nil {
+			return fmt.Errorf("invalid ip rate limit: %w", err)
+		}
+		ac.ipLimiter = l
+		return nil
+	}
+}
+
+// WithAPIKeyRateLimit limits each api key or client certificate to rate api requests per second with bursts of up to burst requests
+func WithAPIKeyRateLimit(rate float64, burst int) AppOption {
+	return func(ac *AppConfig) error {
+		l, err := ratelimit.New(rate, burst)
+		if err != nil {
+			return fmt.Errorf("invalid api key rate limit: %w", err)
+		}
+		ac.apiKeyLimiter = l
+		return nil
+	}
+}
+
+// WithMaxBodyBytes sets the largest json body the api accepts (default 1MiB)
+func WithMaxBodyBytes(n int64) AppOption {
+	return func(ac *AppConfig) error {
+		if n < 1 {
+			return fmt.Errorf("max body bytes must be positive")
+		}
+		ac.maxBodyBytes = n
+		return nil
+	}
+}
+
+// WithReadinessCheck adds a check that must pass for /readyz to report the app as ready
+// the store and whether the app is shutting down are always checked
+func WithReadinessCheck(name string, check handlers.ReadinessCheck) AppOption {
+	return func(ac *AppConfig) error {
+		if name == "" {
+			return fmt.Errorf("readiness check name cannot be empty")
+		}
+		if check == nil {
+			return fmt.Errorf("readiness check cannot be nil")
+		}
+		if ac.readinessChecks == nil {
+			ac.readinessChecks = make(map[string]handlers.ReadinessCheck)
+		}
+		ac.readinessChecks[name] = check
+		return nil
+	}
+}
+
 // parseOpts parses options and returns a config
 func parseOpts(opts ...AppOption) (*AppConfig, error) {
 	ac := &AppConfig{
@@ -140,11 +448,23 @@ func parseOpts(opts ...AppOption) (*AppConfig, error) {
 		l := slog.New(ac.logHandler)
 		ac.logger = l
 	}
-	// make the logger the default
-	slog.SetDefault(ac.logger)
+	// every log call made with a request context gets the request id.
+	// the global default is left alone: wrapping slog.Default() and setting it back
+	// would loop its output through the log package forever
+	ac.logger = slog.New(wrapLogHandler(ac.logger.Handler(), ac.tracerProvider != nil))
 
 	if ac.httpServer == nil {
-		ac.httpServer = &http.Server{Addr: ac.listenAddr}
+		ac.httpServer = &http.Server{}
+	}
+	if ac.httpServer.Addr == "" {
+		ac.httpServer.Addr = ac.listenAddr
+	}
+	if ac.tlsConfig != nil {
+		ac.httpServer.TLSConfig = ac.tlsConfig
+	}
+	if ac.clientCertAuth && (ac.httpServer.TLSConfig == nil || ac.httpServer.TLSConfig.ClientCAs == nil) {
+		ac.lock.Unlock()
+		return nil, fmt.Errorf("client certificate auth requires tls with client CAs")
 	}
 
 	if ac.provider == nil && ac.store == nil {
@@ -165,3 +485,17 @@ func parseOpts(opts ...AppOption) (*AppConfig, error) {
 	ac.lock.Unlock()
 	return ac, nil
 }
+
+// wrapLogHandler adds request ids, and trace ids when traced, to h unless h already has them
+func wrapLogHandler(h slog.Handler, traced bool) slog.Handler {
+	if _, ok := h.(*tracing.LogHandler); ok {
+		return h
+	}
+	if _, ok := h.(*handlers.RequestIDLogHandler); !ok {
+		h = handlers.NewRequestIDLogHandler(h)
+	}
+	if traced {
+		h = tracing.NewLogHandler(h)
+	}
+	return h
+}
@@ -1,12 +1,34 @@
 package statusthing
 
 import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"database/sql"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/lusis/apithings/internal/statusthing/flap"
+	"github.com/lusis/apithings/internal/statusthing/handlers"
+	"github.com/lusis/apithings/internal/statusthing/notifiers"
 	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/statusthingtest"
 	"github.com/lusis/apithings/internal/statusthing/storers"
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/storers/sqlite3"
+	"github.com/lusis/apithings/internal/statusthing/tlsconfig"
+	"github.com/lusis/apithings/internal/statusthing/types"
 	"github.com/stretchr/testify/require"
+	"golang.org/x/exp/slog"
+	_ "modernc.org/sqlite" // sql driver
 )
 
 func TestNew(t *testing.T) {
@@ -34,6 +56,66 @@ func TestNew(t *testing.T) {
 			opts:      []AppOption{},
 			shouldErr: true,
 		},
+		"nil-notifier": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithNotifiers(notifiers.Channel{})},
+			shouldErr: true,
+		},
+		"nil-tracer-provider": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithTracerProvider(nil)},
+			shouldErr: true,
+		},
+		"named-api-keys": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithNamedAPIKey("ci", "abc"), WithNamedAPIKey("grafana", "def")},
+			shouldErr: false,
+		},
+		"duplicate-api-key": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithAPIKey("abc"), WithNamedAPIKey("ci", "abc")},
+			shouldErr: true,
+		},
+		"empty-listen-addr": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithListenAddr("")},
+			shouldErr: true,
+		},
+		"nil-http-server": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithHTTPServer(nil)},
+			shouldErr: true,
+		},
+		"missing-tls-cert": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithTLS(filepath.Join(t.TempDir(), "tls.crt"), filepath.Join(t.TempDir(), "tls.key"))},
+			shouldErr: true,
+		},
+		"client-cert-auth-without-tls": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithClientCertAuth()},
+			shouldErr: true,
+		},
+		"rate-limits": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithIPRateLimit(10, 20), WithAPIKeyRateLimit(1, 5), WithMaxBodyBytes(1024)},
+			shouldErr: false,
+		},
+		"cors": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithCORS(handlers.CORS{AllowedOrigins: []string{"https://ui.example.com"}})},
+			shouldErr: false,
+		},
+		"cors-without-origins": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithCORS(handlers.CORS{})},
+			shouldErr: true,
+		},
+		"invalid-rate-limit": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithIPRateLimit(0, 1)},
+			shouldErr: true,
+		},
+		"invalid-max-body-bytes": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithMaxBodyBytes(0)},
+			shouldErr: true,
+		},
+		"missing-hooks": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithTemplateHooks(filepath.Join(t.TempDir(), "missing.yaml"))},
+			shouldErr: true,
+		},
+		"missing-manifest": {
+			opts:      []AppOption{WithStorer(&storers.UnimplementedStorer{}), WithManifest(filepath.Join(t.TempDir(), "missing.yaml"), false)},
+			shouldErr: true,
+		},
 	}
 
 	for n, tc := range testCases {
@@ -49,3 +131,334 @@ func TestNew(t *testing.T) {
 		})
 	}
 }
+
+func TestReconcileManifest(t *testing.T) {
+	dir := t.TempDir()
+	db, err := sql.Open("sqlite", filepath.Join(dir, "statusthing.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := sqlite3.New(db, true)
+	require.NoError(t, err)
+	manifestPath := filepath.Join(dir, "things.yaml")
+	require.NoError(t, os.WriteFile(manifestPath, []byte("things:\n  - name: api\n    description: the api\n    group: core\n"), 0o600))
+
+	a, err := New(WithStorer(store), WithManifest(manifestPath, true))
+	require.NoError(t, err)
+	require.NoError(t, a.reconcile(context.Background()))
+
+	all, err := a.config.provider.All(context.Background())
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	require.Equal(t, "api", all[0].Name)
+	require.Equal(t, "core", all[0].Group)
+
+	// a second reconcile should not change anything
+	require.NoError(t, a.reconcile(context.Background()))
+	again, err := a.config.provider.All(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, all, again)
+}
+
+func TestHistory(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "statusthing.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := sqlite3.New(db, true)
+	require.NoError(t, err)
+
+	_, err = New(WithStorer(store), WithHistory(nil))
+	require.Error(t, err, "should require a history")
+	a, err := New(WithStorer(store), WithHistory(store), WithFlapDetection(flap.WithDwell(time.Hour)))
+	require.NoError(t, err)
+	ctx := context.Background()
+	thing, err := a.config.provider.Add(ctx, providers.Params{Name: "api", Description: "the api", Status: types.StatusGreen})
+	require.NoError(t, err)
+	_, _, err = a.config.provider.SetStatus(ctx, thing.ID, types.StatusRed)
+	require.NoError(t, err)
+
+	history, err := store.GetTransitions(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 2, "changes should be recorded even when they are not published yet")
+	require.Equal(t, types.StatusRed, history[0].Thing.Status)
+	require.Equal(t, types.StatusGreen, history[0].Previous)
+
+	published, err := store.GetTransitions(ctx, dbfilters.WithPublished())
+	require.NoError(t, err)
+	require.Len(t, published, 1, "changes held back by flap detection should not be published")
+	require.True(t, published[0].Published)
+	require.Equal(t, types.StatusGreen, published[0].Thing.Status)
+	require.NotEqual(t, history[1].ID, published[0].ID, "published changes should be recorded separately")
+
+	_, _, err = a.config.provider.SetStatus(ctx, thing.ID, types.StatusRed, dbfilters.WithDescription("fix deployed"))
+	require.NoError(t, err)
+	history, err = store.GetTransitions(ctx)
+	require.NoError(t, err)
+	require.Len(t, history, 2, "description updates should not count towards uptime")
+	published, err = store.GetTransitions(ctx, dbfilters.WithPublished())
+	require.NoError(t, err)
+	require.Len(t, published, 2, "description updates should be published for feeds")
+	require.True(t, published[0].DescriptionUpdate())
+	require.Equal(t, "fix deployed", published[0].Thing.Description)
+}
+
+// blockingProvider blocks All until released
+type blockingProvider struct {
+	providers.UnimplementedProvider
+	started chan struct{}
+	release chan struct{}
+}
+
+func (bp *blockingProvider) All(_ context.Context) ([]*types.StatusThing, error) {
+	close(bp.started)
+	<-bp.release
+	return []*types.StatusThing{}, nil
+}
+
+func TestShutdown(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	p := &blockingProvider{started: make(chan struct{}), release: make(chan struct{})}
+	a, err := New(WithProvider(p), WithListenAddr(addr))
+	require.NoError(t, err)
+	started := make(chan error, 1)
+	go func() { started <- a.Start() }()
+
+	// the server may take a moment to start listening
+	responses := make(chan *http.Response, 1)
+	go func() {
+		for {
+			req, _ := http.NewRequest(http.MethodGet, "http://"+addr+"/statusthings/api/", nil)
+			req.Header.Set("Content-Type", "application/json")
+			if res, err := http.DefaultClient.Do(req); err == nil {
+				responses <- res
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}()
+	select {
+	case <-p.started:
+	case <-time.After(5 * time.Second):
+		t.Fatal("request should reach the provider")
+	}
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- a.Shutdown(context.Background()) }()
+	require.NoError(t, <-started, "start should return once shutdown begins")
+	select {
+	case <-stopped:
+		t.Fatal("shutdown should wait for in-flight requests")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	close(p.release)
+	res := <-responses
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode, "in-flight requests should complete")
+	require.NoError(t, <-stopped)
+}
+
+func TestShutdownDelay(t *testing.T) {
+	_, err := New(WithStorer(&storers.UnimplementedStorer{}), WithShutdownDelay(-time.Second))
+	require.Error(t, err)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+	a, err := New(WithStorer(&storers.UnimplementedStorer{}), WithListenAddr(addr), WithShutdownDelay(200*time.Millisecond))
+	require.NoError(t, err)
+	started := make(chan error, 1)
+	go func() { started <- a.Start() }()
+	ready := func() int {
+		res, err := http.Get("http://" + addr + "/readyz")
+		if err != nil {
+			return 0
+		}
+		defer res.Body.Close()
+		return res.StatusCode
+	}
+	require.Eventually(t, func() bool { return ready() == http.StatusOK }, 5*time.Second, 10*time.Millisecond)
+
+	stopped := make(chan error, 1)
+	start := time.Now()
+	go func() { stopped <- a.Shutdown(context.Background()) }()
+	require.Eventually(t, func() bool { return ready() == http.StatusServiceUnavailable }, time.Second, 10*time.Millisecond,
+		"requests should still be served while readiness fails")
+	require.NoError(t, <-stopped)
+	require.NoError(t, <-started)
+	require.GreaterOrEqual(t, time.Since(start), 200*time.Millisecond, "the server should only stop after the delay")
+}
+
+func TestReadiness(t *testing.T) {
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "statusthing.db"))
+	require.NoError(t, err)
+	store, err := sqlite3.New(db, true)
+	require.NoError(t, err)
+	_, err = New(WithStorer(store), WithReadinessCheck("store", func(context.Context) error { return nil }))
+	require.Error(t, err, "built in check names should not be reused")
+	var cacheErr error
+	a, err := New(WithStorer(store), WithReadinessCheck("cache", func(context.Context) error { return cacheErr }))
+	require.NoError(t, err)
+	ready := func() (int, map[string]any) {
+		w := httptest.NewRecorder()
+		a.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+		res := struct {
+			Checks map[string]any `json:"checks"`
+		}{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return w.Code, res.Checks
+	}
+
+	code, checks := ready()
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, checks, 3, "the store, shutdown and custom checks should run")
+
+	cacheErr = fmt.Errorf("cache is down")
+	code, _ = ready()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	cacheErr = nil
+
+	require.NoError(t, db.Close())
+	code, checks = ready()
+	require.Equal(t, http.StatusServiceUnavailable, code, "an unreachable store should not be ready")
+	require.Contains(t, checks["store"], "error")
+
+	require.NoError(t, a.Shutdown(context.Background()))
+	code, checks = ready()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, "shutting down", checks["shutdown"].(map[string]any)["error"])
+
+	w := httptest.NewRecorder()
+	a.Handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+	require.Equal(t, http.StatusOK, w.Code, "the process is still alive")
+
+	// notifiers are checked when there are any
+	n := &checkedNotifier{err: fmt.Errorf("smtp is down")}
+	a, err = New(WithProvider(&providers.UnimplementedProvider{}), WithNotifiers(notifiers.Channel{Notifier: n}))
+	require.NoError(t, err)
+	code, checks = ready()
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Contains(t, checks["notifications"].(map[string]any)["error"], "smtp is down")
+	n.err = nil
+	code, _ = ready()
+	require.Equal(t, http.StatusOK, code)
+}
+
+// checkedNotifier is a [notifiers.Checker] that reports err
+type checkedNotifier struct {
+	err error
+}
+
+func (cn *checkedNotifier) Name() string { return "checked" }
+
+func (cn *checkedNotifier) Notify(context.Context, types.Transition) error { return nil }
+
+func (cn *checkedNotifier) Check(context.Context) error { return cn.err }
+
+func TestMultipleApps(t *testing.T) {
+	custom := &http.Server{ReadHeaderTimeout: time.Second}
+	a, err := New(WithStorer(&storers.UnimplementedStorer{}), WithHTTPServer(custom), WithListenAddr("127.0.0.1:9999"))
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:9999", custom.Addr, "the listen address should be used when the server has none")
+	require.Equal(t, a.Handler(), custom.Handler)
+
+	// another app can be mounted in an existing mux alongside the first
+	b, err := New(WithStorer(&storers.UnimplementedStorer{}), WithBasePath("/other"))
+	require.NoError(t, err)
+	require.Equal(t, ":9000", b.config.httpServer.Addr)
+	require.NotEqual(t, a.Handler(), b.Handler())
+	mux := http.NewServeMux()
+	mux.Handle("/other/", b.Handler())
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/other/badge/nope.txt", nil))
+	require.Equal(t, http.StatusNotFound, w.Code)
+	require.Equal(t, "application/problem+json", w.Header().Get("Content-Type"), "the app should serve the request")
+}
+
+func TestLogger(t *testing.T) {
+	def := slog.Default()
+	// the default logger writes through the log package so wrapping it and setting it back would never return
+	a, err := New(WithStorer(&storers.UnimplementedStorer{}), WithLogger(def))
+	require.NoError(t, err)
+	require.Same(t, def, slog.Default(), "new should not replace the default logger")
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		a.Logger().Info("logging through the default handler")
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("logging with the default logger did not return")
+	}
+
+	// a logger that already adds request ids isn't wrapped again
+	first, err := New(WithStorer(&storers.UnimplementedStorer{}), WithLogHandler(slog.NewJSONHandler(io.Discard)))
+	require.NoError(t, err)
+	second, err := New(WithStorer(&storers.UnimplementedStorer{}), WithLogger(first.Logger().With("app", "second")))
+	require.NoError(t, err)
+	h, ok := second.Logger().Handler().(*handlers.RequestIDLogHandler)
+	require.True(t, ok)
+	require.IsType(t, &slog.JSONHandler{}, h.Handler, "the request id handler should only be added once")
+}
+
+func TestTLS(t *testing.T) {
+	dir := t.TempDir()
+	serverCert, serverKey := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	statusthingtest.WriteCert(t, serverCert, serverKey, "server")
+	clientCert, clientKey := filepath.Join(dir, "ci.crt"), filepath.Join(dir, "ci.key")
+	statusthingtest.WriteCert(t, clientCert, clientKey, "ci")
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	db, err := sql.Open("sqlite", filepath.Join(dir, "statusthing.db"))
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := sqlite3.New(db, true)
+	require.NoError(t, err)
+	a, err := New(
+		WithStorer(store),
+		WithListenAddr(addr),
+		WithAPIKey("sekret"),
+		WithTLS(serverCert, serverKey, tlsconfig.WithClientCAs(clientCert)),
+		WithClientCertAuth("ci"),
+	)
+	require.NoError(t, err)
+	go func() { _ = a.Start() }()
+	defer func() { require.NoError(t, a.Shutdown(context.Background())) }()
+
+	roots := x509.NewCertPool()
+	caPEM, err := os.ReadFile(serverCert)
+	require.NoError(t, err)
+	require.True(t, roots.AppendCertsFromPEM(caPEM))
+	pair, err := tls.LoadX509KeyPair(clientCert, clientKey)
+	require.NoError(t, err)
+	get := func(certs []tls.Certificate) (int, error) {
+		c := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: roots, Certificates: certs, MinVersion: tls.VersionTLS12}}}
+		req, _ := http.NewRequest(http.MethodGet, "https://"+addr+"/statusthings/api/", nil)
+		req.Header.Set("Content-Type", "application/json")
+		res, err := c.Do(req)
+		if err != nil {
+			return 0, err
+		}
+		defer res.Body.Close()
+		return res.StatusCode, nil
+	}
+	// the server may take a moment to start listening
+	var status int
+	require.Eventually(t, func() bool {
+		status, err = get(nil)
+		return err == nil
+	}, 5*time.Second, 10*time.Millisecond)
+	require.Equal(t, http.StatusForbidden, status, "should require a key or certificate")
+	status, err = get([]tls.Certificate{pair})
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, status, "the client certificate should identify the caller")
+}
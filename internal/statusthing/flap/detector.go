@@ -0,0 +1,249 @@
+package flap
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/types"
+
+	"golang.org/x/exp/slog"
+)
+
+// timer is the part of [time.Timer] we use so tests can control time
+type timer interface {
+	Stop() bool
+}
+
+// Detector sits between status changes and whatever publishes them i.e. notifiers
+//
+// A change is only published once the thing has kept the new status for the dwell time.
+// A thing that changes status threshold times within the window is flapping and nothing is published for it
+// until it has gone a whole window without changing, at which point its final status is published.
+type Detector struct {
+	next      providers.TransitionFunc
+	dwell     time.Duration
+	window    time.Duration
+	threshold int
+
+	lock   sync.Mutex
+	things map[string]*thingState
+	// stopped is set once the detector is stopped and nothing else is published
+	stopped bool
+	// generation is incremented for every timer so each can be told apart even across forgotten things
+	generation uint64
+
+	nowFunc   func() time.Time
+	afterFunc func(time.Duration, func()) timer
+}
+
+// thingState is what we know about a single thing
+type thingState struct {
+	// published is the last status passed on for the thing
+	published types.Status
+	// changes are when the thing changed status within the window
+	changes  []time.Time
+	flapping bool
+	// latest is the most recent unpublished transition
+	latest *types.Transition
+	timer  timer
+	// generation identifies the current timer
+	// stopping a timer doesn't stop a callback that has already started so settle ignores older ones
+	generation uint64
+}
+
+// Option is a functional option for a [Detector]
+type Option func(*Detector) error
+
+// WithDwell only publishes changes once a thing has kept its new status for d
+func WithDwell(d time.Duration) Option {
+	return func(det *Detector) error {
+		if d < 0 {
+			return fmt.Errorf("dwell time cannot be negative")
+		}
+		det.dwell = d
+		return nil
+	}
+}
+
+// WithFlapping marks a thing as flapping once it changes status threshold times within window
+func WithFlapping(window time.Duration, threshold int) Option {
+	return func(det *Detector) error {
+		if window <= 0 {
+			return fmt.Errorf("flap window must be positive")
+		}
+		if threshold < 2 {
+			return fmt.Errorf("flap threshold must be at least 2")
+		}
+		det.window = window
+		det.threshold = threshold
+		return nil
+	}
+}
+
+// New returns a new [Detector] passing published transitions to next
+func New(next providers.TransitionFunc, opts ...Option) (*Detector, error) {
+	if next == nil {
+		return nil, fmt.Errorf("next cannot be nil")
+	}
+	d := &Detector{
+		next:    next,
+		things:  make(map[string]*thingState),
+		nowFunc: time.Now,
+		afterFunc: func(d time.Duration, f func()) timer {
+			return time.AfterFunc(d, f)
+		},
+	}
+	for _, opt := range opts {
+		if err := opt(d); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+// Observe handles a status transition
+// it can be passed to [providers.NewTransitionProvider]
+func (d *Detector) Observe(ctx context.Context, t types.Transition) {
+	if t.Thing == nil {
+		return
+	}
+	d.lock.Lock()
+	if d.stopped {
+		d.lock.Unlock()
+		return
+	}
+	state, ok := d.things[t.Thing.ID]
+	if !ok || t.Previous == types.StatusUnknown {
+		// new things and things we haven't seen since starting are taken at face value
+		state = &thingState{published: t.Previous}
+		d.things[t.Thing.ID] = state
+	}
+	if t.Previous == types.StatusUnknown {
+		state.published = t.Thing.Status
+		d.lock.Unlock()
+		d.next(ctx, t)
+		return
+	}
+
+	now := d.nowFunc()
+	latest := t
+	state.latest = &latest
+	d.recordChange(state, now)
+	if state.timer != nil {
+		state.timer.Stop()
+		state.timer = nil
+	}
+	d.generation++
+	state.generation = d.generation
+	id, generation := t.Thing.ID, state.generation
+	switch {
+	case state.flapping:
+		// wait for a quiet window before publishing anything
+		state.timer = d.afterFunc(d.window, func() { d.settle(id, generation, true) })
+		d.lock.Unlock()
+	case d.dwell > 0:
+		state.timer = d.afterFunc(d.dwell, func() { d.settle(id, generation, false) })
+		d.lock.Unlock()
+	default:
+		pub, ok := d.publishable(state)
+		d.lock.Unlock()
+		if ok {
+			d.next(ctx, pub)
+		}
+	}
+}
+
+// recordChange records a change and updates the flapping state
+// the lock must be held
+func (d *Detector) recordChange(state *thingState, now time.Time) {
+	if d.threshold == 0 {
+		return
+	}
+	state.changes = append(state.changes, now)
+	cutoff := now.Add(-d.window)
+	for len(state.changes) > 0 && state.changes[0].Before(cutoff) {
+		state.changes = state.changes[1:]
+	}
+	if !state.flapping && len(state.changes) >= d.threshold {
+		state.flapping = true
+		slog.Warn("thing is flapping, suppressing status changes", "thing", state.latest.Thing.Name, "changes", len(state.changes), "window", d.window.String())
+	}
+}
+
+// settle publishes the latest status of a thing once its timer fires
+// a timer that has been replaced, or a thing that has been forgotten, is ignored
+func (d *Detector) settle(id string, generation uint64, flapping bool) {
+	d.lock.Lock()
+	state, ok := d.things[id]
+	if !ok || d.stopped || state.generation != generation {
+		d.lock.Unlock()
+		return
+	}
+	state.timer = nil
+	if flapping {
+		state.flapping = false
+		state.changes = nil
+		slog.Info("thing has stopped flapping", "thing", state.latest.Thing.Name)
+	}
+	pub, ok := d.publishable(state)
+	d.lock.Unlock()
+	if ok {
+		d.next(context.Background(), pub)
+	}
+}
+
+// publishable returns the transition to publish for a thing if its status differs from the last one published
+// the lock must be held
+func (d *Detector) publishable(state *thingState) (types.Transition, bool) {
+	if state.latest == nil {
+		return types.Transition{}, false
+	}
+	t := *state.latest
+	state.latest = nil
+	if t.Thing.Status == state.published {
+		return types.Transition{}, false
+	}
+	t.Previous = state.published
+	state.published = t.Thing.Status
+	return t, true
+}
+
+// Stop cancels any changes waiting to be published
+// changes that haven't settled by the time we stop are dropped since they were never confirmed
+func (d *Detector) Stop() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.stopped = true
+	for _, state := range d.things {
+		if state.timer != nil {
+			state.timer.Stop()
+			state.timer = nil
+		}
+	}
+}
+
+// Forget drops everything known about the thing with the id and cancels anything waiting to be published for it
+// it should be called when a thing is removed
+func (d *Detector) Forget(_ context.Context, id string) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	state, ok := d.things[id]
+	if !ok {
+		return
+	}
+	if state.timer != nil {
+		state.timer.Stop()
+	}
+	delete(d.things, id)
+}
+
+// Flapping reports if the thing with the id is currently flapping
+func (d *Detector) Flapping(id string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	state, ok := d.things[id]
+	return ok && state.flapping
+}
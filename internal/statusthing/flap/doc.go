@@ -0,0 +1,2 @@
+// Package flap debounces status transitions and suppresses them while a thing is flapping
+package flap
@@ -0,0 +1,186 @@
+package flap
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// fakeTimer is a timer that only fires when told to
+type fakeTimer struct {
+	f       func()
+	stopped bool
+}
+
+func (ft *fakeTimer) Stop() bool {
+	ft.stopped = true
+	return true
+}
+
+// harness collects published transitions and controls time for a [Detector]
+type harness struct {
+	lock      sync.Mutex
+	now       time.Time
+	timers    []*fakeTimer
+	published []types.Transition
+}
+
+func newHarness(t *testing.T, opts ...Option) (*Detector, *harness) {
+	t.Helper()
+	h := &harness{now: time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)}
+	d, err := New(func(_ context.Context, tr types.Transition) {
+		h.lock.Lock()
+		defer h.lock.Unlock()
+		h.published = append(h.published, tr)
+	}, opts...)
+	require.NoError(t, err)
+	d.nowFunc = func() time.Time { return h.now }
+	d.afterFunc = func(_ time.Duration, f func()) timer {
+		ft := &fakeTimer{f: f}
+		h.timers = append(h.timers, ft)
+		return ft
+	}
+	return d, h
+}
+
+// fire runs the most recent timer if it hasn't been stopped
+func (h *harness) fire(t *testing.T) {
+	t.Helper()
+	require.NotEmpty(t, h.timers, "a timer should be pending")
+	ft := h.timers[len(h.timers)-1]
+	require.False(t, ft.stopped, "latest timer should not be stopped")
+	ft.f()
+}
+
+// change moves a thing from one status to another a second after the last change
+func (h *harness) change(d *Detector, from, to types.Status) {
+	h.now = h.now.Add(time.Second)
+	d.Observe(context.Background(), types.Transition{
+		Thing:    &types.StatusThing{ID: "abc", Name: "api", Status: to},
+		Previous: from,
+		At:       h.now,
+	})
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	_, err := New(nil)
+	require.Error(t, err, "next is required")
+	noop := func(context.Context, types.Transition) {}
+	_, err = New(noop, WithDwell(-time.Second))
+	require.Error(t, err)
+	_, err = New(noop, WithFlapping(0, 3))
+	require.Error(t, err)
+	_, err = New(noop, WithFlapping(time.Minute, 1))
+	require.Error(t, err)
+}
+
+func TestPassthrough(t *testing.T) {
+	t.Parallel()
+	d, h := newHarness(t)
+	h.change(d, types.StatusUnknown, types.StatusGreen)
+	h.change(d, types.StatusGreen, types.StatusRed)
+	require.Len(t, h.published, 2, "changes should be published immediately without options")
+	require.Equal(t, types.StatusGreen, h.published[1].Previous)
+	require.Empty(t, h.timers)
+}
+
+func TestDwell(t *testing.T) {
+	t.Parallel()
+	d, h := newHarness(t, WithDwell(time.Minute))
+	h.change(d, types.StatusUnknown, types.StatusGreen)
+	require.Len(t, h.published, 1, "new things are published immediately")
+
+	// a blip that recovers within the dwell time is never published
+	h.change(d, types.StatusGreen, types.StatusRed)
+	h.change(d, types.StatusRed, types.StatusGreen)
+	require.True(t, h.timers[0].stopped, "the first timer should be replaced")
+	h.fire(t)
+	require.Len(t, h.published, 1)
+
+	// a change that sticks is published with the original time
+	h.change(d, types.StatusGreen, types.StatusYellow)
+	at := h.now
+	h.fire(t)
+	require.Len(t, h.published, 2)
+	require.Equal(t, types.StatusGreen, h.published[1].Previous)
+	require.Equal(t, types.StatusYellow, h.published[1].Thing.Status)
+	require.Equal(t, at, h.published[1].At)
+}
+
+func TestFlapping(t *testing.T) {
+	t.Parallel()
+	d, h := newHarness(t, WithFlapping(time.Minute, 3))
+	h.change(d, types.StatusUnknown, types.StatusGreen)
+	h.change(d, types.StatusGreen, types.StatusRed)
+	h.change(d, types.StatusRed, types.StatusGreen)
+	require.Len(t, h.published, 3, "changes below the threshold are published")
+	require.False(t, d.Flapping("abc"))
+
+	h.change(d, types.StatusGreen, types.StatusRed)
+	require.True(t, d.Flapping("abc"))
+	h.change(d, types.StatusRed, types.StatusGreen)
+	h.change(d, types.StatusGreen, types.StatusYellow)
+	require.Len(t, h.published, 3, "nothing is published while flapping")
+
+	// a quiet window ends the flapping and publishes the final status
+	h.fire(t)
+	require.False(t, d.Flapping("abc"))
+	require.Len(t, h.published, 4)
+	require.Equal(t, types.StatusGreen, h.published[3].Previous)
+	require.Equal(t, types.StatusYellow, h.published[3].Thing.Status)
+	require.False(t, d.Flapping("unknown"))
+}
+
+func TestStop(t *testing.T) {
+	t.Parallel()
+	d, h := newHarness(t, WithDwell(time.Minute))
+	h.change(d, types.StatusUnknown, types.StatusGreen)
+	h.change(d, types.StatusGreen, types.StatusRed)
+	require.Len(t, h.published, 1)
+
+	d.Stop()
+	require.True(t, h.timers[len(h.timers)-1].stopped, "pending timers should be stopped")
+	// a timer that was already firing when we stopped
+	h.timers[len(h.timers)-1].f()
+	h.change(d, types.StatusRed, types.StatusYellow)
+	require.Len(t, h.published, 1, "nothing should be published once stopped")
+}
+
+func TestStaleTimer(t *testing.T) {
+	t.Parallel()
+	d, h := newHarness(t, WithDwell(time.Minute))
+	h.change(d, types.StatusUnknown, types.StatusGreen)
+	h.change(d, types.StatusGreen, types.StatusRed)
+	h.change(d, types.StatusRed, types.StatusYellow)
+	require.Len(t, h.timers, 2)
+
+	// the first timer was already running its callback when it was replaced
+	h.timers[0].f()
+	require.Len(t, h.published, 1, "a replaced timer should not publish early")
+	h.fire(t)
+	require.Len(t, h.published, 2, "the replacement timer should still publish")
+	require.Equal(t, types.StatusYellow, h.published[1].Thing.Status)
+}
+
+func TestForget(t *testing.T) {
+	t.Parallel()
+	d, h := newHarness(t, WithFlapping(time.Minute, 2))
+	h.change(d, types.StatusUnknown, types.StatusGreen)
+	h.change(d, types.StatusGreen, types.StatusRed)
+	h.change(d, types.StatusRed, types.StatusGreen)
+	require.True(t, d.Flapping("abc"))
+
+	d.Forget(context.Background(), "abc")
+	require.Empty(t, d.things, "removed things should not be kept")
+	require.False(t, d.Flapping("abc"))
+	require.True(t, h.timers[len(h.timers)-1].stopped, "anything pending should be cancelled")
+	h.timers[len(h.timers)-1].f()
+	require.Len(t, h.published, 2, "nothing should be published for a forgotten thing")
+	d.Forget(context.Background(), "unknown")
+}
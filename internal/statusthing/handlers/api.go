@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -11,109 +12,129 @@ import (
 	chi "github.com/go-chi/chi/v5"
 
 	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
 	"github.com/lusis/apithings/internal/statusthing/types"
 
 	"golang.org/x/exp/slog"
 )
 
 func (h *StatusThingHandler) addAPIRoutes(r chi.Router) {
-	// add in some middleware for checking auth and content-type
+	// preflight requests have no api key or content-type so cors is handled first
+	if h.cors != nil {
+		r.Use(h.handleCORS)
+	}
+	// add in some middleware for checking auth
 	r.Use(func(handler http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// check for api key if required
-			if h.apikey != "" {
-				if r.Header.Get("X-STATUSTHING-KEY") != h.apikey {
-					http.Error(w, "permission denied", http.StatusForbidden)
-					return
-				}
+			// addresses are limited before auth so guessing api keys is limited too
+			if !h.limitByIP(w, r) {
+				return
 			}
-			// check for content-type
-			if r.Header.Get(contentTypeHeader) != applicationJSON {
-				http.Error(w, "invalid content type", http.StatusBadRequest)
+			// check for an api key or client certificate if required
+			if h.requiresAuth() && !h.authorized(r, false) {
+				writeError(r.Context(), w, http.StatusForbidden, codePermissionDenied, "permission denied")
+				return
+			}
+			if !h.limitByAPIKey(w, r) {
 				return
 			}
 			handler.ServeHTTP(w, r)
 		})
 	})
+	r.Use(negotiateJSON)
+
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeError(r.Context(), w, http.StatusNotFound, codeNotFound, "not found")
+	})
+
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeError(r.Context(), w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "method not allowed")
+	})
 
 	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
-		h.getall(r.Context(), w)
+		h.getall(r.Context(), r.Header.Get(ifNoneMatchHeader), w)
 	})
 
 	r.Post("/", func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get(contentTypeHeader) != applicationJSON {
-			http.Error(w, "invalid content type", http.StatusBadRequest)
-			return
-		}
-		h.post(r.Context(), r.Body, w)
+		h.post(r.Context(), http.MaxBytesReader(w, r.Body, h.maxBodyBytes), w)
 	})
 
 	r.Put("/{thingID}", func(w http.ResponseWriter, r *http.Request) {
-		if r.Header.Get(contentTypeHeader) != applicationJSON {
-			http.Error(w, "invalid content type", http.StatusBadRequest)
-			return
-		}
 		thingID := chi.URLParam(r, "thingID")
-		h.put(r.Context(), thingID, r.Body, w)
+		h.put(r.Context(), thingID, r.Header.Get(ifMatchHeader), http.MaxBytesReader(w, r.Body, h.maxBodyBytes), w)
 	})
 
 	r.Get("/{thingID}", func(w http.ResponseWriter, r *http.Request) {
 		thingID := chi.URLParam(r, "thingID")
-		h.get(r.Context(), thingID, w)
+		h.get(r.Context(), thingID, r.Header.Get(ifNoneMatchHeader), w)
 	})
 
+	if h.uptime != nil {
+		r.Get("/{thingID}/uptime", func(w http.ResponseWriter, r *http.Request) {
+			h.getUptime(w, r, chi.URLParam(r, "thingID"))
+		})
+	}
+
 	r.Delete("/{thingID}", func(w http.ResponseWriter, r *http.Request) {
 		thingID := chi.URLParam(r, "thingID")
-		h.delete(r.Context(), thingID, w)
+		h.delete(r.Context(), thingID, r.Header.Get(ifMatchHeader), w)
 	})
 }
 
 // getall gets all known things
-func (h *StatusThingHandler) getall(ctx context.Context, w http.ResponseWriter) {
+func (h *StatusThingHandler) getall(ctx context.Context, ifNoneMatch string, w http.ResponseWriter) {
 	all, err := h.provider.All(ctx)
 	if err != nil {
 		slog.ErrorCtx(ctx, "error getting all results", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
 		return
 	}
 
 	res := []*httpRepresentation{}
 	for _, i := range all {
-		res = append(res, &httpRepresentation{
-			ID:          i.ID,
-			Description: i.Description,
-			Name:        i.Name,
-			Status:      i.Status.String(),
-		})
+		res = append(res, h.toHTTPRepresentation(i))
 	}
-	if err := json.NewEncoder(w).Encode(res); err != nil {
+	// the collection has no version of its own so we encode first and derive the etag from the body
+	buf := &bytes.Buffer{}
+	if err := json.NewEncoder(buf).Encode(res); err != nil {
 		slog.ErrorCtx(ctx, "encoding error", "err", err)
-		http.Error(w, "encoding error", http.StatusInternalServerError)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "encoding error")
+		return
+	}
+	etag := bodyETag(buf.Bytes())
+	w.Header().Set(etagHeader, etag)
+	if noneMatch(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
 		return
 	}
+	if _, err := buf.WriteTo(w); err != nil {
+		slog.ErrorCtx(ctx, "unable to write response", "err", err)
+	}
 }
 
 // get returns a statusthing by id
-func (h *StatusThingHandler) get(ctx context.Context, id string, w http.ResponseWriter) {
+func (h *StatusThingHandler) get(ctx context.Context, id string, ifNoneMatch string, w http.ResponseWriter) {
 	res, err := h.provider.Get(ctx, id)
-	if err == types.ErrNotFound {
-		http.Error(w, "not found", http.StatusNotFound)
+	if errors.Is(err, types.ErrNotFound) {
+		writeError(ctx, w, http.StatusNotFound, codeNotFound, "not found")
 		return
 	}
 	if err != nil {
 		slog.ErrorCtx(ctx, "unexpected error", "err", err)
-		http.Error(w, "unexpected error", http.StatusInternalServerError)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "unexpected error")
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(&httpRepresentation{
-		ID:          res.ID,
-		Name:        res.Name,
-		Description: res.Description,
-		Status:      res.Status.String(),
-	}); err != nil {
+	rep := h.toHTTPRepresentation(res)
+	etag := thingETag(rep)
+	w.Header().Set(etagHeader, etag)
+	if noneMatch(ifNoneMatch, etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if err := json.NewEncoder(w).Encode(rep); err != nil {
 		slog.ErrorCtx(ctx, "encoding error", "err", err)
-		http.Error(w, "encoding error", http.StatusInternalServerError)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "encoding error")
 		return
 	}
 }
@@ -122,79 +143,195 @@ func (h *StatusThingHandler) get(ctx context.Context, id string, w http.Response
 func (h *StatusThingHandler) post(ctx context.Context, body io.ReadCloser, w http.ResponseWriter) {
 	var entry = httpRepresentation{}
 	if err := json.NewDecoder(body).Decode(&entry); err != nil {
-		slog.ErrorCtx(ctx, "decoding error", "err", err)
-		http.Error(w, "bad request", http.StatusBadRequest)
+		writeDecodeError(ctx, w, err)
 		return
 	}
 
-	res, err := h.provider.Add(ctx, providers.Params{Name: entry.Name, Description: entry.Description, Status: types.StatusFromString(entry.Status)})
+	params := providers.Params{Name: entry.Name, Description: entry.Description, Status: types.StatusFromString(entry.Status)}
+	if entry.Group != nil {
+		params.Group = *entry.Group
+	}
+	res, err := h.provider.Add(ctx, params)
 	if errors.Is(err, types.ErrRequiredValueMissing) {
-		http.Error(w, fmt.Sprintf("validation failed: %s", err.Error()), http.StatusBadRequest)
+		writeValidationProblem(ctx, w, err)
 		return
 	}
 	if errors.Is(err, types.ErrAlreadyExists) {
-		http.Error(w, "service already exists with that name", http.StatusConflict)
+		writeError(ctx, w, http.StatusConflict, codeAlreadyExists, "service already exists with that name")
 		return
 	}
 	if err != nil {
 		slog.ErrorCtx(ctx, "internal error", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(&httpRepresentation{
-		ID:          res.ID,
-		Name:        res.Name,
-		Description: res.Description,
-		Status:      res.Status.String(),
-	}); err != nil {
-		slog.Error("internal error", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+	rep := h.toHTTPRepresentation(res)
+	if res.Version != 0 {
+		w.Header().Set(etagHeader, thingETag(rep))
+	}
+	if err := json.NewEncoder(w).Encode(rep); err != nil {
+		slog.ErrorCtx(ctx, "internal error", "err", err)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
 		return
 	}
 }
 
 // put provides a mechanism for updating a statusthing
-func (h *StatusThingHandler) put(ctx context.Context, id string, body io.ReadCloser, w http.ResponseWriter) {
+func (h *StatusThingHandler) put(ctx context.Context, id string, ifMatch string, body io.ReadCloser, w http.ResponseWriter) {
 	var entry = httpRepresentation{}
 	if err := json.NewDecoder(body).Decode(&entry); err != nil {
-		slog.Error("decoding error", "err", err)
-		http.Error(w, "bad request", http.StatusBadRequest)
+		writeDecodeError(ctx, w, err)
+		return
+	}
+	opts, ok := preconditionOptions(ifMatch)
+	if !ok {
+		writePreconditionFailed(ctx, w)
+		return
+	}
+	// the description is optional on updates and applied in the same change as the status
+	if entry.Description != "" {
+		opts = append(opts, dbfilters.WithDescription(entry.Description))
+	}
+	if entry.Group != nil {
+		opts = append(opts, dbfilters.WithGroup(*entry.Group))
+	}
+	_, res, err := h.provider.SetStatus(ctx, id, types.StatusFromString(entry.Status), opts...)
+	if errors.Is(err, types.ErrNotFound) {
+		writeNotFound(ctx, w, ifMatch)
 		return
 	}
-	if err := h.provider.SetStatus(ctx, id, types.StatusFromString(entry.Status)); err != nil {
-		slog.Error("error setting status", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+	if errors.Is(err, types.ErrVersionMismatch) {
+		writePreconditionFailed(ctx, w)
 		return
 	}
+	if errors.Is(err, types.ErrRequiredValueMissing) {
+		writeValidationProblem(ctx, w, err)
+		return
+	}
+	if err != nil {
+		slog.ErrorCtx(ctx, "error setting status", "err", err)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
+		return
+	}
+	// return the new version so callers can make another conditional change without getting it first
+	// this is the row the update produced rather than a later read that might include another change
+	rep := h.toHTTPRepresentation(res)
+	w.Header().Set(etagHeader, thingETag(rep))
+	if err := json.NewEncoder(w).Encode(rep); err != nil {
+		slog.ErrorCtx(ctx, "encoding error", "err", err)
+	}
 }
 
 // delete provides a mechanism for deleting a statusthing
-func (h *StatusThingHandler) delete(ctx context.Context, id string, w http.ResponseWriter) {
+func (h *StatusThingHandler) delete(ctx context.Context, id string, ifMatch string, w http.ResponseWriter) {
+	opts, ok := preconditionOptions(ifMatch)
+	if !ok {
+		writePreconditionFailed(ctx, w)
+		return
+	}
 	existing, err := h.provider.Get(ctx, id)
 	if errors.Is(err, types.ErrNotFound) {
-		http.Error(w, "no such record", http.StatusNotFound)
+		writeNotFound(ctx, w, ifMatch)
 		return
 	}
 	if err != nil {
-		slog.Error("error getting existing record", "err", err)
-		http.Error(w, "unexpected error", http.StatusInternalServerError)
+		slog.ErrorCtx(ctx, "error getting existing record", "err", err)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "unexpected error")
+		return
+	}
+	err = h.provider.Remove(ctx, id, opts...)
+	if errors.Is(err, types.ErrNotFound) {
+		writeNotFound(ctx, w, ifMatch)
+		return
+	}
+	if errors.Is(err, types.ErrVersionMismatch) {
+		writePreconditionFailed(ctx, w)
 		return
 	}
-	if err := h.provider.Remove(ctx, id); err != nil {
+	if err != nil {
 		slog.ErrorCtx(ctx, "error removing entry", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
 		return
 	}
 
-	if err := json.NewEncoder(w).Encode(&httpRepresentation{
-		ID:          existing.ID,
-		Name:        existing.Name,
-		Description: existing.Description,
-		Status:      existing.Status.String(),
-	}); err != nil {
-		slog.Error("internal error", "err", err)
-		http.Error(w, "internal error", http.StatusInternalServerError)
+	if err := json.NewEncoder(w).Encode(h.toHTTPRepresentation(existing)); err != nil {
+		slog.ErrorCtx(ctx, "internal error", "err", err)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
 		return
 	}
 }
+
+// writeDecodeError writes the problem for a request body that could not be decoded
+func writeDecodeError(ctx context.Context, w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		writeError(ctx, w, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body must be at most %d bytes", tooLarge.Limit))
+		return
+	}
+	slog.ErrorCtx(ctx, "decoding error", "err", err)
+	writeError(ctx, w, http.StatusBadRequest, codeInvalidBody, "request body is not a valid statusthing")
+}
+
+// toHTTPRepresentation converts a [types.StatusThing] to its api representation
+func (h *StatusThingHandler) toHTTPRepresentation(thing *types.StatusThing) *httpRepresentation {
+	res := &httpRepresentation{
+		ID:          thing.ID,
+		Name:        thing.Name,
+		Description: thing.Description,
+		Status:      thing.Status.String(),
+		Version:     thing.Version,
+	}
+	if h.flapping != nil {
+		res.Flapping = h.flapping.Flapping(thing.ID)
+	}
+	if thing.Group != "" {
+		group := thing.Group
+		res.Group = &group
+	}
+	return res
+}
+
+// preconditionOptions converts an If-Match header to the options needed to enforce it
+// ok is false if the precondition can never be satisfied
+func preconditionOptions(ifMatch string) ([]dbfilters.Option, bool) {
+	version, ok := versionFromIfMatch(ifMatch)
+	if !ok {
+		return nil, false
+	}
+	if version == 0 {
+		return nil, true
+	}
+	return []dbfilters.Option{dbfilters.WithVersion(version)}, true
+}
+
+// writePreconditionFailed writes the [problem] for a failed If-Match check
+func writePreconditionFailed(ctx context.Context, w http.ResponseWriter) {
+	writeError(ctx, w, http.StatusPreconditionFailed, codePreconditionFailed, "the thing has been changed since it was last retrieved")
+}
+
+// writeNotFound writes the [problem] for a conditional change to a thing that doesn't exist
+// If-Match: * only matches an existing thing so the precondition fails instead
+func writeNotFound(ctx context.Context, w http.ResponseWriter, ifMatch string) {
+	for _, t := range splitETags(ifMatch) {
+		if t == "*" {
+			writePreconditionFailed(ctx, w)
+			return
+		}
+	}
+	writeError(ctx, w, http.StatusNotFound, codeNotFound, "no such record")
+}
+
+// writeValidationProblem writes a validation [problem] including the offending field when known
+func writeValidationProblem(ctx context.Context, w http.ResponseWriter, err error) {
+	p := &problem{
+		Status: http.StatusBadRequest,
+		Code:   codeValidationFailed,
+		Detail: fmt.Sprintf("validation failed: %s", err.Error()),
+	}
+	var verr *types.ValidationError
+	if errors.As(err, &verr) {
+		p.Field = verr.Field
+	}
+	writeProblem(ctx, w, p)
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// apiKeyHeader is the header api keys are read from
+const apiKeyHeader = "X-STATUSTHING-KEY"
+
+// defaultAPIKeyName is the name of the key provided with [WithAPIKey]
+const defaultAPIKeyName = "default"
+
+// requiresAuth reports if callers must identify themselves with an api key or client certificate
+func (h *StatusThingHandler) requiresAuth() bool {
+	h.apikeysLock.RLock()
+	defer h.apikeysLock.RUnlock()
+	return len(h.apikeys) > 0 || h.clientCertAuth
+}
+
+// authorized reports if the request has a valid api key or client certificate
+// a bearer token is only checked if allowBearer is true
+func (h *StatusThingHandler) authorized(r *http.Request, allowBearer bool) bool {
+	if _, ok := h.apiKeyName(r, allowBearer); ok {
+		return true
+	}
+	_, ok := h.clientCertSubject(r)
+	return ok
+}
+
+// apiKeyName returns the name of the api key provided with the request
+// a bearer token is only checked if allowBearer is true
+func (h *StatusThingHandler) apiKeyName(r *http.Request, allowBearer bool) (string, bool) {
+	h.apikeysLock.RLock()
+	defer h.apikeysLock.RUnlock()
+	if name, ok := h.apikeys[r.Header.Get(apiKeyHeader)]; ok {
+		return name, true
+	}
+	if allowBearer {
+		if name, ok := h.apikeys[bearerToken(r)]; ok {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// SetAPIKeys replaces the accepted api keys with keys by name i.e. to rotate them without a restart
+// every key can't be removed this way since that would stop requiring api keys altogether
+func (h *StatusThingHandler) SetAPIKeys(keys map[string]string) error {
+	byKey := make(map[string]string, len(keys))
+	for name, key := range keys {
+		if name == "" || key == "" {
+			return fmt.Errorf("api key names and keys cannot be empty")
+		}
+		if existing, ok := byKey[key]; ok {
+			return fmt.Errorf("key %s is the same as key %s", name, existing)
+		}
+		byKey[key] = name
+	}
+	h.apikeysLock.Lock()
+	defer h.apikeysLock.Unlock()
+	if len(byKey) == 0 && len(h.apikeys) > 0 {
+		return fmt.Errorf("api keys are required so at least one must be provided")
+	}
+	h.apikeys = byKey
+	return nil
+}
+
+// clientCertSubject returns the common name of the request's verified client certificate
+// the tls config is responsible for verifying the certificate so unverified certificates are ignored
+func (h *StatusThingHandler) clientCertSubject(r *http.Request) (string, bool) {
+	if !h.clientCertAuth || r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return "", false
+	}
+	cn := r.TLS.VerifiedChains[0][0].Subject.CommonName
+	if len(h.clientCertSubjects) == 0 {
+		return cn, true
+	}
+	_, ok := h.clientCertSubjects[cn]
+	return cn, ok
+}
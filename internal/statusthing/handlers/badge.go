@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"html"
+	"net/http"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+	"github.com/lusis/apithings/internal/statusthing/uptime"
+
+	"golang.org/x/exp/slog"
+)
+
+// badgePath is where badges are served under the base path
+const badgePath = "/badge"
+
+const (
+	svgContentType     = "image/svg+xml"
+	cacheControlHeader = "Cache-Control"
+	// badgeMaxAge is how long badge consumers i.e. github's image proxy may cache a badge
+	badgeMaxAge = "max-age=60"
+)
+
+// badgeColors are the shields.io colours for each status
+var badgeColors = map[types.Status]string{
+	types.StatusGreen:  "#4c1",
+	types.StatusYellow: "#dfb317",
+	types.StatusRed:    "#e05d44",
+}
+
+const badgeUnknownColor = "#9f9f9f"
+
+// badgeMessages are the words shown for each status
+var badgeMessages = map[types.Status]string{
+	types.StatusGreen:  "up",
+	types.StatusYellow: "degraded",
+	types.StatusRed:    "down",
+}
+
+// badgeTemplate is a flat shields style badge
+var badgeTemplate = template.Must(template.New("badge").Parse(`<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="20" role="img" aria-label="{{.Label}}: {{.Message}}">
+<title>{{.Label}}: {{.Message}}</title>
+<linearGradient id="s" x2="0" y2="100%"><stop offset="0" stop-color="#bbb" stop-opacity=".1"/><stop offset="1" stop-opacity=".1"/></linearGradient>
+<clipPath id="r"><rect width="{{.Width}}" height="20" rx="3" fill="#fff"/></clipPath>
+<g clip-path="url(#r)"><rect width="{{.LabelWidth}}" height="20" fill="#555"/><rect x="{{.LabelWidth}}" width="{{.MessageWidth}}" height="20" fill="{{.Color}}"/><rect width="{{.Width}}" height="20" fill="url(#s)"/></g>
+<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" font-size="11">
+<text x="{{.LabelX}}" y="15" fill="#010101" fill-opacity=".3">{{.Label}}</text><text x="{{.LabelX}}" y="14">{{.Label}}</text>
+<text x="{{.MessageX}}" y="15" fill="#010101" fill-opacity=".3">{{.Message}}</text><text x="{{.MessageX}}" y="14">{{.Message}}</text>
+</g>
+</svg>
+`))
+
+// badge is the data used to render a badge
+type badge struct {
+	Label        string
+	Message      string
+	Color        string
+	LabelWidth   int
+	MessageWidth int
+}
+
+// Width is the total width of the badge
+func (b badge) Width() int { return b.LabelWidth + b.MessageWidth }
+
+// LabelX is the centre of the label
+func (b badge) LabelX() int { return b.LabelWidth / 2 }
+
+// MessageX is the centre of the message
+func (b badge) MessageX() int { return b.LabelWidth + b.MessageWidth/2 }
+
+// newBadge returns a badge sized for its text
+// label and message are escaped here since svg is xml and text/template doesn't know that
+func newBadge(label, message, color string) badge {
+	return badge{
+		Label:        html.EscapeString(label),
+		Message:      html.EscapeString(message),
+		Color:        color,
+		LabelWidth:   textWidth(label),
+		MessageWidth: textWidth(message),
+	}
+}
+
+// textWidth approximates the rendered width of 11px verdana plus padding
+// we don't have font metrics so this errs on the wide side
+func textWidth(s string) int {
+	return len([]rune(s))*7 + 10
+}
+
+// thingBadge returns the badge for a thing
+// detail is appended to the status i.e. the uptime
+func thingBadge(thing *types.StatusThing, detail string) badge {
+	color, ok := badgeColors[thing.Status]
+	if !ok {
+		color = badgeUnknownColor
+	}
+	message, ok := badgeMessages[thing.Status]
+	if !ok {
+		message = "unknown"
+	}
+	if detail != "" {
+		message += " " + detail
+	}
+	return newBadge(thing.Name, message, color)
+}
+
+// addBadgeRoutes adds the public badge routes
+func (h *StatusThingHandler) addBadgeRoutes(r chi.Router) {
+	// names can contain dots so we match the whole filename and strip the extension ourselves
+	r.Get(path.Join(h.basePath, badgePath, "{file}"), func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		name, ok := strings.CutSuffix(chi.URLParam(r, "file"), ".svg")
+		if !ok || name == "" {
+			writeError(ctx, w, http.StatusNotFound, codeNotFound, "not found")
+			return
+		}
+		thing, err := h.thingByName(ctx, name)
+		if err != nil {
+			slog.ErrorCtx(ctx, "error getting thing for badge", "err", err)
+			writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
+			return
+		}
+		if thing == nil {
+			// still render something so embedded images show why they are broken
+			h.writeBadge(ctx, w, r, http.StatusNotFound, newBadge(name, "not found", badgeUnknownColor))
+			return
+		}
+		detail := ""
+		// i.e. ?uptime=30d
+		if window := r.URL.Query().Get("uptime"); window != "" && h.uptime != nil {
+			d, err := uptime.ParseWindow(window)
+			if err != nil {
+				writeValidationProblem(ctx, w, types.NewValidationError("uptime", err.Error()))
+				return
+			}
+			now := time.Now().UTC()
+			report, err := h.uptime.Calculate(ctx, thing, now.Add(-d), now)
+			if !uptimeCalculated(ctx, w, err) {
+				return
+			}
+			if report.Known > 0 {
+				detail = formatUptime(report.Uptime)
+			}
+		}
+		h.writeBadge(ctx, w, r, http.StatusOK, thingBadge(thing, detail))
+	})
+}
+
+// thingByName returns the thing with the name or nil if there isn't one
+func (h *StatusThingHandler) thingByName(ctx context.Context, name string) (*types.StatusThing, error) {
+	all, err := h.provider.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, thing := range all {
+		if thing.Name == name {
+			return thing, nil
+		}
+	}
+	return nil, nil
+}
+
+// writeBadge renders a badge with cache headers
+func (h *StatusThingHandler) writeBadge(ctx context.Context, w http.ResponseWriter, r *http.Request, status int, b badge) {
+	buf := &bytes.Buffer{}
+	if err := badgeTemplate.Execute(buf, b); err != nil {
+		slog.ErrorCtx(ctx, "error executing badge template", "err", err)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
+		return
+	}
+	etag := bodyETag(buf.Bytes())
+	w.Header().Set(contentTypeHeader, svgContentType)
+	w.Header().Set(cacheControlHeader, badgeMaxAge)
+	w.Header().Set(etagHeader, etag)
+	if status == http.StatusOK && noneMatch(r.Header.Get(ifNoneMatchHeader), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.WriteHeader(status)
+	if _, err := buf.WriteTo(w); err != nil {
+		slog.ErrorCtx(ctx, "unable to write response", "err", err)
+	}
+}
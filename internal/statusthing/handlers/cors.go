@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS allows browsers on other origins to call the api
+type CORS struct {
+	// AllowedOrigins are the origins allowed to call the api i.e. https://status.example.com
+	// * allows any origin
+	AllowedOrigins []string
+	// AllowedMethods default to GET, POST, PUT and DELETE
+	AllowedMethods []string
+	// AllowedHeaders are request headers browsers may send
+	// they default to the headers the api uses including the api key header
+	AllowedHeaders []string
+	// MaxAge is how long browsers may cache preflight responses if set
+	MaxAge time.Duration
+}
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+	defaultCORSHeaders = []string{contentTypeHeader, "accept", apiKeyHeader, ifMatchHeader, ifNoneMatchHeader, RequestIDHeader}
+	// corsExposedHeaders are response headers browsers let scripts read
+	corsExposedHeaders = strings.Join([]string{etagHeader, RequestIDHeader, retryAfterHeader}, ", ")
+)
+
+// cors is a validated [CORS] with lookups for checking requests
+type cors struct {
+	anyOrigin bool
+	origins   map[string]struct{}
+	methods   map[string]struct{}
+	headers   map[string]struct{}
+	// allowMethods and allowHeaders are sent in response to preflight requests
+	allowMethods string
+	allowHeaders string
+	maxAge       string
+}
+
+func newCORS(c CORS) (*cors, error) {
+	if len(c.AllowedOrigins) == 0 {
+		return nil, fmt.Errorf("at least one allowed origin must be provided")
+	}
+	res := &cors{
+		origins: make(map[string]struct{}),
+		methods: make(map[string]struct{}),
+		headers: make(map[string]struct{}),
+	}
+	for _, o := range c.AllowedOrigins {
+		if o == "" {
+			return nil, fmt.Errorf("allowed origins cannot be empty")
+		}
+		if o == "*" {
+			res.anyOrigin = true
+			continue
+		}
+		// origins never have a trailing slash
+		res.origins[strings.ToLower(strings.TrimSuffix(o, "/"))] = struct{}{}
+	}
+	allowed := c.AllowedMethods
+	if len(allowed) == 0 {
+		allowed = defaultCORSMethods
+	}
+	methods := make([]string, 0, len(allowed))
+	for _, m := range allowed {
+		m = strings.ToUpper(m)
+		methods = append(methods, m)
+		res.methods[m] = struct{}{}
+	}
+	headers := c.AllowedHeaders
+	if len(headers) == 0 {
+		headers = defaultCORSHeaders
+	}
+	for _, h := range headers {
+		res.headers[http.CanonicalHeaderKey(h)] = struct{}{}
+	}
+	res.allowMethods = strings.Join(methods, ", ")
+	res.allowHeaders = strings.Join(headers, ", ")
+	if c.MaxAge < 0 {
+		return nil, fmt.Errorf("max age cannot be negative")
+	}
+	if c.MaxAge > 0 {
+		res.maxAge = strconv.Itoa(int(c.MaxAge.Seconds()))
+	}
+	return res, nil
+}
+
+// allowedOrigin reports if origin may call the api
+func (c *cors) allowedOrigin(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+	_, ok := c.origins[strings.ToLower(origin)]
+	return ok
+}
+
+// allowedHeaders reports if every header in a preflight's comma separated list of headers is allowed
+func (c *cors) allowedHeaders(requested string) bool {
+	for _, h := range strings.Split(requested, ",") {
+		if h = strings.TrimSpace(h); h == "" {
+			continue
+		}
+		if _, ok := c.headers[http.CanonicalHeaderKey(h)]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// handleCORS is middleware that answers preflight requests and adds cors headers to requests from allowed origins
+// it runs before auth since browsers never send credentials with a preflight
+func (h *StatusThingHandler) handleCORS(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		if origin == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		if !h.cors.allowedOrigin(origin) {
+			if preflight {
+				writeError(r.Context(), w, http.StatusForbidden, codePermissionDenied, "origin not allowed")
+				return
+			}
+			// without cors headers the browser won't let the caller read the response
+			next.ServeHTTP(w, r)
+			return
+		}
+		allowOrigin := origin
+		if h.cors.anyOrigin {
+			allowOrigin = "*"
+		}
+		w.Header().Set("Access-Control-Allow-Origin", allowOrigin)
+		if !preflight {
+			w.Header().Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+		w.Header().Add("Vary", "Access-Control-Request-Method")
+		w.Header().Add("Vary", "Access-Control-Request-Headers")
+		if _, ok := h.cors.methods[strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))]; !ok {
+			writeError(r.Context(), w, http.StatusForbidden, codePermissionDenied, "method not allowed for cross-origin requests")
+			return
+		}
+		if !h.cors.allowedHeaders(r.Header.Get("Access-Control-Request-Headers")) {
+			writeError(r.Context(), w, http.StatusForbidden, codePermissionDenied, "headers not allowed for cross-origin requests")
+			return
+		}
+		w.Header().Set("Access-Control-Allow-Methods", h.cors.allowMethods)
+		w.Header().Set("Access-Control-Allow-Headers", h.cors.allowHeaders)
+		if h.cors.maxAge != "" {
+			w.Header().Set("Access-Control-Max-Age", h.cors.maxAge)
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
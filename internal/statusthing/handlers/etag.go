@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	etagHeader        = "ETag"
+	ifMatchHeader     = "If-Match"
+	ifNoneMatchHeader = "If-None-Match"
+)
+
+// flappingSuffix is added to the version in the etag of a thing that is flapping
+// flapping isn't stored with the thing so it doesn't change the version
+const flappingSuffix = "-flapping"
+
+// versionETag returns the strong etag for a thing at the provided version
+func versionETag(version int64) string {
+	return fmt.Sprintf("%q", strconv.FormatInt(version, 10))
+}
+
+// thingETag returns the strong etag for the representation of a thing
+// the version alone would let caches keep a stale flapping state
+func thingETag(rep *httpRepresentation) string {
+	if rep.Flapping {
+		return fmt.Sprintf("%q", strconv.FormatInt(rep.Version, 10)+flappingSuffix)
+	}
+	return versionETag(rep.Version)
+}
+
+// bodyETag returns a strong etag derived from the contents of a response body
+// this is used for collections which have no version of their own
+func bodyETag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf("%q", hex.EncodeToString(sum[:16]))
+}
+
+// splitETags splits a comma separated list of etags from a conditional header
+func splitETags(header string) []string {
+	tags := []string{}
+	for _, t := range strings.Split(header, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// noneMatch reports if an If-None-Match header matches the current etag
+// If-None-Match uses weak comparison so any W/ prefix is ignored
+func noneMatch(header, etag string) bool {
+	for _, t := range splitETags(header) {
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// versionFromIfMatch returns the version requested by an If-Match header
+// a version of 0 means the header was empty or "*" and any version is acceptable
+// ok is false if the header could never match a version we would have generated
+func versionFromIfMatch(header string) (version int64, ok bool) {
+	tags := splitETags(header)
+	if len(tags) == 0 {
+		return 0, true
+	}
+	// we can only check a single version atomically
+	if len(tags) != 1 {
+		return 0, false
+	}
+	if tags[0] == "*" {
+		return 0, true
+	}
+	// If-Match uses strong comparison so weak etags never match
+	unquoted, err := strconv.Unquote(tags[0])
+	if err != nil || strings.HasPrefix(tags[0], "W/") {
+		return 0, false
+	}
+	// the thing's version is all that is checked so its flapping state doesn't matter
+	unquoted, _ = strings.CutSuffix(unquoted, flappingSuffix)
+	v, err := strconv.ParseInt(unquoted, 10, 64)
+	if err != nil || v <= 0 {
+		return 0, false
+	}
+	return v, true
+}
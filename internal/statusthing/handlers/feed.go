@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"path"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/types"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	atomPath        = "/feed.atom"
+	rssPath         = "/feed.rss"
+	atomContentType = "application/atom+xml"
+	rssContentType  = "application/rss+xml"
+	// feedLimit is the number of changes included in a feed
+	feedLimit = 50
+	feedTitle = "statusthing"
+	// feedID identifies the feed when there is no public url to use
+	feedID = "urn:statusthing:feed"
+)
+
+// History provides the history of status changes
+type History interface {
+	// GetTransitions gets recorded status changes newest first
+	GetTransitions(ctx context.Context, opts ...dbfilters.Option) ([]types.Transition, error)
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	Title   string      `xml:"title"`
+	ID      string      `xml:"id"`
+	Updated string      `xml:"updated"`
+	Link    atomLink    `xml:"link"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Title   string   `xml:"title"`
+	ID      string   `xml:"id"`
+	Updated string   `xml:"updated"`
+	Link    atomLink `xml:"link"`
+	Summary string   `xml:"summary"`
+}
+
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate"`
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+// feedEntry is what atom and rss have in common for a single change
+type feedEntry struct {
+	id      string
+	title   string
+	summary string
+	at      time.Time
+}
+
+func newFeedEntry(t types.Transition) feedEntry {
+	e := feedEntry{
+		// ids of recorded changes are never reused
+		id:    fmt.Sprintf("urn:statusthing:transition:%d", t.ID),
+		title: fmt.Sprintf("%s is %s", t.Thing.Name, statusWord(t.Thing.Status)),
+		at:    t.At,
+	}
+	switch {
+	case t.DescriptionUpdate():
+		e.title = fmt.Sprintf("Update on %s", t.Thing.Name)
+		e.summary = fmt.Sprintf("%s is still %s", t.Thing.Name, statusWord(t.Thing.Status))
+	case t.Previous == types.StatusUnknown:
+		e.summary = fmt.Sprintf("%s was added as %s", t.Thing.Name, statusWord(t.Thing.Status))
+	default:
+		e.summary = fmt.Sprintf("%s changed from %s to %s", t.Thing.Name, statusWord(t.Previous), statusWord(t.Thing.Status))
+	}
+	if t.Thing.Description != "" {
+		e.summary += ": " + t.Thing.Description
+	}
+	return e
+}
+
+// statusWord is the human readable word for a status
+func statusWord(s types.Status) string {
+	if word, ok := badgeMessages[s]; ok {
+		return word
+	}
+	return "unknown"
+}
+
+func (h *StatusThingHandler) addFeedRoutes(r chi.Router) {
+	r.Get(path.Join(h.basePath, atomPath), func(w http.ResponseWriter, r *http.Request) {
+		h.feed(w, r, atomContentType, atom)
+	})
+	r.Get(path.Join(h.basePath, rssPath), func(w http.ResponseWriter, r *http.Request) {
+		h.feed(w, r, rssContentType, rss)
+	})
+}
+
+// feedFunc builds a feed document for the entries
+type feedFunc func(id, link string, entries []feedEntry) any
+
+// feed writes a feed of recent changes optionally filtered by thing name or group
+func (h *StatusThingHandler) feed(w http.ResponseWriter, r *http.Request, contentType string, build feedFunc) {
+	ctx := r.Context()
+	// feeds only list what made it through flap detection like notifications and description updates
+	opts := []dbfilters.Option{dbfilters.WithPublished(), dbfilters.WithLimit(feedLimit)}
+	if thing := r.URL.Query().Get("thing"); thing != "" {
+		opts = append(opts, dbfilters.WithName(thing))
+	}
+	if group := r.URL.Query().Get("group"); group != "" {
+		opts = append(opts, dbfilters.WithGroup(group))
+	}
+	transitions, err := h.history.GetTransitions(ctx, opts...)
+	if err != nil {
+		slog.ErrorCtx(ctx, "error getting history", "err", err)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
+		return
+	}
+	entries := make([]feedEntry, 0, len(transitions))
+	for _, t := range transitions {
+		entries = append(entries, newFeedEntry(t))
+	}
+
+	buf := &bytes.Buffer{}
+	buf.WriteString(xml.Header)
+	if err := xml.NewEncoder(buf).Encode(build(h.feedID(), h.dashboardURL(), entries)); err != nil {
+		slog.ErrorCtx(ctx, "encoding error", "err", err)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "encoding error")
+		return
+	}
+	etag := bodyETag(buf.Bytes())
+	w.Header().Set(contentTypeHeader, contentType)
+	w.Header().Set(etagHeader, etag)
+	if noneMatch(r.Header.Get(ifNoneMatchHeader), etag) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	if _, err := buf.WriteTo(w); err != nil {
+		slog.ErrorCtx(ctx, "unable to write response", "err", err)
+	}
+}
+
+// dashboardURL is the url of the dashboard
+// request headers can't be trusted to build it so it is relative to the server unless a public url is configured
+func (h *StatusThingHandler) dashboardURL() string {
+	if h.publicURL != "" {
+		return h.publicURL + "/"
+	}
+	return path.Join(h.basePath, "/") + "/"
+}
+
+// feedID identifies the feed and doesn't change with how the feed was requested
+func (h *StatusThingHandler) feedID() string {
+	if h.publicURL != "" {
+		return h.dashboardURL()
+	}
+	return feedID
+}
+
+// atom builds an atom feed
+func atom(id, link string, entries []feedEntry) any {
+	feed := &atomFeed{
+		Title:   feedTitle,
+		ID:      id,
+		Link:    atomLink{Href: link},
+		Author:  atomAuthor{Name: feedTitle},
+		Updated: time.Unix(0, 0).UTC().Format(time.RFC3339),
+		Entries: []atomEntry{},
+	}
+	if len(entries) > 0 {
+		feed.Updated = entries[0].at.UTC().Format(time.RFC3339)
+	}
+	for _, e := range entries {
+		feed.Entries = append(feed.Entries, atomEntry{
+			Title:   e.title,
+			ID:      e.id,
+			Updated: e.at.UTC().Format(time.RFC3339),
+			Link:    atomLink{Href: link},
+			Summary: e.summary,
+		})
+	}
+	return feed
+}
+
+// rss builds an rss 2.0 feed
+func rss(_, link string, entries []feedEntry) any {
+	channel := rssChannel{
+		Title:       feedTitle,
+		Link:        link,
+		Description: "recent status changes",
+		Items:       []rssItem{},
+	}
+	if len(entries) > 0 {
+		channel.LastBuildDate = entries[0].at.UTC().Format(time.RFC1123Z)
+	}
+	for _, e := range entries {
+		channel.Items = append(channel.Items, rssItem{
+			Title:       e.title,
+			Link:        link,
+			Description: e.summary,
+			GUID:        rssGUID{Value: e.id},
+			PubDate:     e.at.UTC().Format(time.RFC1123Z),
+		})
+	}
+	return &rssFeed{Version: "2.0", Channel: channel}
+}
@@ -6,11 +6,18 @@ import (
 	"io/fs"
 	"net/http"
 	"path"
+	"sync"
 
 	"github.com/lusis/apithings/internal/static"
+	"github.com/lusis/apithings/internal/statusthing/metrics"
 	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/ratelimit"
+	"github.com/lusis/apithings/internal/statusthing/receivers"
+	"github.com/lusis/apithings/internal/statusthing/tracing"
 	"github.com/lusis/apithings/internal/statusthing/ui/templates"
 
+	"go.opentelemetry.io/otel/trace"
+
 	"golang.org/x/exp/slog"
 
 	chi "github.com/go-chi/chi/v5"
@@ -24,6 +31,7 @@ const (
 var siteTemplates = []string{
 	"index.htmx",
 	"card.htmx",
+	"subscription.htmx",
 }
 
 // StatusThingHandler is a struct that provides an http access for statusthings
@@ -35,34 +43,105 @@ type StatusThingHandler struct {
 	// basePath is the path where the handler is mounted
 	basePath string
 
-	apikey string
+	// apikeys are the names of the accepted api keys by key
+	// they can be replaced while serving so access them with apikeysLock held
+	apikeys     map[string]string
+	apikeysLock sync.RWMutex
+
+	// clientCertAuth accepts verified client certificates in place of an api key
+	clientCertAuth bool
+	// clientCertSubjects limits the accepted client certificates by common name if not empty
+	clientCertSubjects map[string]struct{}
+
+	// cors allows cross-origin api requests if provided
+	cors *cors
+
+	// ipLimiter limits api requests by client address if provided
+	ipLimiter *ratelimit.Limiter
+	// apiKeyLimiter limits api requests by api key or client certificate if provided
+	apiKeyLimiter *ratelimit.Limiter
+	// maxBodyBytes is the largest request body the api decodes
+	maxBodyBytes int64
+
+	// accessLog logs every request if provided
+	accessLog *slog.Logger
+
+	// metrics are served at /metrics if provided
+	metrics *metrics.Metrics
+
+	// receivers are webhook receivers by name
+	receivers map[string]receivers.Receiver
+
+	// subscriptions are served if provided
+	subscriptions Subscriptions
+	// subscribeLimiter limits new subscriptions by client address
+	subscribeLimiter *ratelimit.Limiter
+
+	// flapping marks things that are flapping if provided
+	flapping FlapDetector
+
+	// history is used for feeds if provided
+	history History
+	// publicURL is where the base path can be reached from outside if it is known
+	publicURL string
+	// noDashboard skips the dashboard routes
+	noDashboard bool
+
+	// uptime is served and shown on the dashboard if provided
+	uptime Uptime
+
+	// tracerProvider traces requests if provided
+	tracerProvider trace.TracerProvider
+
+	// readinessChecks must all pass for the handler to report it is ready
+	readinessChecks map[string]ReadinessCheck
 
 	templates map[string]*template.Template
 }
 
+// FlapDetector reports if a thing is flapping
+type FlapDetector interface {
+	Flapping(id string) bool
+}
+
 type httpRepresentation struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
-	Status      string `json:"status"`
+	// Group is a pointer so updates can distinguish between leaving the group alone and removing it
+	Group   *string `json:"group,omitempty"`
+	Status  string  `json:"status"`
+	Version int64   `json:"version"`
+	// Flapping is set when the thing keeps changing status
+	Flapping bool `json:"flapping,omitempty"`
 }
 
 const applicationJSON = "application/json"
 const textHTML = "text/html"
 const contentTypeHeader = "content-type"
 
+// metricsPath is where metrics are served regardless of the base path
+const metricsPath = "/metrics"
+
 // NewStatusThingHandler returns a new statusthing handler
 func NewStatusThingHandler(provider providers.Provider, opts ...HandlerOption) (*StatusThingHandler, error) {
 	if provider == nil {
 		return nil, fmt.Errorf("provider cannot be nil")
 	}
 	mux := chi.NewRouter()
+	mux.Use(requestID)
 
 	sth := &StatusThingHandler{
 		basePath:  DefaultBasePath,
 		provider:  provider,
 		templates: make(map[string]*template.Template),
+		receivers: make(map[string]receivers.Receiver),
+		apikeys:   make(map[string]string),
 		mux:       mux,
+
+		maxBodyBytes: defaultMaxBodyBytes,
+
+		readinessChecks: make(map[string]ReadinessCheck),
 	}
 
 	for _, opt := range opts {
@@ -71,6 +150,21 @@ func NewStatusThingHandler(provider providers.Provider, opts ...HandlerOption) (
 		}
 	}
 
+	// tracing is added before metrics so request spans cover the whole request
+	if sth.tracerProvider != nil {
+		mux.Use(tracing.Middleware(sth.tracerProvider))
+	}
+	if sth.accessLog != nil {
+		mux.Use(sth.logRequests)
+	}
+	if sth.metrics != nil {
+		mux.Use(sth.metrics.Middleware)
+		mux.Get(metricsPath, sth.metrics.ServeHTTP)
+	}
+
+	// probes are public and served regardless of the base path like metrics
+	sth.addHealthRoutes(mux)
+
 	// parse our templates
 	tmplFs := templates.UITemplateFS
 	for _, fname := range siteTemplates {
@@ -102,15 +196,42 @@ func NewStatusThingHandler(provider providers.Provider, opts ...HandlerOption) (
 	})
 
 	// ui
-	mux.Route(path.Join(sth.basePath, "/"), func(r chi.Router) {
-		sth.addUIRoutes(r)
-	})
+	if !sth.noDashboard {
+		mux.Route(path.Join(sth.basePath, "/"), func(r chi.Router) {
+			sth.addUIRoutes(r)
+		})
+	}
 
 	// api
 	mux.Route(path.Join(sth.basePath, "/api/"), func(r chi.Router) {
 		sth.addAPIRoutes(r)
 	})
 
+	// badges are public so they can be embedded anywhere
+	sth.addBadgeRoutes(mux)
+
+	// feeds
+	if sth.history != nil {
+		sth.addFeedRoutes(mux)
+	}
+
+	// email subscriptions
+	if sth.subscriptions != nil {
+		if sth.subscribeLimiter == nil {
+			if sth.subscribeLimiter, err = ratelimit.New(defaultSubscribeRate, defaultSubscribeBurst); err != nil {
+				return nil, err
+			}
+		}
+		sth.addSubscriptionRoutes(mux)
+	}
+
+	// webhooks
+	if len(sth.receivers) > 0 {
+		mux.Route(path.Join(sth.basePath, hooksPath), func(r chi.Router) {
+			sth.addHookRoutes(r)
+		})
+	}
+
 	return sth, nil
 }
 
@@ -1,17 +1,36 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/xml"
 	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	"github.com/lusis/apithings/internal/statusthing/metrics"
+	"github.com/lusis/apithings/internal/statusthing/notifiers"
 	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/ratelimit"
+	"github.com/lusis/apithings/internal/statusthing/receivers"
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
 	"github.com/lusis/apithings/internal/statusthing/types"
+	"github.com/lusis/apithings/internal/statusthing/uptime"
 	"github.com/stretchr/testify/require"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"golang.org/x/exp/slog"
 )
 
 func TestConstructor(t *testing.T) {
@@ -30,9 +49,26 @@ func TestConstructor(t *testing.T) {
 	})
 }
 
+func TestWithoutDashboard(t *testing.T) {
+	t.Parallel()
+	h, err := NewStatusThingHandler(&testProvider{
+		allFunc: func() ([]*types.StatusThing, error) { return []*types.StatusThing{}, nil },
+	}, WithoutDashboard())
+	require.NoError(t, err)
+	for p, want := range map[string]int{
+		"/statusthings/":      http.StatusNotFound,
+		"/statusthings/cards": http.StatusNotFound,
+		"/statusthings/api/":  http.StatusOK,
+	} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p, nil))
+		require.Equal(t, want, w.Result().StatusCode, p)
+	}
+}
+
 func TestInvalidContentType(t *testing.T) {
 	basePath := "/"
-	for _, m := range []string{http.MethodPost, http.MethodPut, http.MethodGet, http.MethodDelete} {
+	for _, m := range []string{http.MethodPost, http.MethodPut} {
 		t.Run(m, func(t *testing.T) {
 			r := httptest.NewRequest(m, "/api/", nil)
 			w := httptest.NewRecorder()
@@ -49,13 +85,82 @@ func TestInvalidContentType(t *testing.T) {
 			body, err := io.ReadAll(result.Body)
 			require.NoError(t, err, "body should be read")
 			require.NotEmpty(t, body, "body should not be empty")
-			require.Equal(t, http.StatusBadRequest, result.StatusCode)
-			require.Equal(t, "invalid content type\n", string(body))
+			require.Equal(t, http.StatusUnsupportedMediaType, result.StatusCode)
+			require.Equal(t, applicationProblemJSON, result.Header.Get(contentTypeHeader))
+			prob := decodeProblem(t, body)
+			require.Equal(t, codeInvalidContentType, prob.Code)
+			require.Equal(t, "content type must be application/json", prob.Detail)
 		})
 	}
 
 }
 
+func TestContentNegotiation(t *testing.T) {
+	t.Parallel()
+	p := &testProvider{
+		allFunc: func() ([]*types.StatusThing, error) { return []*types.StatusThing{}, nil },
+		getFunc: func(id string) (*types.StatusThing, error) {
+			return &types.StatusThing{ID: id, Name: "api", Status: types.StatusGreen, Version: 1}, nil
+		},
+		addFunc: func(params providers.Params) (*types.StatusThing, error) {
+			return &types.StatusThing{ID: "abc", Name: params.Name, Status: params.Status, Version: 1}, nil
+		},
+		statusFunc: func(string, types.Status, *dbfilters.Filters) error { return nil },
+		removeFunc: func(string, *dbfilters.Filters) error { return nil },
+	}
+	h, err := NewStatusThingHandler(p)
+	require.NoError(t, err)
+
+	body := `{"name":"api","status":"STATUS_GREEN"}`
+	for name, tc := range map[string]struct {
+		method      string
+		path        string
+		contentType string
+		accept      string
+		status      int
+		code        string
+	}{
+		"get-without-headers":      {method: http.MethodGet, path: "/statusthings/api/", status: http.StatusOK},
+		"get-one-without-headers":  {method: http.MethodGet, path: "/statusthings/api/abc", status: http.StatusOK},
+		"get-browser-accept":       {method: http.MethodGet, path: "/statusthings/api/", accept: "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", status: http.StatusOK},
+		"get-json-charset":         {method: http.MethodGet, path: "/statusthings/api/", contentType: "application/json; charset=utf-8", status: http.StatusOK},
+		"get-not-acceptable":       {method: http.MethodGet, path: "/statusthings/api/", accept: "text/html", status: http.StatusNotAcceptable, code: codeNotAcceptable},
+		"get-json-refused":         {method: http.MethodGet, path: "/statusthings/api/", accept: "application/json;q=0, text/plain", status: http.StatusNotAcceptable, code: codeNotAcceptable},
+		"get-application-wildcard": {method: http.MethodGet, path: "/statusthings/api/", accept: "application/*", status: http.StatusOK},
+		"delete-without-headers":   {method: http.MethodDelete, path: "/statusthings/api/abc", status: http.StatusOK},
+		"post-json-charset":        {method: http.MethodPost, path: "/statusthings/api/", contentType: "application/json; charset=utf-8", status: http.StatusOK},
+		"post-json-suffix":         {method: http.MethodPost, path: "/statusthings/api/", contentType: "application/vnd.statusthing+json", status: http.StatusOK},
+		"post-mixed-case":          {method: http.MethodPost, path: "/statusthings/api/", contentType: "Application/JSON", status: http.StatusOK},
+		"post-form":                {method: http.MethodPost, path: "/statusthings/api/", contentType: "application/x-www-form-urlencoded", status: http.StatusUnsupportedMediaType, code: codeInvalidContentType},
+		"post-malformed":           {method: http.MethodPost, path: "/statusthings/api/", contentType: "application/json; charset", status: http.StatusUnsupportedMediaType, code: codeInvalidContentType},
+		"put-json-charset":         {method: http.MethodPut, path: "/statusthings/api/abc", contentType: "application/json;charset=UTF-8", status: http.StatusOK},
+		"put-text":                 {method: http.MethodPut, path: "/statusthings/api/abc", contentType: "text/plain", status: http.StatusUnsupportedMediaType, code: codeInvalidContentType},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var reqBody io.Reader
+			if hasBody(tc.method) {
+				reqBody = strings.NewReader(body)
+			}
+			r := httptest.NewRequest(tc.method, tc.path, reqBody)
+			if tc.contentType != "" {
+				r.Header.Set(contentTypeHeader, tc.contentType)
+			}
+			if tc.accept != "" {
+				r.Header.Set(acceptHeader, tc.accept)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			require.Equal(t, tc.status, w.Code, w.Body.String())
+			if tc.code != "" {
+				require.Equal(t, applicationProblemJSON, w.Header().Get(contentTypeHeader))
+				require.Equal(t, tc.code, decodeProblem(t, w.Body.Bytes()).Code)
+				return
+			}
+			require.Equal(t, applicationJSON, w.Header().Get(contentTypeHeader), "api responses should be json")
+		})
+	}
+}
+
 func TestGetAll(t *testing.T) {
 	t.Parallel()
 
@@ -129,7 +234,7 @@ func TestGetAll(t *testing.T) {
 				body, err := io.ReadAll(result.Body)
 				require.NoError(t, err, "body should read")
 				require.Equal(t, http.StatusOK, result.StatusCode, "should be okay")
-				require.Equal(t, fmt.Sprintf(`[{"id":"TestGetAll/%[1]s/one-result_id","name":"TestGetAll/%[1]s/one-result_name","description":"TestGetAll/%[1]s/one-result_desc","status":"STATUS_GREEN"}]`, tname), strings.TrimSuffix(string(body), "\n"), "should return empty result set")
+				require.Equal(t, fmt.Sprintf(`[{"id":"TestGetAll/%[1]s/one-result_id","name":"TestGetAll/%[1]s/one-result_name","description":"TestGetAll/%[1]s/one-result_desc","status":"STATUS_GREEN","version":0}]`, tname), strings.TrimSuffix(string(body), "\n"), "should return empty result set")
 			})
 		})
 	}
@@ -174,7 +279,7 @@ func TestGet(t *testing.T) {
 		body, err := io.ReadAll(result.Body)
 		require.NoError(t, err, "body should read")
 		require.Equal(t, http.StatusNotFound, result.StatusCode, "should be not found")
-		require.Equal(t, "not found\n", string(body), "should return not found")
+		require.Equal(t, codeNotFound, decodeProblem(t, body).Code, "should return not found")
 	})
 
 	t.Run("good", func(t *testing.T) {
@@ -201,7 +306,7 @@ func TestGet(t *testing.T) {
 		body, err := io.ReadAll(result.Body)
 		require.NoError(t, err, "body should read")
 		require.Equal(t, http.StatusOK, result.StatusCode, "should be ok")
-		require.Equal(t, `{"id":"TestGet/good_id","name":"TestGet/good_name","description":"TestGet/good_desc","status":"STATUS_GREEN"}`, strings.TrimSuffix(string(body), "\n"), "should return not found")
+		require.Equal(t, `{"id":"TestGet/good_id","name":"TestGet/good_name","description":"TestGet/good_desc","status":"STATUS_GREEN","version":0}`, strings.TrimSuffix(string(body), "\n"), "should return not found")
 	})
 }
 
@@ -244,7 +349,9 @@ func TestDelete(t *testing.T) {
 		body, err := io.ReadAll(result.Body)
 		require.NoError(t, err, "body should read")
 		require.Equal(t, http.StatusNotFound, result.StatusCode, "should be not found")
-		require.Equal(t, "no such record\n", string(body), "should return not found")
+		prob := decodeProblem(t, body)
+		require.Equal(t, codeNotFound, prob.Code, "should return not found")
+		require.Equal(t, "no such record", prob.Detail, "should return not found")
 	})
 
 	t.Run("good", func(t *testing.T) {
@@ -260,7 +367,7 @@ func TestDelete(t *testing.T) {
 					Status:      types.StatusGreen,
 				}, nil
 			},
-			removeFunc: func(s string) error { return nil },
+			removeFunc: func(s string, f *dbfilters.Filters) error { return nil },
 		}
 		h, err := NewStatusThingHandler(p, WithBasePath("/"))
 		require.NoError(t, err, "should not error")
@@ -272,7 +379,7 @@ func TestDelete(t *testing.T) {
 		body, err := io.ReadAll(result.Body)
 		require.NoError(t, err, "body should read")
 		require.Equal(t, http.StatusOK, result.StatusCode, "should be ok")
-		require.Equal(t, `{"id":"TestDelete/good_id","name":"TestDelete/good_name","description":"TestDelete/good_desc","status":"STATUS_GREEN"}`, strings.TrimSuffix(string(body), "\n"), "should return not found")
+		require.Equal(t, `{"id":"TestDelete/good_id","name":"TestDelete/good_name","description":"TestDelete/good_desc","status":"STATUS_GREEN","version":0}`, strings.TrimSuffix(string(body), "\n"), "should return not found")
 	})
 }
 
@@ -313,7 +420,7 @@ func TestPost(t *testing.T) {
 				p := &testProvider{
 					addFunc: func(p providers.Params) (*types.StatusThing, error) {
 						addCalled = true
-						return nil, types.ErrRequiredValueMissing
+						return nil, types.NewValidationError("name", "name cannot be empty")
 					},
 				}
 				h, err := NewStatusThingHandler(p, WithBasePath("/"))
@@ -323,9 +430,14 @@ func TestPost(t *testing.T) {
 				h.ServeHTTP(w, r)
 				result := w.Result()
 				defer result.Body.Close()
+				body, err := io.ReadAll(result.Body)
+				require.NoError(t, err, "body should read")
 
 				require.Equal(t, http.StatusBadRequest, result.StatusCode, "should fail validation error")
 				require.True(t, addCalled, "should have called our add func")
+				prob := decodeProblem(t, body)
+				require.Equal(t, codeValidationFailed, prob.Code, "should be a validation problem")
+				require.Equal(t, "name", prob.Field, "should report the offending field")
 			})
 
 			t.Run("already-exists", func(t *testing.T) {
@@ -349,6 +461,9 @@ func TestPost(t *testing.T) {
 
 				require.Equal(t, http.StatusConflict, result.StatusCode, "should fail with conflict error")
 				require.True(t, addCalled, "should have called our add func")
+				body, err := io.ReadAll(result.Body)
+				require.NoError(t, err, "body should read")
+				require.Equal(t, codeAlreadyExists, decodeProblem(t, body).Code, "should be a conflict problem")
 			})
 
 			t.Run("internal-error", func(t *testing.T) {
@@ -397,7 +512,7 @@ func TestPost(t *testing.T) {
 				stringBody := strings.TrimSuffix(string(body), "\n")
 				require.Equal(t, http.StatusOK, result.StatusCode, "should pass")
 				require.True(t, addCalled, "should have called our add func")
-				require.Equal(t, fmt.Sprintf(`{"id":"%s","name":"","description":"","status":"STATUS_UNKNOWN"}`, tname), stringBody)
+				require.Equal(t, fmt.Sprintf(`{"id":"%s","name":"","description":"","status":"STATUS_UNKNOWN","version":0}`, tname), stringBody)
 			})
 		})
 	}
@@ -411,7 +526,7 @@ func TestPut(t *testing.T) {
 		w := httptest.NewRecorder()
 		statusCalled := false
 		p := &testProvider{
-			statusFunc: func(s1 string, s2 types.Status) error {
+			statusFunc: func(s1 string, s2 types.Status, f *dbfilters.Filters) error {
 				statusCalled = true
 				return fmt.Errorf("snarf")
 			},
@@ -433,7 +548,7 @@ func TestPut(t *testing.T) {
 		w := httptest.NewRecorder()
 		statusCalled := false
 		p := &testProvider{
-			statusFunc: func(s1 string, s2 types.Status) error {
+			statusFunc: func(s1 string, s2 types.Status, f *dbfilters.Filters) error {
 				statusCalled = true
 				return fmt.Errorf("snarf")
 			},
@@ -455,7 +570,7 @@ func TestPut(t *testing.T) {
 		w := httptest.NewRecorder()
 		statusCalled := false
 		p := &testProvider{
-			statusFunc: func(s1 string, s2 types.Status) error {
+			statusFunc: func(s1 string, s2 types.Status, f *dbfilters.Filters) error {
 				statusCalled = true
 				return nil
 			},
@@ -472,17 +587,1355 @@ func TestPut(t *testing.T) {
 		stringBody := strings.TrimSuffix(string(body), "\n")
 		require.Equal(t, http.StatusOK, result.StatusCode, "should pass")
 		require.True(t, statusCalled, "should have called our status func")
-		require.Empty(t, stringBody, "should not return a body")
+		res := &httpRepresentation{}
+		require.NoError(t, json.Unmarshal([]byte(stringBody), res), "should return the updated thing")
+		require.Equal(t, "STATUS_GREEN", res.Status)
+		require.Equal(t, "foo", res.Description)
+		require.Equal(t, `"1"`, result.Header.Get(etagHeader))
+	})
+}
+
+func TestProblemResponses(t *testing.T) {
+	t.Parallel()
+
+	t.Run("request-id-propagated", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/foobar", nil)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		r.Header.Set(RequestIDHeader, t.Name())
+		w := httptest.NewRecorder()
+		p := &testProvider{
+			getFunc: func(s string) (*types.StatusThing, error) { return nil, fmt.Errorf("snarf") },
+		}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+		require.NotNil(t, h, "should not be nil")
+
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err, "body should read")
+		require.Equal(t, http.StatusInternalServerError, result.StatusCode, "should be internal error")
+		require.Equal(t, t.Name(), result.Header.Get(RequestIDHeader), "should echo the request id")
+		prob := decodeProblem(t, body)
+		require.Equal(t, codeInternalError, prob.Code, "should be an internal error problem")
+		require.Equal(t, t.Name(), prob.RequestID, "should include the request id")
+		require.Equal(t, http.StatusInternalServerError, prob.Status, "should include the status")
+	})
+
+	t.Run("request-id-generated", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/foobar", nil)
+		w := httptest.NewRecorder()
+		h, err := NewStatusThingHandler(&testProvider{}, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+		require.NotNil(t, h, "should not be nil")
+
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err, "body should read")
+		require.NotEmpty(t, result.Header.Get(RequestIDHeader), "should generate a request id")
+		require.Equal(t, result.Header.Get(RequestIDHeader), decodeProblem(t, body).RequestID, "should include the generated request id")
+	})
+
+	t.Run("permission-denied", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/", nil)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		w := httptest.NewRecorder()
+		h, err := NewStatusThingHandler(&testProvider{}, WithBasePath("/"), WithAPIKey(t.Name()))
+		require.NoError(t, err, "should not error")
+		require.NotNil(t, h, "should not be nil")
+
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err, "body should read")
+		require.Equal(t, http.StatusForbidden, result.StatusCode, "should be forbidden")
+		require.Equal(t, codePermissionDenied, decodeProblem(t, body).Code, "should be a permission problem")
+	})
+
+	t.Run("invalid-status-on-put", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPut, "/api/abcdefg", strings.NewReader(`{"status":"STATUS_PURPLE"}`))
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		w := httptest.NewRecorder()
+		p := &testProvider{
+			statusFunc: func(s1 string, s2 types.Status, f *dbfilters.Filters) error {
+				return types.NewValidationError("status", "a valid status must be provided")
+			},
+		}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+		require.NotNil(t, h, "should not be nil")
+
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err, "body should read")
+		require.Equal(t, http.StatusBadRequest, result.StatusCode, "should be bad request")
+		prob := decodeProblem(t, body)
+		require.Equal(t, codeValidationFailed, prob.Code, "should be a validation problem")
+		require.Equal(t, "status", prob.Field, "should report the offending field")
+	})
+}
+
+func TestConditionalRequests(t *testing.T) {
+	t.Parallel()
+	thing := &types.StatusThing{ID: "abcdefg", Name: "name", Description: "desc", Status: types.StatusGreen, Version: 3}
+
+	t.Run("get-etag", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/abcdefg", nil)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		w := httptest.NewRecorder()
+		p := &testProvider{getFunc: func(s string) (*types.StatusThing, error) { return thing, nil }}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode, "should be ok")
+		require.Equal(t, `"3"`, result.Header.Get(etagHeader), "etag should be the version")
+	})
+
+	for name, header := range map[string]string{"exact": `"3"`, "weak": `W/"3"`, "list": `"1", "3"`, "star": "*"} {
+		t.Run("get-not-modified-"+name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/api/abcdefg", nil)
+			r.Header.Set(contentTypeHeader, applicationJSON)
+			r.Header.Set(ifNoneMatchHeader, header)
+			w := httptest.NewRecorder()
+			p := &testProvider{getFunc: func(s string) (*types.StatusThing, error) { return thing, nil }}
+			h, err := NewStatusThingHandler(p, WithBasePath("/"))
+			require.NoError(t, err, "should not error")
+
+			h.ServeHTTP(w, r)
+			result := w.Result()
+			defer result.Body.Close()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err, "body should read")
+			require.Equal(t, http.StatusNotModified, result.StatusCode, "should not be modified")
+			require.Empty(t, body, "should not return a body")
+		})
+	}
+
+	t.Run("get-modified", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "/api/abcdefg", nil)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		r.Header.Set(ifNoneMatchHeader, `"2"`)
+		w := httptest.NewRecorder()
+		p := &testProvider{getFunc: func(s string) (*types.StatusThing, error) { return thing, nil }}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode, "should be ok")
+	})
+
+	t.Run("list-not-modified", func(t *testing.T) {
+		p := &testProvider{allFunc: func() ([]*types.StatusThing, error) { return []*types.StatusThing{thing}, nil }}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+
+		r := httptest.NewRequest(http.MethodGet, "/api/", nil)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		first := w.Result()
+		defer first.Body.Close()
+		etag := first.Header.Get(etagHeader)
+		require.NotEmpty(t, etag, "list should have an etag")
+
+		r = httptest.NewRequest(http.MethodGet, "/api/", nil)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		r.Header.Set(ifNoneMatchHeader, etag)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		second := w.Result()
+		defer second.Body.Close()
+		require.Equal(t, http.StatusNotModified, second.StatusCode, "should not be modified")
+	})
+
+	t.Run("put-if-match", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPut, "/api/abcdefg", strings.NewReader(`{"status":"STATUS_RED"}`))
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		r.Header.Set(ifMatchHeader, `"3"`)
+		w := httptest.NewRecorder()
+		var version int64
+		gets := 0
+		p := &testProvider{
+			statusFunc: func(s1 string, s2 types.Status, f *dbfilters.Filters) error {
+				version = f.Version()
+				return nil
+			},
+			// the test provider reads the previous state once in SetStatus
+			getFunc: func(id string) (*types.StatusThing, error) {
+				gets++
+				return &types.StatusThing{ID: id, Name: thing.Name, Status: types.StatusGreen, Version: 3}, nil
+			},
+		}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode, "should be ok")
+		require.Equal(t, int64(3), version, "should pass the version to the provider")
+		require.Equal(t, `"4"`, result.Header.Get(etagHeader), "should return the new version")
+		res := &httpRepresentation{}
+		require.NoError(t, json.NewDecoder(result.Body).Decode(res))
+		require.Equal(t, "STATUS_RED", res.Status, "should return the updated thing")
+		require.Equal(t, int64(4), res.Version)
+		require.Equal(t, 1, gets, "the updated thing should come from the update rather than another read")
+	})
+
+	t.Run("put-star-missing", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPut, "/api/abcdefg", strings.NewReader(`{"status":"STATUS_RED"}`))
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		r.Header.Set(ifMatchHeader, "*")
+		w := httptest.NewRecorder()
+		p := &testProvider{
+			statusFunc: func(s1 string, s2 types.Status, f *dbfilters.Filters) error { return types.ErrNotFound },
+		}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusPreconditionFailed, w.Code, "* should only match an existing thing")
+		require.Equal(t, codePreconditionFailed, decodeProblem(t, w.Body.Bytes()).Code)
+	})
+
+	t.Run("delete-star-missing", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodDelete, "/api/abcdefg", nil)
+		r.Header.Set(ifMatchHeader, "*")
+		w := httptest.NewRecorder()
+		p := &testProvider{getFunc: func(s string) (*types.StatusThing, error) { return nil, types.ErrNotFound }}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusPreconditionFailed, w.Code, "* should only match an existing thing")
+	})
+
+	t.Run("put-description", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPut, "/api/abcdefg", strings.NewReader(`{"status":"STATUS_RED","description":"on fire"}`))
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		w := httptest.NewRecorder()
+		var description string
+		p := &testProvider{
+			statusFunc: func(s1 string, s2 types.Status, f *dbfilters.Filters) error {
+				description = f.Description()
+				return nil
+			},
+		}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		require.Equal(t, http.StatusOK, result.StatusCode, "should be ok")
+		require.Equal(t, "on fire", description, "should pass the description to the provider")
+	})
+
+	t.Run("put-stale", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPut, "/api/abcdefg", strings.NewReader(`{"status":"STATUS_RED"}`))
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		r.Header.Set(ifMatchHeader, `"2"`)
+		w := httptest.NewRecorder()
+		p := &testProvider{
+			statusFunc: func(s1 string, s2 types.Status, f *dbfilters.Filters) error {
+				return types.ErrVersionMismatch
+			},
+		}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err, "body should read")
+		require.Equal(t, http.StatusPreconditionFailed, result.StatusCode, "should fail the precondition")
+		require.Equal(t, codePreconditionFailed, decodeProblem(t, body).Code, "should be a precondition problem")
+	})
+
+	for name, header := range map[string]string{"weak": `W/"3"`, "garbage": "snarf", "list": `"1", "3"`} {
+		t.Run("put-unsatisfiable-"+name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/api/abcdefg", strings.NewReader(`{"status":"STATUS_RED"}`))
+			r.Header.Set(contentTypeHeader, applicationJSON)
+			r.Header.Set(ifMatchHeader, header)
+			w := httptest.NewRecorder()
+			statusCalled := false
+			p := &testProvider{
+				statusFunc: func(s1 string, s2 types.Status, f *dbfilters.Filters) error {
+					statusCalled = true
+					return nil
+				},
+			}
+			h, err := NewStatusThingHandler(p, WithBasePath("/"))
+			require.NoError(t, err, "should not error")
+
+			h.ServeHTTP(w, r)
+			result := w.Result()
+			defer result.Body.Close()
+			require.Equal(t, http.StatusPreconditionFailed, result.StatusCode, "should fail the precondition")
+			require.False(t, statusCalled, "should not call the provider")
+		})
+	}
+
+	t.Run("delete-stale", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodDelete, "/api/abcdefg", nil)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		r.Header.Set(ifMatchHeader, `"2"`)
+		w := httptest.NewRecorder()
+		var version int64
+		p := &testProvider{
+			getFunc: func(s string) (*types.StatusThing, error) { return thing, nil },
+			removeFunc: func(s string, f *dbfilters.Filters) error {
+				version = f.Version()
+				return types.ErrVersionMismatch
+			},
+		}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		require.Equal(t, http.StatusPreconditionFailed, result.StatusCode, "should fail the precondition")
+		require.Equal(t, int64(2), version, "should pass the version to the provider")
 	})
 }
 
+func TestGroups(t *testing.T) {
+	t.Parallel()
+
+	t.Run("post", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/api/", strings.NewReader(`{"status":"STATUS_GREEN","name":"api","description":"the api","group":"core"}`))
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		w := httptest.NewRecorder()
+		var group string
+		p := &testProvider{
+			addFunc: func(p providers.Params) (*types.StatusThing, error) {
+				group = p.Group
+				return &types.StatusThing{ID: "api", Name: p.Name, Description: p.Description, Group: p.Group, Status: p.Status, Version: 1}, nil
+			},
+		}
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err, "should not error")
+
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err, "body should read")
+		require.Equal(t, http.StatusOK, result.StatusCode, "should be ok")
+		require.Equal(t, "core", group, "should pass the group to the provider")
+		require.Equal(t, `{"id":"api","name":"api","description":"the api","group":"core","status":"STATUS_GREEN","version":1}`, strings.TrimSuffix(string(body), "\n"))
+	})
+
+	for name, tc := range map[string]struct {
+		body  string
+		group string
+		set   bool
+	}{
+		"put-unchanged": {body: `{"status":"STATUS_RED"}`},
+		"put-cleared":   {body: `{"status":"STATUS_RED","group":""}`, set: true},
+		"put-changed":   {body: `{"status":"STATUS_RED","group":"edge"}`, group: "edge", set: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPut, "/api/abcdefg", strings.NewReader(tc.body))
+			r.Header.Set(contentTypeHeader, applicationJSON)
+			w := httptest.NewRecorder()
+			var group string
+			var set bool
+			p := &testProvider{
+				statusFunc: func(s1 string, s2 types.Status, f *dbfilters.Filters) error {
+					group, set = f.Group()
+					return nil
+				},
+			}
+			h, err := NewStatusThingHandler(p, WithBasePath("/"))
+			require.NoError(t, err, "should not error")
+
+			h.ServeHTTP(w, r)
+			result := w.Result()
+			defer result.Body.Close()
+			require.Equal(t, http.StatusOK, result.StatusCode, "should be ok")
+			require.Equal(t, tc.set, set, "group should only be set when provided")
+			require.Equal(t, tc.group, group)
+		})
+	}
+}
+
+func TestMetricsRoute(t *testing.T) {
+	t.Parallel()
+	p := &testProvider{
+		allFunc: func() ([]*types.StatusThing, error) {
+			return []*types.StatusThing{{ID: "abc", Name: "api", Status: types.StatusGreen}}, nil
+		},
+	}
+	m, err := metrics.New(p)
+	require.NoError(t, err)
+	_, err = NewStatusThingHandler(p, WithMetrics(nil))
+	require.Error(t, err, "should require metrics")
+	h, err := NewStatusThingHandler(p, WithMetrics(m))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/statusthings/api/", nil)
+	r.Header.Set(contentTypeHeader, applicationJSON)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	result := w.Result()
+	defer result.Body.Close()
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	require.Contains(t, string(body), `statusthing_thing_status{id="abc",name="api",group=""} 2`)
+	require.Contains(t, string(body), `statusthing_http_requests_total{method="GET",route="/statusthings/api",code="200"} 1`)
+}
+
+func TestHealth(t *testing.T) {
+	t.Parallel()
+	p := &testProvider{}
+	_, err := NewStatusThingHandler(p, WithReadinessCheck("db", nil))
+	require.Error(t, err, "should require a check")
+	_, err = NewStatusThingHandler(p, WithReadinessCheck("", func(context.Context) error { return nil }))
+	require.Error(t, err, "should require a name")
+	ok := func(context.Context) error { return nil }
+	_, err = NewStatusThingHandler(p, WithReadinessCheck("db", ok), WithReadinessCheck("db", ok))
+	require.Error(t, err, "names should be unique")
+
+	failing := false
+	h, err := NewStatusThingHandler(p, WithAPIKey("secret"), WithBasePath("/elsewhere"),
+		WithReadinessCheck("db", ok),
+		WithReadinessCheck("queue", func(context.Context) error {
+			if failing {
+				return fmt.Errorf("queue is full")
+			}
+			return nil
+		}))
+	require.NoError(t, err)
+	get := func(path string) (int, healthResponse) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		require.Equal(t, applicationJSON, w.Header().Get(contentTypeHeader))
+		res := healthResponse{}
+		require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+		return w.Code, res
+	}
+
+	code, res := get(healthzPath)
+	require.Equal(t, http.StatusOK, code, "probes should not require an api key")
+	require.Equal(t, healthOK, res.Status)
+
+	code, res = get(readyzPath)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, healthOK, res.Status)
+	require.Len(t, res.Checks, 2)
+
+	failing = true
+	code, res = get(readyzPath)
+	require.Equal(t, http.StatusServiceUnavailable, code)
+	require.Equal(t, healthUnavailable, res.Status)
+	require.Equal(t, healthOK, res.Checks["db"].Status)
+	require.Equal(t, healthUnavailable, res.Checks["queue"].Status)
+	require.Equal(t, "queue is full", res.Checks["queue"].Error)
+
+	code, _ = get(healthzPath)
+	require.Equal(t, http.StatusOK, code, "failing checks should not affect liveness")
+}
+
+type testFlapDetector map[string]bool
+
+func (tf testFlapDetector) Flapping(id string) bool { return tf[id] }
+
+func TestFlapping(t *testing.T) {
+	t.Parallel()
+	p := &testProvider{
+		allFunc: func() ([]*types.StatusThing, error) {
+			return []*types.StatusThing{
+				{ID: "abc", Name: "api", Description: "api", Status: types.StatusRed, Version: 1},
+				{ID: "def", Name: "web", Description: "web", Status: types.StatusGreen, Version: 1},
+			}, nil
+		},
+	}
+	_, err := NewStatusThingHandler(p, WithFlapping(nil))
+	require.Error(t, err, "should require a detector")
+	h, err := NewStatusThingHandler(p, WithBasePath("/"), WithFlapping(testFlapDetector{"abc": true}))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/api/", nil)
+	r.Header.Set(contentTypeHeader, applicationJSON)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	result := w.Result()
+	defer result.Body.Close()
+	body, err := io.ReadAll(result.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	require.Equal(t, `[{"id":"abc","name":"api","description":"api","status":"STATUS_RED","version":1,"flapping":true},{"id":"def","name":"web","description":"web","status":"STATUS_GREEN","version":1}]`, strings.TrimSuffix(string(body), "\n"))
+
+	// the flapping state isn't part of the version so it has to be part of the etag
+	detector := testFlapDetector{"abc": true}
+	p.getFunc = func(id string) (*types.StatusThing, error) {
+		return &types.StatusThing{ID: "abc", Name: "api", Description: "api", Status: types.StatusRed, Version: 1}, nil
+	}
+	h, err = NewStatusThingHandler(p, WithBasePath("/"), WithFlapping(detector))
+	require.NoError(t, err)
+	get := func(ifNoneMatch string) *http.Response {
+		r := httptest.NewRequest(http.MethodGet, "/api/abc", nil)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		r.Header.Set(ifNoneMatchHeader, ifNoneMatch)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Result()
+	}
+	res := get("")
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	etag := res.Header.Get(etagHeader)
+	require.Equal(t, `"1-flapping"`, etag)
+	res = get(etag)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusNotModified, res.StatusCode)
+	detector["abc"] = false
+	res = get(etag)
+	defer res.Body.Close()
+	require.Equal(t, http.StatusOK, res.StatusCode, "a change in flapping should not be reported as not modified")
+	require.Equal(t, `"1"`, res.Header.Get(etagHeader))
+
+	// the etag can still be used to make a conditional change
+	version, ok := versionFromIfMatch(etag)
+	require.True(t, ok)
+	require.Equal(t, int64(1), version)
+}
+
+func TestBadges(t *testing.T) {
+	t.Parallel()
+	p := &testProvider{
+		allFunc: func() ([]*types.StatusThing, error) {
+			return []*types.StatusThing{
+				{ID: "abc", Name: "api.v2", Status: types.StatusRed},
+				{ID: "def", Name: "<web>", Status: types.StatusGreen},
+			}, nil
+		},
+	}
+	h, err := NewStatusThingHandler(p, WithAPIKey("secret"))
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		path     string
+		code     int
+		contains []string
+	}{
+		"dotted-name": {path: "/statusthings/badge/api.v2.svg", code: http.StatusOK, contains: []string{">api.v2<", ">down<", "#e05d44"}},
+		"escaped":     {path: "/statusthings/badge/%3Cweb%3E.svg", code: http.StatusOK, contains: []string{">&lt;web&gt;<", ">up<", "#4c1"}},
+		"missing":     {path: "/statusthings/badge/nope.svg", code: http.StatusNotFound, contains: []string{">nope<", ">not found<"}},
+		"not-svg":     {path: "/statusthings/badge/api.v2.png", code: http.StatusNotFound},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, tc.path, nil))
+			result := w.Result()
+			defer result.Body.Close()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.Equal(t, tc.code, result.StatusCode, "badges should not require the api key")
+			for _, c := range tc.contains {
+				require.Contains(t, string(body), c)
+			}
+			if len(tc.contains) > 0 {
+				require.Equal(t, svgContentType, result.Header.Get(contentTypeHeader))
+				require.Equal(t, badgeMaxAge, result.Header.Get(cacheControlHeader))
+			}
+		})
+	}
+
+	t.Run("not-modified", func(t *testing.T) {
+		t.Parallel()
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/statusthings/badge/api.v2.svg", nil))
+		etag := w.Result().Header.Get(etagHeader)
+		require.NotEmpty(t, etag)
+		r := httptest.NewRequest(http.MethodGet, "/statusthings/badge/api.v2.svg", nil)
+		r.Header.Set(ifNoneMatchHeader, etag)
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNotModified, w.Result().StatusCode)
+	})
+}
+
+type testHistory struct {
+	filters     *dbfilters.Filters
+	transitions []types.Transition
+}
+
+func (th *testHistory) GetTransitions(_ context.Context, opts ...dbfilters.Option) ([]types.Transition, error) {
+	f, err := dbfilters.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	th.filters = f
+	return th.transitions, nil
+}
+
+func TestFeeds(t *testing.T) {
+	t.Parallel()
+	at := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	hist := &testHistory{transitions: []types.Transition{
+		{ID: 9, Thing: &types.StatusThing{ID: "abc", Name: "api", Description: "fix deployed", Status: types.StatusRed}, Previous: types.StatusRed, At: at.Add(2 * time.Hour), Published: true},
+		{ID: 7, Thing: &types.StatusThing{ID: "abc", Name: "api", Description: "the <api>", Status: types.StatusRed}, Previous: types.StatusGreen, At: at.Add(time.Hour), Published: true},
+		{ID: 3, Thing: &types.StatusThing{ID: "abc", Name: "api", Status: types.StatusGreen}, Previous: types.StatusUnknown, At: at, Published: true},
+	}}
+	_, err := NewStatusThingHandler(&testProvider{}, WithHistory(nil))
+	require.Error(t, err, "should require a history")
+	_, err = NewStatusThingHandler(&testProvider{}, WithHistory(hist), WithPublicURL("/statusthings"))
+	require.Error(t, err, "public url should be absolute")
+	h, err := NewStatusThingHandler(&testProvider{}, WithHistory(hist), WithAPIKey("secret"), WithPublicURL("https://status.example.com/statusthings/"))
+	require.NoError(t, err)
+
+	t.Run("atom", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://status.example.com/statusthings/feed.atom?thing=api&group=core", nil))
+		result := w.Result()
+		defer result.Body.Close()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, result.StatusCode, "feeds should not require the api key")
+		require.Equal(t, atomContentType, result.Header.Get(contentTypeHeader))
+		require.Equal(t, "api", hist.filters.Name())
+		group, ok := hist.filters.Group()
+		require.True(t, ok)
+		require.Equal(t, "core", group)
+		require.Equal(t, feedLimit, hist.filters.Limit())
+		require.True(t, hist.filters.Published(), "feeds should only list published changes")
+
+		var feed atomFeed
+		require.NoError(t, xml.Unmarshal(body, &feed))
+		require.Equal(t, "https://status.example.com/statusthings/", feed.ID)
+		require.Equal(t, "https://status.example.com/statusthings/", feed.Link.Href)
+		require.Equal(t, "2023-05-01T14:00:00Z", feed.Updated)
+		require.Len(t, feed.Entries, 3)
+		require.Equal(t, "Update on api", feed.Entries[0].Title, "description updates should be listed")
+		require.Equal(t, "api is still down: fix deployed", feed.Entries[0].Summary)
+		require.Equal(t, "api is down", feed.Entries[1].Title)
+		require.Equal(t, "urn:statusthing:transition:7", feed.Entries[1].ID)
+		require.Equal(t, "urn:statusthing:transition:3", feed.Entries[2].ID)
+		require.Equal(t, "api changed from up to down: the <api>", feed.Entries[1].Summary)
+		require.Equal(t, "api was added as up", feed.Entries[2].Summary)
+	})
+
+	t.Run("rss", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodGet, "http://evil.example.com/statusthings/feed.rss", nil)
+		r.Header.Set("X-Forwarded-Proto", "gopher")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		result := w.Result()
+		defer result.Body.Close()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		require.Equal(t, rssContentType, result.Header.Get(contentTypeHeader))
+		require.Equal(t, "", hist.filters.Name())
+
+		var feed rssFeed
+		require.NoError(t, xml.Unmarshal(body, &feed))
+		require.Equal(t, "2.0", feed.Version)
+		require.Equal(t, "https://status.example.com/statusthings/", feed.Channel.Link, "links should not come from request headers")
+		require.Len(t, feed.Channel.Items, 3)
+		require.Equal(t, "Mon, 01 May 2023 14:00:00 +0000", feed.Channel.Items[0].PubDate)
+		require.False(t, feed.Channel.Items[0].GUID.IsPermaLink)
+
+		r.Header.Set(ifNoneMatchHeader, result.Header.Get(etagHeader))
+		w = httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNotModified, w.Result().StatusCode)
+	})
+
+	t.Run("no-public-url", func(t *testing.T) {
+		h, err := NewStatusThingHandler(&testProvider{}, WithHistory(hist))
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "http://status.example.com/statusthings/feed.atom", nil))
+		result := w.Result()
+		defer result.Body.Close()
+		body, err := io.ReadAll(result.Body)
+		require.NoError(t, err)
+		require.Equal(t, http.StatusOK, result.StatusCode)
+		var feed atomFeed
+		require.NoError(t, xml.Unmarshal(body, &feed))
+		require.Equal(t, feedID, feed.ID, "the id should not depend on how the feed was requested")
+		require.Equal(t, "/statusthings/", feed.Link.Href)
+	})
+}
+
+type testUptime struct {
+	from, to time.Time
+}
+
+func (tu *testUptime) Calculate(_ context.Context, thing *types.StatusThing, from, to time.Time) (*uptime.Report, error) {
+	tu.from, tu.to = from, to
+	if !from.Before(to) {
+		return nil, types.NewValidationError("from", "from must be before to")
+	}
+	return &uptime.Report{From: from, To: to, Uptime: 99.5, Known: time.Hour, Durations: map[types.Status]time.Duration{types.StatusGreen: time.Hour}}, nil
+}
+
+func (tu *testUptime) Buckets(_ context.Context, thing *types.StatusThing, from, to time.Time, size time.Duration) ([]*uptime.Report, error) {
+	return []*uptime.Report{
+		{From: from, To: from.Add(size)},
+		{From: from.Add(size), To: to, Uptime: 100, Known: time.Hour},
+	}, nil
+}
+
+func TestUptime(t *testing.T) {
+	t.Parallel()
+	thing := &types.StatusThing{ID: "abc", Name: "api", Description: "the api", Status: types.StatusGreen}
+	p := &testProvider{
+		getFunc: func(id string) (*types.StatusThing, error) {
+			if id != "abc" {
+				return nil, types.ErrNotFound
+			}
+			return thing, nil
+		},
+		allFunc: func() ([]*types.StatusThing, error) { return []*types.StatusThing{thing}, nil },
+	}
+	_, err := NewStatusThingHandler(p, WithUptime(nil))
+	require.Error(t, err, "should require uptime")
+
+	t.Run("disabled", func(t *testing.T) {
+		h, err := NewStatusThingHandler(p, WithBasePath("/"))
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodGet, "/api/abc/uptime", nil)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	})
+
+	for name, tc := range map[string]struct {
+		query   string
+		code    int
+		windows []string
+	}{
+		"defaults":   {code: http.StatusOK, windows: []string{"24h", "7d", "30d", "90d"}},
+		"window":     {query: "?window=14d", code: http.StatusOK, windows: []string{"14d"}},
+		"custom":     {query: "?from=2023-05-01T00:00:00Z&to=2023-06-01T00:00:00Z", code: http.StatusOK, windows: []string{""}},
+		"bad-window": {query: "?window=soon", code: http.StatusBadRequest},
+		"bad-from":   {query: "?from=yesterday", code: http.StatusBadRequest},
+		"backwards":  {query: "?from=2023-06-01T00:00:00Z&to=2023-05-01T00:00:00Z", code: http.StatusBadRequest},
+	} {
+		tc := tc
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			h, err := NewStatusThingHandler(p, WithBasePath("/"), WithUptime(&testUptime{}))
+			require.NoError(t, err)
+			r := httptest.NewRequest(http.MethodGet, "/api/abc/uptime"+tc.query, nil)
+			r.Header.Set(contentTypeHeader, applicationJSON)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			result := w.Result()
+			defer result.Body.Close()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.Equal(t, tc.code, result.StatusCode, string(body))
+			if tc.code != http.StatusOK {
+				return
+			}
+			var res uptimeRepresentation
+			require.NoError(t, json.Unmarshal(body, &res))
+			require.Equal(t, "abc", res.ID)
+			require.Len(t, res.Windows, len(tc.windows))
+			for i, window := range tc.windows {
+				require.Equal(t, window, res.Windows[i].Window)
+				require.Equal(t, 99.5, *res.Windows[i].Uptime)
+				require.Equal(t, int64(3600), res.Windows[i].Seconds["STATUS_GREEN"])
+			}
+		})
+	}
+
+	t.Run("missing", func(t *testing.T) {
+		h, err := NewStatusThingHandler(p, WithBasePath("/"), WithUptime(&testUptime{}))
+		require.NoError(t, err)
+		r := httptest.NewRequest(http.MethodGet, "/api/nope/uptime", nil)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		require.Equal(t, http.StatusNotFound, w.Result().StatusCode)
+	})
+
+	t.Run("cards", func(t *testing.T) {
+		h, err := NewStatusThingHandler(p, WithBasePath("/"), WithUptime(&testUptime{}))
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/cards", nil))
+		body := w.Body.String()
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Contains(t, body, `id="uptime-abc"`)
+		require.Contains(t, body, `: no data"`)
+		require.Contains(t, body, `: 100.00%"`)
+	})
+
+	t.Run("badge", func(t *testing.T) {
+		u := &testUptime{}
+		h, err := NewStatusThingHandler(p, WithUptime(u))
+		require.NoError(t, err)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/statusthings/badge/api.svg?uptime=30d", nil))
+		require.Equal(t, http.StatusOK, w.Result().StatusCode)
+		require.Contains(t, w.Body.String(), ">up 99.50%<")
+		require.Equal(t, 30*24*time.Hour, u.to.Sub(u.from))
+	})
+}
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+	_, err := NewStatusThingHandler(&testProvider{}, WithTracerProvider(nil))
+	require.Error(t, err, "should require a tracer provider")
+
+	sr := tracetest.NewSpanRecorder()
+	p := &testProvider{getFunc: func(string) (*types.StatusThing, error) { return nil, types.ErrNotFound }}
+	h, err := NewStatusThingHandler(p, WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodGet, "/statusthings/api/abc", nil)
+	r.Header.Set(contentTypeHeader, applicationJSON)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	spans := sr.Ended()
+	require.Len(t, spans, 1)
+	require.Equal(t, "GET /statusthings/api/{thingID}", spans[0].Name())
+}
+
+func TestAccessLog(t *testing.T) {
+	t.Parallel()
+	_, err := NewStatusThingHandler(&testProvider{}, WithAccessLog(nil))
+	require.Error(t, err, "should require a logger")
+	_, err = NewStatusThingHandler(&testProvider{}, WithAPIKey("abc"), WithNamedAPIKey("ci", "abc"))
+	require.Error(t, err, "keys should be unique")
+	_, err = NewStatusThingHandler(&testProvider{}, WithNamedAPIKey("", "abc"))
+	require.Error(t, err, "keys should be named")
+
+	buf := &bytes.Buffer{}
+	logger := slog.New(NewRequestIDLogHandler(slog.NewJSONHandler(buf)))
+	p := &testProvider{getFunc: func(string) (*types.StatusThing, error) { return nil, types.ErrNotFound }}
+	h, err := NewStatusThingHandler(p, WithAccessLog(logger), WithAPIKey("abc"), WithNamedAPIKey("ci", "def"))
+	require.NoError(t, err)
+
+	r := httptest.NewRequest(http.MethodGet, "/statusthings/api/abc", nil)
+	r.Header.Set(contentTypeHeader, applicationJSON)
+	r.Header.Set(RequestIDHeader, t.Name())
+	r.Header.Set(apiKeyHeader, "def")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNotFound, w.Code)
+
+	entry := map[string]any{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, "INFO", entry["level"])
+	require.Equal(t, t.Name(), entry["request_id"])
+	require.Equal(t, "ci", entry["apikey.name"], "should log the key name and not the key")
+	require.Equal(t, float64(http.StatusNotFound), entry["http.status_code"])
+	require.Equal(t, float64(w.Body.Len()), entry["http.response_bytes"])
+	require.Equal(t, "/statusthings/api/abc", entry["http.path"])
+	require.NotContains(t, buf.String(), "def")
+
+	buf.Reset()
+	r = httptest.NewRequest(http.MethodGet, "/statusthings/api/abc", nil)
+	r.Header.Set(contentTypeHeader, applicationJSON)
+	w = httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusForbidden, w.Code)
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &entry))
+	require.Equal(t, w.Header().Get(RequestIDHeader), entry["request_id"], "should log the generated request id")
+	require.NotContains(t, buf.String(), "apikey.name")
+}
+
+func TestRateLimit(t *testing.T) {
+	t.Parallel()
+	p := &testProvider{allFunc: func() ([]*types.StatusThing, error) { return []*types.StatusThing{}, nil }}
+	_, err := NewStatusThingHandler(p, WithIPRateLimit(nil))
+	require.Error(t, err, "should require a limiter")
+	_, err = NewStatusThingHandler(p, WithAPIKeyRateLimit(nil))
+	require.Error(t, err, "should require a limiter")
+
+	t.Run("by-ip", func(t *testing.T) {
+		l, err := ratelimit.New(0.5, 2)
+		require.NoError(t, err)
+		h, err := NewStatusThingHandler(p, WithIPRateLimit(l), WithAPIKey("secret"))
+		require.NoError(t, err)
+		get := func(addr string) *httptest.ResponseRecorder {
+			r := httptest.NewRequest(http.MethodGet, "/statusthings/api/", nil)
+			r.RemoteAddr = addr
+			r.Header.Set(contentTypeHeader, applicationJSON)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w
+		}
+		require.Equal(t, http.StatusForbidden, get("10.0.0.1:1000").Code)
+		require.Equal(t, http.StatusForbidden, get("10.0.0.1:1001").Code, "ports should share the address's limit")
+		w := get("10.0.0.1:1002")
+		require.Equal(t, http.StatusTooManyRequests, w.Code, "requests without a valid key should be limited too")
+		require.Equal(t, "2", w.Header().Get(retryAfterHeader))
+		require.Equal(t, applicationProblemJSON, w.Header().Get(contentTypeHeader))
+		require.Contains(t, w.Body.String(), codeRateLimited)
+		require.Equal(t, http.StatusForbidden, get("10.0.0.2:1000").Code, "other addresses should not be limited")
+	})
+
+	t.Run("by-api-key", func(t *testing.T) {
+		l, err := ratelimit.New(1, 1)
+		require.NoError(t, err)
+		h, err := NewStatusThingHandler(p, WithAPIKeyRateLimit(l), WithNamedAPIKey("cron", "abc"), WithNamedAPIKey("ci", "def"))
+		require.NoError(t, err)
+		get := func(key string) int {
+			r := httptest.NewRequest(http.MethodGet, "/statusthings/api/", nil)
+			r.Header.Set(contentTypeHeader, applicationJSON)
+			r.Header.Set(apiKeyHeader, key)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			return w.Code
+		}
+		require.Equal(t, http.StatusOK, get("abc"))
+		require.Equal(t, http.StatusTooManyRequests, get("abc"))
+		require.Equal(t, http.StatusOK, get("def"), "keys should have their own limit")
+		require.Equal(t, http.StatusForbidden, get("nope"), "invalid keys should not use up a limit")
+
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/statusthings/badge/nope.txt", nil))
+		require.NotEqual(t, http.StatusTooManyRequests, w.Code, "only the api should be limited")
+	})
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	t.Parallel()
+	p := &testProvider{
+		addFunc: func(params providers.Params) (*types.StatusThing, error) {
+			return &types.StatusThing{ID: "abc", Name: params.Name, Status: params.Status}, nil
+		},
+		statusFunc: func(string, types.Status, *dbfilters.Filters) error { return nil },
+	}
+	_, err := NewStatusThingHandler(p, WithMaxBodyBytes(0))
+	require.Error(t, err, "should require a positive limit")
+	h, err := NewStatusThingHandler(p, WithMaxBodyBytes(64))
+	require.NoError(t, err)
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, path, strings.NewReader(body))
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	small := `{"name":"api","status":"STATUS_GREEN"}`
+	large := `{"name":"api","status":"STATUS_GREEN","description":"` + strings.Repeat("a", 64) + `"}`
+	require.Equal(t, http.StatusOK, send(http.MethodPost, "/statusthings/api/", small).Code)
+	require.Equal(t, http.StatusOK, send(http.MethodPut, "/statusthings/api/abc", small).Code)
+	for _, method := range []string{http.MethodPost, http.MethodPut} {
+		path := "/statusthings/api/"
+		if method == http.MethodPut {
+			path += "abc"
+		}
+		w := send(method, path, large)
+		require.Equal(t, http.StatusRequestEntityTooLarge, w.Code, method)
+		require.Contains(t, w.Body.String(), codeBodyTooLarge)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	t.Parallel()
+	p := &testProvider{allFunc: func() ([]*types.StatusThing, error) { return []*types.StatusThing{}, nil }}
+	_, err := NewStatusThingHandler(p, WithCORS(CORS{}))
+	require.Error(t, err, "should require an origin")
+	_, err = NewStatusThingHandler(p, WithCORS(CORS{AllowedOrigins: []string{""}}))
+	require.Error(t, err, "origins cannot be empty")
+
+	h, err := NewStatusThingHandler(p, WithAPIKey("secret"), WithCORS(CORS{AllowedOrigins: []string{"https://ui.example.com/"}, MaxAge: time.Hour}))
+	require.NoError(t, err)
+	preflight := func(origin, method, headers string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodOptions, "/statusthings/api/abc", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set("Access-Control-Request-Method", method)
+		r.Header.Set("Access-Control-Request-Headers", headers)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	w := preflight("https://ui.example.com", http.MethodPut, "content-type, x-statusthing-key, if-match")
+	require.Equal(t, http.StatusNoContent, w.Code, "preflight should not need an api key or content type")
+	require.Equal(t, "https://ui.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Contains(t, w.Header().Get("Access-Control-Allow-Methods"), http.MethodPut)
+	require.Contains(t, w.Header().Get("Access-Control-Allow-Headers"), apiKeyHeader)
+	require.Equal(t, "3600", w.Header().Get("Access-Control-Max-Age"))
+	require.Contains(t, w.Header().Values("Vary"), "Origin")
+
+	require.Equal(t, http.StatusForbidden, preflight("https://evil.example.com", http.MethodPut, "").Code)
+	require.Empty(t, preflight("https://evil.example.com", http.MethodPut, "").Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, http.StatusForbidden, preflight("https://ui.example.com", http.MethodPatch, "").Code)
+	require.Equal(t, http.StatusForbidden, preflight("https://ui.example.com", http.MethodGet, "x-custom").Code)
+
+	get := func(origin string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/statusthings/api/", nil)
+		r.Header.Set("Origin", origin)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		r.Header.Set(apiKeyHeader, "secret")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+	w = get("https://ui.example.com")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Equal(t, "https://ui.example.com", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Contains(t, w.Header().Get("Access-Control-Expose-Headers"), etagHeader)
+	w = get("https://evil.example.com")
+	require.Equal(t, http.StatusOK, w.Code, "the browser enforces cors for other origins")
+	require.Empty(t, w.Header().Get("Access-Control-Allow-Origin"))
+
+	anyOrigin, err := NewStatusThingHandler(p, WithCORS(CORS{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"get"}}))
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodOptions, "/statusthings/api/", nil)
+	r.Header.Set("Origin", "https://anywhere.example.com")
+	r.Header.Set("Access-Control-Request-Method", http.MethodGet)
+	w = httptest.NewRecorder()
+	anyOrigin.ServeHTTP(w, r)
+	require.Equal(t, http.StatusNoContent, w.Code)
+	require.Equal(t, "*", w.Header().Get("Access-Control-Allow-Origin"))
+	require.Equal(t, http.MethodGet, w.Header().Get("Access-Control-Allow-Methods"))
+}
+
+func TestSetAPIKeys(t *testing.T) {
+	t.Parallel()
+	p := &testProvider{allFunc: func() ([]*types.StatusThing, error) { return []*types.StatusThing{}, nil }}
+	h, err := NewStatusThingHandler(p, WithAPIKey("old"))
+	require.NoError(t, err)
+	get := func(key string) int {
+		r := httptest.NewRequest(http.MethodGet, "/statusthings/api/", nil)
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		r.Header.Set(apiKeyHeader, key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+	require.Equal(t, http.StatusOK, get("old"))
+
+	require.Error(t, h.SetAPIKeys(map[string]string{"ci": "same", "deploy": "same"}), "keys should be unique")
+	require.Error(t, h.SetAPIKeys(map[string]string{}), "should not stop requiring keys")
+	require.Equal(t, http.StatusOK, get("old"), "failed changes should keep the existing keys")
+
+	require.NoError(t, h.SetAPIKeys(map[string]string{"ci": "new"}))
+	require.Equal(t, http.StatusForbidden, get("old"))
+	require.Equal(t, http.StatusOK, get("new"))
+}
+
+func TestClientCertAuth(t *testing.T) {
+	t.Parallel()
+	_, err := NewStatusThingHandler(&testProvider{}, WithClientCertAuth(""))
+	require.Error(t, err)
+
+	p := &testProvider{allFunc: func() ([]*types.StatusThing, error) { return []*types.StatusThing{}, nil }}
+	withCert := func(cn string) *tls.ConnectionState {
+		return &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}}}}}
+	}
+	type testCase struct {
+		opts   []HandlerOption
+		tls    *tls.ConnectionState
+		key    string
+		status int
+	}
+	testCases := map[string]testCase{
+		"any-subject":        {opts: []HandlerOption{WithClientCertAuth()}, tls: withCert("anyone"), status: http.StatusOK},
+		"no-cert":            {opts: []HandlerOption{WithClientCertAuth()}, tls: &tls.ConnectionState{}, status: http.StatusForbidden},
+		"allowed-subject":    {opts: []HandlerOption{WithClientCertAuth("ci"), WithAPIKey("sekret")}, tls: withCert("ci"), status: http.StatusOK},
+		"disallowed-subject": {opts: []HandlerOption{WithClientCertAuth("ci"), WithAPIKey("sekret")}, tls: withCert("other"), status: http.StatusForbidden},
+		"key-instead":        {opts: []HandlerOption{WithClientCertAuth("ci"), WithAPIKey("sekret")}, tls: withCert("other"), key: "sekret", status: http.StatusOK},
+		"certs-not-enabled":  {opts: []HandlerOption{WithAPIKey("sekret")}, tls: withCert("ci"), status: http.StatusForbidden},
+	}
+	for n, tc := range testCases {
+		tc := tc
+		t.Run(n, func(t *testing.T) {
+			t.Parallel()
+			h, err := NewStatusThingHandler(p, tc.opts...)
+			require.NoError(t, err)
+			r := httptest.NewRequest(http.MethodGet, "/statusthings/api/", nil)
+			r.Header.Set(contentTypeHeader, applicationJSON)
+			if tc.key != "" {
+				r.Header.Set(apiKeyHeader, tc.key)
+			}
+			r.TLS = tc.tls
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			require.Equal(t, tc.status, w.Code)
+		})
+	}
+}
+
+type testReceiver struct {
+	name        string
+	receiveFunc func(*http.Request) (*receivers.Result, error)
+}
+
+func (tr *testReceiver) Name() string {
+	if tr.name == "" {
+		return "test"
+	}
+	return tr.name
+}
+
+// testAuthenticator is a receiver that verifies requests itself
+type testAuthenticator struct {
+	testReceiver
+}
+
+func (ta *testAuthenticator) Authenticates() bool { return true }
+
+func (tr *testReceiver) Receive(_ context.Context, r *http.Request) (*receivers.Result, error) {
+	return tr.receiveFunc(r)
+}
+
+func TestHooks(t *testing.T) {
+	t.Parallel()
+	rcv := &testReceiver{receiveFunc: func(r *http.Request) (*receivers.Result, error) {
+		switch r.URL.Query().Get("outcome") {
+		case "invalid":
+			return nil, types.NewValidationError("body", "bad payload")
+		case "error":
+			return nil, fmt.Errorf("snarf")
+		case "read":
+			if _, err := io.ReadAll(r.Body); err != nil {
+				return nil, fmt.Errorf("unable to read body: %w", err)
+			}
+		}
+		return &receivers.Result{Updated: []string{"api"}, Unchanged: []string{}, Skipped: []string{}}, nil
+	}}
+	_, err := NewStatusThingHandler(&testProvider{}, WithReceiver(nil))
+	require.Error(t, err, "should require a receiver")
+	_, err = NewStatusThingHandler(&testProvider{}, WithReceiver(rcv), WithReceiver(rcv))
+	require.Error(t, err, "should not allow duplicate receivers")
+	signed := &testAuthenticator{testReceiver{name: "signed", receiveFunc: func(r *http.Request) (*receivers.Result, error) {
+		if r.Header.Get("X-Signature") != "good" {
+			return nil, receivers.ErrUnauthorized
+		}
+		return rcv.receiveFunc(r)
+	}}}
+	h, err := NewStatusThingHandler(&testProvider{}, WithReceiver(rcv), WithReceiver(signed), WithAPIKey("sekret"), WithMaxBodyBytes(64))
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		path    string
+		method  string
+		headers map[string]string
+		body    string
+		status  int
+		code    string
+	}{
+		"ok-header":       {path: "/statusthings/hooks/test", headers: map[string]string{"X-STATUSTHING-KEY": "sekret"}, status: http.StatusOK},
+		"ok-bearer":       {path: "/statusthings/hooks/test", headers: map[string]string{"Authorization": "Bearer sekret"}, status: http.StatusOK},
+		"no-key":          {path: "/statusthings/hooks/test", status: http.StatusForbidden, code: codePermissionDenied},
+		"wrong-bearer":    {path: "/statusthings/hooks/test", headers: map[string]string{"Authorization": "Bearer nope"}, status: http.StatusForbidden, code: codePermissionDenied},
+		"unknown":         {path: "/statusthings/hooks/nope", headers: map[string]string{"X-STATUSTHING-KEY": "sekret"}, status: http.StatusNotFound, code: codeNotFound},
+		"wrong-method":    {path: "/statusthings/hooks/test", method: http.MethodGet, status: http.StatusMethodNotAllowed, code: codeMethodNotAllowed},
+		"invalid-payload": {path: "/statusthings/hooks/test?outcome=invalid", headers: map[string]string{"X-STATUSTHING-KEY": "sekret"}, status: http.StatusBadRequest, code: codeValidationFailed},
+		"receiver-error":  {path: "/statusthings/hooks/test?outcome=error", headers: map[string]string{"X-STATUSTHING-KEY": "sekret"}, status: http.StatusInternalServerError, code: codeInternalError},
+		"signed-no-key":   {path: "/statusthings/hooks/signed", headers: map[string]string{"X-Signature": "good"}, status: http.StatusOK},
+		"signed-bad":      {path: "/statusthings/hooks/signed", headers: map[string]string{"X-Signature": "bad", "X-STATUSTHING-KEY": "sekret"}, status: http.StatusForbidden, code: codePermissionDenied},
+		"body-ok":         {path: "/statusthings/hooks/signed?outcome=read", headers: map[string]string{"X-Signature": "good"}, body: strings.Repeat("a", 64), status: http.StatusOK},
+		"body-too-large":  {path: "/statusthings/hooks/signed?outcome=read", headers: map[string]string{"X-Signature": "good"}, body: strings.Repeat("a", 65), status: http.StatusRequestEntityTooLarge, code: codeBodyTooLarge},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			method := tc.method
+			if method == "" {
+				method = http.MethodPost
+			}
+			reqBody := tc.body
+			if reqBody == "" {
+				reqBody = `{}`
+			}
+			r := httptest.NewRequest(method, tc.path, strings.NewReader(reqBody))
+			for k, v := range tc.headers {
+				r.Header.Set(k, v)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			result := w.Result()
+			defer result.Body.Close()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.Equal(t, tc.status, result.StatusCode)
+			if tc.code != "" {
+				require.Equal(t, tc.code, decodeProblem(t, body).Code)
+				return
+			}
+			var res receivers.Result
+			require.NoError(t, json.Unmarshal(body, &res))
+			require.Equal(t, []string{"api"}, res.Updated)
+		})
+	}
+}
+
+type testSubscriptions struct {
+	lock   sync.Mutex
+	email  string
+	filter notifiers.Filter
+	// calls are the confirm and unsubscribe calls made
+	calls []string
+}
+
+func (ts *testSubscriptions) Subscribe(_ context.Context, email string, filter notifiers.Filter) error {
+	if email == "bad" {
+		return types.NewValidationError("email", "a valid email address must be provided")
+	}
+	ts.email, ts.filter = email, filter
+	return nil
+}
+
+func (ts *testSubscriptions) Confirm(_ context.Context, token string) error {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.calls = append(ts.calls, "confirm "+token)
+	if token != "good" {
+		return types.ErrNotFound
+	}
+	return nil
+}
+
+func (ts *testSubscriptions) Unsubscribe(_ context.Context, token string) error {
+	ts.lock.Lock()
+	defer ts.lock.Unlock()
+	ts.calls = append(ts.calls, "unsubscribe "+token)
+	if token == "error" {
+		return fmt.Errorf("snarf")
+	}
+	if token != "good" {
+		return types.ErrNotFound
+	}
+	return nil
+}
+
+func TestSubscriptions(t *testing.T) {
+	t.Parallel()
+	_, err := NewStatusThingHandler(&testProvider{}, WithSubscriptions(nil))
+	require.Error(t, err, "should require subscriptions")
+	_, err = NewStatusThingHandler(&testProvider{}, WithSubscribeRateLimit(nil))
+	require.Error(t, err, "should require a limiter")
+	subs := &testSubscriptions{}
+	limiter, err := ratelimit.New(100, 100)
+	require.NoError(t, err)
+	h, err := NewStatusThingHandler(&testProvider{}, WithSubscriptions(subs), WithAPIKey("sekret"), WithSubscribeRateLimit(limiter), WithMaxBodyBytes(64))
+	require.NoError(t, err)
+
+	testCases := map[string]struct {
+		method      string
+		path        string
+		body        string
+		contentType string
+		status      int
+		code        string
+	}{
+		"subscribe":         {method: http.MethodPost, path: "/statusthings/subscriptions", body: `{"email":"a@example.com","groups":["core"]}`, contentType: applicationJSON, status: http.StatusAccepted},
+		"subscribe-invalid": {method: http.MethodPost, path: "/statusthings/subscriptions", body: `{"email":"bad"}`, contentType: applicationJSON, status: http.StatusBadRequest, code: codeValidationFailed},
+		"subscribe-body":    {method: http.MethodPost, path: "/statusthings/subscriptions", body: `[`, contentType: applicationJSON, status: http.StatusBadRequest, code: codeInvalidBody},
+		"subscribe-type":    {method: http.MethodPost, path: "/statusthings/subscriptions", body: `{}`, contentType: "text/plain", status: http.StatusUnsupportedMediaType, code: codeInvalidContentType},
+		"subscribe-large":   {method: http.MethodPost, path: "/statusthings/subscriptions", body: `{"email":"` + strings.Repeat("a", 64) + `@example.com"}`, contentType: applicationJSON, status: http.StatusRequestEntityTooLarge, code: codeBodyTooLarge},
+		"confirm":           {method: http.MethodPost, path: "/statusthings/subscriptions/confirm?token=good", status: http.StatusOK},
+		"confirm-invalid":   {method: http.MethodPost, path: "/statusthings/subscriptions/confirm?token=bad", status: http.StatusNotFound, code: codeNotFound},
+		"confirm-no-token":  {method: http.MethodGet, path: "/statusthings/subscriptions/confirm", status: http.StatusNotFound, code: codeNotFound},
+		"unsubscribe":       {method: http.MethodPost, path: "/statusthings/subscriptions/unsubscribe?token=good", status: http.StatusOK},
+		"unsubscribe-error": {method: http.MethodPost, path: "/statusthings/subscriptions/unsubscribe?token=error", status: http.StatusInternalServerError, code: codeInternalError},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			r := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				r.Header.Set(contentTypeHeader, tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			result := w.Result()
+			defer result.Body.Close()
+			body, err := io.ReadAll(result.Body)
+			require.NoError(t, err)
+			require.Equal(t, tc.status, result.StatusCode, string(body))
+			if tc.code != "" {
+				require.Equal(t, tc.code, decodeProblem(t, body).Code)
+			}
+		})
+	}
+}
+
+func TestSubscriptionForms(t *testing.T) {
+	t.Parallel()
+	subs := &testSubscriptions{}
+	h, err := NewStatusThingHandler(&testProvider{}, WithSubscriptions(subs))
+	require.NoError(t, err)
+	for _, p := range []string{"/statusthings/subscriptions/confirm", "/statusthings/subscriptions/unsubscribe"} {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, p+"?token=a%26b", nil))
+		res := w.Result()
+		require.Equal(t, http.StatusOK, res.StatusCode, p)
+		require.Contains(t, res.Header.Get(contentTypeHeader), textHTML)
+		require.Contains(t, w.Body.String(), `<form method="post" action="?token=a%26b">`, "the form should post the token back")
+	}
+	require.Empty(t, subs.calls, "following a link should not change anything")
+}
+
+func TestSubscriptionsRateLimit(t *testing.T) {
+	t.Parallel()
+	limiter, err := ratelimit.New(1, 1)
+	require.NoError(t, err)
+	h, err := NewStatusThingHandler(&testProvider{}, WithSubscriptions(&testSubscriptions{}), WithSubscribeRateLimit(limiter))
+	require.NoError(t, err)
+	subscribe := func(remoteAddr string) *http.Response {
+		r := httptest.NewRequest(http.MethodPost, "/statusthings/subscriptions", strings.NewReader(`{"email":"a@example.com"}`))
+		r.Header.Set(contentTypeHeader, applicationJSON)
+		r.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Result()
+	}
+	require.Equal(t, http.StatusAccepted, subscribe("192.0.2.1:1234").StatusCode)
+	res := subscribe("192.0.2.1:5678")
+	require.Equal(t, http.StatusTooManyRequests, res.StatusCode, "subscriptions should be limited by address")
+	require.NotEmpty(t, res.Header.Get(retryAfterHeader))
+	require.Equal(t, http.StatusAccepted, subscribe("192.0.2.2:1234").StatusCode, "other addresses should not be limited")
+}
+
+func TestSubscribeFilter(t *testing.T) {
+	t.Parallel()
+	subs := &testSubscriptions{}
+	h, err := NewStatusThingHandler(&testProvider{}, WithSubscriptions(subs))
+	require.NoError(t, err)
+	r := httptest.NewRequest(http.MethodPost, "/statusthings/subscriptions", strings.NewReader(`{"email":"a@example.com","things":["api"],"groups":["core"]}`))
+	r.Header.Set(contentTypeHeader, applicationJSON)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	require.Equal(t, http.StatusAccepted, w.Code)
+	require.Equal(t, "a@example.com", subs.email)
+	require.Equal(t, notifiers.Filter{Things: []string{"api"}, Groups: []string{"core"}}, subs.filter)
+}
+
+func decodeProblem(t *testing.T, body []byte) problem {
+	t.Helper()
+	prob := problem{}
+	require.NoError(t, json.Unmarshal(body, &prob), "body should be a problem")
+	return prob
+}
+
 type testProvider struct {
 	providers.UnimplementedProvider
 	allFunc    func() ([]*types.StatusThing, error)
 	getFunc    func(string) (*types.StatusThing, error)
 	addFunc    func(providers.Params) (*types.StatusThing, error)
-	removeFunc func(string) error
-	statusFunc func(string, types.Status) error
+	removeFunc func(string, *dbfilters.Filters) error
+	statusFunc func(string, types.Status, *dbfilters.Filters) error
 }
 
 // All gets all [types.StatusThing]
@@ -510,17 +1963,44 @@ func (tp *testProvider) Add(ctx context.Context, newThing providers.Params) (*ty
 }
 
 // Remove removes a [types.StatusThing] by its id
-func (tp *testProvider) Remove(ctx context.Context, id string) error {
+func (tp *testProvider) Remove(ctx context.Context, id string, opts ...dbfilters.Option) error {
 	if tp.removeFunc == nil {
 		return fmt.Errorf("missing removefunc")
 	}
-	return tp.removeFunc(id)
+	dbopts, err := dbfilters.New(opts...)
+	if err != nil {
+		return err
+	}
+	return tp.removeFunc(id, dbopts)
 }
 
 // SetStatus sets the status of a [types.StatusThing] by its id
-func (tp *testProvider) SetStatus(ctx context.Context, id string, status types.Status) error {
+// the thing from getFunc, if set, is returned as previous with the change applied to it as updated
+func (tp *testProvider) SetStatus(ctx context.Context, id string, status types.Status, opts ...dbfilters.Option) (*types.StatusThing, *types.StatusThing, error) {
 	if tp.statusFunc == nil {
-		return fmt.Errorf("missing statusfunc")
+		return nil, nil, fmt.Errorf("missing statusfunc")
+	}
+	dbopts, err := dbfilters.New(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := tp.statusFunc(id, status, dbopts); err != nil {
+		return nil, nil, err
+	}
+	previous := &types.StatusThing{ID: id}
+	if tp.getFunc != nil {
+		if previous, err = tp.getFunc(id); err != nil {
+			return nil, nil, err
+		}
+	}
+	updated := *previous
+	updated.Status = status
+	if dbopts.Description() != "" {
+		updated.Description = dbopts.Description()
+	}
+	if group, ok := dbopts.Group(); ok {
+		updated.Group = group
 	}
-	return tp.statusFunc(id, status)
+	updated.Version++
+	return previous, &updated, nil
 }
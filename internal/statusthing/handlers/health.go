@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+
+	"golang.org/x/exp/slog"
+)
+
+// liveness and readiness are served at these paths regardless of the base path
+const (
+	healthzPath = "/healthz"
+	readyzPath  = "/readyz"
+)
+
+// readinessTimeout is how long all readiness checks are given to finish
+const readinessTimeout = 5 * time.Second
+
+// ReadinessCheck reports an error if something the app needs to serve requests is unavailable
+type ReadinessCheck func(ctx context.Context) error
+
+const (
+	healthOK          = "ok"
+	healthUnavailable = "unavailable"
+)
+
+type healthResponse struct {
+	Status string `json:"status"`
+	// Checks are the results of each readiness check by name
+	Checks map[string]checkResponse `json:"checks,omitempty"`
+}
+
+type checkResponse struct {
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+func (h *StatusThingHandler) addHealthRoutes(r chi.Router) {
+	r.Get(healthzPath, h.healthz)
+	r.Get(readyzPath, h.readyz)
+}
+
+// healthz reports that the process is alive and serving requests
+func (h *StatusThingHandler) healthz(w http.ResponseWriter, r *http.Request) {
+	writeHealth(r.Context(), w, http.StatusOK, &healthResponse{Status: healthOK})
+}
+
+// readyz runs every readiness check concurrently and is unavailable if any of them fail
+func (h *StatusThingHandler) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	names := make([]string, 0, len(h.readinessChecks))
+	for name := range h.readinessChecks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	results := make([]checkResponse, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		wg.Add(1)
+		go func(i int, check ReadinessCheck) {
+			defer wg.Done()
+			start := time.Now()
+			res := checkResponse{Status: healthOK}
+			if err := check(ctx); err != nil {
+				res.Status = healthUnavailable
+				res.Error = err.Error()
+			}
+			res.Duration = time.Since(start).String()
+			results[i] = res
+		}(i, h.readinessChecks[name])
+	}
+	wg.Wait()
+
+	status := http.StatusOK
+	res := &healthResponse{Status: healthOK, Checks: make(map[string]checkResponse, len(names))}
+	for i, name := range names {
+		if results[i].Status != healthOK {
+			status = http.StatusServiceUnavailable
+			res.Status = healthUnavailable
+			slog.WarnCtx(ctx, "readiness check failed", "check", name, "err", results[i].Error)
+		}
+		res.Checks[name] = results[i]
+	}
+	writeHealth(r.Context(), w, status, res)
+}
+
+func writeHealth(ctx context.Context, w http.ResponseWriter, status int, res *healthResponse) {
+	w.Header().Set(contentTypeHeader, applicationJSON)
+	// probes should always see the current state
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		slog.ErrorCtx(ctx, "unable to encode health response", "err", err)
+	}
+}
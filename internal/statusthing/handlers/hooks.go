@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	chi "github.com/go-chi/chi/v5"
+
+	"github.com/lusis/apithings/internal/statusthing/receivers"
+	"github.com/lusis/apithings/internal/statusthing/types"
+
+	"golang.org/x/exp/slog"
+)
+
+// hooksPath is where webhook receivers are served under the base path
+const hooksPath = "/hooks/"
+
+func (h *StatusThingHandler) addHookRoutes(r chi.Router) {
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		writeError(r.Context(), w, http.StatusNotFound, codeNotFound, "no such receiver")
+	})
+
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeError(r.Context(), w, http.StatusMethodNotAllowed, codeMethodNotAllowed, "method not allowed")
+	})
+
+	r.Post("/{receiver}", func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		receiver, ok := h.receivers[chi.URLParam(r, "receiver")]
+		if !ok {
+			writeError(ctx, w, http.StatusNotFound, codeNotFound, "no such receiver")
+			return
+		}
+		// webhook senders can rarely set custom headers so a bearer token is accepted as well
+		if h.requiresAuth() && !authenticates(receiver) && !h.authorized(r, true) {
+			writeError(ctx, w, http.StatusForbidden, codePermissionDenied, "permission denied")
+			return
+		}
+		// receivers read the body before they can verify it so it gets the same limit as the api
+		r.Body = http.MaxBytesReader(w, r.Body, h.maxBodyBytes)
+		res, err := receiver.Receive(ctx, r)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeError(ctx, w, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body must be at most %d bytes", tooLarge.Limit))
+			return
+		}
+		if errors.Is(err, receivers.ErrUnauthorized) {
+			writeError(ctx, w, http.StatusForbidden, codePermissionDenied, "webhook could not be verified")
+			return
+		}
+		if errors.Is(err, types.ErrRequiredValueMissing) {
+			writeValidationProblem(ctx, w, err)
+			return
+		}
+		if err != nil {
+			slog.ErrorCtx(ctx, "error handling webhook", "receiver", receiver.Name(), "err", err)
+			writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
+			return
+		}
+		slog.DebugCtx(ctx, "handled webhook", "receiver", receiver.Name(), "updated", res.Updated, "skipped", res.Skipped)
+		if err := json.NewEncoder(w).Encode(res); err != nil {
+			slog.ErrorCtx(ctx, "encoding error", "err", err)
+		}
+	})
+}
+
+// authenticates reports if the receiver verifies its own requests
+func authenticates(r receivers.Receiver) bool {
+	a, ok := r.(receivers.Authenticator)
+	return ok && a.Authenticates()
+}
+
+// bearerToken returns the token from an Authorization: Bearer header
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) < len("bearer ") || !strings.EqualFold(auth[:len("bearer ")], "bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[len("bearer "):])
+}
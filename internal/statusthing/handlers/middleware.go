@@ -0,0 +1,103 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/segmentio/ksuid"
+
+	"golang.org/x/exp/slog"
+)
+
+// RequestIDHeader is the header used to read and propagate request ids
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength is the longest caller provided request id we will propagate
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// RequestIDFromContext returns the request id stored in the context or an empty string
+func RequestIDFromContext(ctx context.Context) string {
+	if id, ok := ctx.Value(requestIDKey{}).(string); ok {
+		return id
+	}
+	return ""
+}
+
+// requestID is middleware that propagates the caller's request id or assigns a new one
+func requestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(RequestIDHeader)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = ksuid.New().String()
+		}
+		w.Header().Set(RequestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// logRequests is middleware that logs every request to the access log once it is complete
+// probes are frequent and uninteresting so they are only logged at debug level
+func (h *StatusThingHandler) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		status := ww.Status()
+		if status == 0 {
+			// nothing was written so net/http will send a 200
+			status = http.StatusOK
+		}
+		attrs := []any{
+			"http.method", r.Method,
+			"http.path", r.URL.Path,
+			"http.status_code", status,
+			"http.response_bytes", ww.BytesWritten(),
+			"http.duration", time.Since(start),
+			"http.remote_addr", r.RemoteAddr,
+		}
+		if name, ok := h.apiKeyName(r, true); ok {
+			attrs = append(attrs, "apikey.name", name)
+		}
+		if subject, ok := h.clientCertSubject(r); ok {
+			attrs = append(attrs, "tls.client_subject", subject)
+		}
+		level := slog.LevelInfo
+		if r.URL.Path == healthzPath || r.URL.Path == readyzPath {
+			level = slog.LevelDebug
+		}
+		h.accessLog.Log(r.Context(), level, "request", attrs...)
+	})
+}
+
+// RequestIDLogHandler adds the request id from the context to log records
+type RequestIDLogHandler struct {
+	slog.Handler
+}
+
+// NewRequestIDLogHandler returns a new [RequestIDLogHandler] wrapping h
+func NewRequestIDLogHandler(h slog.Handler) *RequestIDLogHandler {
+	return &RequestIDLogHandler{Handler: h}
+}
+
+// Handle adds the request id to the record if the context has one
+func (rh *RequestIDLogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestIDFromContext(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return rh.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a new [RequestIDLogHandler] with the attributes
+func (rh *RequestIDLogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &RequestIDLogHandler{Handler: rh.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a new [RequestIDLogHandler] with the group
+func (rh *RequestIDLogHandler) WithGroup(name string) slog.Handler {
+	return &RequestIDLogHandler{Handler: rh.Handler.WithGroup(name)}
+}
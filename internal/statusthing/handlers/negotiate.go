@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const acceptHeader = "accept"
+
+// isJSON reports if the media type in a content-type header is json
+// parameters are ignored and structured syntax suffixes i.e. application/merge-patch+json are json too
+func isJSON(contentType string) bool {
+	mt, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	return mt == applicationJSON || (strings.HasPrefix(mt, "application/") && strings.HasSuffix(mt, "+json"))
+}
+
+// acceptsJSON reports if an accept header allows a json response
+// a missing header accepts anything
+func acceptsJSON(accept string) bool {
+	if strings.TrimSpace(accept) == "" {
+		return true
+	}
+	for _, rng := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(rng)
+		if err != nil {
+			continue
+		}
+		// q=0 means the media type is not acceptable
+		if q, ok := params["q"]; ok {
+			if weight, err := strconv.ParseFloat(q, 64); err == nil && weight <= 0 {
+				continue
+			}
+		}
+		switch mt {
+		case "*/*", "application/*", applicationJSON:
+			return true
+		}
+	}
+	return false
+}
+
+// hasBody reports if requests using method send a body to be decoded
+func hasBody(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch
+}
+
+// negotiateJSON is middleware for routes that only speak json
+// request bodies must be json, the caller must accept json and responses are marked as json
+func negotiateJSON(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if hasBody(r.Method) && !isJSON(r.Header.Get(contentTypeHeader)) {
+			writeError(r.Context(), w, http.StatusUnsupportedMediaType, codeInvalidContentType, "content type must be application/json")
+			return
+		}
+		if !acceptsJSON(r.Header.Get(acceptHeader)) {
+			writeError(r.Context(), w, http.StatusNotAcceptable, codeNotAcceptable, "responses are only available as application/json")
+			return
+		}
+		// problems replace this with their own content type
+		w.Header().Set(contentTypeHeader, applicationJSON)
+		next.ServeHTTP(w, r)
+	})
+}
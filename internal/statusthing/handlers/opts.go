@@ -2,6 +2,16 @@ package handlers
 
 import (
 	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/lusis/apithings/internal/statusthing/metrics"
+	"github.com/lusis/apithings/internal/statusthing/ratelimit"
+	"github.com/lusis/apithings/internal/statusthing/receivers"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"golang.org/x/exp/slog"
 )
 
 // HandlerOption is a functional option type
@@ -20,11 +30,225 @@ func WithBasePath(path string) HandlerOption {
 
 // WithAPIKey sets the api key
 func WithAPIKey(key string) HandlerOption {
+	return WithNamedAPIKey(defaultAPIKeyName, key)
+}
+
+// WithNamedAPIKey adds an accepted api key
+// the name is logged instead of the key to tell callers apart
+func WithNamedAPIKey(name, key string) HandlerOption {
 	return func(sth *StatusThingHandler) error {
 		if key == "" {
 			return fmt.Errorf("a non-empty key must be provided")
 		}
-		sth.apikey = key
+		if name == "" {
+			return fmt.Errorf("a non-empty key name must be provided")
+		}
+		if existing, ok := sth.apikeys[key]; ok {
+			return fmt.Errorf("key %s is the same as key %s", name, existing)
+		}
+		sth.apikeys[key] = name
+		return nil
+	}
+}
+
+// WithClientCertAuth accepts verified tls client certificates in place of an api key
+// the certificate's subject common name is the caller's identity and, if any subjects are provided, must be one of them
+func WithClientCertAuth(subjects ...string) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		sth.clientCertAuth = true
+		sth.clientCertSubjects = make(map[string]struct{}, len(subjects))
+		for _, s := range subjects {
+			if s == "" {
+				return fmt.Errorf("client certificate subjects cannot be empty")
+			}
+			sth.clientCertSubjects[s] = struct{}{}
+		}
+		return nil
+	}
+}
+
+// WithCORS allows browsers on other origins to call the api
+func WithCORS(c CORS) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		cfg, err := newCORS(c)
+		if err != nil {
+			return err
+		}
+		sth.cors = cfg
+		return nil
+	}
+}
+
+// WithIPRateLimit limits api requests from each client address with l
+func WithIPRateLimit(l *ratelimit.Limiter) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if l == nil {
+			return fmt.Errorf("limiter cannot be nil")
+		}
+		sth.ipLimiter = l
+		return nil
+	}
+}
+
+// WithAPIKeyRateLimit limits api requests made with each api key or client certificate with l
+func WithAPIKeyRateLimit(l *ratelimit.Limiter) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if l == nil {
+			return fmt.Errorf("limiter cannot be nil")
+		}
+		sth.apiKeyLimiter = l
+		return nil
+	}
+}
+
+// WithMaxBodyBytes sets the largest request body the api will decode (default 1MiB)
+func WithMaxBodyBytes(n int64) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if n < 1 {
+			return fmt.Errorf("max body bytes must be positive")
+		}
+		sth.maxBodyBytes = n
+		return nil
+	}
+}
+
+// WithAccessLog logs every request to logger at info level
+func WithAccessLog(logger *slog.Logger) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if logger == nil {
+			return fmt.Errorf("logger cannot be nil")
+		}
+		sth.accessLog = logger
+		return nil
+	}
+}
+
+// WithMetrics records request metrics and serves them at /metrics
+func WithMetrics(m *metrics.Metrics) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if m == nil {
+			return fmt.Errorf("metrics cannot be nil")
+		}
+		sth.metrics = m
+		return nil
+	}
+}
+
+// WithReceiver serves the webhook receiver at <basepath>/hooks/<name>
+func WithReceiver(r receivers.Receiver) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if r == nil {
+			return fmt.Errorf("receiver cannot be nil")
+		}
+		if _, ok := sth.receivers[r.Name()]; ok {
+			return fmt.Errorf("a receiver named %s already exists", r.Name())
+		}
+		sth.receivers[r.Name()] = r
+		return nil
+	}
+}
+
+// WithSubscriptions serves the email subscription routes under <basepath>/subscriptions
+func WithSubscriptions(s Subscriptions) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if s == nil {
+			return fmt.Errorf("subscriptions cannot be nil")
+		}
+		sth.subscriptions = s
+		return nil
+	}
+}
+
+// WithSubscribeRateLimit limits new subscriptions from each client address with l
+// anyone can subscribe so subscriptions are limited by default to a few a minute
+func WithSubscribeRateLimit(l *ratelimit.Limiter) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if l == nil {
+			return fmt.Errorf("limiter cannot be nil")
+		}
+		sth.subscribeLimiter = l
+		return nil
+	}
+}
+
+// WithFlapping marks things the detector reports as flapping in api responses
+func WithFlapping(f FlapDetector) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if f == nil {
+			return fmt.Errorf("flap detector cannot be nil")
+		}
+		sth.flapping = f
+		return nil
+	}
+}
+
+// WithHistory serves feeds of status changes from the history
+func WithHistory(hist History) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if hist == nil {
+			return fmt.Errorf("history cannot be nil")
+		}
+		sth.history = hist
+		return nil
+	}
+}
+
+// WithPublicURL sets the absolute url the base path can be reached at from outside
+// it is used for links that have to be absolute i.e. in feeds
+func WithPublicURL(publicURL string) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		u, err := url.Parse(publicURL)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("public url must be absolute")
+		}
+		sth.publicURL = strings.TrimSuffix(publicURL, "/")
+		return nil
+	}
+}
+
+// WithoutDashboard skips the dashboard routes for when another ui is pointed at the api
+func WithoutDashboard() HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		sth.noDashboard = true
+		return nil
+	}
+}
+
+// WithUptime serves the uptime of things and shows it on the dashboard
+func WithUptime(u Uptime) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if u == nil {
+			return fmt.Errorf("uptime cannot be nil")
+		}
+		sth.uptime = u
+		return nil
+	}
+}
+
+// WithReadinessCheck adds a check that must pass for /readyz to report the app as ready
+func WithReadinessCheck(name string, check ReadinessCheck) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if name == "" {
+			return fmt.Errorf("a non-empty check name must be provided")
+		}
+		if check == nil {
+			return fmt.Errorf("readiness check cannot be nil")
+		}
+		if _, ok := sth.readinessChecks[name]; ok {
+			return fmt.Errorf("a readiness check named %s already exists", name)
+		}
+		sth.readinessChecks[name] = check
+		return nil
+	}
+}
+
+// WithTracerProvider starts a span for every request using tp
+func WithTracerProvider(tp trace.TracerProvider) HandlerOption {
+	return func(sth *StatusThingHandler) error {
+		if tp == nil {
+			return fmt.Errorf("tracer provider cannot be nil")
+		}
+		sth.tracerProvider = tp
 		return nil
 	}
 }
@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"golang.org/x/exp/slog"
+)
+
+const applicationProblemJSON = "application/problem+json"
+
+// stable, machine-readable error codes returned in the code member of a [problem]
+const (
+	codePermissionDenied   = "permission_denied"
+	codeInvalidContentType = "invalid_content_type"
+	codeNotAcceptable      = "not_acceptable"
+	codeInvalidBody        = "invalid_body"
+	codeBodyTooLarge       = "body_too_large"
+	codeValidationFailed   = "validation_failed"
+	codeAlreadyExists      = "already_exists"
+	codeNotFound           = "not_found"
+	codePreconditionFailed = "precondition_failed"
+	codeMethodNotAllowed   = "method_not_allowed"
+	codeRateLimited        = "rate_limited"
+	codeInternalError      = "internal_error"
+)
+
+// problem is an RFC 7807 problem details response
+// code, field and request_id are extension members
+type problem struct {
+	Type      string `json:"type"`
+	Title     string `json:"title"`
+	Status    int    `json:"status"`
+	Detail    string `json:"detail,omitempty"`
+	Code      string `json:"code"`
+	Field     string `json:"field,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeProblem writes the provided problem to the client as application/problem+json
+// type, title and request_id are populated if not already set
+func writeProblem(ctx context.Context, w http.ResponseWriter, p *problem) {
+	if p.Type == "" {
+		p.Type = "about:blank"
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.RequestID == "" {
+		p.RequestID = RequestIDFromContext(ctx)
+	}
+	w.Header().Set(contentTypeHeader, applicationProblemJSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if err := json.NewEncoder(w).Encode(p); err != nil {
+		slog.ErrorCtx(ctx, "unable to encode problem", "err", err)
+	}
+}
+
+// writeError is a shorthand for writing a [problem] with only a code and detail
+func writeError(ctx context.Context, w http.ResponseWriter, status int, code, detail string) {
+	writeProblem(ctx, w, &problem{Status: status, Code: code, Detail: detail})
+}
@@ -0,0 +1,67 @@
+package handlers
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/lusis/apithings/internal/statusthing/ratelimit"
+)
+
+// defaultMaxBodyBytes is the largest request body decoded by the api unless changed with [WithMaxBodyBytes]
+const defaultMaxBodyBytes = 1 << 20
+
+const retryAfterHeader = "Retry-After"
+
+// limitByIP writes a problem and returns false if the caller's address has made too many requests
+func (h *StatusThingHandler) limitByIP(w http.ResponseWriter, r *http.Request) bool {
+	if h.ipLimiter == nil {
+		return true
+	}
+	return limit(w, r, h.ipLimiter, clientIP(r))
+}
+
+// limitByAPIKey writes a problem and returns false if the caller's api key or client certificate has made too many requests
+// anonymous callers are only limited by address
+func (h *StatusThingHandler) limitByAPIKey(w http.ResponseWriter, r *http.Request) bool {
+	if h.apiKeyLimiter == nil {
+		return true
+	}
+	key := ""
+	if name, ok := h.apiKeyName(r, false); ok {
+		key = "apikey:" + name
+	} else if subject, ok := h.clientCertSubject(r); ok {
+		key = "cert:" + subject
+	}
+	if key == "" {
+		return true
+	}
+	return limit(w, r, h.apiKeyLimiter, key)
+}
+
+// limit takes a token for key from l and writes a problem with when to retry if there are none left
+func limit(w http.ResponseWriter, r *http.Request, l *ratelimit.Limiter, key string) bool {
+	allowed, wait := l.Allow(key)
+	if allowed {
+		return true
+	}
+	// Retry-After is in whole seconds so round up to avoid retrying too early
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set(retryAfterHeader, strconv.Itoa(seconds))
+	writeError(r.Context(), w, http.StatusTooManyRequests, codeRateLimited, "too many requests")
+	return false
+}
+
+// clientIP is the address the request came from
+// forwarding headers can be set by anyone so they are ignored
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
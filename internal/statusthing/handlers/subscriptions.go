@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"path"
+
+	chi "github.com/go-chi/chi/v5"
+
+	"github.com/lusis/apithings/internal/statusthing/notifiers"
+	"github.com/lusis/apithings/internal/statusthing/types"
+
+	"golang.org/x/exp/slog"
+)
+
+// subscriptionsPath is where email subscriptions are created under the base path
+const subscriptionsPath = "/subscriptions"
+
+const (
+	// defaultSubscribeRate and defaultSubscribeBurst allow each address five subscriptions at once and then one a minute
+	defaultSubscribeRate  = 1.0 / 60
+	defaultSubscribeBurst = 5
+)
+
+// Subscriptions manages email subscriptions
+type Subscriptions interface {
+	// Subscribe adds an unconfirmed subscriber and sends them a confirmation link
+	Subscribe(ctx context.Context, email string, filter notifiers.Filter) error
+	// Confirm confirms a subscription by its confirmation token
+	Confirm(ctx context.Context, token string) error
+	// Unsubscribe removes a subscription by its unsubscribe token
+	Unsubscribe(ctx context.Context, token string) error
+}
+
+type subscriptionRequest struct {
+	Email  string   `json:"email"`
+	Things []string `json:"things,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+// addSubscriptionRoutes adds the public subscription routes
+// they don't require the api key since they are used by people following links in emails
+func (h *StatusThingHandler) addSubscriptionRoutes(r chi.Router) {
+	r.Post(path.Join(h.basePath, subscriptionsPath), func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		// subscribing sends an email so it needs limiting even when the api isn't
+		if !limit(w, r, h.subscribeLimiter, clientIP(r)) {
+			return
+		}
+		if !isJSON(r.Header.Get(contentTypeHeader)) {
+			writeError(ctx, w, http.StatusUnsupportedMediaType, codeInvalidContentType, "content type must be application/json")
+			return
+		}
+		var req subscriptionRequest
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, h.maxBodyBytes)).Decode(&req); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(ctx, w, http.StatusRequestEntityTooLarge, codeBodyTooLarge, fmt.Sprintf("request body must be at most %d bytes", tooLarge.Limit))
+				return
+			}
+			writeError(ctx, w, http.StatusBadRequest, codeInvalidBody, "request body is not a valid subscription")
+			return
+		}
+		err := h.subscriptions.Subscribe(ctx, req.Email, notifiers.Filter{Things: req.Things, Groups: req.Groups})
+		if errors.Is(err, types.ErrRequiredValueMissing) {
+			writeValidationProblem(ctx, w, err)
+			return
+		}
+		if err != nil {
+			slog.ErrorCtx(ctx, "unable to subscribe", "err", err)
+			writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
+			return
+		}
+		// the same response is used for new and existing subscribers so subscriptions can't be discovered
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	// following a link only shows a form since mail scanners fetch links without anyone clicking them
+	r.Get(path.Join(h.basePath, notifiers.ConfirmPath), func(w http.ResponseWriter, r *http.Request) {
+		h.subscriptionForm(w, r, "Confirm that you want to be emailed when things change status.", "Confirm")
+	})
+	r.Post(path.Join(h.basePath, notifiers.ConfirmPath), func(w http.ResponseWriter, r *http.Request) {
+		h.subscriptionAction(w, r, h.subscriptions.Confirm, "Your subscription has been confirmed.")
+	})
+
+	r.Get(path.Join(h.basePath, notifiers.UnsubscribePath), func(w http.ResponseWriter, r *http.Request) {
+		h.subscriptionForm(w, r, "Stop being emailed when things change status?", "Unsubscribe")
+	})
+	// mail clients also POST here for one-click unsubscribe (RFC 8058)
+	r.Post(path.Join(h.basePath, notifiers.UnsubscribePath), func(w http.ResponseWriter, r *http.Request) {
+		h.subscriptionAction(w, r, h.subscriptions.Unsubscribe, "You have been unsubscribed.")
+	})
+}
+
+// subscriptionPage is the data for the subscription page
+type subscriptionPage struct {
+	Message string
+	// Button and Token are set to show a form that posts the token back
+	Button string
+	Token  string
+}
+
+// subscriptionForm shows a form that posts the token from the query string back to the same path
+func (h *StatusThingHandler) subscriptionForm(w http.ResponseWriter, r *http.Request, message, button string) {
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		writeError(r.Context(), w, http.StatusNotFound, codeNotFound, "this link is invalid or has already been used")
+		return
+	}
+	h.subscriptionPage(w, r, subscriptionPage{Message: message, Button: button, Token: token})
+}
+
+// subscriptionAction calls action with the token from the query string and shows the result
+func (h *StatusThingHandler) subscriptionAction(w http.ResponseWriter, r *http.Request, action func(context.Context, string) error, done string) {
+	ctx := r.Context()
+	err := action(ctx, r.URL.Query().Get("token"))
+	if errors.Is(err, types.ErrNotFound) {
+		writeError(ctx, w, http.StatusNotFound, codeNotFound, "this link is invalid or has already been used")
+		return
+	}
+	if err != nil {
+		slog.ErrorCtx(ctx, "unable to update subscription", "err", err)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
+		return
+	}
+	h.subscriptionPage(w, r, subscriptionPage{Message: done})
+}
+
+func (h *StatusThingHandler) subscriptionPage(w http.ResponseWriter, r *http.Request, page subscriptionPage) {
+	w.Header().Set(contentTypeHeader, "text/html; charset=utf-8")
+	if err := h.templates["subscription.htmx"].Execute(w, page); err != nil {
+		slog.ErrorCtx(r.Context(), "error executing template", "err", err)
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"html/template"
 	"net/http"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 
@@ -22,6 +23,8 @@ type card struct {
 	Title string
 	ID    string
 	Desc  string
+	// Bars are the daily uptime bars if uptime is enabled
+	Bars []uptimeBar
 }
 
 func makeCard(thing *types.StatusThing) card {
@@ -53,8 +56,19 @@ func (h *StatusThingHandler) addUIRoutes(r chi.Router) {
 			return
 		}
 		cards := []card{}
+		now := time.Now().UTC()
 		for _, thing := range all {
-			cards = append(cards, makeCard(thing))
+			c := makeCard(thing)
+			if h.uptime != nil {
+				bars, err := h.uptimeBars(r.Context(), thing, now)
+				if err != nil {
+					slog.Error("error getting uptime", "err", err)
+					http.Error(w, "internal error", http.StatusInternalServerError)
+					return
+				}
+				c.Bars = bars
+			}
+			cards = append(cards, c)
 		}
 		tmpl := h.templates["card.htmx"]
 
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+	"github.com/lusis/apithings/internal/statusthing/uptime"
+
+	"golang.org/x/exp/slog"
+)
+
+// Uptime calculates the uptime of things
+type Uptime interface {
+	// Calculate returns the uptime of the thing between from and to
+	Calculate(ctx context.Context, thing *types.StatusThing, from, to time.Time) (*uptime.Report, error)
+	// Buckets splits the window between from and to into consecutive reports of size
+	Buckets(ctx context.Context, thing *types.StatusThing, from, to time.Time, size time.Duration) ([]*uptime.Report, error)
+}
+
+// defaultUptimeWindows are returned when no window is requested
+var defaultUptimeWindows = []string{"24h", "7d", "30d", "90d"}
+
+// uptimeBarDays is the number of daily bars shown on the dashboard
+const uptimeBarDays = 90
+
+type uptimeRepresentation struct {
+	ID      string                 `json:"id"`
+	Name    string                 `json:"name"`
+	Windows []uptimeWindowResponse `json:"windows"`
+}
+
+type uptimeWindowResponse struct {
+	// Window is the requested window or empty for a custom range
+	Window string    `json:"window,omitempty"`
+	From   time.Time `json:"from"`
+	To     time.Time `json:"to"`
+	// Uptime is null when there is no history for the window
+	Uptime *float64 `json:"uptime"`
+	// KnownSeconds is how much of the window there is history for
+	KnownSeconds int64 `json:"known_seconds"`
+	// Seconds is how long was spent in each status
+	Seconds map[string]int64 `json:"seconds"`
+}
+
+func toUptimeWindow(window string, r *uptime.Report) uptimeWindowResponse {
+	res := uptimeWindowResponse{
+		Window:       window,
+		From:         r.From,
+		To:           r.To,
+		KnownSeconds: int64(r.Known.Seconds()),
+		Seconds:      map[string]int64{},
+	}
+	if r.Known > 0 {
+		pct := r.Uptime
+		res.Uptime = &pct
+	}
+	for status, d := range r.Durations {
+		res.Seconds[status.String()] = int64(d.Seconds())
+	}
+	return res
+}
+
+// getUptime returns the uptime of a thing
+// either a single window (i.e. ?window=30d) or a custom range (?from=...&to=...) can be requested
+// all of the default windows are returned otherwise
+func (h *StatusThingHandler) getUptime(w http.ResponseWriter, r *http.Request, id string) {
+	ctx := r.Context()
+	thing, err := h.provider.Get(ctx, id)
+	if errors.Is(err, types.ErrNotFound) {
+		writeError(ctx, w, http.StatusNotFound, codeNotFound, "not found")
+		return
+	}
+	if err != nil {
+		slog.ErrorCtx(ctx, "unexpected error", "err", err)
+		writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "unexpected error")
+		return
+	}
+
+	now := time.Now().UTC()
+	res := &uptimeRepresentation{ID: thing.ID, Name: thing.Name, Windows: []uptimeWindowResponse{}}
+	query := r.URL.Query()
+	if query.Get("from") != "" {
+		from, to, err := customRange(query.Get("from"), query.Get("to"), now)
+		if err != nil {
+			writeValidationProblem(ctx, w, err)
+			return
+		}
+		report, err := h.uptime.Calculate(ctx, thing, from, to)
+		if !uptimeCalculated(ctx, w, err) {
+			return
+		}
+		res.Windows = append(res.Windows, toUptimeWindow("", report))
+	} else {
+		windows := defaultUptimeWindows
+		if query.Get("window") != "" {
+			windows = []string{query.Get("window")}
+		}
+		for _, window := range windows {
+			d, err := uptime.ParseWindow(window)
+			if err != nil {
+				writeValidationProblem(ctx, w, types.NewValidationError("window", err.Error()))
+				return
+			}
+			report, err := h.uptime.Calculate(ctx, thing, now.Add(-d), now)
+			if !uptimeCalculated(ctx, w, err) {
+				return
+			}
+			res.Windows = append(res.Windows, toUptimeWindow(window, report))
+		}
+	}
+	if err := json.NewEncoder(w).Encode(res); err != nil {
+		slog.ErrorCtx(ctx, "encoding error", "err", err)
+	}
+}
+
+// uptimeCalculated writes the response for an error calculating uptime
+// it returns true if there was no error
+func uptimeCalculated(ctx context.Context, w http.ResponseWriter, err error) bool {
+	if err == nil {
+		return true
+	}
+	if errors.Is(err, types.ErrRequiredValueMissing) {
+		writeValidationProblem(ctx, w, err)
+		return false
+	}
+	slog.ErrorCtx(ctx, "error calculating uptime", "err", err)
+	writeError(ctx, w, http.StatusInternalServerError, codeInternalError, "internal error")
+	return false
+}
+
+// customRange parses an RFC3339 range where to defaults to now
+func customRange(fromParam, toParam string, now time.Time) (time.Time, time.Time, error) {
+	from, err := time.Parse(time.RFC3339, fromParam)
+	if err != nil {
+		return time.Time{}, time.Time{}, types.NewValidationError("from", "from must be an RFC3339 time")
+	}
+	to := now
+	if toParam != "" {
+		to, err = time.Parse(time.RFC3339, toParam)
+		if err != nil {
+			return time.Time{}, time.Time{}, types.NewValidationError("to", "to must be an RFC3339 time")
+		}
+	}
+	return from, to, nil
+}
+
+// uptimeBar is a single day on the dashboard
+type uptimeBar struct {
+	Style string
+	Title string
+}
+
+// uptimeBars returns the daily uptime bars for a thing
+func (h *StatusThingHandler) uptimeBars(ctx context.Context, thing *types.StatusThing, now time.Time) ([]uptimeBar, error) {
+	day := 24 * time.Hour
+	from := now.Truncate(day).Add(-(uptimeBarDays - 1) * day)
+	reports, err := h.uptime.Buckets(ctx, thing, from, now, day)
+	if err != nil {
+		return nil, err
+	}
+	bars := make([]uptimeBar, 0, len(reports))
+	for _, r := range reports {
+		date := r.From.Format("2006-01-02")
+		if r.Known == 0 {
+			bars = append(bars, uptimeBar{Style: "bg-secondary", Title: date + ": no data"})
+			continue
+		}
+		bars = append(bars, uptimeBar{Style: uptimeStyle(r.Uptime), Title: fmt.Sprintf("%s: %s", date, formatUptime(r.Uptime))})
+	}
+	return bars, nil
+}
+
+// uptimeStyle is the bootstrap background for an uptime percentage
+func uptimeStyle(pct float64) string {
+	switch {
+	case pct >= 99.9:
+		return bgSuccessCard
+	case pct >= 99:
+		return bgWarningCard
+	default:
+		return bgDangerCard
+	}
+}
+
+// formatUptime formats an uptime percentage for people
+func formatUptime(pct float64) string {
+	return fmt.Sprintf("%.2f%%", pct)
+}
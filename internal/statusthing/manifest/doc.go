@@ -0,0 +1,2 @@
+// Package manifest contains a declarative definition of statusthings and the logic to reconcile it with a provider
+package manifest
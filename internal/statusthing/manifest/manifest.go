@@ -0,0 +1,95 @@
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Manifest is a declarative list of things
+type Manifest struct {
+	Things []Thing `json:"things" yaml:"things"`
+}
+
+// Thing is the declared state of a single thing
+type Thing struct {
+	// Name is the unique name of the thing and is used to match existing things
+	Name string `json:"name" yaml:"name"`
+	// Description is the description of the thing
+	Description string `json:"description" yaml:"description"`
+	// Group is the optional group the thing belongs to
+	Group string `json:"group,omitempty" yaml:"group,omitempty"`
+	// Status is the status a thing is created with. It defaults to STATUS_GREEN.
+	// The status of an existing thing is never changed since it is runtime state and not configuration
+	Status string `json:"status,omitempty" yaml:"status,omitempty"`
+}
+
+// defaultStatus is the status new things are created with when none is declared
+const defaultStatus = types.StatusGreen
+
+// InitialStatus returns the status the thing should be created with
+func (t Thing) InitialStatus() types.Status {
+	if t.Status == "" {
+		return defaultStatus
+	}
+	return types.StatusFromString(t.Status)
+}
+
+// Load reads a [Manifest] from a yaml or json file
+func Load(path string) (*Manifest, error) {
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return nil, fmt.Errorf("unable to open manifest: %w", err)
+	}
+	defer f.Close()
+	m, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Parse reads a [Manifest] from yaml or json
+func Parse(r io.Reader) (*Manifest, error) {
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read manifest: %w", err)
+	}
+	m := &Manifest{}
+	// json is valid yaml so we only need one decoder
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	dec.KnownFields(true)
+	if err := dec.Decode(m); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("unable to parse manifest: %w", err)
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Validate checks that the manifest is usable
+func (m *Manifest) Validate() error {
+	seen := map[string]bool{}
+	for i, t := range m.Things {
+		if t.Name == "" {
+			return fmt.Errorf("thing %d: %w", i, types.NewValidationError("name", "name cannot be empty"))
+		}
+		if seen[t.Name] {
+			return fmt.Errorf("thing %d: %s is declared more than once: %w", i, t.Name, types.ErrAlreadyExists)
+		}
+		seen[t.Name] = true
+		if t.Description == "" {
+			return fmt.Errorf("thing %s: %w", t.Name, types.NewValidationError("description", "description cannot be empty"))
+		}
+		if t.InitialStatus() == types.StatusUnknown {
+			return fmt.Errorf("thing %s: %w", t.Name, types.NewValidationError("status", fmt.Sprintf("unknown status %q", t.Status)))
+		}
+	}
+	return nil
+}
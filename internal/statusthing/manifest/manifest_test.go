@@ -0,0 +1,212 @@
+package manifest
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/types"
+	"github.com/stretchr/testify/require"
+)
+
+const testYAML = `
+things:
+  - name: api
+    description: the api
+    group: core
+  - name: db
+    description: the database
+    status: STATUS_YELLOW
+`
+
+const testJSON = `{"things":[{"name":"api","description":"the api","group":"core"},{"name":"db","description":"the database","status":"STATUS_YELLOW"}]}`
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	for name, doc := range map[string]string{"yaml": testYAML, "json": testJSON} {
+		t.Run(name, func(t *testing.T) {
+			m, err := Parse(strings.NewReader(doc))
+			require.NoError(t, err)
+			require.Len(t, m.Things, 2)
+			require.Equal(t, Thing{Name: "api", Description: "the api", Group: "core"}, m.Things[0])
+			require.Equal(t, types.StatusGreen, m.Things[0].InitialStatus(), "should default to green")
+			require.Equal(t, types.StatusYellow, m.Things[1].InitialStatus())
+		})
+	}
+
+	t.Run("empty", func(t *testing.T) {
+		m, err := Parse(strings.NewReader(""))
+		require.NoError(t, err)
+		require.Empty(t, m.Things)
+	})
+}
+
+func TestParseInvalid(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		doc string
+		err error
+	}{
+		"missing-name":        {doc: `things: [{description: foo}]`, err: types.ErrRequiredValueMissing},
+		"missing-description": {doc: `things: [{name: foo}]`, err: types.ErrRequiredValueMissing},
+		"bad-status":          {doc: `things: [{name: foo, description: foo, status: STATUS_PURPLE}]`, err: types.ErrRequiredValueMissing},
+		"duplicate":           {doc: `things: [{name: foo, description: foo}, {name: foo, description: bar}]`, err: types.ErrAlreadyExists},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			m, err := Parse(strings.NewReader(tc.doc))
+			require.ErrorIs(t, err, tc.err)
+			require.Nil(t, m)
+		})
+	}
+
+	t.Run("unknown-field", func(t *testing.T) {
+		m, err := Parse(strings.NewReader(`things: [{name: foo, description: foo, colour: blue}]`))
+		require.Error(t, err)
+		require.Nil(t, m)
+	})
+}
+
+func TestLoad(t *testing.T) {
+	t.Parallel()
+	path := filepath.Join(t.TempDir(), "things.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testYAML), 0o600))
+	m, err := Load(path)
+	require.NoError(t, err)
+	require.Len(t, m.Things, 2)
+
+	_, err = Load(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.Error(t, err)
+}
+
+func TestReconcile(t *testing.T) {
+	t.Parallel()
+	m, err := Parse(strings.NewReader(testYAML))
+	require.NoError(t, err)
+
+	newProvider := func() *mapProvider {
+		return &mapProvider{things: map[string]*types.StatusThing{
+			"1": {ID: "1", Name: "api", Description: "old description", Status: types.StatusRed, Version: 4},
+			"2": {ID: "2", Name: "legacy", Description: "legacy", Status: types.StatusGreen, Version: 1},
+		}}
+	}
+
+	t.Run("without-prune", func(t *testing.T) {
+		p := newProvider()
+		plan, err := NewPlan(context.Background(), p, m, false)
+		require.NoError(t, err)
+		require.Len(t, plan.Changes, 2)
+		require.Equal(t, ActionUpdate, plan.Changes[0].Action)
+		require.Equal(t, ActionCreate, plan.Changes[1].Action)
+
+		diff := &bytes.Buffer{}
+		require.NoError(t, plan.Diff(diff))
+		require.Equal(t, "~ api\n    description: \"old description\" -> \"the api\"\n    group: \"\" -> \"core\"\n+ db\n    description: \"the database\"\n    group: \"\"\n    status: STATUS_YELLOW\n", diff.String())
+
+		require.NoError(t, plan.Apply(context.Background(), p))
+		require.Len(t, p.things, 3, "should not prune")
+		api := p.things["1"]
+		require.Equal(t, "the api", api.Description)
+		require.Equal(t, "core", api.Group)
+		require.Equal(t, types.StatusRed, api.Status, "should not change the status of existing things")
+
+		// reconciling again should be a noop
+		plan, err = NewPlan(context.Background(), p, m, false)
+		require.NoError(t, err)
+		require.True(t, plan.Empty())
+		diff.Reset()
+		require.NoError(t, plan.Diff(diff))
+		require.Equal(t, "no changes\n", diff.String())
+	})
+
+	t.Run("with-prune", func(t *testing.T) {
+		p := newProvider()
+		plan, err := NewPlan(context.Background(), p, m, true)
+		require.NoError(t, err)
+		require.Len(t, plan.Changes, 3)
+		require.Equal(t, ActionDelete, plan.Changes[2].Action)
+		require.NoError(t, plan.Apply(context.Background(), p))
+		require.Len(t, p.things, 2, "should prune")
+		_, ok := p.things["2"]
+		require.False(t, ok, "legacy should be removed")
+	})
+
+	t.Run("stale-plan", func(t *testing.T) {
+		p := newProvider()
+		plan, err := NewPlan(context.Background(), p, m, false)
+		require.NoError(t, err)
+		// somebody else changes the thing after we planned
+		p.things["1"].Version++
+		require.ErrorIs(t, plan.Apply(context.Background(), p), types.ErrVersionMismatch)
+	})
+}
+
+// mapProvider is a simple in-memory [providers.Provider]
+type mapProvider struct {
+	providers.UnimplementedProvider
+	things map[string]*types.StatusThing
+	nextID int
+}
+
+func (mp *mapProvider) All(ctx context.Context) ([]*types.StatusThing, error) {
+	res := []*types.StatusThing{}
+	for _, t := range mp.things {
+		copied := *t
+		res = append(res, &copied)
+	}
+	return res, nil
+}
+
+func (mp *mapProvider) Add(ctx context.Context, p providers.Params) (*types.StatusThing, error) {
+	mp.nextID++
+	t := &types.StatusThing{ID: fmt.Sprintf("new-%d", mp.nextID), Name: p.Name, Description: p.Description, Group: p.Group, Status: p.Status, Version: 1}
+	mp.things[t.ID] = t
+	return t, nil
+}
+
+func (mp *mapProvider) SetStatus(ctx context.Context, id string, status types.Status, opts ...dbfilters.Option) (*types.StatusThing, *types.StatusThing, error) {
+	f, err := dbfilters.New(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	t, ok := mp.things[id]
+	if !ok {
+		return nil, nil, types.ErrNotFound
+	}
+	if f.Version() != 0 && f.Version() != t.Version {
+		return nil, nil, types.ErrVersionMismatch
+	}
+	previous := *t
+	t.Status = status
+	if f.Description() != "" {
+		t.Description = f.Description()
+	}
+	if g, ok := f.Group(); ok {
+		t.Group = g
+	}
+	t.Version++
+	updated := *t
+	return &previous, &updated, nil
+}
+
+func (mp *mapProvider) Remove(ctx context.Context, id string, opts ...dbfilters.Option) error {
+	f, err := dbfilters.New(opts...)
+	if err != nil {
+		return err
+	}
+	t, ok := mp.things[id]
+	if !ok {
+		return types.ErrNotFound
+	}
+	if f.Version() != 0 && f.Version() != t.Version {
+		return types.ErrVersionMismatch
+	}
+	delete(mp.things, id)
+	return nil
+}
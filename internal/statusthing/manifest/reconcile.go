@@ -0,0 +1,159 @@
+package manifest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// Action is the kind of change needed to reconcile a thing
+type Action int
+
+const (
+	// ActionCreate creates a thing that does not exist
+	ActionCreate Action = iota + 1
+	// ActionUpdate updates the description or group of an existing thing
+	ActionUpdate
+	// ActionDelete deletes a thing that is not in the manifest
+	ActionDelete
+)
+
+// String returns the string representation of an action
+func (a Action) String() string {
+	switch a {
+	case ActionCreate:
+		return "create"
+	case ActionUpdate:
+		return "update"
+	case ActionDelete:
+		return "delete"
+	default:
+		return "unknown"
+	}
+}
+
+// Change is a single change needed to reconcile a thing
+type Change struct {
+	Action Action
+	// Existing is the current state of the thing for updates and deletes
+	Existing *types.StatusThing
+	// Desired is the declared state of the thing for creates and updates
+	Desired *Thing
+}
+
+// Plan is the set of changes needed to make a provider match a manifest
+type Plan struct {
+	Changes []Change
+}
+
+// Empty reports if the plan has no changes
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// Diff writes a human readable description of the plan to w
+func (p *Plan) Diff(w io.Writer) error {
+	if p.Empty() {
+		_, err := fmt.Fprintln(w, "no changes")
+		return err
+	}
+	for _, c := range p.Changes {
+		var err error
+		switch c.Action {
+		case ActionCreate:
+			_, err = fmt.Fprintf(w, "+ %s\n    description: %q\n    group: %q\n    status: %s\n", c.Desired.Name, c.Desired.Description, c.Desired.Group, c.Desired.InitialStatus())
+		case ActionUpdate:
+			_, err = fmt.Fprintf(w, "~ %s\n", c.Existing.Name)
+			if err == nil && c.Existing.Description != c.Desired.Description {
+				_, err = fmt.Fprintf(w, "    description: %q -> %q\n", c.Existing.Description, c.Desired.Description)
+			}
+			if err == nil && c.Existing.Group != c.Desired.Group {
+				_, err = fmt.Fprintf(w, "    group: %q -> %q\n", c.Existing.Group, c.Desired.Group)
+			}
+		case ActionDelete:
+			_, err = fmt.Fprintf(w, "- %s\n", c.Existing.Name)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// NewPlan compares the manifest with the things known to the provider
+// things that are not in the manifest are only deleted if prune is true
+func NewPlan(ctx context.Context, p providers.Provider, m *Manifest, prune bool) (*Plan, error) {
+	existing, err := p.All(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("unable to get existing things: %w", err)
+	}
+	byName := make(map[string]*types.StatusThing, len(existing))
+	for _, t := range existing {
+		byName[t.Name] = t
+	}
+	plan := &Plan{}
+	declared := make(map[string]bool, len(m.Things))
+	for i := range m.Things {
+		desired := &m.Things[i]
+		declared[desired.Name] = true
+		current, ok := byName[desired.Name]
+		if !ok {
+			plan.Changes = append(plan.Changes, Change{Action: ActionCreate, Desired: desired})
+			continue
+		}
+		if current.Description != desired.Description || current.Group != desired.Group {
+			plan.Changes = append(plan.Changes, Change{Action: ActionUpdate, Existing: current, Desired: desired})
+		}
+	}
+	if prune {
+		deletes := []Change{}
+		for _, t := range existing {
+			if !declared[t.Name] {
+				deletes = append(deletes, Change{Action: ActionDelete, Existing: t})
+			}
+		}
+		sort.Slice(deletes, func(i, j int) bool { return deletes[i].Existing.Name < deletes[j].Existing.Name })
+		plan.Changes = append(plan.Changes, deletes...)
+	}
+	return plan, nil
+}
+
+// Apply applies the plan to the provider
+// updates and deletes are conditional on the thing not having changed since the plan was made
+func (p *Plan) Apply(ctx context.Context, provider providers.Provider) error {
+	for _, c := range p.Changes {
+		switch c.Action {
+		case ActionCreate:
+			if _, err := provider.Add(ctx, providers.Params{
+				Name:        c.Desired.Name,
+				Description: c.Desired.Description,
+				Group:       c.Desired.Group,
+				Status:      c.Desired.InitialStatus(),
+			}); err != nil {
+				return fmt.Errorf("unable to create %s: %w", c.Desired.Name, err)
+			}
+		case ActionUpdate:
+			opts := []dbfilters.Option{dbfilters.WithDescription(c.Desired.Description), dbfilters.WithGroup(c.Desired.Group)}
+			if c.Existing.Version != 0 {
+				opts = append(opts, dbfilters.WithVersion(c.Existing.Version))
+			}
+			if _, _, err := provider.SetStatus(ctx, c.Existing.ID, c.Existing.Status, opts...); err != nil {
+				return fmt.Errorf("unable to update %s: %w", c.Existing.Name, err)
+			}
+		case ActionDelete:
+			opts := []dbfilters.Option{}
+			if c.Existing.Version != 0 {
+				opts = append(opts, dbfilters.WithVersion(c.Existing.Version))
+			}
+			if err := provider.Remove(ctx, c.Existing.ID, opts...); err != nil {
+				return fmt.Errorf("unable to delete %s: %w", c.Existing.Name, err)
+			}
+		}
+	}
+	return nil
+}
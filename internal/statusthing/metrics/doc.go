@@ -0,0 +1,2 @@
+// Package metrics exposes statusthing metrics in the prometheus text exposition format
+package metrics
@@ -0,0 +1,220 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/types"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// contentType is the content type of the text exposition format
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+	// unmatchedRoute is the route label used for requests that did not match a route
+	unmatchedRoute = "unmatched"
+)
+
+// defaultBuckets are the upper bounds of the request duration histogram in seconds
+var defaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Metrics collects statusthing metrics
+// thing statuses are read from the provider on every scrape so they are never stale
+type Metrics struct {
+	provider providers.Provider
+
+	lock        sync.Mutex
+	transitions map[transitionKey]uint64
+	requests    map[requestKey]*histogram
+}
+
+type transitionKey struct {
+	name  string
+	group string
+	from  string
+	to    string
+}
+
+type requestKey struct {
+	method string
+	route  string
+	code   string
+}
+
+type histogram struct {
+	// counts are cumulative per bucket
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// New returns a new [Metrics] reading thing statuses from p
+func New(p providers.Provider) (*Metrics, error) {
+	if p == nil {
+		return nil, fmt.Errorf("provider cannot be nil")
+	}
+	return &Metrics{
+		provider:    p,
+		transitions: make(map[transitionKey]uint64),
+		requests:    make(map[requestKey]*histogram),
+	}, nil
+}
+
+// ObserveTransition counts a status transition
+// it can be passed to [providers.NewTransitionProvider]
+func (m *Metrics) ObserveTransition(_ context.Context, t types.Transition) {
+	if t.Thing == nil {
+		return
+	}
+	key := transitionKey{name: t.Thing.Name, group: t.Thing.Group, from: t.Previous.String(), to: t.Thing.Status.String()}
+	m.lock.Lock()
+	m.transitions[key]++
+	m.lock.Unlock()
+}
+
+// Middleware records the count and duration of requests handled by next
+// requests are labelled by their chi route pattern to keep the number of series bounded
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		next.ServeHTTP(ww, r)
+		route := ""
+		if rctx := chi.RouteContext(r.Context()); rctx != nil {
+			route = rctx.RoutePattern()
+		}
+		if route == "" {
+			route = unmatchedRoute
+		}
+		code := ww.Status()
+		if code == 0 {
+			code = http.StatusOK
+		}
+		m.observeRequest(requestKey{method: r.Method, route: route, code: strconv.Itoa(code)}, time.Since(start))
+	})
+}
+
+func (m *Metrics) observeRequest(key requestKey, d time.Duration) {
+	seconds := d.Seconds()
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	h, ok := m.requests[key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(defaultBuckets))}
+		m.requests[key] = h
+	}
+	for i, le := range defaultBuckets {
+		if seconds <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// ServeHTTP writes all metrics in the text exposition format
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	buf := &bytes.Buffer{}
+	if err := m.Write(r.Context(), buf); err != nil {
+		slog.ErrorCtx(r.Context(), "unable to gather metrics", "err", err)
+		http.Error(w, "unable to gather metrics", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if _, err := buf.WriteTo(w); err != nil {
+		slog.ErrorCtx(r.Context(), "unable to write metrics", "err", err)
+	}
+}
+
+// Write writes all metrics to buf in the text exposition format
+func (m *Metrics) Write(ctx context.Context, buf *bytes.Buffer) error {
+	things, err := m.provider.All(ctx)
+	if err != nil {
+		return err
+	}
+	sort.Slice(things, func(i, j int) bool { return things[i].Name < things[j].Name })
+
+	writeHeader(buf, "statusthing_thing_status", "gauge", "Current status of a thing (0=unknown 1=red 2=green 3=yellow)")
+	for _, t := range things {
+		writeSample(buf, "statusthing_thing_status", labels("id", t.ID, "name", t.Name, "group", t.Group), float64(t.Status))
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	writeHeader(buf, "statusthing_status_transitions_total", "counter", "Number of status transitions")
+	transitionKeys := make([]transitionKey, 0, len(m.transitions))
+	for k := range m.transitions {
+		transitionKeys = append(transitionKeys, k)
+	}
+	sort.Slice(transitionKeys, func(i, j int) bool {
+		a, b := transitionKeys[i], transitionKeys[j]
+		return a.name+"\x00"+a.group+"\x00"+a.from+"\x00"+a.to < b.name+"\x00"+b.group+"\x00"+b.from+"\x00"+b.to
+	})
+	for _, k := range transitionKeys {
+		writeSample(buf, "statusthing_status_transitions_total", labels("name", k.name, "group", k.group, "from", k.from, "to", k.to), float64(m.transitions[k]))
+	}
+
+	requestKeys := make([]requestKey, 0, len(m.requests))
+	for k := range m.requests {
+		requestKeys = append(requestKeys, k)
+	}
+	sort.Slice(requestKeys, func(i, j int) bool {
+		a, b := requestKeys[i], requestKeys[j]
+		return a.route+"\x00"+a.method+"\x00"+a.code < b.route+"\x00"+b.method+"\x00"+b.code
+	})
+
+	writeHeader(buf, "statusthing_http_requests_total", "counter", "Number of http requests handled")
+	for _, k := range requestKeys {
+		writeSample(buf, "statusthing_http_requests_total", labels("method", k.method, "route", k.route, "code", k.code), float64(m.requests[k].count))
+	}
+
+	writeHeader(buf, "statusthing_http_request_duration_seconds", "histogram", "Duration of http requests in seconds")
+	for _, k := range requestKeys {
+		h := m.requests[k]
+		base := []string{"method", k.method, "route", k.route, "code", k.code}
+		for i, le := range defaultBuckets {
+			writeSample(buf, "statusthing_http_request_duration_seconds_bucket", labels(append(base, "le", formatFloat(le))...), float64(h.counts[i]))
+		}
+		writeSample(buf, "statusthing_http_request_duration_seconds_bucket", labels(append(base, "le", "+Inf")...), float64(h.count))
+		writeSample(buf, "statusthing_http_request_duration_seconds_sum", labels(base...), h.sum)
+		writeSample(buf, "statusthing_http_request_duration_seconds_count", labels(base...), float64(h.count))
+	}
+	return nil
+}
+
+func writeHeader(buf *bytes.Buffer, name, kind, help string) {
+	fmt.Fprintf(buf, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeSample(buf *bytes.Buffer, name, labels string, value float64) {
+	fmt.Fprintf(buf, "%s%s %s\n", name, labels, formatFloat(value))
+}
+
+// labels formats pairs of label names and values
+func labels(pairs ...string) string {
+	parts := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		parts = append(parts, pairs[i]+`="`+labelEscaper.Replace(pairs[i+1])+`"`)
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// labelEscaper escapes label values as required by the exposition format
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
@@ -0,0 +1,81 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/types"
+	"github.com/stretchr/testify/require"
+)
+
+type testProvider struct {
+	providers.UnimplementedProvider
+	things []*types.StatusThing
+}
+
+func (tp *testProvider) All(_ context.Context) ([]*types.StatusThing, error) {
+	return tp.things, nil
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	m, err := New(nil)
+	require.Error(t, err, "should require a provider")
+	require.Nil(t, m)
+}
+
+func TestMetrics(t *testing.T) {
+	t.Parallel()
+	p := &testProvider{things: []*types.StatusThing{
+		{ID: "2", Name: "web", Status: types.StatusYellow},
+		{ID: "1", Name: "api", Group: `co"re`, Status: types.StatusRed},
+	}}
+	m, err := New(p)
+	require.NoError(t, err)
+
+	m.ObserveTransition(context.Background(), types.Transition{Thing: p.things[1], Previous: types.StatusGreen, At: time.Now()})
+	m.ObserveTransition(context.Background(), types.Transition{Thing: p.things[1], Previous: types.StatusGreen, At: time.Now()})
+
+	mux := chi.NewRouter()
+	mux.Use(m.Middleware)
+	mux.Get("/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.Get("/metrics", m.ServeHTTP)
+	for _, id := range []string{"1", "2"} {
+		mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/"+id, nil))
+	}
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	res := w.Result()
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, res.StatusCode)
+	require.Equal(t, contentType, res.Header.Get("Content-Type"))
+
+	out := string(body)
+	require.Contains(t, out, "# TYPE statusthing_thing_status gauge\n")
+	require.Contains(t, out, `statusthing_thing_status{id="1",name="api",group="co\"re"} 1`+"\n")
+	require.Contains(t, out, `statusthing_thing_status{id="2",name="web",group=""} 3`+"\n")
+	require.Less(t, strings.Index(out, `name="api"`), strings.Index(out, `name="web"`), "things should be sorted by name")
+	require.Contains(t, out, `statusthing_status_transitions_total{name="api",group="co\"re",from="STATUS_GREEN",to="STATUS_RED"} 2`+"\n")
+	require.Contains(t, out, `statusthing_http_requests_total{method="GET",route="/things/{id}",code="404"} 2`+"\n")
+	require.Contains(t, out, `statusthing_http_requests_total{method="GET",route="unmatched",code="404"} 1`+"\n")
+	require.Contains(t, out, `statusthing_http_request_duration_seconds_bucket{method="GET",route="/things/{id}",code="404",le="+Inf"} 2`+"\n")
+	require.Contains(t, out, `statusthing_http_request_duration_seconds_count{method="GET",route="/things/{id}",code="404"} 2`+"\n")
+}
+
+func TestLabels(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, `{a="x\\y",b="line\nbreak",c="\"q\""}`, labels("a", `x\y`, "b", "line\nbreak", "c", `"q"`))
+}
@@ -0,0 +1,76 @@
+package notifiers
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Config is a list of notification channels
+type Config struct {
+	Notifiers []ChannelConfig `json:"notifiers" yaml:"notifiers"`
+}
+
+// ChannelConfig is the configuration for a single [Channel]
+type ChannelConfig struct {
+	// Type is the kind of notifier i.e. slack, discord or teams
+	Type string `json:"type" yaml:"type"`
+	// URL is the incoming webhook url for chat notifiers
+	URL    string `json:"url,omitempty" yaml:"url,omitempty"`
+	Filter `yaml:",inline"`
+}
+
+// Build builds the [Channel] described by the config
+func (cc ChannelConfig) Build() (Channel, error) {
+	var n Notifier
+	var err error
+	switch cc.Type {
+	case "slack":
+		n, err = NewSlackNotifier(cc.URL)
+	case "discord":
+		n, err = NewDiscordNotifier(cc.URL)
+	case "teams":
+		n, err = NewTeamsNotifier(cc.URL)
+	default:
+		return Channel{}, fmt.Errorf("unknown notifier type %q", cc.Type)
+	}
+	if err != nil {
+		return Channel{}, err
+	}
+	return Channel{Notifier: n, Filter: cc.Filter}, nil
+}
+
+// Load reads notification channels from a yaml or json file
+func Load(path string) ([]Channel, error) {
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return nil, fmt.Errorf("unable to open notifiers: %w", err)
+	}
+	defer f.Close()
+	channels, err := Parse(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return channels, nil
+}
+
+// Parse reads notification channels from yaml or json
+func Parse(r io.Reader) ([]Channel, error) {
+	cfg := &Config{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("unable to parse notifiers: %w", err)
+	}
+	channels := make([]Channel, 0, len(cfg.Notifiers))
+	for i, cc := range cfg.Notifiers {
+		c, err := cc.Build()
+		if err != nil {
+			return nil, fmt.Errorf("notifiers[%d]: %w", i, err)
+		}
+		channels = append(channels, c)
+	}
+	return channels, nil
+}
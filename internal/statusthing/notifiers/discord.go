@@ -0,0 +1,77 @@
+package notifiers
+
+import (
+	"context"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// discordColors are the embed colors used for each status
+var discordColors = map[types.Status]int{
+	types.StatusRed:    0xdc3545,
+	types.StatusYellow: 0xffc107,
+	types.StatusGreen:  0x198754,
+}
+
+// DiscordNotifier posts embeds to a discord webhook
+type DiscordNotifier struct {
+	webhook *webhook
+}
+
+// ensure we always satisfy
+var _ Notifier = (*DiscordNotifier)(nil)
+
+// NewDiscordNotifier returns a new [DiscordNotifier] posting to the webhook url
+func NewDiscordNotifier(webhookURL string, opts ...Option) (*DiscordNotifier, error) {
+	w, err := newWebhook("discord", webhookURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &DiscordNotifier{webhook: w}, nil
+}
+
+// Name identifies the notifier in logs
+func (dn *DiscordNotifier) Name() string {
+	return "discord"
+}
+
+// Notify sends a notification about t
+func (dn *DiscordNotifier) Notify(ctx context.Context, t types.Transition) error {
+	return dn.webhook.post(ctx, discordMessage(t))
+}
+
+type discordField struct {
+	Name   string `json:"name"`
+	Value  string `json:"value"`
+	Inline bool   `json:"inline"`
+}
+
+type discordEmbed struct {
+	Title       string         `json:"title"`
+	Description string         `json:"description,omitempty"`
+	Color       int            `json:"color"`
+	Fields      []discordField `json:"fields"`
+	Timestamp   string         `json:"timestamp"`
+}
+
+type discordPayload struct {
+	Embeds []discordEmbed `json:"embeds"`
+}
+
+func discordMessage(t types.Transition) discordPayload {
+	fields := []discordField{
+		{Name: "Status", Value: shortStatus(t.Thing.Status), Inline: true},
+		{Name: "Previous", Value: shortStatus(t.Previous), Inline: true},
+	}
+	if t.Thing.Group != "" {
+		fields = append(fields, discordField{Name: "Group", Value: t.Thing.Group, Inline: true})
+	}
+	return discordPayload{Embeds: []discordEmbed{{
+		Title:       summary(t),
+		Description: t.Thing.Description,
+		Color:       discordColors[t.Thing.Status],
+		Fields:      fields,
+		Timestamp:   t.At.UTC().Format(time.RFC3339),
+	}}}
+}
@@ -0,0 +1,2 @@
+// Package notifiers sends notifications when the status of a statusthing changes
+package notifiers
@@ -0,0 +1,502 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing/storers"
+	"github.com/lusis/apithings/internal/statusthing/types"
+
+	"github.com/segmentio/ksuid"
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// ConfirmPath is where confirmation links point relative to the public url
+	ConfirmPath = "/subscriptions/confirm"
+	// UnsubscribePath is where unsubscribe links point relative to the public url
+	UnsubscribePath = "/subscriptions/unsubscribe"
+
+	subjectPrefix = "[statusthing] "
+
+	// defaultConfirmCooldown is how long to wait before sending another confirmation email to the same address
+	defaultConfirmCooldown = 15 * time.Minute
+
+	// maxEmailAttempts is how many times we try to email a subscriber the same changes before giving up
+	maxEmailAttempts = 3
+)
+
+// SMTPConfig is how to connect to the mail server
+type SMTPConfig struct {
+	// Addr is the host:port of the smtp server
+	Addr string
+	// Username and Password are used for PLAIN auth if Username is set
+	Username string
+	Password string
+	// From is the sender address
+	From string
+}
+
+// EmailNotifier emails confirmed subscribers about status changes
+// changes are batched into a single digest per subscriber when a digest window is set
+type EmailNotifier struct {
+	store     storers.SubscriberStorer
+	smtp      SMTPConfig
+	publicURL string
+	digest    time.Duration
+	// confirmCooldown stops the subscribe form being used to flood an address with confirmation emails
+	confirmCooldown time.Duration
+
+	lock    sync.Mutex
+	pending []types.Transition
+	// queuedAt is when the oldest pending change was queued
+	queuedAt time.Time
+	// sendErr is set when the last flush couldn't email any of the subscribers it tried to
+	sendErr error
+	// undelivered are changes that couldn't be emailed to a subscriber yet keyed by their email
+	undelivered map[string]undelivered
+	timer       *time.Timer
+	// sending is held while a digest is sent so [EmailNotifier.Flush] waits for one already being sent
+	sending chan struct{}
+	// sendTimeout is how long each email is allowed to take
+	sendTimeout time.Duration
+
+	nowFunc func() time.Time
+}
+
+// undelivered are changes that still need to be emailed to a subscriber
+type undelivered struct {
+	transitions []types.Transition
+	attempts    int
+}
+
+// ensure we always satisfy
+var _ Flusher = (*EmailNotifier)(nil)
+var _ Checker = (*EmailNotifier)(nil)
+
+// EmailOption is a functional option for an [EmailNotifier]
+type EmailOption func(*EmailNotifier) error
+
+// WithDigest batches changes made within d into a single email per subscriber
+func WithDigest(d time.Duration) EmailOption {
+	return func(en *EmailNotifier) error {
+		if d < 0 {
+			return fmt.Errorf("digest window cannot be negative")
+		}
+		en.digest = d
+		return nil
+	}
+}
+
+// WithConfirmCooldown only resends a confirmation email to an address once d has passed since the last one (default 15m)
+func WithConfirmCooldown(d time.Duration) EmailOption {
+	return func(en *EmailNotifier) error {
+		if d < 0 {
+			return fmt.Errorf("confirmation cooldown cannot be negative")
+		}
+		en.confirmCooldown = d
+		return nil
+	}
+}
+
+// NewEmailNotifier returns a new [EmailNotifier]
+// publicURL is the url the statusthing base path can be reached at and is used to build confirm and unsubscribe links
+func NewEmailNotifier(store storers.SubscriberStorer, cfg SMTPConfig, publicURL string, opts ...EmailOption) (*EmailNotifier, error) {
+	if store == nil {
+		return nil, fmt.Errorf("store cannot be nil")
+	}
+	if _, _, err := net.SplitHostPort(cfg.Addr); err != nil {
+		return nil, fmt.Errorf("smtp address must be host:port: %w", err)
+	}
+	if _, err := mail.ParseAddress(cfg.From); err != nil {
+		return nil, fmt.Errorf("invalid from address: %w", err)
+	}
+	u, err := url.Parse(publicURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("public url must be an absolute http or https url")
+	}
+	en := &EmailNotifier{
+		store:     store,
+		smtp:      cfg,
+		publicURL: strings.TrimSuffix(publicURL, "/"),
+		nowFunc:   time.Now,
+
+		sending:         make(chan struct{}, 1),
+		sendTimeout:     defaultTimeout,
+		confirmCooldown: defaultConfirmCooldown,
+	}
+	for _, opt := range opts {
+		if err := opt(en); err != nil {
+			return nil, err
+		}
+	}
+	return en, nil
+}
+
+// Name identifies the notifier in logs
+func (en *EmailNotifier) Name() string {
+	return "email"
+}
+
+// Notify queues a notification about t and sends it once the digest window has passed
+func (en *EmailNotifier) Notify(ctx context.Context, t types.Transition) error {
+	en.lock.Lock()
+	if len(en.pending) == 0 {
+		en.queuedAt = en.nowFunc()
+	}
+	en.pending = append(en.pending, t)
+	if en.digest == 0 {
+		en.lock.Unlock()
+		return en.flush(ctx)
+	}
+	en.startDigest()
+	en.lock.Unlock()
+	return nil
+}
+
+// startDigest starts the timer that sends the digest if it isn't already running
+// the lock must be held
+func (en *EmailNotifier) startDigest() {
+	if en.timer != nil {
+		return
+	}
+	en.timer = time.AfterFunc(en.digest, func() {
+		en.sending <- struct{}{}
+		defer func() { <-en.sending }()
+		// each email has its own timeout so the digest as a whole doesn't need one
+		if err := en.flush(context.Background()); err != nil {
+			slog.Error("unable to send email digest", "err", err)
+		}
+	})
+}
+
+// stopDigest stops the digest timer
+// a timer that has already fired sends whatever is queued when it runs, if anything
+// the lock must be held
+func (en *EmailNotifier) stopDigest() {
+	if en.timer != nil {
+		en.timer.Stop()
+		en.timer = nil
+	}
+}
+
+// Flush sends any queued notifications immediately
+// a digest that is already being sent is waited for first so anything it couldn't send is tried again
+func (en *EmailNotifier) Flush(ctx context.Context) error {
+	select {
+	case en.sending <- struct{}{}:
+		defer func() { <-en.sending }()
+	case <-ctx.Done():
+		return fmt.Errorf("unable to wait for the digest being sent: %w", ctx.Err())
+	}
+	return en.flush(ctx)
+}
+
+// flush emails every subscriber the queued changes they are interested in
+// changes a subscriber wasn't sent are kept for the next flush
+func (en *EmailNotifier) flush(ctx context.Context) error {
+	en.lock.Lock()
+	pending, retries, queuedAt := en.pending, en.undelivered, en.queuedAt
+	en.pending, en.undelivered = nil, nil
+	en.stopDigest()
+	en.lock.Unlock()
+	if len(pending) == 0 && len(retries) == 0 {
+		return nil
+	}
+
+	subs, err := en.store.GetSubscribers(ctx)
+	if err != nil {
+		en.requeue(pending, queuedAt, retries)
+		return fmt.Errorf("unable to get subscribers: %w", err)
+	}
+	var errs []error
+	sent, failed := 0, 0
+	left := map[string]undelivered{}
+	for _, sub := range subs {
+		if !sub.Confirmed {
+			continue
+		}
+		u := retries[sub.Email]
+		filter := Filter{Things: sub.Things, Groups: sub.Groups}
+		for _, t := range pending {
+			if filter.Matches(t.Thing) {
+				u.transitions = append(u.transitions, t)
+			}
+		}
+		if len(u.transitions) == 0 {
+			continue
+		}
+		if ctx.Err() != nil {
+			// anyone left is tried next time rather than holding up shutdown
+			left[sub.Email] = u
+			continue
+		}
+		sendCtx, cancel := context.WithTimeout(ctx, en.sendTimeout)
+		err := en.sendSMTP(sendCtx, sub.Email, en.digestMessage(sub, u.transitions))
+		cancel()
+		if err == nil {
+			sent++
+			continue
+		}
+		failed++
+		u.attempts++
+		if u.attempts >= maxEmailAttempts {
+			errs = append(errs, fmt.Errorf("unable to email %s, giving up after %d attempts: %w", sub.Email, u.attempts, err))
+			continue
+		}
+		errs = append(errs, fmt.Errorf("unable to email %s: %w", sub.Email, err))
+		left[sub.Email] = u
+	}
+	if err := ctx.Err(); err != nil {
+		errs = append(errs, fmt.Errorf("unable to email every subscriber: %w", err))
+	}
+	en.requeue(nil, time.Time{}, left)
+	en.lock.Lock()
+	switch {
+	case sent > 0:
+		en.sendErr = nil
+	case failed > 0:
+		en.sendErr = errors.Join(errs...)
+	}
+	en.lock.Unlock()
+	return errors.Join(errs...)
+}
+
+// Check returns an error if the last digest couldn't email anyone or changes have been queued for twice the digest window
+// one subscriber that can't be emailed doesn't fail the check
+func (en *EmailNotifier) Check(_ context.Context) error {
+	en.lock.Lock()
+	defer en.lock.Unlock()
+	if en.sendErr != nil {
+		return fmt.Errorf("unable to email any subscribers: %w", en.sendErr)
+	}
+	if en.digest > 0 && len(en.pending) > 0 {
+		if waiting := en.nowFunc().Sub(en.queuedAt); waiting > 2*en.digest {
+			return fmt.Errorf("changes have been waiting %s to be emailed", waiting.Round(time.Second))
+		}
+	}
+	return nil
+}
+
+// requeue keeps changes that weren't sent for the next flush
+// with a digest window the next flush is scheduled, otherwise they are sent with the next change
+func (en *EmailNotifier) requeue(pending []types.Transition, queuedAt time.Time, left map[string]undelivered) {
+	if len(pending) == 0 && len(left) == 0 {
+		return
+	}
+	en.lock.Lock()
+	defer en.lock.Unlock()
+	if len(pending) > 0 {
+		en.queuedAt = queuedAt
+	}
+	en.pending = append(pending, en.pending...)
+	if en.undelivered == nil {
+		en.undelivered = map[string]undelivered{}
+	}
+	for email, u := range left {
+		// anything queued for them since is sent with the retries
+		u.transitions = append(u.transitions, en.undelivered[email].transitions...)
+		en.undelivered[email] = u
+	}
+	if en.digest > 0 {
+		en.startDigest()
+	}
+}
+
+// Subscribe adds an unconfirmed subscriber and emails them a confirmation link
+// subscribing an email that is waiting for confirmation replaces its filter and sends the link again
+// unless one was sent within the confirmation cooldown
+func (en *EmailNotifier) Subscribe(ctx context.Context, email string, filter Filter) error {
+	addr, err := mail.ParseAddress(email)
+	if err != nil || addr.Address != email {
+		return types.NewValidationError("email", "a valid email address must be provided")
+	}
+	now := en.nowFunc()
+	sub, err := en.store.InsertSubscriber(ctx, &types.Subscriber{
+		ID:               ksuid.New().String(),
+		Email:            email,
+		Things:           filter.Things,
+		Groups:           filter.Groups,
+		ConfirmToken:     newToken(),
+		UnsubscribeToken: newToken(),
+		CreatedAt:        now,
+		ConfirmSentAt:    now,
+	})
+	if errors.Is(err, types.ErrAlreadyExists) {
+		existing, err := en.store.GetSubscriberByEmail(ctx, email)
+		if err != nil {
+			return err
+		}
+		if existing.Confirmed {
+			// nothing to do and we don't want to reveal who is subscribed
+			return nil
+		}
+		resend := now.Sub(existing.ConfirmSentAt) >= en.confirmCooldown
+		existing.Things, existing.Groups = filter.Things, filter.Groups
+		if resend {
+			existing.ConfirmSentAt = now
+		}
+		sub, err = en.store.UpdatePendingSubscriber(ctx, existing)
+		if errors.Is(err, types.ErrNotFound) {
+			// confirmed or unsubscribed in the meantime
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !resend {
+			return nil
+		}
+	} else if err != nil {
+		return err
+	}
+	subject := "Confirm your subscription"
+	body := fmt.Sprintf("Someone (hopefully you) asked to be emailed when things change status.\r\n\r\nConfirm your subscription by visiting:\r\n%s\r\n\r\nIf this wasn't you, you can ignore this email.\r\n", en.link(ConfirmPath, sub.ConfirmToken))
+	return en.sendSMTP(ctx, sub.Email, en.message(sub, subject, body))
+}
+
+// Confirm confirms the subscriber with the confirmation token
+func (en *EmailNotifier) Confirm(ctx context.Context, token string) error {
+	_, err := en.store.ConfirmSubscriber(ctx, token)
+	return err
+}
+
+// Unsubscribe removes the subscriber with the unsubscribe token
+func (en *EmailNotifier) Unsubscribe(ctx context.Context, token string) error {
+	return en.store.DeleteSubscriber(ctx, token)
+}
+
+func (en *EmailNotifier) link(path, token string) string {
+	return en.publicURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// digestMessage builds the email for one or more transitions
+func (en *EmailNotifier) digestMessage(sub *types.Subscriber, transitions []types.Transition) []byte {
+	subject := fmt.Sprintf("%d status changes", len(transitions))
+	if len(transitions) == 1 {
+		subject = summary(transitions[0])
+	}
+	body := &strings.Builder{}
+	for _, t := range transitions {
+		fmt.Fprintf(body, "%s %s\r\n", t.At.UTC().Format("2006-01-02 15:04:05 MST"), summary(t))
+		if t.Thing.Description != "" {
+			fmt.Fprintf(body, "    %s\r\n", t.Thing.Description)
+		}
+	}
+	fmt.Fprintf(body, "\r\nView the dashboard at %s\r\n", en.publicURL)
+	return en.message(sub, subject, body.String())
+}
+
+// message builds a plain text email including the unsubscribe link
+func (en *EmailNotifier) message(sub *types.Subscriber, subject, body string) []byte {
+	unsubscribe := en.link(UnsubscribePath, sub.UnsubscribeToken)
+	msg := &bytes.Buffer{}
+	headers := [][2]string{
+		{"From", en.smtp.From},
+		{"To", sub.Email},
+		{"Subject", subjectPrefix + headerSafe(subject)},
+		{"Date", en.nowFunc().Format(time.RFC1123Z)},
+		{"MIME-Version", "1.0"},
+		{"Content-Type", "text/plain; charset=utf-8"},
+		{"Content-Transfer-Encoding", "8bit"},
+		{"List-Unsubscribe", "<" + unsubscribe + ">"},
+		{"List-Unsubscribe-Post", "List-Unsubscribe=One-Click"},
+	}
+	for _, h := range headers {
+		fmt.Fprintf(msg, "%s: %s\r\n", h[0], h[1])
+	}
+	fmt.Fprintf(msg, "\r\n%s\r\n--\r\nUnsubscribe: %s\r\n", body, unsubscribe)
+	return msg.Bytes()
+}
+
+// sendSMTP sends msg using the configured smtp server
+// STARTTLS is used automatically when the server supports it
+// the connection is closed if ctx is done so a slow server can't hold up shutdown
+func (en *EmailNotifier) sendSMTP(ctx context.Context, to string, msg []byte) error {
+	from, err := mail.ParseAddress(en.smtp.From)
+	if err != nil {
+		return err
+	}
+	host, _, _ := net.SplitHostPort(en.smtp.Addr) // nolint: errcheck
+	conn, err := (&net.Dialer{}).DialContext(ctx, "tcp", en.smtp.Addr)
+	if err != nil {
+		return err
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(defaultTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		_ = conn.Close()
+		return err
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			_ = conn.Close()
+		case <-done:
+		}
+	}()
+	c, err := smtp.NewClient(conn, host)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+	defer c.Close()
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}); err != nil {
+			return err
+		}
+	}
+	if en.smtp.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", en.smtp.Username, en.smtp.Password, host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(msg); err != nil {
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// headerSafe strips characters that could be used to inject headers
+func headerSafe(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// newToken returns a random url safe token
+func newToken() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand failing means the system is unusable
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
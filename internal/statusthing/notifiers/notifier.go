@@ -0,0 +1,232 @@
+package notifiers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+
+	"golang.org/x/exp/slog"
+)
+
+const (
+	// defaultTimeout is how long a single notification is allowed to take
+	defaultTimeout = 10 * time.Second
+
+	// unhealthyAfter is how many notifications in a row a notifier can fail to send before it is reported as unhealthy
+	unhealthyAfter = 3
+)
+
+// Notifier sends notifications about status transitions
+type Notifier interface {
+	// Name identifies the notifier in logs
+	Name() string
+	// Notify sends a notification about t
+	Notify(ctx context.Context, t types.Transition) error
+}
+
+// Flusher is implemented by notifiers that batch notifications
+type Flusher interface {
+	Notifier
+	// Flush sends any batched notifications immediately
+	Flush(ctx context.Context) error
+}
+
+// Checker is implemented by notifiers that can report problems sending notifications of their own
+type Checker interface {
+	Notifier
+	// Check returns an error if the notifier is unable to send notifications
+	Check(ctx context.Context) error
+}
+
+// Filter limits the transitions sent to a [Notifier]
+// an empty filter matches every thing
+type Filter struct {
+	// Things are names of things to notify about
+	Things []string `json:"things,omitempty" yaml:"things,omitempty"`
+	// Groups are groups of things to notify about
+	Groups []string `json:"groups,omitempty" yaml:"groups,omitempty"`
+}
+
+// Matches reports if the filter matches thing
+func (f Filter) Matches(thing *types.StatusThing) bool {
+	if len(f.Things) == 0 && len(f.Groups) == 0 {
+		return true
+	}
+	for _, name := range f.Things {
+		if name == thing.Name {
+			return true
+		}
+	}
+	for _, group := range f.Groups {
+		if group == thing.Group {
+			return true
+		}
+	}
+	return false
+}
+
+// Channel is a [Notifier] and the [Filter] for the transitions it should receive
+type Channel struct {
+	Notifier Notifier
+	Filter   Filter
+}
+
+// Dispatcher sends transitions to every matching [Channel]
+// notifications are sent in the background so they never hold up changes to things
+type Dispatcher struct {
+	channels []Channel
+	wg       sync.WaitGroup
+	timeout  time.Duration
+
+	lock sync.Mutex
+	// sending are when each notification that is being sent was started
+	sending map[uint64]time.Time
+	nextID  uint64
+	// failures are how many notifications in a row each channel has failed to send
+	failures []int
+	lastErrs []error
+
+	nowFunc func() time.Time
+}
+
+// NewDispatcher returns a new [Dispatcher] for channels
+func NewDispatcher(channels ...Channel) (*Dispatcher, error) {
+	for i, c := range channels {
+		if c.Notifier == nil {
+			return nil, fmt.Errorf("channels[%d]: notifier cannot be nil", i)
+		}
+	}
+	return &Dispatcher{
+		channels: channels,
+		timeout:  defaultTimeout,
+		sending:  make(map[uint64]time.Time),
+		failures: make([]int, len(channels)),
+		lastErrs: make([]error, len(channels)),
+		nowFunc:  time.Now,
+	}, nil
+}
+
+// Observe sends t to every matching channel
+// things being created are not notified about
+// it can be passed to [providers.NewTransitionProvider]
+func (d *Dispatcher) Observe(_ context.Context, t types.Transition) {
+	if t.Thing == nil || t.Previous == types.StatusUnknown {
+		return
+	}
+	for i, c := range d.channels {
+		if !c.Filter.Matches(t.Thing) {
+			continue
+		}
+		d.wg.Add(1)
+		id := d.started()
+		go func(i int, n Notifier) {
+			defer d.wg.Done()
+			// the request that caused the transition may be long gone so we don't use its context
+			ctx, cancel := context.WithTimeout(context.Background(), d.timeout)
+			defer cancel()
+			err := n.Notify(ctx, t)
+			d.finished(id, i, err)
+			if err != nil {
+				slog.Error("unable to send notification", "notifier", n.Name(), "thing", t.Thing.Name, "err", err)
+			}
+		}(i, c.Notifier)
+	}
+}
+
+// started records that a notification is being sent
+func (d *Dispatcher) started() uint64 {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.nextID++
+	d.sending[d.nextID] = d.nowFunc()
+	return d.nextID
+}
+
+// finished records the result of sending a notification on the channel at index i
+func (d *Dispatcher) finished(id uint64, i int, err error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	delete(d.sending, id)
+	if err != nil {
+		d.failures[i]++
+		d.lastErrs[i] = err
+		return
+	}
+	d.failures[i] = 0
+	d.lastErrs[i] = nil
+}
+
+// Check returns an error if notifications aren't being sent
+// that is when one has been sending for twice as long as it is allowed to, a notifier has failed to send several in a row
+// or a notifier implementing [Checker] reports a problem
+func (d *Dispatcher) Check(ctx context.Context) error {
+	var errs []error
+	d.lock.Lock()
+	now := d.nowFunc()
+	stuck := 0
+	for _, started := range d.sending {
+		if now.Sub(started) > 2*d.timeout {
+			stuck++
+		}
+	}
+	if stuck > 0 {
+		errs = append(errs, fmt.Errorf("%d notifications have been sending for more than %s", stuck, 2*d.timeout))
+	}
+	for i, c := range d.channels {
+		if d.failures[i] >= unhealthyAfter {
+			errs = append(errs, fmt.Errorf("%s: failed to send the last %d notifications: %w", c.Notifier.Name(), d.failures[i], d.lastErrs[i]))
+		}
+	}
+	d.lock.Unlock()
+	for _, c := range d.channels {
+		if ch, ok := c.Notifier.(Checker); ok {
+			if err := ch.Check(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", ch.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Wait waits for any notifications that are being sent or until ctx is done
+func (d *Dispatcher) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		d.wg.Wait()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Flush flushes every notifier that batches notifications
+func (d *Dispatcher) Flush(ctx context.Context) error {
+	var errs []error
+	for _, c := range d.channels {
+		if f, ok := c.Notifier.(Flusher); ok {
+			if err := f.Flush(ctx); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", f.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// shortStatus returns the short lowercase form of a status i.e. green
+func shortStatus(s types.Status) string {
+	return strings.ToLower(strings.TrimPrefix(s.String(), "STATUS_"))
+}
+
+// summary is the one line description of a transition
+func summary(t types.Transition) string {
+	return fmt.Sprintf("%s is now %s (was %s)", t.Thing.Name, shortStatus(t.Thing.Status), shortStatus(t.Previous))
+}
@@ -0,0 +1,715 @@
+package notifiers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+	"github.com/stretchr/testify/require"
+)
+
+var testTransition = types.Transition{
+	Thing:    &types.StatusThing{ID: "abc", Name: "api", Description: "the api", Group: "core", Status: types.StatusRed},
+	Previous: types.StatusGreen,
+	At:       time.Date(2023, 5, 1, 12, 30, 0, 0, time.UTC),
+}
+
+// recorder is a webhook server that records every body it receives
+type recorder struct {
+	lock   sync.Mutex
+	bodies []map[string]any
+	status int
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var body map[string]any
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || r.Header.Get("Content-Type") != "application/json" {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	rec.lock.Lock()
+	rec.bodies = append(rec.bodies, body)
+	rec.lock.Unlock()
+	if rec.status != 0 {
+		w.WriteHeader(rec.status)
+		_, _ = io.WriteString(w, "nope")
+	}
+}
+
+func newRecorder(t *testing.T) (*recorder, string) {
+	t.Helper()
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	t.Cleanup(srv.Close)
+	return rec, srv.URL
+}
+
+func TestNotifiers(t *testing.T) {
+	t.Parallel()
+	type constructor func(string, ...Option) (Notifier, error)
+	testCases := map[string]struct {
+		build constructor
+		check func(t *testing.T, body map[string]any)
+	}{
+		"slack": {
+			build: func(u string, opts ...Option) (Notifier, error) { return NewSlackNotifier(u, opts...) },
+			check: func(t *testing.T, body map[string]any) {
+				require.Equal(t, "api is now red (was green)", body["text"])
+				blocks := body["blocks"].([]any)
+				require.Len(t, blocks, 2)
+				section := blocks[0].(map[string]any)["text"].(map[string]any)
+				require.Equal(t, ":red_circle: *api* is now *red* (was green)\nthe api", section["text"])
+				footer := blocks[1].(map[string]any)["elements"].([]any)[0].(map[string]any)
+				require.Contains(t, footer["text"], "group: core")
+			},
+		},
+		"discord": {
+			build: func(u string, opts ...Option) (Notifier, error) { return NewDiscordNotifier(u, opts...) },
+			check: func(t *testing.T, body map[string]any) {
+				embed := body["embeds"].([]any)[0].(map[string]any)
+				require.Equal(t, "api is now red (was green)", embed["title"])
+				require.Equal(t, "the api", embed["description"])
+				require.EqualValues(t, 0xdc3545, embed["color"])
+				require.Equal(t, "2023-05-01T12:30:00Z", embed["timestamp"])
+				require.Len(t, embed["fields"], 3)
+			},
+		},
+		"teams": {
+			build: func(u string, opts ...Option) (Notifier, error) { return NewTeamsNotifier(u, opts...) },
+			check: func(t *testing.T, body map[string]any) {
+				require.Equal(t, "message", body["type"])
+				attachment := body["attachments"].([]any)[0].(map[string]any)
+				require.Equal(t, adaptiveCardContentType, attachment["contentType"])
+				card := attachment["content"].(map[string]any)
+				require.Equal(t, "AdaptiveCard", card["type"])
+				elements := card["body"].([]any)
+				require.Len(t, elements, 3)
+				require.Equal(t, "Attention", elements[0].(map[string]any)["color"])
+				require.Len(t, elements[2].(map[string]any)["facts"], 4)
+			},
+		},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			_, err := tc.build("ftp://example.com")
+			require.Error(t, err, "should require an http url")
+			_, err = tc.build("http://example.com", WithHTTPClient(nil))
+			require.Error(t, err, "should require a client")
+
+			rec, u := newRecorder(t)
+			n, err := tc.build(u, WithHTTPClient(http.DefaultClient))
+			require.NoError(t, err)
+			require.Equal(t, name, n.Name())
+			require.NoError(t, n.Notify(context.Background(), testTransition))
+			require.Len(t, rec.bodies, 1)
+			tc.check(t, rec.bodies[0])
+
+			rec.status = http.StatusInternalServerError
+			err = n.Notify(context.Background(), testTransition)
+			require.ErrorContains(t, err, "nope", "errors should include the response")
+
+			// the url is the webhook's secret so it should never end up in logs
+			secret := "http://127.0.0.1:1/services/T000/B000/sekret"
+			n, err = tc.build(secret, WithHTTPClient(http.DefaultClient))
+			require.NoError(t, err)
+			err = n.Notify(context.Background(), testTransition)
+			require.ErrorContains(t, err, name)
+			require.NotContains(t, err.Error(), "sekret")
+			_, err = tc.build("http://example.com/sekret\x7f")
+			require.Error(t, err)
+			require.NotContains(t, err.Error(), "sekret")
+		})
+	}
+}
+
+func TestFilter(t *testing.T) {
+	t.Parallel()
+	thing := &types.StatusThing{Name: "api", Group: "core"}
+	require.True(t, Filter{}.Matches(thing), "empty filters match everything")
+	require.True(t, Filter{Things: []string{"web", "api"}}.Matches(thing))
+	require.True(t, Filter{Groups: []string{"core"}}.Matches(thing))
+	require.False(t, Filter{Things: []string{"web"}, Groups: []string{"edge"}}.Matches(thing))
+}
+
+type testNotifier struct {
+	lock sync.Mutex
+	seen []types.Transition
+	// err is returned from every notification if set
+	err error
+	// block holds notifications until it is closed if set
+	block chan struct{}
+}
+
+func (tn *testNotifier) Name() string { return "test" }
+
+func (tn *testNotifier) Notify(_ context.Context, t types.Transition) error {
+	if tn.block != nil {
+		<-tn.block
+	}
+	tn.lock.Lock()
+	defer tn.lock.Unlock()
+	tn.seen = append(tn.seen, t)
+	return tn.err
+}
+
+func TestDispatcher(t *testing.T) {
+	t.Parallel()
+	_, err := NewDispatcher(Channel{})
+	require.Error(t, err, "should require a notifier")
+
+	all, core := &testNotifier{}, &testNotifier{}
+	d, err := NewDispatcher(Channel{Notifier: all}, Channel{Notifier: core, Filter: Filter{Groups: []string{"core"}}})
+	require.NoError(t, err)
+
+	d.Observe(context.Background(), testTransition)
+	d.Observe(context.Background(), types.Transition{Thing: &types.StatusThing{Name: "web", Status: types.StatusYellow}, Previous: types.StatusGreen})
+	d.Observe(context.Background(), types.Transition{Thing: &types.StatusThing{Name: "new", Status: types.StatusGreen}, Previous: types.StatusUnknown})
+	require.NoError(t, d.Wait(context.Background()))
+
+	require.Len(t, all.seen, 2, "new things should not be notified about")
+	require.Len(t, core.seen, 1, "filters should be applied")
+	require.Equal(t, "api", core.seen[0].Thing.Name)
+}
+
+func TestDispatcherCheck(t *testing.T) {
+	t.Parallel()
+	failing := &testNotifier{err: fmt.Errorf("snarf")}
+	d, err := NewDispatcher(Channel{Notifier: failing})
+	require.NoError(t, err)
+	for i := 0; i < unhealthyAfter; i++ {
+		require.NoError(t, d.Check(context.Background()), "a few failures should not fail the check")
+		d.Observe(context.Background(), testTransition)
+		require.NoError(t, d.Wait(context.Background()))
+	}
+	require.ErrorContains(t, d.Check(context.Background()), "snarf", "a notifier that keeps failing should fail the check")
+	failing.lock.Lock()
+	failing.err = nil
+	failing.lock.Unlock()
+	d.Observe(context.Background(), testTransition)
+	require.NoError(t, d.Wait(context.Background()))
+	require.NoError(t, d.Check(context.Background()), "a successful notification should clear the failures")
+
+	// a notifier that doesn't give up when its context is done holds up the queue
+	stuck := &testNotifier{block: make(chan struct{})}
+	d, err = NewDispatcher(Channel{Notifier: stuck})
+	require.NoError(t, err)
+	now := time.Now()
+	d.nowFunc = func() time.Time { return now }
+	d.Observe(context.Background(), testTransition)
+	require.NoError(t, d.Check(context.Background()))
+	now = now.Add(3 * d.timeout)
+	require.ErrorContains(t, d.Check(context.Background()), "1 notifications have been sending")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	require.ErrorIs(t, d.Wait(ctx), context.DeadlineExceeded, "waiting should give up when the context is done")
+	close(stuck.block)
+	require.NoError(t, d.Wait(context.Background()))
+	require.NoError(t, d.Check(context.Background()))
+}
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+	channels, err := Parse(strings.NewReader(`
+notifiers:
+  - type: slack
+    url: https://hooks.slack.com/services/x
+    groups: [core]
+  - type: discord
+    url: https://discord.com/api/webhooks/x
+    things: [api, web]
+  - type: teams
+    url: https://example.webhook.office.com/x
+`))
+	require.NoError(t, err)
+	require.Len(t, channels, 3)
+	require.Equal(t, "slack", channels[0].Notifier.Name())
+	require.Equal(t, []string{"core"}, channels[0].Filter.Groups)
+	require.Equal(t, []string{"api", "web"}, channels[1].Filter.Things)
+	require.Equal(t, "teams", channels[2].Notifier.Name())
+
+	for name, body := range map[string]string{
+		"unknown-type":  "notifiers:\n  - type: pager\n",
+		"missing-url":   "notifiers:\n  - type: slack\n",
+		"unknown-field": "notifiers:\n  - type: slack\n    channel: '#ops'\n",
+	} {
+		_, err := Parse(strings.NewReader(body))
+		require.Error(t, err, name)
+	}
+}
+
+// smtpMessage is a message received by [smtpServer]
+type smtpMessage struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is a minimal in-process smtp server that records messages
+type smtpServer struct {
+	lock     sync.Mutex
+	messages []smtpMessage
+	addr     string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	s := &smtpServer{addr: l.Addr().String()}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	msg := smtpMessage{}
+	_ = tp.PrintfLine("220 localhost ESMTP test")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			_ = tp.PrintfLine("250-localhost\r\n250 AUTH PLAIN")
+		case "AUTH":
+			_ = tp.PrintfLine("235 ok")
+		case "MAIL":
+			msg.from = strings.Trim(strings.TrimPrefix(line[5:], "FROM:"), "<>")
+			_ = tp.PrintfLine("250 ok")
+		case "RCPT":
+			msg.to = append(msg.to, strings.Trim(strings.TrimPrefix(line[5:], "TO:"), "<>"))
+			_ = tp.PrintfLine("250 ok")
+		case "DATA":
+			_ = tp.PrintfLine("354 go ahead")
+			data, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			msg.data = strings.Join(data, "\n")
+			s.lock.Lock()
+			s.messages = append(s.messages, msg)
+			s.lock.Unlock()
+			msg = smtpMessage{}
+			_ = tp.PrintfLine("250 ok")
+		case "QUIT":
+			_ = tp.PrintfLine("221 bye")
+			return
+		default:
+			_ = tp.PrintfLine("250 ok")
+		}
+	}
+}
+
+func (s *smtpServer) received() []smtpMessage {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return append([]smtpMessage{}, s.messages...)
+}
+
+// memorySubscribers is an in memory [storers.SubscriberStorer]
+type memorySubscribers struct {
+	lock sync.Mutex
+	subs map[string]*types.Subscriber
+}
+
+func (ms *memorySubscribers) InsertSubscriber(_ context.Context, sub *types.Subscriber) (*types.Subscriber, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if _, ok := ms.subs[sub.Email]; ok {
+		return nil, types.ErrAlreadyExists
+	}
+	ms.subs[sub.Email] = sub
+	return sub, nil
+}
+
+func (ms *memorySubscribers) GetSubscriberByEmail(_ context.Context, email string) (*types.Subscriber, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	if sub, ok := ms.subs[email]; ok {
+		return sub, nil
+	}
+	return nil, types.ErrNotFound
+}
+
+func (ms *memorySubscribers) GetSubscribers(_ context.Context) ([]*types.Subscriber, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	res := []*types.Subscriber{}
+	for _, sub := range ms.subs {
+		res = append(res, sub)
+	}
+	return res, nil
+}
+
+func (ms *memorySubscribers) ConfirmSubscriber(_ context.Context, token string) (*types.Subscriber, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	for _, sub := range ms.subs {
+		if sub.ConfirmToken == token {
+			sub.Confirmed = true
+			return sub, nil
+		}
+	}
+	return nil, types.ErrNotFound
+}
+
+func (ms *memorySubscribers) UpdatePendingSubscriber(_ context.Context, sub *types.Subscriber) (*types.Subscriber, error) {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	existing, ok := ms.subs[sub.Email]
+	if !ok || existing.Confirmed {
+		return nil, types.ErrNotFound
+	}
+	updated := *existing
+	updated.Things, updated.Groups, updated.ConfirmSentAt = sub.Things, sub.Groups, sub.ConfirmSentAt
+	ms.subs[sub.Email] = &updated
+	return &updated, nil
+}
+
+func (ms *memorySubscribers) DeleteSubscriber(_ context.Context, token string) error {
+	ms.lock.Lock()
+	defer ms.lock.Unlock()
+	for email, sub := range ms.subs {
+		if sub.UnsubscribeToken == token {
+			delete(ms.subs, email)
+			return nil
+		}
+	}
+	return types.ErrNotFound
+}
+
+// linkToken extracts the token from the first link to path in an email
+func linkToken(t *testing.T, data, path string) string {
+	t.Helper()
+	idx := strings.Index(data, path+"?token=")
+	require.NotEqual(t, -1, idx, "email should contain a link to %s", path)
+	rest := data[idx+len(path+"?token="):]
+	end := strings.IndexAny(rest, "\r\n>")
+	require.NotEqual(t, -1, end)
+	return rest[:end]
+}
+
+func TestNewEmailNotifier(t *testing.T) {
+	t.Parallel()
+	store := &memorySubscribers{subs: map[string]*types.Subscriber{}}
+	good := SMTPConfig{Addr: "localhost:25", From: "status@example.com"}
+	testCases := map[string]struct {
+		store     *memorySubscribers
+		cfg       SMTPConfig
+		publicURL string
+		opts      []EmailOption
+	}{
+		"nil-store":         {cfg: good, publicURL: "https://example.com"},
+		"bad-addr":          {store: store, cfg: SMTPConfig{Addr: "localhost", From: "status@example.com"}, publicURL: "https://example.com"},
+		"bad-from":          {store: store, cfg: SMTPConfig{Addr: "localhost:25", From: "nope"}, publicURL: "https://example.com"},
+		"relative-url":      {store: store, cfg: good, publicURL: "/statusthings"},
+		"negative-digest":   {store: store, cfg: good, publicURL: "https://example.com", opts: []EmailOption{WithDigest(-time.Second)}},
+		"negative-cooldown": {store: store, cfg: good, publicURL: "https://example.com", opts: []EmailOption{WithConfirmCooldown(-time.Second)}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			var en *EmailNotifier
+			var err error
+			if tc.store == nil {
+				en, err = NewEmailNotifier(nil, tc.cfg, tc.publicURL, tc.opts...)
+			} else {
+				en, err = NewEmailNotifier(tc.store, tc.cfg, tc.publicURL, tc.opts...)
+			}
+			require.Error(t, err)
+			require.Nil(t, en)
+		})
+	}
+}
+
+func TestEmailNotifier(t *testing.T) {
+	t.Parallel()
+	srv := newSMTPServer(t)
+	store := &memorySubscribers{subs: map[string]*types.Subscriber{}}
+	en, err := NewEmailNotifier(store, SMTPConfig{Addr: srv.addr, Username: "user", Password: "pass", From: "Status <status@example.com>"}, "https://status.example.com/statusthings/", WithDigest(time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, "email", en.Name())
+	ctx := context.Background()
+
+	require.ErrorIs(t, en.Subscribe(ctx, "not an email", Filter{}), types.ErrRequiredValueMissing)
+	require.ErrorIs(t, en.Subscribe(ctx, "Bob <bob@example.com>", Filter{}), types.ErrRequiredValueMissing, "display names should not be accepted")
+
+	require.NoError(t, en.Subscribe(ctx, "core@example.com", Filter{Groups: []string{"core"}}))
+	require.NoError(t, en.Subscribe(ctx, "everything@example.com", Filter{}))
+	require.NoError(t, en.Subscribe(ctx, "unconfirmed@example.com", Filter{}))
+	msgs := srv.received()
+	require.Len(t, msgs, 3, "should send confirmation emails")
+	require.Equal(t, "status@example.com", msgs[0].from)
+	require.Equal(t, []string{"core@example.com"}, msgs[0].to)
+	require.Contains(t, msgs[0].data, "Subject: [statusthing] Confirm your subscription")
+	require.Contains(t, msgs[0].data, "https://status.example.com/statusthings"+ConfirmPath+"?token=")
+	require.Contains(t, msgs[0].data, "List-Unsubscribe: <https://status.example.com/statusthings"+UnsubscribePath+"?token=")
+
+	for _, m := range msgs[:2] {
+		require.NoError(t, en.Confirm(ctx, linkToken(t, m.data, ConfirmPath)))
+	}
+	require.ErrorIs(t, en.Confirm(ctx, "nope"), types.ErrNotFound)
+
+	// subscribing again while confirmed should not send anything
+	require.NoError(t, en.Subscribe(ctx, "core@example.com", Filter{}))
+	require.Len(t, srv.received(), 3)
+
+	web := &types.StatusThing{Name: "web", Status: types.StatusYellow}
+	require.NoError(t, en.Notify(ctx, testTransition))
+	require.NoError(t, en.Notify(ctx, types.Transition{Thing: web, Previous: types.StatusGreen, At: testTransition.At}))
+	require.Len(t, srv.received(), 3, "changes should be batched until the digest window passes")
+
+	require.NoError(t, en.Flush(ctx))
+	msgs = srv.received()[3:]
+	require.Len(t, msgs, 2, "only confirmed subscribers with matching filters should be emailed")
+	byRecipient := map[string]string{}
+	for _, m := range msgs {
+		byRecipient[m.to[0]] = m.data
+	}
+	require.Contains(t, byRecipient["core@example.com"], "Subject: [statusthing] api is now red (was green)")
+	require.NotContains(t, byRecipient["core@example.com"], "web is now")
+	require.Contains(t, byRecipient["everything@example.com"], "Subject: [statusthing] 2 status changes")
+	require.Contains(t, byRecipient["everything@example.com"], "web is now yellow (was green)")
+
+	require.NoError(t, en.Flush(ctx), "flushing nothing should be fine")
+	require.Len(t, srv.received(), 5)
+
+	require.NoError(t, en.Unsubscribe(ctx, linkToken(t, byRecipient["everything@example.com"], UnsubscribePath)))
+	require.ErrorIs(t, en.Unsubscribe(ctx, "nope"), types.ErrNotFound)
+	_, err = store.GetSubscriberByEmail(ctx, "everything@example.com")
+	require.ErrorIs(t, err, types.ErrNotFound)
+}
+
+func TestEmailNotifierConfirmCooldown(t *testing.T) {
+	t.Parallel()
+	srv := newSMTPServer(t)
+	store := &memorySubscribers{subs: map[string]*types.Subscriber{}}
+	en, err := NewEmailNotifier(store, SMTPConfig{Addr: srv.addr, From: "status@example.com"}, "https://status.example.com", WithConfirmCooldown(time.Minute))
+	require.NoError(t, err)
+	now := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	en.nowFunc = func() time.Time { return now }
+	ctx := context.Background()
+
+	require.NoError(t, en.Subscribe(ctx, "a@example.com", Filter{Groups: []string{"core"}}))
+	require.Len(t, srv.received(), 1)
+
+	now = now.Add(30 * time.Second)
+	require.NoError(t, en.Subscribe(ctx, "a@example.com", Filter{Things: []string{"api"}}))
+	require.Len(t, srv.received(), 1, "confirmation should not be resent within the cooldown")
+	sub, err := store.GetSubscriberByEmail(ctx, "a@example.com")
+	require.NoError(t, err)
+	require.Equal(t, []string{"api"}, sub.Things, "the latest filter should be kept")
+	require.Empty(t, sub.Groups)
+
+	now = now.Add(time.Minute)
+	require.NoError(t, en.Subscribe(ctx, "a@example.com", Filter{Things: []string{"api"}}))
+	msgs := srv.received()
+	require.Len(t, msgs, 2, "confirmation should be resent once the cooldown has passed")
+	require.Equal(t, linkToken(t, msgs[0].data, ConfirmPath), linkToken(t, msgs[1].data, ConfirmPath), "the same link should be resent")
+}
+
+// newSilentServer starts a server that accepts connections but never says anything
+// each accepted connection is sent on the returned channel if there is room
+func newSilentServer(t *testing.T) (string, chan struct{}) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = l.Close() })
+	accepted := make(chan struct{}, 10)
+	go func() {
+		conns := []net.Conn{}
+		defer func() {
+			for _, c := range conns {
+				_ = c.Close()
+			}
+		}()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+			select {
+			case accepted <- struct{}{}:
+			default:
+			}
+		}
+	}()
+	return l.Addr().String(), accepted
+}
+
+func TestEmailNotifierContext(t *testing.T) {
+	t.Parallel()
+	addr, _ := newSilentServer(t)
+	store := &memorySubscribers{subs: map[string]*types.Subscriber{
+		"a@example.com": {Email: "a@example.com", Confirmed: true, UnsubscribeToken: "u"},
+		"b@example.com": {Email: "b@example.com", Confirmed: true, UnsubscribeToken: "u2"},
+	}}
+	en, err := NewEmailNotifier(store, SMTPConfig{Addr: addr, From: "status@example.com"}, "https://status.example.com", WithDigest(time.Hour))
+	require.NoError(t, err)
+	require.NoError(t, en.Notify(context.Background(), testTransition))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = en.Flush(ctx)
+	require.Error(t, err)
+	require.ErrorIs(t, err, context.DeadlineExceeded, "subscribers left once the context is done should not be emailed")
+	require.Less(t, time.Since(start), 5*time.Second, "flushing should give up when the context is done")
+	en.lock.Lock()
+	require.Len(t, en.undelivered, 2, "everyone should get the changes next time")
+	en.stopDigest()
+	en.lock.Unlock()
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	require.Error(t, en.Subscribe(ctx, "c@example.com", Filter{}))
+	require.Less(t, time.Since(start), 5*time.Second, "subscribing should give up when the context is done")
+}
+
+func TestEmailNotifierRetries(t *testing.T) {
+	t.Parallel()
+	addr, _ := newSilentServer(t)
+	srv := newSMTPServer(t)
+	store := &memorySubscribers{subs: map[string]*types.Subscriber{
+		"a@example.com": {Email: "a@example.com", Confirmed: true, UnsubscribeToken: "u"},
+		"b@example.com": {Email: "b@example.com", Confirmed: true, UnsubscribeToken: "u2"},
+	}}
+	en, err := NewEmailNotifier(store, SMTPConfig{Addr: addr, From: "status@example.com"}, "https://status.example.com", WithDigest(time.Hour))
+	require.NoError(t, err)
+	en.sendTimeout = 50 * time.Millisecond
+	require.NoError(t, en.Notify(context.Background(), testTransition))
+
+	// each email times out on its own so one slow send doesn't use up everyone else's time
+	err = en.Flush(context.Background())
+	require.ErrorContains(t, err, "unable to email a@example.com")
+	require.ErrorContains(t, err, "unable to email b@example.com")
+	en.lock.Lock()
+	require.Len(t, en.undelivered, 2)
+	require.Equal(t, 1, en.undelivered["a@example.com"].attempts)
+	en.stopDigest()
+	en.lock.Unlock()
+
+	// the server recovers and the changes are sent once
+	en.smtp.Addr = srv.addr
+	require.NoError(t, en.Flush(context.Background()))
+	require.Len(t, srv.received(), 2)
+	require.NoError(t, en.Flush(context.Background()))
+	require.Len(t, srv.received(), 2, "delivered changes should not be sent again")
+
+	// changes that keep failing are eventually dropped
+	en.smtp.Addr = addr
+	require.NoError(t, en.Notify(context.Background(), testTransition))
+	for i := 1; i < maxEmailAttempts; i++ {
+		require.Error(t, en.Flush(context.Background()))
+	}
+	err = en.Flush(context.Background())
+	require.ErrorContains(t, err, "giving up")
+	en.lock.Lock()
+	require.Empty(t, en.undelivered)
+	en.lock.Unlock()
+}
+
+func TestEmailNotifierDigestInFlight(t *testing.T) {
+	t.Parallel()
+	addr, accepted := newSilentServer(t)
+	store := &memorySubscribers{subs: map[string]*types.Subscriber{
+		"a@example.com": {Email: "a@example.com", Confirmed: true, UnsubscribeToken: "u"},
+	}}
+	en, err := NewEmailNotifier(store, SMTPConfig{Addr: addr, From: "status@example.com"}, "https://status.example.com", WithDigest(time.Hour))
+	require.NoError(t, err)
+	en.sendTimeout = 200 * time.Millisecond
+	require.NoError(t, en.Notify(context.Background(), testTransition))
+	// send the digest now rather than in an hour
+	en.lock.Lock()
+	en.timer.Reset(time.Millisecond)
+	en.lock.Unlock()
+	<-accepted
+
+	// the digest is being sent so flushing has to wait for it
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err = en.Flush(ctx)
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.ErrorContains(t, err, "unable to wait for the digest")
+
+	// once it is done what it couldn't send is tried again
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	err = en.Flush(ctx)
+	require.ErrorContains(t, err, "unable to email a@example.com")
+	en.lock.Lock()
+	require.Equal(t, 2, en.undelivered["a@example.com"].attempts, "the digest and the flush should both have tried")
+	en.stopDigest()
+	en.lock.Unlock()
+}
+
+func TestEmailNotifierCheck(t *testing.T) {
+	t.Parallel()
+	addr, _ := newSilentServer(t)
+	srv := newSMTPServer(t)
+	store := &memorySubscribers{subs: map[string]*types.Subscriber{
+		"a@example.com": {Email: "a@example.com", Confirmed: true, UnsubscribeToken: "u"},
+	}}
+	en, err := NewEmailNotifier(store, SMTPConfig{Addr: addr, From: "status@example.com"}, "https://status.example.com", WithDigest(time.Minute))
+	require.NoError(t, err)
+	en.sendTimeout = 50 * time.Millisecond
+	now := time.Now()
+	en.nowFunc = func() time.Time { return now }
+	require.NoError(t, en.Check(context.Background()))
+
+	// a digest that hasn't been sent long after it should have been
+	require.NoError(t, en.Notify(context.Background(), testTransition))
+	require.NoError(t, en.Check(context.Background()))
+	now = now.Add(3 * time.Minute)
+	require.ErrorContains(t, en.Check(context.Background()), "waiting 3m0s")
+
+	// nobody could be emailed
+	require.Error(t, en.Flush(context.Background()))
+	require.ErrorContains(t, en.Check(context.Background()), "unable to email any subscribers")
+
+	en.lock.Lock()
+	en.stopDigest()
+	en.lock.Unlock()
+	en.smtp.Addr = srv.addr
+	require.NoError(t, en.Flush(context.Background()))
+	require.NoError(t, en.Check(context.Background()), "sending again should clear the error")
+}
+
+func TestEmailNotifierImmediate(t *testing.T) {
+	t.Parallel()
+	srv := newSMTPServer(t)
+	store := &memorySubscribers{subs: map[string]*types.Subscriber{
+		"a@example.com": {Email: "a@example.com", Confirmed: true, UnsubscribeToken: "u"},
+	}}
+	en, err := NewEmailNotifier(store, SMTPConfig{Addr: srv.addr, From: "status@example.com"}, "https://status.example.com")
+	require.NoError(t, err)
+	d, err := NewDispatcher(Channel{Notifier: en})
+	require.NoError(t, err)
+	d.Observe(context.Background(), testTransition)
+	require.NoError(t, d.Wait(context.Background()))
+	require.Len(t, srv.received(), 1, "without a digest window changes should be sent straight away")
+	require.NoError(t, d.Flush(context.Background()))
+}
@@ -0,0 +1,77 @@
+package notifiers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// slackEmoji are the emoji used for each status in slack messages
+var slackEmoji = map[types.Status]string{
+	types.StatusRed:    ":red_circle:",
+	types.StatusYellow: ":large_yellow_circle:",
+	types.StatusGreen:  ":large_green_circle:",
+}
+
+// SlackNotifier posts Block Kit messages to a slack incoming webhook
+type SlackNotifier struct {
+	webhook *webhook
+}
+
+// ensure we always satisfy
+var _ Notifier = (*SlackNotifier)(nil)
+
+// NewSlackNotifier returns a new [SlackNotifier] posting to the incoming webhook url
+func NewSlackNotifier(webhookURL string, opts ...Option) (*SlackNotifier, error) {
+	w, err := newWebhook("slack", webhookURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &SlackNotifier{webhook: w}, nil
+}
+
+// Name identifies the notifier in logs
+func (sn *SlackNotifier) Name() string {
+	return "slack"
+}
+
+// Notify sends a notification about t
+func (sn *SlackNotifier) Notify(ctx context.Context, t types.Transition) error {
+	return sn.webhook.post(ctx, slackMessage(t))
+}
+
+type slackText struct {
+	Type string `json:"type"`
+	Text string `json:"text"`
+}
+
+type slackBlock struct {
+	Type     string      `json:"type"`
+	Text     *slackText  `json:"text,omitempty"`
+	Elements []slackText `json:"elements,omitempty"`
+}
+
+type slackPayload struct {
+	// Text is the fallback for notifications and clients without block support
+	Text   string       `json:"text"`
+	Blocks []slackBlock `json:"blocks"`
+}
+
+func slackMessage(t types.Transition) slackPayload {
+	text := fmt.Sprintf("%s *%s* is now *%s* (was %s)", slackEmoji[t.Thing.Status], t.Thing.Name, shortStatus(t.Thing.Status), shortStatus(t.Previous))
+	if t.Thing.Description != "" {
+		text += "\n" + t.Thing.Description
+	}
+	footer := fmt.Sprintf("<!date^%d^{date_short_pretty} {time}|%s>", t.At.Unix(), t.At.UTC().Format("2006-01-02 15:04:05 MST"))
+	if t.Thing.Group != "" {
+		footer = "group: " + t.Thing.Group + " | " + footer
+	}
+	return slackPayload{
+		Text: summary(t),
+		Blocks: []slackBlock{
+			{Type: "section", Text: &slackText{Type: "mrkdwn", Text: text}},
+			{Type: "context", Elements: []slackText{{Type: "mrkdwn", Text: footer}}},
+		},
+	}
+}
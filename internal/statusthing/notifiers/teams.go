@@ -0,0 +1,104 @@
+package notifiers
+
+import (
+	"context"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+const (
+	adaptiveCardContentType = "application/vnd.microsoft.card.adaptive"
+	adaptiveCardSchema      = "http://adaptivecards.io/schemas/adaptive-card.json"
+	adaptiveCardVersion     = "1.4"
+)
+
+// teamsColors are the adaptive card text colors used for each status
+var teamsColors = map[types.Status]string{
+	types.StatusRed:    "Attention",
+	types.StatusYellow: "Warning",
+	types.StatusGreen:  "Good",
+}
+
+// TeamsNotifier posts adaptive cards to a microsoft teams incoming webhook or workflow
+type TeamsNotifier struct {
+	webhook *webhook
+}
+
+// ensure we always satisfy
+var _ Notifier = (*TeamsNotifier)(nil)
+
+// NewTeamsNotifier returns a new [TeamsNotifier] posting to the webhook url
+func NewTeamsNotifier(webhookURL string, opts ...Option) (*TeamsNotifier, error) {
+	w, err := newWebhook("teams", webhookURL, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &TeamsNotifier{webhook: w}, nil
+}
+
+// Name identifies the notifier in logs
+func (tn *TeamsNotifier) Name() string {
+	return "teams"
+}
+
+// Notify sends a notification about t
+func (tn *TeamsNotifier) Notify(ctx context.Context, t types.Transition) error {
+	return tn.webhook.post(ctx, teamsMessage(t))
+}
+
+type teamsFact struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+}
+
+type teamsElement struct {
+	Type   string      `json:"type"`
+	Text   string      `json:"text,omitempty"`
+	Size   string      `json:"size,omitempty"`
+	Weight string      `json:"weight,omitempty"`
+	Color  string      `json:"color,omitempty"`
+	Wrap   bool        `json:"wrap,omitempty"`
+	Facts  []teamsFact `json:"facts,omitempty"`
+}
+
+type teamsCard struct {
+	Schema  string         `json:"$schema"`
+	Type    string         `json:"type"`
+	Version string         `json:"version"`
+	Body    []teamsElement `json:"body"`
+}
+
+type teamsAttachment struct {
+	ContentType string    `json:"contentType"`
+	Content     teamsCard `json:"content"`
+}
+
+type teamsPayload struct {
+	Type        string            `json:"type"`
+	Attachments []teamsAttachment `json:"attachments"`
+}
+
+func teamsMessage(t types.Transition) teamsPayload {
+	body := []teamsElement{
+		{Type: "TextBlock", Text: summary(t), Size: "Medium", Weight: "Bolder", Color: teamsColors[t.Thing.Status], Wrap: true},
+	}
+	if t.Thing.Description != "" {
+		body = append(body, teamsElement{Type: "TextBlock", Text: t.Thing.Description, Wrap: true})
+	}
+	facts := []teamsFact{
+		{Title: "Status", Value: shortStatus(t.Thing.Status)},
+		{Title: "Previous", Value: shortStatus(t.Previous)},
+	}
+	if t.Thing.Group != "" {
+		facts = append(facts, teamsFact{Title: "Group", Value: t.Thing.Group})
+	}
+	facts = append(facts, teamsFact{Title: "Changed", Value: t.At.UTC().Format("2006-01-02 15:04:05 MST")})
+	body = append(body, teamsElement{Type: "FactSet", Facts: facts})
+	return teamsPayload{
+		Type: "message",
+		Attachments: []teamsAttachment{{
+			ContentType: adaptiveCardContentType,
+			Content:     teamsCard{Schema: adaptiveCardSchema, Type: "AdaptiveCard", Version: adaptiveCardVersion, Body: body},
+		}},
+	}
+}
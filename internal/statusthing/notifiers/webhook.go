@@ -0,0 +1,88 @@
+package notifiers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// maxErrorBody is how much of an error response is included in errors
+const maxErrorBody = 512
+
+// Option is a functional option for the chat notifiers
+type Option func(*webhook) error
+
+// WithHTTPClient sets the http client used to send notifications
+func WithHTTPClient(c *http.Client) Option {
+	return func(w *webhook) error {
+		if c == nil {
+			return fmt.Errorf("http client cannot be nil")
+		}
+		w.client = c
+		return nil
+	}
+}
+
+// webhook posts json payloads to an incoming webhook url
+// the url is usually the only secret so it is kept out of errors
+type webhook struct {
+	name   string
+	url    string
+	client *http.Client
+}
+
+func newWebhook(name, rawURL string, opts ...Option) (*webhook, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s webhook url: %w", name, stripURL(err))
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("webhook url must be http or https")
+	}
+	w := &webhook{name: name, url: rawURL, client: &http.Client{Timeout: defaultTimeout}}
+	for _, opt := range opts {
+		if err := opt(w); err != nil {
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// post sends payload as json
+func (w *webhook) post(ctx context.Context, payload any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	res, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("unable to send %s notification: %w", w.name, stripURL(err))
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, maxErrorBody)) // nolint: errcheck
+		return fmt.Errorf("%s webhook returned %s: %s", w.name, res.Status, bytes.TrimSpace(msg))
+	}
+	// drain the body so the connection can be reused
+	_, _ = io.Copy(io.Discard, res.Body) // nolint: errcheck
+	return nil
+}
+
+// stripURL returns the error a [url.Error] wraps so the url isn't logged
+func stripURL(err error) error {
+	var uerr *url.Error
+	if errors.As(err, &uerr) {
+		return uerr.Err
+	}
+	return err
+}
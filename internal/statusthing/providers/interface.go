@@ -3,6 +3,7 @@ package providers
 import (
 	"context"
 
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
 	"github.com/lusis/apithings/internal/statusthing/types"
 )
 
@@ -15,15 +16,20 @@ type Provider interface {
 	// Add adds a [types.StatusThing]
 	Add(ctx context.Context, newThing Params) (*types.StatusThing, error)
 	// Remove removes a [types.StatusThing] by its id
-	Remove(ctx context.Context, id string) error
+	// [dbfilters.WithVersion] can be provided to only remove the thing if it has not changed
+	Remove(ctx context.Context, id string, opts ...dbfilters.Option) error
 	// SetStatus sets the status of a [types.StatusThing] by its id
-	SetStatus(ctx context.Context, id string, status types.Status) error
+	// [dbfilters.WithVersion] can be provided to only set the status if the thing has not changed
+	// [dbfilters.WithDescription] and [dbfilters.WithGroup] can be provided to change the description and group at the same time
+	// the thing is returned as it was before and after the change
+	SetStatus(ctx context.Context, id string, status types.Status, opts ...dbfilters.Option) (previous *types.StatusThing, updated *types.StatusThing, err error)
 }
 
 // Params are params that can be passed to a [Provider]
 type Params struct {
 	Name        string
 	Description string
+	Group       string
 	Status      types.Status
 }
 
@@ -49,11 +55,11 @@ func (up *UnimplementedProvider) Add(ctx context.Context, newThing Params) (*typ
 }
 
 // Remove removes a [types.StatusThing] by its id
-func (up *UnimplementedProvider) Remove(ctx context.Context, id string) error {
+func (up *UnimplementedProvider) Remove(ctx context.Context, id string, opts ...dbfilters.Option) error {
 	panic("not implemented")
 }
 
 // SetStatus sets the status of a [types.StatusThing] by its id
-func (up *UnimplementedProvider) SetStatus(ctx context.Context, id string, status types.Status) error {
+func (up *UnimplementedProvider) SetStatus(ctx context.Context, id string, status types.Status, opts ...dbfilters.Option) (*types.StatusThing, *types.StatusThing, error) {
 	panic("not implemented")
 }
@@ -43,29 +43,29 @@ func (stp *StatusThingProvider) All(ctx context.Context) ([]*types.StatusThing,
 // Add adds a [types.StatusThing]
 func (stp *StatusThingProvider) Add(ctx context.Context, newThing Params) (*types.StatusThing, error) {
 	if newThing.Status == types.StatusUnknown {
-		return nil, fmt.Errorf("a valid status must be provided: %w", types.ErrRequiredValueMissing)
+		return nil, types.NewValidationError("status", "a valid status must be provided")
 	}
 	if newThing.Name == "" {
-		return nil, fmt.Errorf("name cannot be empty: %w", types.ErrRequiredValueMissing)
+		return nil, types.NewValidationError("name", "name cannot be empty")
 	}
 	if newThing.Description == "" {
-		return nil, fmt.Errorf("description cannot be empty: %w", types.ErrRequiredValueMissing)
+		return nil, types.NewValidationError("description", "description cannot be empty")
 	}
 	return stp.store.Insert(ctx, &types.StatusThing{
 		ID:          stp.idFunc(),
 		Name:        newThing.Name,
 		Description: newThing.Description,
+		Group:       newThing.Group,
 		Status:      newThing.Status,
 	})
 }
 
 // Remove removes a [types.StatusThing] by its id
-func (stp *StatusThingProvider) Remove(ctx context.Context, id string) error {
-	return stp.store.Delete(ctx, id)
+func (stp *StatusThingProvider) Remove(ctx context.Context, id string, opts ...dbfilters.Option) error {
+	return stp.store.Delete(ctx, id, opts...)
 }
 
 // SetStatus sets the status of a [types.StatusThing] by its id
-func (stp *StatusThingProvider) SetStatus(ctx context.Context, id string, status types.Status) error {
-	_, err := stp.store.Update(ctx, id, dbfilters.WithStatus(status))
-	return err
+func (stp *StatusThingProvider) SetStatus(ctx context.Context, id string, status types.Status, opts ...dbfilters.Option) (*types.StatusThing, *types.StatusThing, error) {
+	return stp.store.Update(ctx, id, append([]dbfilters.Option{dbfilters.WithStatus(status)}, opts...)...)
 }
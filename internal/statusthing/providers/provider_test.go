@@ -9,6 +9,11 @@ import (
 	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
 	"github.com/lusis/apithings/internal/statusthing/types"
 	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
 )
 
 func TestImplements(t *testing.T) {
@@ -38,15 +43,15 @@ func TestHappyPath(t *testing.T) {
 			}
 			return nil
 		},
-		updateFunc: func(id string, opts *dbfilters.Filters) (*types.StatusThing, error) {
+		updateFunc: func(id string, opts *dbfilters.Filters) (*types.StatusThing, *types.StatusThing, error) {
 			if opts.Status() == types.StatusUnknown {
-				return nil, fmt.Errorf("status was not provided")
+				return nil, nil, fmt.Errorf("status was not provided")
 			}
 			if opts.Status() != newStatus {
-				return nil, fmt.Errorf("expected status not provided")
+				return nil, nil, fmt.Errorf("expected status not provided")
 			}
 			// we don't care what we return here
-			return &types.StatusThing{}, nil
+			return &types.StatusThing{}, &types.StatusThing{}, nil
 		},
 	}
 	p, err := NewStatusThingProvider(ts)
@@ -66,7 +71,8 @@ func TestHappyPath(t *testing.T) {
 	require.NotNil(t, insertres, "result should not be nil")
 	require.NotEmpty(t, insertres.ID, "id should have been generated")
 
-	require.NoError(t, p.SetStatus(context.Background(), "fakeid", newStatus), "set status should work")
+	_, _, err = p.SetStatus(context.Background(), "fakeid", newStatus)
+	require.NoError(t, err, "set status should work")
 	require.NoError(t, p.Remove(context.Background(), "fakeid"), "delete should work")
 }
 
@@ -85,10 +91,11 @@ func TestMissingParams(t *testing.T) {
 	testCases := map[string]struct {
 		thing Params
 		err   error
+		field string
 	}{
-		"invalid-status":      {Params{Name: t.Name(), Description: t.Name()}, types.ErrRequiredValueMissing},
-		"missing-name":        {Params{Status: types.StatusGreen, Description: t.Name()}, types.ErrRequiredValueMissing},
-		"missing-description": {Params{Status: types.StatusGreen, Name: t.Name()}, types.ErrRequiredValueMissing},
+		"invalid-status":      {Params{Name: t.Name(), Description: t.Name()}, types.ErrRequiredValueMissing, "status"},
+		"missing-name":        {Params{Status: types.StatusGreen, Description: t.Name()}, types.ErrRequiredValueMissing, "name"},
+		"missing-description": {Params{Status: types.StatusGreen, Name: t.Name()}, types.ErrRequiredValueMissing, "description"},
 	}
 	t.Parallel()
 	for name, tc := range testCases {
@@ -96,16 +103,168 @@ func TestMissingParams(t *testing.T) {
 			res, err := p.Add(context.Background(), tc.thing)
 			require.Nil(t, res, "should not return a result")
 			require.ErrorIs(t, err, tc.err, "should be expected error type")
+			var verr *types.ValidationError
+			require.ErrorAs(t, err, &verr, "should be a validation error")
+			require.Equal(t, tc.field, verr.Field, "should report the offending field")
 		})
 	}
 }
 
+func TestTransitionProvider(t *testing.T) {
+	t.Parallel()
+	_, err := NewTransitionProvider(nil)
+	require.Error(t, err, "should require a provider")
+	_, err = NewTransitionProvider(&UnimplementedProvider{}, nil)
+	require.Error(t, err, "should not allow nil funcs")
+
+	thing := &types.StatusThing{ID: "abc", Name: "api", Description: "the api", Status: types.StatusGreen}
+	ts := &testStorer{
+		// the transition has to come from the update since anything read separately may include another change
+		getFunc: func() (*types.StatusThing, error) {
+			return &types.StatusThing{ID: "abc", Name: "api", Status: types.StatusYellow}, nil
+		},
+		insertFunc: func(st *types.StatusThing) (*types.StatusThing, error) { return st, nil },
+		updateFunc: func(id string, opts *dbfilters.Filters) (*types.StatusThing, *types.StatusThing, error) {
+			previous := *thing
+			thing.Status = opts.Status()
+			thing.Version++
+			updated := *thing
+			return &previous, &updated, nil
+		},
+	}
+	sp, err := NewStatusThingProvider(ts)
+	require.NoError(t, err)
+	var seen []types.Transition
+	tp, err := NewTransitionProvider(sp, func(_ context.Context, tr types.Transition) { seen = append(seen, tr) })
+	require.NoError(t, err)
+
+	_, err = tp.Add(context.Background(), Params{Name: "web", Description: "the web", Status: types.StatusYellow})
+	require.NoError(t, err)
+	require.Len(t, seen, 1, "adding should be a transition")
+	require.Equal(t, types.StatusUnknown, seen[0].Previous)
+	require.Equal(t, types.StatusYellow, seen[0].Thing.Status)
+
+	_, _, err = tp.SetStatus(context.Background(), "abc", types.StatusGreen)
+	require.NoError(t, err)
+	require.Len(t, seen, 1, "unchanged status should not be a transition")
+
+	previous, updated, err := tp.SetStatus(context.Background(), "abc", types.StatusRed)
+	require.NoError(t, err)
+	require.Equal(t, types.StatusGreen, previous.Status)
+	require.Equal(t, types.StatusRed, updated.Status)
+	require.Len(t, seen, 2)
+	require.Equal(t, types.StatusGreen, seen[1].Previous)
+	require.Equal(t, types.StatusRed, seen[1].Thing.Status)
+	require.Equal(t, updated.Version, seen[1].Thing.Version)
+	require.Equal(t, "api", seen[1].Thing.Name)
+	require.False(t, seen[1].At.IsZero(), "should record when")
+}
+
+func TestRemoveProvider(t *testing.T) {
+	t.Parallel()
+	_, err := NewRemoveProvider(nil)
+	require.Error(t, err, "should require a provider")
+	_, err = NewRemoveProvider(&UnimplementedProvider{}, nil)
+	require.Error(t, err, "should not allow nil funcs")
+
+	ts := &testStorer{
+		deleteFunc: func(id string) error {
+			if id != "abc" {
+				return types.ErrNotFound
+			}
+			return nil
+		},
+	}
+	sp, err := NewStatusThingProvider(ts)
+	require.NoError(t, err)
+	var removed []string
+	rp, err := NewRemoveProvider(sp, func(_ context.Context, id string) { removed = append(removed, id) })
+	require.NoError(t, err)
+
+	require.ErrorIs(t, rp.Remove(context.Background(), "nope"), types.ErrNotFound)
+	require.Empty(t, removed, "failed removals should not be reported")
+	require.NoError(t, rp.Remove(context.Background(), "abc"))
+	require.Equal(t, []string{"abc"}, removed)
+}
+
+func TestDescriptionProvider(t *testing.T) {
+	t.Parallel()
+	_, err := NewDescriptionProvider(nil)
+	require.Error(t, err, "should require a provider")
+	_, err = NewDescriptionProvider(&UnimplementedProvider{}, nil)
+	require.Error(t, err, "should not allow nil funcs")
+
+	thing := &types.StatusThing{ID: "abc", Name: "api", Description: "the api", Status: types.StatusGreen}
+	ts := &testStorer{
+		updateFunc: func(id string, opts *dbfilters.Filters) (*types.StatusThing, *types.StatusThing, error) {
+			previous := *thing
+			thing.Status = opts.Status()
+			if desc := opts.Description(); desc != "" {
+				thing.Description = desc
+			}
+			updated := *thing
+			return &previous, &updated, nil
+		},
+	}
+	sp, err := NewStatusThingProvider(ts)
+	require.NoError(t, err)
+	var seen []*types.StatusThing
+	dp, err := NewDescriptionProvider(sp, func(_ context.Context, previous, updated *types.StatusThing) {
+		require.Equal(t, previous.Status, updated.Status)
+		seen = append(seen, updated)
+	})
+	require.NoError(t, err)
+
+	_, _, err = dp.SetStatus(context.Background(), "abc", types.StatusGreen)
+	require.NoError(t, err)
+	require.Empty(t, seen, "nothing changed")
+	_, _, err = dp.SetStatus(context.Background(), "abc", types.StatusRed, dbfilters.WithDescription("investigating"))
+	require.NoError(t, err)
+	require.Empty(t, seen, "status changes are transitions and not description updates")
+	_, _, err = dp.SetStatus(context.Background(), "abc", types.StatusRed, dbfilters.WithDescription("fix deployed"))
+	require.NoError(t, err)
+	require.Len(t, seen, 1)
+	require.Equal(t, "fix deployed", seen[0].Description)
+}
+
+func TestTracingProvider(t *testing.T) {
+	t.Parallel()
+	sr := tracetest.NewSpanRecorder()
+	tracerProvider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	_, err := NewTracingProvider(nil, tracerProvider)
+	require.Error(t, err, "should require a provider")
+	_, err = NewTracingProvider(&UnimplementedProvider{}, nil)
+	require.Error(t, err, "should require a tracer provider")
+
+	ts := &testStorer{
+		getFunc: func() (*types.StatusThing, error) { return nil, types.ErrNotFound },
+		allFunc: func() ([]*types.StatusThing, error) { return nil, fmt.Errorf("kaboom") },
+	}
+	sp, err := NewStatusThingProvider(ts)
+	require.NoError(t, err)
+	tp, err := NewTracingProvider(sp, tracerProvider)
+	require.NoError(t, err)
+
+	_, err = tp.Get(context.Background(), "abc")
+	require.ErrorIs(t, err, types.ErrNotFound)
+	_, err = tp.All(context.Background())
+	require.Error(t, err)
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "Provider.Get", spans[0].Name())
+	require.Contains(t, spans[0].Attributes(), attribute.String("statusthing.id", "abc"))
+	require.Equal(t, codes.Unset, spans[0].Status().Code, "not found is not an error")
+	require.Equal(t, "Provider.All", spans[1].Name())
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+}
+
 type testStorer struct {
 	storers.UnimplementedStorer
 	getFunc    func() (*types.StatusThing, error)
 	allFunc    func() ([]*types.StatusThing, error)
 	insertFunc func(*types.StatusThing) (*types.StatusThing, error)
-	updateFunc func(id string, opts *dbfilters.Filters) (*types.StatusThing, error)
+	updateFunc func(id string, opts *dbfilters.Filters) (*types.StatusThing, *types.StatusThing, error)
 	deleteFunc func(id string) error
 }
 
@@ -121,14 +280,14 @@ func (ts *testStorer) Insert(ctx context.Context, thing *types.StatusThing) (*ty
 	return ts.insertFunc(thing)
 }
 
-func (ts *testStorer) Delete(ctx context.Context, id string) error {
+func (ts *testStorer) Delete(ctx context.Context, id string, opts ...dbfilters.Option) error {
 	return ts.deleteFunc(id)
 }
 
-func (ts *testStorer) Update(ctx context.Context, id string, opts ...dbfilters.Option) (*types.StatusThing, error) {
+func (ts *testStorer) Update(ctx context.Context, id string, opts ...dbfilters.Option) (*types.StatusThing, *types.StatusThing, error) {
 	dbopts, err := dbfilters.New(opts...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 	return ts.updateFunc(id, dbopts)
 }
@@ -0,0 +1,83 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/tracing"
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// tracingScope is the instrumentation scope for provider spans
+const tracingScope = "github.com/lusis/apithings/internal/statusthing/providers"
+
+// TracingProvider wraps a [Provider] and starts a span for every call
+type TracingProvider struct {
+	Provider
+	tracer trace.Tracer
+}
+
+// ensure we always satisfy
+var _ Provider = (*TracingProvider)(nil)
+
+// NewTracingProvider returns a new [TracingProvider] wrapping p
+func NewTracingProvider(p Provider, tp trace.TracerProvider) (*TracingProvider, error) {
+	if p == nil {
+		return nil, fmt.Errorf("provider cannot be nil")
+	}
+	if tp == nil {
+		return nil, fmt.Errorf("tracer provider cannot be nil")
+	}
+	return &TracingProvider{Provider: p, tracer: tp.Tracer(tracingScope)}, nil
+}
+
+// All gets all [types.StatusThing]
+func (tp *TracingProvider) All(ctx context.Context) ([]*types.StatusThing, error) {
+	ctx, span := tp.tracer.Start(ctx, "Provider.All")
+	res, err := tp.Provider.All(ctx)
+	span.SetAttributes(attribute.Int("statusthing.count", len(res)))
+	tracing.End(span, err)
+	return res, err
+}
+
+// Get gets a [types.StatusThing] by its id
+func (tp *TracingProvider) Get(ctx context.Context, id string) (*types.StatusThing, error) {
+	ctx, span := tp.tracer.Start(ctx, "Provider.Get", trace.WithAttributes(attribute.String("statusthing.id", id)))
+	res, err := tp.Provider.Get(ctx, id)
+	tracing.End(span, err)
+	return res, err
+}
+
+// Add adds a [types.StatusThing]
+func (tp *TracingProvider) Add(ctx context.Context, newThing Params) (*types.StatusThing, error) {
+	ctx, span := tp.tracer.Start(ctx, "Provider.Add", trace.WithAttributes(attribute.String("statusthing.name", newThing.Name)))
+	res, err := tp.Provider.Add(ctx, newThing)
+	if res != nil {
+		span.SetAttributes(attribute.String("statusthing.id", res.ID))
+	}
+	tracing.End(span, err)
+	return res, err
+}
+
+// Remove removes a [types.StatusThing] by its id
+func (tp *TracingProvider) Remove(ctx context.Context, id string, opts ...dbfilters.Option) error {
+	ctx, span := tp.tracer.Start(ctx, "Provider.Remove", trace.WithAttributes(attribute.String("statusthing.id", id)))
+	err := tp.Provider.Remove(ctx, id, opts...)
+	tracing.End(span, err)
+	return err
+}
+
+// SetStatus sets the status of a [types.StatusThing] by its id
+func (tp *TracingProvider) SetStatus(ctx context.Context, id string, status types.Status, opts ...dbfilters.Option) (*types.StatusThing, *types.StatusThing, error) {
+	ctx, span := tp.tracer.Start(ctx, "Provider.SetStatus", trace.WithAttributes(
+		attribute.String("statusthing.id", id),
+		attribute.String("statusthing.status", status.String()),
+	))
+	previous, updated, err := tp.Provider.SetStatus(ctx, id, status, opts...)
+	tracing.End(span, err)
+	return previous, updated, err
+}
@@ -0,0 +1,146 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// TransitionFunc is called after a [types.StatusThing] changes status
+type TransitionFunc func(ctx context.Context, t types.Transition)
+
+// TransitionProvider wraps a [Provider] and calls every registered [TransitionFunc] when a thing is added or its status changes
+type TransitionProvider struct {
+	Provider
+	funcs   []TransitionFunc
+	nowFunc func() time.Time
+}
+
+// ensure we always satisfy
+var _ Provider = (*TransitionProvider)(nil)
+
+// NewTransitionProvider returns a new [TransitionProvider] wrapping p
+func NewTransitionProvider(p Provider, funcs ...TransitionFunc) (*TransitionProvider, error) {
+	if p == nil {
+		return nil, fmt.Errorf("provider cannot be nil")
+	}
+	for _, fn := range funcs {
+		if fn == nil {
+			return nil, fmt.Errorf("transition func cannot be nil")
+		}
+	}
+	return &TransitionProvider{Provider: p, funcs: funcs, nowFunc: time.Now}, nil
+}
+
+// Add adds a [types.StatusThing]
+// the new thing is reported as a transition from [types.StatusUnknown]
+func (tp *TransitionProvider) Add(ctx context.Context, newThing Params) (*types.StatusThing, error) {
+	res, err := tp.Provider.Add(ctx, newThing)
+	if err != nil {
+		return nil, err
+	}
+	tp.notify(ctx, types.Transition{Thing: res, Previous: types.StatusUnknown, At: tp.nowFunc()})
+	return res, nil
+}
+
+// SetStatus sets the status of a [types.StatusThing] by its id
+// funcs are only called if the status actually changed
+// the transition is built from the states the wrapped provider returns so it always describes this change
+func (tp *TransitionProvider) SetStatus(ctx context.Context, id string, status types.Status, opts ...dbfilters.Option) (*types.StatusThing, *types.StatusThing, error) {
+	previous, updated, err := tp.Provider.SetStatus(ctx, id, status, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if previous.Status != updated.Status {
+		tp.notify(ctx, types.Transition{Thing: updated, Previous: previous.Status, At: tp.nowFunc()})
+	}
+	return previous, updated, nil
+}
+
+func (tp *TransitionProvider) notify(ctx context.Context, t types.Transition) {
+	for _, fn := range tp.funcs {
+		fn(ctx, t)
+	}
+}
+
+// RemoveFunc is called after a [types.StatusThing] is removed
+type RemoveFunc func(ctx context.Context, id string)
+
+// RemoveProvider wraps a [Provider] and calls every registered [RemoveFunc] when a thing is removed
+// this lets anything keeping state per thing drop it
+type RemoveProvider struct {
+	Provider
+	funcs []RemoveFunc
+}
+
+// ensure we always satisfy
+var _ Provider = (*RemoveProvider)(nil)
+
+// NewRemoveProvider returns a new [RemoveProvider] wrapping p
+func NewRemoveProvider(p Provider, funcs ...RemoveFunc) (*RemoveProvider, error) {
+	if p == nil {
+		return nil, fmt.Errorf("provider cannot be nil")
+	}
+	for _, fn := range funcs {
+		if fn == nil {
+			return nil, fmt.Errorf("remove func cannot be nil")
+		}
+	}
+	return &RemoveProvider{Provider: p, funcs: funcs}, nil
+}
+
+// Remove removes a [types.StatusThing] by its id
+// funcs are only called if it was removed
+func (rp *RemoveProvider) Remove(ctx context.Context, id string, opts ...dbfilters.Option) error {
+	if err := rp.Provider.Remove(ctx, id, opts...); err != nil {
+		return err
+	}
+	for _, fn := range rp.funcs {
+		fn(ctx, id)
+	}
+	return nil
+}
+
+// DescriptionFunc is called after the description of a [types.StatusThing] changes without its status changing
+type DescriptionFunc func(ctx context.Context, previous, updated *types.StatusThing)
+
+// DescriptionProvider wraps a [Provider] and calls every registered [DescriptionFunc] when only the description of a thing changes
+// this lets updates to an ongoing incident be recorded without them looking like a status change
+type DescriptionProvider struct {
+	Provider
+	funcs []DescriptionFunc
+}
+
+// ensure we always satisfy
+var _ Provider = (*DescriptionProvider)(nil)
+
+// NewDescriptionProvider returns a new [DescriptionProvider] wrapping p
+func NewDescriptionProvider(p Provider, funcs ...DescriptionFunc) (*DescriptionProvider, error) {
+	if p == nil {
+		return nil, fmt.Errorf("provider cannot be nil")
+	}
+	for _, fn := range funcs {
+		if fn == nil {
+			return nil, fmt.Errorf("description func cannot be nil")
+		}
+	}
+	return &DescriptionProvider{Provider: p, funcs: funcs}, nil
+}
+
+// SetStatus sets the status of a [types.StatusThing] by its id
+// funcs are only called if the description changed and the status did not
+func (dp *DescriptionProvider) SetStatus(ctx context.Context, id string, status types.Status, opts ...dbfilters.Option) (*types.StatusThing, *types.StatusThing, error) {
+	previous, updated, err := dp.Provider.SetStatus(ctx, id, status, opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	if previous.Status == updated.Status && previous.Description != updated.Description {
+		for _, fn := range dp.funcs {
+			fn(ctx, previous, updated)
+		}
+	}
+	return previous, updated, nil
+}
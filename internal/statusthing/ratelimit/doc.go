@@ -0,0 +1,2 @@
+// Package ratelimit limits how often callers can make requests with a token bucket per caller
+package ratelimit
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// sweepInterval is how often buckets that have refilled are forgotten
+const sweepInterval = time.Minute
+
+// Limiter is a token bucket rate limiter with a bucket per key
+type Limiter struct {
+	// rate is how many tokens are added to a bucket per second
+	rate float64
+	// burst is how many tokens a bucket holds
+	burst float64
+
+	lock      sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	nowFunc   func() time.Time
+}
+
+// bucket is the tokens left for a single key as of last
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// New returns a new [Limiter] allowing rate requests per second per key on average
+// and up to burst requests at once
+func New(rate float64, burst int) (*Limiter, error) {
+	if rate <= 0 || math.IsInf(rate, 0) || math.IsNaN(rate) {
+		return nil, fmt.Errorf("rate must be a positive number")
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("burst must be at least 1")
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+		nowFunc: time.Now,
+	}, nil
+}
+
+// Allow takes a token from the bucket for key
+// if the bucket is empty it returns false and how long until a token is available
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	now := l.nowFunc()
+	l.sweep(now)
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// refill returns the tokens in b at now
+func (l *Limiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed <= 0 {
+		return b.tokens
+	}
+	return math.Min(l.burst, b.tokens+elapsed*l.rate)
+}
+
+// sweep forgets full buckets since they are the same as a new one
+// callers must hold the lock
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < sweepInterval {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if l.refill(b, now) >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
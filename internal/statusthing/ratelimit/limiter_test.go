@@ -0,0 +1,66 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	_, err := New(0, 1)
+	require.Error(t, err, "rate should be positive")
+	_, err = New(1, 0)
+	require.Error(t, err, "burst should be at least 1")
+	_, err = New(0.5, 1)
+	require.NoError(t, err)
+}
+
+func TestAllow(t *testing.T) {
+	t.Parallel()
+	l, err := New(2, 3)
+	require.NoError(t, err)
+	now := time.Unix(1000, 0)
+	l.nowFunc = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("a")
+		require.True(t, ok, "requests up to the burst should be allowed")
+	}
+	ok, wait := l.Allow("a")
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, wait, "a token is added every half second")
+
+	ok, _ = l.Allow("b")
+	require.True(t, ok, "keys should have their own bucket")
+
+	now = now.Add(500 * time.Millisecond)
+	ok, _ = l.Allow("a")
+	require.True(t, ok)
+	ok, _ = l.Allow("a")
+	require.False(t, ok)
+
+	// buckets are refilled up to the burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		ok, _ := l.Allow("a")
+		require.True(t, ok)
+	}
+	ok, _ = l.Allow("a")
+	require.False(t, ok)
+}
+
+func TestSweep(t *testing.T) {
+	t.Parallel()
+	l, err := New(1, 1)
+	require.NoError(t, err)
+	now := time.Unix(1000, 0)
+	l.nowFunc = func() time.Time { return now }
+	l.Allow("a")
+	now = now.Add(2 * sweepInterval)
+	l.Allow("b")
+	require.Len(t, l.buckets, 1, "full buckets should be forgotten")
+	_, ok := l.buckets["b"]
+	require.True(t, ok)
+}
@@ -0,0 +1,164 @@
+package receivers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+const (
+	// DefaultAlertmanagerNameLabel is the alert label holding the name of the thing an alert applies to
+	DefaultAlertmanagerNameLabel = "statusthing_name"
+	// DefaultAlertmanagerSeverityLabel is the alert label holding the severity of an alert
+	DefaultAlertmanagerSeverityLabel = "severity"
+
+	alertFiring   = "firing"
+	alertResolved = "resolved"
+)
+
+// AlertmanagerReceiver receives Prometheus Alertmanager webhooks
+// firing alerts set the thing to the status mapped from their severity and resolved alerts set it back to green
+type AlertmanagerReceiver struct {
+	provider      providers.Provider
+	nameLabel     string
+	severityLabel string
+	severities    map[string]types.Status
+	// defaultStatus is used for firing alerts with an unmapped severity
+	defaultStatus types.Status
+}
+
+// ensure we always satisfy
+var _ Receiver = (*AlertmanagerReceiver)(nil)
+
+// AlertmanagerOption is a functional option for an [AlertmanagerReceiver]
+type AlertmanagerOption func(*AlertmanagerReceiver) error
+
+// WithNameLabel sets the alert label used to find the thing an alert applies to
+func WithNameLabel(label string) AlertmanagerOption {
+	return func(ar *AlertmanagerReceiver) error {
+		if label == "" {
+			return fmt.Errorf("name label cannot be empty")
+		}
+		ar.nameLabel = label
+		return nil
+	}
+}
+
+// WithSeverityLabel sets the alert label used to determine the severity of an alert
+func WithSeverityLabel(label string) AlertmanagerOption {
+	return func(ar *AlertmanagerReceiver) error {
+		if label == "" {
+			return fmt.Errorf("severity label cannot be empty")
+		}
+		ar.severityLabel = label
+		return nil
+	}
+}
+
+// WithSeverityStatus maps an alert severity to the status set while the alert is firing
+// unmapped severities set things to red
+func WithSeverityStatus(severity string, status types.Status) AlertmanagerOption {
+	return func(ar *AlertmanagerReceiver) error {
+		if severity == "" {
+			return fmt.Errorf("severity cannot be empty")
+		}
+		if status == types.StatusUnknown {
+			return fmt.Errorf("a valid status must be provided for severity %s", severity)
+		}
+		ar.severities[strings.ToLower(severity)] = status
+		return nil
+	}
+}
+
+// NewAlertmanagerReceiver returns a new [AlertmanagerReceiver]
+// by default critical alerts turn things red and warning alerts turn them yellow
+func NewAlertmanagerReceiver(p providers.Provider, opts ...AlertmanagerOption) (*AlertmanagerReceiver, error) {
+	if p == nil {
+		return nil, fmt.Errorf("provider cannot be nil")
+	}
+	ar := &AlertmanagerReceiver{
+		provider:      p,
+		nameLabel:     DefaultAlertmanagerNameLabel,
+		severityLabel: DefaultAlertmanagerSeverityLabel,
+		severities: map[string]types.Status{
+			"critical": types.StatusRed,
+			"warning":  types.StatusYellow,
+		},
+		defaultStatus: types.StatusRed,
+	}
+	for _, opt := range opts {
+		if err := opt(ar); err != nil {
+			return nil, err
+		}
+	}
+	return ar, nil
+}
+
+// alertmanagerPayload is the subset of the alertmanager webhook payload we care about
+type alertmanagerPayload struct {
+	Version string              `json:"version"`
+	Status  string              `json:"status"`
+	Alerts  []alertmanagerAlert `json:"alerts"`
+}
+
+type alertmanagerAlert struct {
+	Status string            `json:"status"`
+	Labels map[string]string `json:"labels"`
+}
+
+// Name is the path segment the receiver is served at
+func (ar *AlertmanagerReceiver) Name() string {
+	return "alertmanager"
+}
+
+// Receive handles an alertmanager webhook
+// when a payload has several alerts for the same thing the most severe status wins
+func (ar *AlertmanagerReceiver) Receive(ctx context.Context, r *http.Request) (*Result, error) {
+	var payload alertmanagerPayload
+	if err := decodeBody(r.Body, &payload, "not a valid alertmanager payload"); err != nil {
+		return nil, err
+	}
+	res := newResult()
+	statuses := map[string]types.Status{}
+	for i, alert := range payload.Alerts {
+		name := alert.Labels[ar.nameLabel]
+		if name == "" {
+			res.Skipped = append(res.Skipped, fmt.Sprintf("alerts[%d]", i))
+			continue
+		}
+		var status types.Status
+		switch alert.Status {
+		case alertFiring:
+			status = ar.statusFor(alert.Labels[ar.severityLabel])
+		case alertResolved:
+			status = types.StatusGreen
+		default:
+			return nil, types.NewValidationError(fmt.Sprintf("alerts[%d].status", i), "must be firing or resolved")
+		}
+		statuses[name] = worse(statuses[name], status)
+	}
+
+	names := make([]string, 0, len(statuses))
+	for name := range statuses {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := setStatus(ctx, ar.provider, res, name, statuses[name]); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+func (ar *AlertmanagerReceiver) statusFor(severity string) types.Status {
+	if s, ok := ar.severities[strings.ToLower(severity)]; ok {
+		return s
+	}
+	return ar.defaultStatus
+}
@@ -0,0 +1,74 @@
+package receivers
+
+import (
+	"fmt"
+	"strings"
+)
+
+// deploymentTarget is a repository and environment being deployed
+type deploymentTarget struct {
+	repository  string
+	environment string
+}
+
+// deploymentConfig is the configuration shared by the deployment receivers
+type deploymentConfig struct {
+	// targets maps a deployment target to the name of a thing
+	targets map[deploymentTarget]string
+}
+
+// DeploymentOption is a functional option for the deployment receivers
+type DeploymentOption func(*deploymentConfig) error
+
+// WithDeploymentTarget sets the status of the thing named thing when repository is deployed to environment
+// an empty environment matches deployments of the repository to any environment without a more specific target
+func WithDeploymentTarget(repository, environment, thing string) DeploymentOption {
+	return func(dc *deploymentConfig) error {
+		if repository == "" {
+			return fmt.Errorf("repository cannot be empty")
+		}
+		if thing == "" {
+			return fmt.Errorf("thing cannot be empty")
+		}
+		dc.targets[deploymentTarget{repository: strings.ToLower(repository), environment: environment}] = thing
+		return nil
+	}
+}
+
+func newDeploymentConfig(opts ...DeploymentOption) (*deploymentConfig, error) {
+	dc := &deploymentConfig{targets: map[deploymentTarget]string{}}
+	for _, opt := range opts {
+		if err := opt(dc); err != nil {
+			return nil, err
+		}
+	}
+	if len(dc.targets) == 0 {
+		return nil, fmt.Errorf("at least one deployment target must be provided")
+	}
+	return dc, nil
+}
+
+// thingFor returns the name of the thing for a deployment if there is one
+func (dc *deploymentConfig) thingFor(repository, environment string) (string, bool) {
+	repository = strings.ToLower(repository)
+	if name, ok := dc.targets[deploymentTarget{repository: repository, environment: environment}]; ok {
+		return name, true
+	}
+	name, ok := dc.targets[deploymentTarget{repository: repository}]
+	return name, ok
+}
+
+// deploymentDescription is the description of a thing that was deployed
+func deploymentDescription(state, sha, environment, commitURL, deployURL string) string {
+	if len(sha) > 7 {
+		sha = sha[:7]
+	}
+	parts := []string{fmt.Sprintf("deploy %s: %s to %s", state, sha, environment)}
+	if commitURL != "" {
+		parts = append(parts, commitURL)
+	}
+	if deployURL != "" {
+		parts = append(parts, deployURL)
+	}
+	return strings.Join(parts, " ")
+}
@@ -0,0 +1,2 @@
+// Package receivers contains inbound webhook receivers that change the status of statusthings
+package receivers
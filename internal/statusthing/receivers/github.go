@@ -0,0 +1,150 @@
+package receivers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+const (
+	githubEventHeader     = "X-GitHub-Event"
+	githubSignatureHeader = "X-Hub-Signature-256"
+	githubSignaturePrefix = "sha256="
+)
+
+// githubStates maps deployment_status states to statuses
+// states that are not listed i.e. inactive do not change the thing
+var githubStates = map[string]types.Status{
+	"pending":     types.StatusYellow,
+	"queued":      types.StatusYellow,
+	"in_progress": types.StatusYellow,
+	"success":     types.StatusGreen,
+	"failure":     types.StatusRed,
+	"error":       types.StatusRed,
+}
+
+// GitHubReceiver receives GitHub deployment_status webhooks
+type GitHubReceiver struct {
+	provider providers.Provider
+	secret   []byte
+	config   *deploymentConfig
+}
+
+// ensure we always satisfy
+var _ Authenticator = (*GitHubReceiver)(nil)
+
+// NewGitHubReceiver returns a new [GitHubReceiver] verifying webhooks were signed with secret
+func NewGitHubReceiver(p providers.Provider, secret string, opts ...DeploymentOption) (*GitHubReceiver, error) {
+	if p == nil {
+		return nil, fmt.Errorf("provider cannot be nil")
+	}
+	if secret == "" {
+		return nil, fmt.Errorf("secret cannot be empty")
+	}
+	dc, err := newDeploymentConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GitHubReceiver{provider: p, secret: []byte(secret), config: dc}, nil
+}
+
+// githubDeploymentStatusEvent is the subset of the deployment_status payload we care about
+type githubDeploymentStatusEvent struct {
+	DeploymentStatus struct {
+		State          string `json:"state"`
+		TargetURL      string `json:"target_url"`
+		LogURL         string `json:"log_url"`
+		EnvironmentURL string `json:"environment_url"`
+	} `json:"deployment_status"`
+	Deployment struct {
+		SHA         string `json:"sha"`
+		Environment string `json:"environment"`
+	} `json:"deployment"`
+	Repository struct {
+		FullName string `json:"full_name"`
+		HTMLURL  string `json:"html_url"`
+	} `json:"repository"`
+}
+
+// Name is the path segment the receiver is served at
+func (gr *GitHubReceiver) Name() string {
+	return "github"
+}
+
+// Authenticates reports that webhook signatures are verified
+func (gr *GitHubReceiver) Authenticates() bool {
+	return true
+}
+
+// Receive handles a github webhook
+// events other than deployment_status are accepted and ignored so the webhook can subscribe to more than it needs
+func (gr *GitHubReceiver) Receive(ctx context.Context, r *http.Request) (*Result, error) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read body: %w", err)
+	}
+	if !gr.verify(r.Header.Get(githubSignatureHeader), body) {
+		return nil, ErrUnauthorized
+	}
+	res := newResult()
+	if r.Header.Get(githubEventHeader) != "deployment_status" {
+		return res, nil
+	}
+	var event githubDeploymentStatusEvent
+	if err := json.NewDecoder(bytes.NewReader(body)).Decode(&event); err != nil {
+		return nil, types.NewValidationError("body", "not a valid deployment_status payload")
+	}
+	name, ok := gr.config.thingFor(event.Repository.FullName, event.Deployment.Environment)
+	if !ok {
+		res.Skipped = append(res.Skipped, event.Repository.FullName+"@"+event.Deployment.Environment)
+		return res, nil
+	}
+	status, ok := githubStates[event.DeploymentStatus.State]
+	if !ok {
+		res.Skipped = append(res.Skipped, name)
+		return res, nil
+	}
+	commitURL := ""
+	if event.Repository.HTMLURL != "" && event.Deployment.SHA != "" {
+		commitURL = event.Repository.HTMLURL + "/commit/" + event.Deployment.SHA
+	}
+	deployURL := firstNonEmpty(event.DeploymentStatus.TargetURL, event.DeploymentStatus.LogURL, event.DeploymentStatus.EnvironmentURL)
+	description := deploymentDescription(event.DeploymentStatus.State, event.Deployment.SHA, event.Deployment.Environment, commitURL, deployURL)
+	if err := update(ctx, gr.provider, res, name, status, description); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// verify checks the X-Hub-Signature-256 header against the body
+func (gr *GitHubReceiver) verify(signature string, body []byte) bool {
+	if !strings.HasPrefix(signature, githubSignaturePrefix) {
+		return false
+	}
+	sig, err := hex.DecodeString(strings.TrimPrefix(signature, githubSignaturePrefix))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, gr.secret)
+	mac.Write(body) // nolint: errcheck
+	return hmac.Equal(sig, mac.Sum(nil))
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,141 @@
+package receivers
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"net/http"
+
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+const (
+	gitlabEventHeader = "X-Gitlab-Event"
+	gitlabTokenHeader = "X-Gitlab-Token"
+
+	gitlabPipelineEvent   = "Pipeline Hook"
+	gitlabDeploymentEvent = "Deployment Hook"
+)
+
+// gitlabStates maps pipeline and deployment statuses to statuses
+// statuses that are not listed i.e. canceled and skipped do not change the thing
+var gitlabStates = map[string]types.Status{
+	"created": types.StatusYellow,
+	"pending": types.StatusYellow,
+	"running": types.StatusYellow,
+	"success": types.StatusGreen,
+	"failed":  types.StatusRed,
+}
+
+// GitLabReceiver receives GitLab pipeline and deployment webhooks
+// pipelines have no environment so their ref is matched as the environment instead
+type GitLabReceiver struct {
+	provider providers.Provider
+	token    []byte
+	config   *deploymentConfig
+}
+
+// ensure we always satisfy
+var _ Authenticator = (*GitLabReceiver)(nil)
+
+// NewGitLabReceiver returns a new [GitLabReceiver] verifying webhooks send token as their secret token
+func NewGitLabReceiver(p providers.Provider, token string, opts ...DeploymentOption) (*GitLabReceiver, error) {
+	if p == nil {
+		return nil, fmt.Errorf("provider cannot be nil")
+	}
+	if token == "" {
+		return nil, fmt.Errorf("token cannot be empty")
+	}
+	dc, err := newDeploymentConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &GitLabReceiver{provider: p, token: []byte(token), config: dc}, nil
+}
+
+type gitlabProject struct {
+	PathWithNamespace string `json:"path_with_namespace"`
+	WebURL            string `json:"web_url"`
+}
+
+// gitlabPipelinePayload is the subset of the pipeline hook payload we care about
+type gitlabPipelinePayload struct {
+	ObjectAttributes struct {
+		ID     int64  `json:"id"`
+		Ref    string `json:"ref"`
+		SHA    string `json:"sha"`
+		Status string `json:"status"`
+		URL    string `json:"url"`
+	} `json:"object_attributes"`
+	Commit struct {
+		URL string `json:"url"`
+	} `json:"commit"`
+	Project gitlabProject `json:"project"`
+}
+
+// gitlabDeploymentPayload is the subset of the deployment hook payload we care about
+type gitlabDeploymentPayload struct {
+	Status        string        `json:"status"`
+	Environment   string        `json:"environment"`
+	SHA           string        `json:"short_sha"`
+	CommitURL     string        `json:"commit_url"`
+	DeployableURL string        `json:"deployable_url"`
+	Project       gitlabProject `json:"project"`
+}
+
+// Name is the path segment the receiver is served at
+func (gr *GitLabReceiver) Name() string {
+	return "gitlab"
+}
+
+// Authenticates reports that webhook tokens are verified
+func (gr *GitLabReceiver) Authenticates() bool {
+	return true
+}
+
+// Receive handles a gitlab webhook
+// events other than pipeline and deployment hooks are accepted and ignored
+func (gr *GitLabReceiver) Receive(ctx context.Context, r *http.Request) (*Result, error) {
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(gitlabTokenHeader)), gr.token) != 1 {
+		return nil, ErrUnauthorized
+	}
+	res := newResult()
+	var repository, environment, state, sha, commitURL, deployURL string
+	switch r.Header.Get(gitlabEventHeader) {
+	case gitlabPipelineEvent:
+		var payload gitlabPipelinePayload
+		if err := decodeBody(r.Body, &payload, "not a valid pipeline payload"); err != nil {
+			return nil, err
+		}
+		attrs := payload.ObjectAttributes
+		repository, environment, state, sha, commitURL = payload.Project.PathWithNamespace, attrs.Ref, attrs.Status, attrs.SHA, payload.Commit.URL
+		deployURL = attrs.URL
+		if deployURL == "" && payload.Project.WebURL != "" {
+			deployURL = fmt.Sprintf("%s/-/pipelines/%d", payload.Project.WebURL, attrs.ID)
+		}
+	case gitlabDeploymentEvent:
+		var payload gitlabDeploymentPayload
+		if err := decodeBody(r.Body, &payload, "not a valid deployment payload"); err != nil {
+			return nil, err
+		}
+		repository, environment, state, sha, commitURL, deployURL = payload.Project.PathWithNamespace, payload.Environment, payload.Status, payload.SHA, payload.CommitURL, payload.DeployableURL
+	default:
+		return res, nil
+	}
+
+	name, ok := gr.config.thingFor(repository, environment)
+	if !ok {
+		res.Skipped = append(res.Skipped, repository+"@"+environment)
+		return res, nil
+	}
+	status, ok := gitlabStates[state]
+	if !ok {
+		res.Skipped = append(res.Skipped, name)
+		return res, nil
+	}
+	if err := update(ctx, gr.provider, res, name, status, deploymentDescription(state, sha, environment, commitURL, deployURL)); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,118 @@
+package receivers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// ErrUnauthorized is returned when a webhook could not be verified
+var ErrUnauthorized = errors.New("webhook could not be verified")
+
+// Receiver turns inbound webhooks into status changes
+type Receiver interface {
+	// Name is the path segment the receiver is served at
+	Name() string
+	// Receive handles an inbound webhook request
+	// invalid payloads should return a [types.ValidationError]
+	Receive(ctx context.Context, r *http.Request) (*Result, error)
+}
+
+// Authenticator is implemented by receivers that verify requests themselves i.e. with a signature
+// the api key is not required for these receivers
+type Authenticator interface {
+	Receiver
+	// Authenticates reports if the receiver verifies its own requests
+	Authenticates() bool
+}
+
+// Result is the outcome of a webhook
+type Result struct {
+	// Updated are the names of things whose status was changed
+	Updated []string `json:"updated"`
+	// Unchanged are the names of things that already had the requested status
+	Unchanged []string `json:"unchanged"`
+	// Skipped are names that did not match a thing or payload entries that did not map to one
+	Skipped []string `json:"skipped"`
+}
+
+// newResult returns a [Result] with empty rather than nil slices so it always encodes as arrays
+func newResult() *Result {
+	return &Result{Updated: []string{}, Unchanged: []string{}, Skipped: []string{}}
+}
+
+// decodeBody decodes a json webhook body into v
+// read errors such as a body over the handler's size limit are returned as is rather than as a [types.ValidationError]
+func decodeBody(r io.Reader, v any, invalid string) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return fmt.Errorf("unable to read body: %w", err)
+		}
+		return types.NewValidationError("body", invalid)
+	}
+	return nil
+}
+
+// setStatus sets the status of the thing named name and records the outcome in res
+func setStatus(ctx context.Context, p providers.Provider, res *Result, name string, status types.Status) error {
+	return update(ctx, p, res, name, status, "")
+}
+
+// update sets the status and, if not empty, the description of the thing named name and records the outcome in res
+func update(ctx context.Context, p providers.Provider, res *Result, name string, status types.Status, description string) error {
+	all, err := p.All(ctx)
+	if err != nil {
+		return err
+	}
+	for _, thing := range all {
+		if thing.Name != name {
+			continue
+		}
+		opts := []dbfilters.Option{}
+		if description != "" && description != thing.Description {
+			opts = append(opts, dbfilters.WithDescription(description))
+		}
+		if thing.Status == status && len(opts) == 0 {
+			res.Unchanged = append(res.Unchanged, name)
+			return nil
+		}
+		if _, _, err := p.SetStatus(ctx, thing.ID, status, opts...); err != nil {
+			return fmt.Errorf("unable to set status of %s: %w", name, err)
+		}
+		res.Updated = append(res.Updated, name)
+		return nil
+	}
+	res.Skipped = append(res.Skipped, name)
+	return nil
+}
+
+// worse returns the more severe of two statuses
+func worse(a, b types.Status) types.Status {
+	if severity(b) > severity(a) {
+		return b
+	}
+	return a
+}
+
+func severity(s types.Status) int {
+	switch s {
+	case types.StatusRed:
+		return 3
+	case types.StatusYellow:
+		return 2
+	case types.StatusGreen:
+		return 1
+	default:
+		return 0
+	}
+}
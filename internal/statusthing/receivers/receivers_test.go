@@ -0,0 +1,434 @@
+package receivers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/types"
+	"github.com/stretchr/testify/require"
+)
+
+// mapProvider is an in memory provider keyed by id
+type mapProvider struct {
+	providers.UnimplementedProvider
+	things map[string]*types.StatusThing
+	sets   int
+}
+
+func newMapProvider(things ...*types.StatusThing) *mapProvider {
+	mp := &mapProvider{things: map[string]*types.StatusThing{}}
+	for _, t := range things {
+		mp.things[t.ID] = t
+	}
+	return mp
+}
+
+func (mp *mapProvider) All(_ context.Context) ([]*types.StatusThing, error) {
+	res := []*types.StatusThing{}
+	for _, t := range mp.things {
+		res = append(res, t)
+	}
+	return res, nil
+}
+
+func (mp *mapProvider) SetStatus(_ context.Context, id string, status types.Status, opts ...dbfilters.Option) (*types.StatusThing, *types.StatusThing, error) {
+	t, ok := mp.things[id]
+	if !ok {
+		return nil, nil, types.ErrNotFound
+	}
+	f, err := dbfilters.New(opts...)
+	if err != nil {
+		return nil, nil, err
+	}
+	mp.sets++
+	previous := *t
+	t.Status = status
+	if f.Description() != "" {
+		t.Description = f.Description()
+	}
+	updated := *t
+	return &previous, &updated, nil
+}
+
+func (mp *mapProvider) byName(name string) *types.StatusThing {
+	for _, t := range mp.things {
+		if t.Name == name {
+			return t
+		}
+	}
+	return nil
+}
+
+func TestNewAlertmanagerReceiver(t *testing.T) {
+	t.Parallel()
+	testCases := map[string][]AlertmanagerOption{
+		"empty-name-label":     {WithNameLabel("")},
+		"empty-severity-label": {WithSeverityLabel("")},
+		"empty-severity":       {WithSeverityStatus("", types.StatusRed)},
+		"unknown-status":       {WithSeverityStatus("page", types.StatusUnknown)},
+	}
+	for name, opts := range testCases {
+		t.Run(name, func(t *testing.T) {
+			ar, err := NewAlertmanagerReceiver(newMapProvider(), opts...)
+			require.Error(t, err)
+			require.Nil(t, ar)
+		})
+	}
+	_, err := NewAlertmanagerReceiver(nil)
+	require.Error(t, err, "should require a provider")
+}
+
+func TestAlertmanagerReceiver(t *testing.T) {
+	t.Parallel()
+	const payload = `{
+		"version": "4",
+		"status": "firing",
+		"alerts": [
+			{"status": "firing", "labels": {"statusthing_name": "api", "severity": "warning"}},
+			{"status": "firing", "labels": {"statusthing_name": "api", "severity": "critical"}},
+			{"status": "firing", "labels": {"statusthing_name": "web", "severity": "Warning"}},
+			{"status": "firing", "labels": {"statusthing_name": "queue", "severity": "info"}},
+			{"status": "resolved", "labels": {"statusthing_name": "db", "severity": "critical"}},
+			{"status": "resolved", "labels": {"statusthing_name": "cache"}},
+			{"status": "firing", "labels": {"statusthing_name": "nope", "severity": "critical"}},
+			{"status": "firing", "labels": {"alertname": "unrelated"}}
+		]
+	}`
+	mp := newMapProvider(
+		&types.StatusThing{ID: "1", Name: "api", Status: types.StatusGreen},
+		&types.StatusThing{ID: "2", Name: "web", Status: types.StatusGreen},
+		&types.StatusThing{ID: "3", Name: "queue", Status: types.StatusGreen},
+		&types.StatusThing{ID: "4", Name: "db", Status: types.StatusRed},
+		&types.StatusThing{ID: "5", Name: "cache", Status: types.StatusGreen},
+	)
+	ar, err := NewAlertmanagerReceiver(mp, WithSeverityStatus("info", types.StatusYellow))
+	require.NoError(t, err)
+	require.Equal(t, "alertmanager", ar.Name())
+
+	res, err := ar.Receive(context.Background(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(payload)))
+	require.NoError(t, err)
+	require.Equal(t, []string{"api", "db", "queue", "web"}, res.Updated)
+	require.Equal(t, []string{"cache"}, res.Unchanged)
+	require.Equal(t, []string{"alerts[7]", "nope"}, res.Skipped)
+	require.Equal(t, 4, mp.sets, "unchanged things should not be updated")
+
+	require.Equal(t, types.StatusRed, mp.byName("api").Status, "most severe alert should win")
+	require.Equal(t, types.StatusYellow, mp.byName("web").Status, "severities should be case insensitive")
+	require.Equal(t, types.StatusYellow, mp.byName("queue").Status, "custom severities should be used")
+	require.Equal(t, types.StatusGreen, mp.byName("db").Status, "resolved should be green")
+}
+
+func TestAlertmanagerReceiverLabels(t *testing.T) {
+	t.Parallel()
+	mp := newMapProvider(&types.StatusThing{ID: "1", Name: "api", Status: types.StatusGreen})
+	ar, err := NewAlertmanagerReceiver(mp, WithNameLabel("service"), WithSeverityLabel("level"))
+	require.NoError(t, err)
+	res, err := ar.Receive(context.Background(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"alerts":[{"status":"firing","labels":{"service":"api","level":"warning"}}]}`)))
+	require.NoError(t, err)
+	require.Equal(t, []string{"api"}, res.Updated)
+	require.Equal(t, types.StatusYellow, mp.byName("api").Status)
+}
+
+func TestAlertmanagerReceiverInvalid(t *testing.T) {
+	t.Parallel()
+	ar, err := NewAlertmanagerReceiver(newMapProvider())
+	require.NoError(t, err)
+	for name, body := range map[string]string{
+		"not-json":   `[`,
+		"bad-status": `{"alerts":[{"status":"pending","labels":{"statusthing_name":"api"}}]}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			res, err := ar.Receive(context.Background(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+			require.ErrorIs(t, err, types.ErrRequiredValueMissing)
+			require.Nil(t, res)
+		})
+	}
+}
+
+func TestReceiversBodyTooLarge(t *testing.T) {
+	t.Parallel()
+	am, err := NewAlertmanagerReceiver(newMapProvider())
+	require.NoError(t, err)
+	tr, err := NewTemplateReceiver(newMapProvider(), TemplateHook{ID: "ci", Name: "{{ .name }}", Status: "{{ .status }}"})
+	require.NoError(t, err)
+	gl, err := NewGitLabReceiver(newMapProvider(), "tok", WithDeploymentTarget("lusis/apithings", "main", "api"))
+	require.NoError(t, err)
+	body := `{"alerts":[],"name":"api","status":"red","object_attributes":{"ref":"main"}}`
+	for _, rcv := range []Receiver{am, tr, gl} {
+		rcv := rcv
+		t.Run(rcv.Name(), func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+			r.Header.Set(gitlabEventHeader, gitlabPipelineEvent)
+			r.Header.Set(gitlabTokenHeader, "tok")
+			r.Body = http.MaxBytesReader(httptest.NewRecorder(), r.Body, 16)
+			res, err := rcv.Receive(context.Background(), r)
+			var tooLarge *http.MaxBytesError
+			require.ErrorAs(t, err, &tooLarge)
+			require.NotErrorIs(t, err, types.ErrRequiredValueMissing)
+			require.Nil(t, res)
+		})
+	}
+}
+
+func signGitHub(secret, body string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(body))
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestNewDeploymentReceivers(t *testing.T) {
+	t.Parallel()
+	target := WithDeploymentTarget("lusis/apithings", "", "api")
+	testCases := map[string]struct {
+		p      providers.Provider
+		secret string
+		opts   []DeploymentOption
+	}{
+		"nil-provider": {secret: "s", opts: []DeploymentOption{target}},
+		"empty-secret": {p: newMapProvider(), opts: []DeploymentOption{target}},
+		"no-targets":   {p: newMapProvider(), secret: "s"},
+		"empty-repo":   {p: newMapProvider(), secret: "s", opts: []DeploymentOption{WithDeploymentTarget("", "production", "api")}},
+		"empty-thing":  {p: newMapProvider(), secret: "s", opts: []DeploymentOption{WithDeploymentTarget("lusis/apithings", "production", "")}},
+	}
+	for name, tc := range testCases {
+		t.Run(name, func(t *testing.T) {
+			gh, err := NewGitHubReceiver(tc.p, tc.secret, tc.opts...)
+			require.Error(t, err)
+			require.Nil(t, gh)
+			gl, err := NewGitLabReceiver(tc.p, tc.secret, tc.opts...)
+			require.Error(t, err)
+			require.Nil(t, gl)
+		})
+	}
+}
+
+func TestGitHubReceiver(t *testing.T) {
+	t.Parallel()
+	const secret = "sekret"
+	payload := func(state, env string) string {
+		return `{
+			"deployment_status": {"state": "` + state + `", "target_url": "https://example.com/deploys/1"},
+			"deployment": {"sha": "0123456789abcdef", "environment": "` + env + `"},
+			"repository": {"full_name": "Lusis/apithings", "html_url": "https://github.com/lusis/apithings"}
+		}`
+	}
+	mp := newMapProvider(
+		&types.StatusThing{ID: "1", Name: "api", Description: "the api", Status: types.StatusGreen},
+		&types.StatusThing{ID: "2", Name: "api-staging", Description: "the staging api", Status: types.StatusGreen},
+	)
+	gr, err := NewGitHubReceiver(mp, secret,
+		WithDeploymentTarget("lusis/apithings", "", "api"),
+		WithDeploymentTarget("lusis/apithings", "staging", "api-staging"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "github", gr.Name())
+	require.True(t, gr.Authenticates())
+
+	send := func(event, body, signature string) (*Result, error) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set(githubEventHeader, event)
+		r.Header.Set(githubSignatureHeader, signature)
+		return gr.Receive(context.Background(), r)
+	}
+
+	t.Run("bad-signature", func(t *testing.T) {
+		body := payload("success", "production")
+		for _, sig := range []string{"", "sha256=zz", signGitHub("wrong", body), strings.TrimPrefix(signGitHub(secret, body), "sha256=")} {
+			_, err := send("deployment_status", body, sig)
+			require.ErrorIs(t, err, ErrUnauthorized, sig)
+		}
+	})
+
+	t.Run("ignored-event", func(t *testing.T) {
+		res, err := send("ping", `{"zen":"hi"}`, signGitHub(secret, `{"zen":"hi"}`))
+		require.NoError(t, err)
+		require.Empty(t, res.Updated)
+	})
+
+	for _, tc := range []struct {
+		state  string
+		env    string
+		thing  string
+		status types.Status
+	}{
+		{"in_progress", "production", "api", types.StatusYellow},
+		{"success", "production", "api", types.StatusGreen},
+		{"failure", "staging", "api-staging", types.StatusRed},
+	} {
+		body := payload(tc.state, tc.env)
+		res, err := send("deployment_status", body, signGitHub(secret, body))
+		require.NoError(t, err, tc.state)
+		require.Equal(t, []string{tc.thing}, res.Updated, tc.state)
+		thing := mp.byName(tc.thing)
+		require.Equal(t, tc.status, thing.Status, tc.state)
+		require.Equal(t, "deploy "+tc.state+": 0123456 to "+tc.env+" https://github.com/lusis/apithings/commit/0123456789abcdef https://example.com/deploys/1", thing.Description)
+	}
+
+	body := payload("inactive", "production")
+	res, err := send("deployment_status", body, signGitHub(secret, body))
+	require.NoError(t, err)
+	require.Equal(t, []string{"api"}, res.Skipped, "inactive should not change the thing")
+	require.Equal(t, types.StatusGreen, mp.byName("api").Status)
+
+	body = strings.ReplaceAll(payload("success", "production"), "Lusis/apithings", "lusis/other")
+	res, err = send("deployment_status", body, signGitHub(secret, body))
+	require.NoError(t, err)
+	require.Equal(t, []string{"lusis/other@production"}, res.Skipped, "unmapped repositories should be skipped")
+
+	_, err = send("deployment_status", `[`, signGitHub(secret, `[`))
+	require.ErrorIs(t, err, types.ErrRequiredValueMissing)
+}
+
+func TestGitLabReceiver(t *testing.T) {
+	t.Parallel()
+	mp := newMapProvider(
+		&types.StatusThing{ID: "1", Name: "api", Description: "the api", Status: types.StatusGreen},
+		&types.StatusThing{ID: "2", Name: "web", Description: "the web", Status: types.StatusGreen},
+	)
+	gr, err := NewGitLabReceiver(mp, "sekret",
+		WithDeploymentTarget("group/api", "production", "api"),
+		WithDeploymentTarget("group/web", "main", "web"),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "gitlab", gr.Name())
+	require.True(t, gr.Authenticates())
+
+	send := func(event, body, token string) (*Result, error) {
+		r := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+		r.Header.Set(gitlabEventHeader, event)
+		r.Header.Set(gitlabTokenHeader, token)
+		return gr.Receive(context.Background(), r)
+	}
+
+	_, err = send(gitlabDeploymentEvent, `{}`, "wrong")
+	require.ErrorIs(t, err, ErrUnauthorized)
+
+	res, err := send("Push Hook", `{}`, "sekret")
+	require.NoError(t, err)
+	require.Empty(t, res.Updated, "other events should be ignored")
+
+	deployment := `{"object_kind":"deployment","status":"running","environment":"production","short_sha":"0123456","commit_url":"https://gitlab.com/group/api/-/commit/0123456789","deployable_url":"https://gitlab.com/group/api/-/jobs/1","project":{"path_with_namespace":"group/api"}}`
+	res, err = send(gitlabDeploymentEvent, deployment, "sekret")
+	require.NoError(t, err)
+	require.Equal(t, []string{"api"}, res.Updated)
+	require.Equal(t, types.StatusYellow, mp.byName("api").Status)
+	require.Equal(t, "deploy running: 0123456 to production https://gitlab.com/group/api/-/commit/0123456789 https://gitlab.com/group/api/-/jobs/1", mp.byName("api").Description)
+
+	res, err = send(gitlabDeploymentEvent, strings.Replace(deployment, "running", "canceled", 1), "sekret")
+	require.NoError(t, err)
+	require.Equal(t, []string{"api"}, res.Skipped, "canceled should not change the thing")
+
+	pipeline := `{"object_kind":"pipeline","object_attributes":{"id":42,"ref":"main","sha":"abcdef0123456","status":"failed"},"commit":{"url":"https://gitlab.com/group/web/-/commit/abcdef0123456"},"project":{"path_with_namespace":"group/web","web_url":"https://gitlab.com/group/web"}}`
+	res, err = send(gitlabPipelineEvent, pipeline, "sekret")
+	require.NoError(t, err)
+	require.Equal(t, []string{"web"}, res.Updated)
+	require.Equal(t, types.StatusRed, mp.byName("web").Status)
+	require.Equal(t, "deploy failed: abcdef0 to main https://gitlab.com/group/web/-/commit/abcdef0123456 https://gitlab.com/group/web/-/pipelines/42", mp.byName("web").Description)
+
+	_, err = send(gitlabPipelineEvent, `[`, "sekret")
+	require.ErrorIs(t, err, types.ErrRequiredValueMissing)
+}
+
+func TestParseTemplateHooks(t *testing.T) {
+	t.Parallel()
+	hooks, err := ParseTemplateHooks(strings.NewReader(`
+hooks:
+  - id: grafana
+    name: '{{ .commonLabels.statusthing_name }}'
+    status: '{{ if eq .status "firing" }}red{{ else }}green{{ end }}'
+    description: '{{ .title }}'
+`))
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	require.Equal(t, "grafana", hooks[0].ID)
+
+	_, err = ParseTemplateHooks(strings.NewReader("hooks:\n  - id: a\n  - id: a\n"))
+	require.Error(t, err, "ids should be unique")
+	_, err = ParseTemplateHooks(strings.NewReader("hooks:\n  - id: a\n    unknown: true\n"))
+	require.Error(t, err, "unknown fields should be rejected")
+}
+
+func TestNewTemplateReceiver(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]TemplateHook{
+		"bad-id":         {ID: "Bad/ID", Name: "x", Status: "red"},
+		"empty-id":       {Name: "x", Status: "red"},
+		"no-name":        {ID: "a", Status: "red"},
+		"no-status":      {ID: "a", Name: "x"},
+		"bad-name":       {ID: "a", Name: "{{ .x", Status: "red"},
+		"bad-status":     {ID: "a", Name: "x", Status: "{{ .x"},
+		"bad-descripton": {ID: "a", Name: "x", Status: "red", Description: "{{ .x"},
+	}
+	for name, hook := range testCases {
+		t.Run(name, func(t *testing.T) {
+			tr, err := NewTemplateReceiver(newMapProvider(), hook)
+			require.Error(t, err)
+			require.Nil(t, tr)
+		})
+	}
+}
+
+func TestTemplateReceiver(t *testing.T) {
+	t.Parallel()
+	mp := newMapProvider(
+		&types.StatusThing{ID: "1", Name: "api", Description: "the api", Status: types.StatusGreen},
+		&types.StatusThing{ID: "2", Name: "web", Description: "the web", Status: types.StatusGreen},
+	)
+	tr, err := NewTemplateReceiver(mp, TemplateHook{
+		ID:          "grafana",
+		Name:        `{{ .commonLabels.statusthing_name }}`,
+		Status:      `{{ if eq .status "firing" }}{{ default "red" .commonLabels.level }}{{ else if eq .status "resolved" }}green{{ end }}`,
+		Description: `{{ .title }}`,
+	})
+	require.NoError(t, err)
+	require.Equal(t, "grafana", tr.Name())
+
+	send := func(body string) (*Result, error) {
+		return tr.Receive(context.Background(), httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body)))
+	}
+
+	res, err := send(`{"status":"firing","title":"api is down","commonLabels":{"statusthing_name":"api"}}`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"api"}, res.Updated)
+	require.Equal(t, types.StatusRed, mp.byName("api").Status)
+	require.Equal(t, "api is down", mp.byName("api").Description)
+
+	res, err = send(`{"status":"firing","title":"web is slow","commonLabels":{"statusthing_name":"web","level":"Yellow"}}`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"web"}, res.Updated)
+	require.Equal(t, types.StatusYellow, mp.byName("web").Status, "rendered statuses should be case insensitive")
+
+	res, err = send(`{"status":"pending","title":"api is still down","commonLabels":{"statusthing_name":"api"}}`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"api"}, res.Updated, "an empty status should only change the description")
+	require.Equal(t, types.StatusRed, mp.byName("api").Status)
+	require.Equal(t, "api is still down", mp.byName("api").Description)
+
+	res, err = send(`{"status":"resolved","commonLabels":{"statusthing_name":"api"}}`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"api"}, res.Updated)
+	require.Equal(t, types.StatusGreen, mp.byName("api").Status)
+	require.Equal(t, "api is still down", mp.byName("api").Description, "an empty description should be left alone")
+
+	res, err = send(`{"status":"firing","commonLabels":{}}`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"body"}, res.Skipped, "missing names should be skipped")
+
+	res, err = send(`{"status":"firing","commonLabels":{"statusthing_name":"nope"}}`)
+	require.NoError(t, err)
+	require.Equal(t, []string{"nope"}, res.Skipped)
+
+	_, err = send(`{"status":"firing","commonLabels":{"statusthing_name":"api","level":"purple"}}`)
+	require.ErrorIs(t, err, types.ErrRequiredValueMissing, "invalid statuses should be rejected")
+
+	_, err = send(`nope`)
+	require.ErrorIs(t, err, types.ErrRequiredValueMissing)
+}
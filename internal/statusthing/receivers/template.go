@@ -0,0 +1,220 @@
+package receivers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/types"
+
+	"gopkg.in/yaml.v3"
+)
+
+// noValue is what text/template renders for missing map keys
+const noValue = "<no value>"
+
+// validHookID matches ids that are safe to use as a path segment
+var validHookID = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]*$`)
+
+// templateFuncs are the extra functions available to hook templates
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+	"default": func(def string, v any) string {
+		if v == nil || fmt.Sprint(v) == "" {
+			return def
+		}
+		return fmt.Sprint(v)
+	},
+}
+
+// TemplateHooks is a list of [TemplateHook] definitions
+type TemplateHooks struct {
+	Hooks []TemplateHook `json:"hooks" yaml:"hooks"`
+}
+
+// TemplateHook defines how to turn an arbitrary json body into a status change
+// each field is a go template executed against the decoded body
+type TemplateHook struct {
+	// ID is the path segment the hook is served at
+	ID string `json:"id" yaml:"id"`
+	// Name renders the name of the thing to change
+	Name string `json:"name" yaml:"name"`
+	// Status renders red, yellow or green. An empty result leaves the status alone
+	Status string `json:"status" yaml:"status"`
+	// Description optionally renders a new description for the thing
+	Description string `json:"description,omitempty" yaml:"description,omitempty"`
+}
+
+// LoadTemplateHooks reads [TemplateHook] definitions from a yaml or json file
+func LoadTemplateHooks(path string) ([]TemplateHook, error) {
+	f, err := os.Open(path) // nolint: gosec
+	if err != nil {
+		return nil, fmt.Errorf("unable to open hooks: %w", err)
+	}
+	defer f.Close()
+	hooks, err := ParseTemplateHooks(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return hooks, nil
+}
+
+// ParseTemplateHooks reads [TemplateHook] definitions from yaml or json
+func ParseTemplateHooks(r io.Reader) ([]TemplateHook, error) {
+	th := &TemplateHooks{}
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(th); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("unable to parse hooks: %w", err)
+	}
+	seen := map[string]bool{}
+	for i, h := range th.Hooks {
+		if seen[h.ID] {
+			return nil, fmt.Errorf("hooks[%d]: duplicate id %s", i, h.ID)
+		}
+		seen[h.ID] = true
+	}
+	return th.Hooks, nil
+}
+
+// TemplateReceiver changes things based on a [TemplateHook]
+type TemplateReceiver struct {
+	provider    providers.Provider
+	id          string
+	name        *template.Template
+	status      *template.Template
+	description *template.Template
+}
+
+// ensure we always satisfy
+var _ Receiver = (*TemplateReceiver)(nil)
+
+// NewTemplateReceiver returns a new [TemplateReceiver] for hook
+func NewTemplateReceiver(p providers.Provider, hook TemplateHook) (*TemplateReceiver, error) {
+	if p == nil {
+		return nil, fmt.Errorf("provider cannot be nil")
+	}
+	if !validHookID.MatchString(hook.ID) {
+		return nil, fmt.Errorf("hook id %q must be lowercase letters, numbers, - or _", hook.ID)
+	}
+	if hook.Name == "" {
+		return nil, fmt.Errorf("hook %s: name template cannot be empty", hook.ID)
+	}
+	if hook.Status == "" {
+		return nil, fmt.Errorf("hook %s: status template cannot be empty", hook.ID)
+	}
+	tr := &TemplateReceiver{provider: p, id: hook.ID}
+	var err error
+	if tr.name, err = parseHookTemplate(hook.ID, "name", hook.Name); err != nil {
+		return nil, err
+	}
+	if tr.status, err = parseHookTemplate(hook.ID, "status", hook.Status); err != nil {
+		return nil, err
+	}
+	if hook.Description != "" {
+		if tr.description, err = parseHookTemplate(hook.ID, "description", hook.Description); err != nil {
+			return nil, err
+		}
+	}
+	return tr, nil
+}
+
+func parseHookTemplate(id, field, text string) (*template.Template, error) {
+	t, err := template.New(field).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("hook %s: invalid %s template: %w", id, field, err)
+	}
+	return t, nil
+}
+
+// Name is the path segment the receiver is served at
+func (tr *TemplateReceiver) Name() string {
+	return tr.id
+}
+
+// Receive handles a webhook by rendering the hook templates against the body
+func (tr *TemplateReceiver) Receive(ctx context.Context, r *http.Request) (*Result, error) {
+	var body any
+	if err := decodeBody(r.Body, &body, "not valid json"); err != nil {
+		return nil, err
+	}
+	name, err := render(tr.name, body)
+	if err != nil {
+		return nil, err
+	}
+	rawStatus, err := render(tr.status, body)
+	if err != nil {
+		return nil, err
+	}
+	description := ""
+	if tr.description != nil {
+		if description, err = render(tr.description, body); err != nil {
+			return nil, err
+		}
+	}
+
+	res := newResult()
+	if name == "" {
+		res.Skipped = append(res.Skipped, "body")
+		return res, nil
+	}
+	status := types.StatusUnknown
+	if rawStatus != "" {
+		full := strings.ToUpper(rawStatus)
+		if !strings.HasPrefix(full, "STATUS_") {
+			full = "STATUS_" + full
+		}
+		status = types.StatusFromString(full)
+		if status == types.StatusUnknown {
+			return nil, types.NewValidationError("status", fmt.Sprintf("rendered status %q is not red, yellow or green", rawStatus))
+		}
+	}
+	if status == types.StatusUnknown {
+		// keep the current status but still allow the description to change
+		current, err := currentStatus(ctx, tr.provider, name)
+		if err != nil {
+			return nil, err
+		}
+		if current == types.StatusUnknown {
+			res.Skipped = append(res.Skipped, name)
+			return res, nil
+		}
+		status = current
+	}
+	if err := update(ctx, tr.provider, res, name, status, description); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// render executes t against data and returns the trimmed result
+func render(t *template.Template, data any) (string, error) {
+	buf := &bytes.Buffer{}
+	if err := t.Execute(buf, data); err != nil {
+		return "", types.NewValidationError(t.Name(), fmt.Sprintf("unable to render template: %s", err))
+	}
+	return strings.TrimSpace(strings.ReplaceAll(buf.String(), noValue, "")), nil
+}
+
+// currentStatus returns the status of the thing named name or [types.StatusUnknown] if there isn't one
+func currentStatus(ctx context.Context, p providers.Provider, name string) (types.Status, error) {
+	all, err := p.All(ctx)
+	if err != nil {
+		return types.StatusUnknown, err
+	}
+	for _, t := range all {
+		if t.Name == name {
+			return t.Status, nil
+		}
+	}
+	return types.StatusUnknown, nil
+}
@@ -0,0 +1,36 @@
+// Package statusthingtest provides helpers for tests that need a running statusthing
+package statusthingtest
+
+import (
+	"database/sql"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lusis/apithings/internal/statusthing/handlers"
+	"github.com/lusis/apithings/internal/statusthing/providers"
+	"github.com/lusis/apithings/internal/statusthing/storers/sqlite3"
+	_ "modernc.org/sqlite" // sql driver
+)
+
+// NewServer starts a server backed by a new sqlite database that requires apiKey
+// the server and database are closed when the test finishes
+func NewServer(t *testing.T, apiKey string) *httptest.Server {
+	t.Helper()
+	db, err := sql.Open("sqlite", filepath.Join(t.TempDir(), "statusthing.db"))
+	require.NoError(t, err)
+	store, err := sqlite3.New(db, true)
+	require.NoError(t, err)
+	provider, err := providers.NewStatusThingProvider(store)
+	require.NoError(t, err)
+	h, err := handlers.NewStatusThingHandler(provider, handlers.WithAPIKey(apiKey))
+	require.NoError(t, err)
+	srv := httptest.NewServer(h)
+	t.Cleanup(func() {
+		srv.Close()
+		_ = db.Close()
+	})
+	return srv
+}
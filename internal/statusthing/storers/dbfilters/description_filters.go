@@ -0,0 +1,23 @@
+package dbfilters
+
+import (
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// WithDescription is a filter option to set the description of a thing
+func WithDescription(description string) Option {
+	return func(f *Filters) error {
+		if description == "" {
+			return types.NewValidationError("description", "description cannot be empty")
+		}
+		f.thingDescription = description
+		return nil
+	}
+}
+
+// Description gets the value of the [WithDescription] option
+func (f *Filters) Description() string {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.thingDescription
+}
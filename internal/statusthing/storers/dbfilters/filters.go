@@ -2,6 +2,7 @@ package dbfilters
 
 import (
 	"sync"
+	"time"
 
 	"github.com/lusis/apithings/internal/statusthing/types"
 )
@@ -12,6 +13,24 @@ type Filters struct {
 	lock sync.RWMutex
 	// thingStatus is the placeholder for a single service status
 	thingStatus types.Status
+	// thingVersion is the expected current version of a thing
+	thingVersion int64
+	// thingDescription is the placeholder for a thing's description
+	thingDescription string
+	// thingGroup is the placeholder for a thing's group
+	// thingGroupSet is needed since an empty group is a valid value
+	thingGroup    string
+	thingGroupSet bool
+	// thingID and thingName limit history to a single thing
+	thingID   string
+	thingName string
+	// since and until limit history to changes within a time range
+	since time.Time
+	until time.Time
+	// published limits history to published changes
+	published bool
+	// limit is the maximum number of records returned
+	limit int
 }
 
 // Option is a functional option for [Filters]
@@ -0,0 +1,19 @@
+package dbfilters
+
+// WithGroup is a filter option to set the group of a thing
+// an empty group removes the thing from any group
+func WithGroup(group string) Option {
+	return func(f *Filters) error {
+		f.thingGroup = group
+		f.thingGroupSet = true
+		return nil
+	}
+}
+
+// Group gets the value of the [WithGroup] option
+// ok is false if the option was not provided
+func (f *Filters) Group() (group string, ok bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.thingGroup, f.thingGroupSet
+}
@@ -0,0 +1,106 @@
+package dbfilters
+
+import (
+	"fmt"
+	"time"
+)
+
+// WithThingID is a filter option to only return history for the thing with the id
+func WithThingID(id string) Option {
+	return func(f *Filters) error {
+		if id == "" {
+			return fmt.Errorf("id cannot be empty")
+		}
+		f.thingID = id
+		return nil
+	}
+}
+
+// ThingID gets the value of the [WithThingID] option
+func (f *Filters) ThingID() string {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.thingID
+}
+
+// WithName is a filter option to only return history for the thing with the name
+func WithName(name string) Option {
+	return func(f *Filters) error {
+		if name == "" {
+			return fmt.Errorf("name cannot be empty")
+		}
+		f.thingName = name
+		return nil
+	}
+}
+
+// Name gets the value of the [WithName] option
+func (f *Filters) Name() string {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.thingName
+}
+
+// WithSince is a filter option to only return history at or after t
+func WithSince(t time.Time) Option {
+	return func(f *Filters) error {
+		f.since = t
+		return nil
+	}
+}
+
+// Since gets the value of the [WithSince] option
+func (f *Filters) Since() time.Time {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.since
+}
+
+// WithUntil is a filter option to only return history before t
+func WithUntil(t time.Time) Option {
+	return func(f *Filters) error {
+		f.until = t
+		return nil
+	}
+}
+
+// Until gets the value of the [WithUntil] option
+func (f *Filters) Until() time.Time {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.until
+}
+
+// WithPublished is a filter option to return the changes that were published rather than every recorded change
+func WithPublished() Option {
+	return func(f *Filters) error {
+		f.published = true
+		return nil
+	}
+}
+
+// Published gets the value of the [WithPublished] option
+func (f *Filters) Published() bool {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.published
+}
+
+// WithLimit is a filter option to return at most n records
+func WithLimit(n int) Option {
+	return func(f *Filters) error {
+		if n <= 0 {
+			return fmt.Errorf("limit must be positive")
+		}
+		f.limit = n
+		return nil
+	}
+}
+
+// Limit gets the value of the [WithLimit] option
+// 0 means there is no limit
+func (f *Filters) Limit() int {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.limit
+}
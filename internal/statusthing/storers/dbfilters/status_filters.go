@@ -1,8 +1,6 @@
 package dbfilters
 
 import (
-	"fmt"
-
 	"github.com/lusis/apithings/internal/statusthing/types"
 )
 
@@ -10,7 +8,7 @@ import (
 func WithStatus(status types.Status) Option {
 	return func(f *Filters) error {
 		if status == types.StatusUnknown {
-			return fmt.Errorf("a valid status must be provided")
+			return types.NewValidationError("status", "a valid status must be provided")
 		}
 		f.thingStatus = status
 		return nil
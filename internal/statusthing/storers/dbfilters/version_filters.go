@@ -0,0 +1,24 @@
+package dbfilters
+
+import (
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// WithVersion is a filter option to only apply a change if the thing is currently at the provided version
+func WithVersion(version int64) Option {
+	return func(f *Filters) error {
+		if version <= 0 {
+			return types.NewValidationError("version", "a valid version must be provided")
+		}
+		f.thingVersion = version
+		return nil
+	}
+}
+
+// Version gets the value of the [WithVersion] option
+// a value of 0 means no version was requested
+func (f *Filters) Version() int64 {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return f.thingVersion
+}
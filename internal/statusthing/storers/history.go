@@ -0,0 +1,18 @@
+package storers
+
+import (
+	"context"
+
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// HistoryStorer stores the history of status changes
+type HistoryStorer interface {
+	// InsertTransition records a status change
+	InsertTransition(ctx context.Context, t types.Transition) error
+	// GetTransitions gets recorded status changes newest first
+	// only unpublished changes are returned unless [dbfilters.WithPublished] is provided
+	// supported options are [dbfilters.WithThingID], [dbfilters.WithName], [dbfilters.WithGroup], [dbfilters.WithSince], [dbfilters.WithUntil], [dbfilters.WithPublished] and [dbfilters.WithLimit]
+	GetTransitions(ctx context.Context, opts ...dbfilters.Option) ([]types.Transition, error)
+}
@@ -0,0 +1,118 @@
+package sqlite3
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing/storers"
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/tracing"
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+const (
+	historyTableName = "transitions"
+	historyColumns   = "thing_id,name,description,group_name,status,previous,version,at,published"
+)
+
+// historyColumnMigrations are columns added to the history table
+var historyColumnMigrations = []columnMigration{
+	{name: "published", definition: "`published` INTEGER NOT NULL DEFAULT 0"},
+}
+
+var (
+	createHistoryTableStatement = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (`id` INTEGER PRIMARY KEY AUTOINCREMENT, `thing_id` VARCHAR(191) NOT NULL, `name` VARCHAR(191) NOT NULL, `description` VARCHAR(191) NOT NULL DEFAULT '', `group_name` VARCHAR(191) NOT NULL DEFAULT '', `status` INT UNSIGNED NOT NULL, `previous` INT UNSIGNED NOT NULL, `version` INTEGER NOT NULL DEFAULT 0, `at` INTEGER NOT NULL, `published` INTEGER NOT NULL DEFAULT 0)", historyTableName)
+	createHistoryIndexStatement = fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_thing_at ON %s (`thing_id`, `at`)", historyTableName, historyTableName)
+	insertHistoryStatement      = fmt.Sprintf("INSERT INTO %s (%s) VALUES (?,?,?,?,?,?,?,?,?)", historyTableName, historyColumns)
+	selectHistoryStatement      = fmt.Sprintf("SELECT id,%s FROM %s", historyColumns, historyTableName)
+)
+
+// ensure we always satisfy
+var _ storers.HistoryStorer = (*Store)(nil)
+
+func scanTransition(row scanner) (types.Transition, error) {
+	thing := &types.StatusThing{}
+	var status, previous int
+	var id, at int64
+	var published bool
+	if err := row.Scan(&id, &thing.ID, &thing.Name, &thing.Description, &thing.Group, &status, &previous, &thing.Version, &at, &published); err != nil {
+		return types.Transition{}, err
+	}
+	thing.Status = types.Status(status)
+	return types.Transition{ID: id, Thing: thing, Previous: types.Status(previous), At: time.Unix(at, 0).UTC(), Published: published}, nil
+}
+
+// InsertTransition records a status change
+func (ss *Store) InsertTransition(ctx context.Context, t types.Transition) (err error) {
+	ctx, span := ss.startSpan(ctx, "InsertTransition", insertHistoryStatement)
+	defer func() { tracing.End(span, err) }()
+	if t.Thing == nil {
+		return types.NewValidationError("thing", "thing cannot be nil")
+	}
+	at := t.At
+	if at.IsZero() {
+		at = time.Now()
+	}
+	if _, err := ss.db.ExecContext(ctx, insertHistoryStatement, t.Thing.ID, t.Thing.Name, t.Thing.Description, t.Thing.Group, int(t.Thing.Status), int(t.Previous), t.Thing.Version, at.Unix(), t.Published); err != nil {
+		return fmt.Errorf("unable to insert transition: %w", err)
+	}
+	return nil
+}
+
+// GetTransitions gets recorded status changes newest first
+func (ss *Store) GetTransitions(ctx context.Context, opts ...dbfilters.Option) (_ []types.Transition, err error) {
+	ctx, span := ss.startSpan(ctx, "GetTransitions", "")
+	defer func() { tracing.End(span, err) }()
+	dbopts, err := dbfilters.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	wheres := []string{"published = ?"}
+	args := []any{dbopts.Published()}
+	if id := dbopts.ThingID(); id != "" {
+		wheres = append(wheres, "thing_id = ?")
+		args = append(args, id)
+	}
+	if name := dbopts.Name(); name != "" {
+		wheres = append(wheres, "name = ?")
+		args = append(args, name)
+	}
+	if group, ok := dbopts.Group(); ok {
+		wheres = append(wheres, "group_name = ?")
+		args = append(args, group)
+	}
+	if since := dbopts.Since(); !since.IsZero() {
+		wheres = append(wheres, "at >= ?")
+		args = append(args, since.Unix())
+	}
+	if until := dbopts.Until(); !until.IsZero() {
+		wheres = append(wheres, "at < ?")
+		args = append(args, until.Unix())
+	}
+	stmt := selectHistoryStatement + " WHERE " + strings.Join(wheres, " AND ")
+	// changes within the same second are ordered by when they were recorded
+	stmt += " ORDER BY at DESC, id DESC"
+	if dbopts.Limit() > 0 {
+		stmt += " LIMIT ?"
+		args = append(args, dbopts.Limit())
+	}
+
+	span.SetAttributes(statementAttribute(stmt))
+
+	res := []types.Transition{}
+	rows, err := ss.db.QueryContext(ctx, stmt, args...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t, err := scanTransition(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read data: %w", err)
+		}
+		res = append(res, t)
+	}
+	return res, rows.Err()
+}
@@ -7,29 +7,67 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 
+	"github.com/lusis/apithings/internal/statusthing/storers"
 	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/tracing"
 	"github.com/lusis/apithings/internal/statusthing/types"
 
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+
 	"modernc.org/sqlite"
 	_ "modernc.org/sqlite" // sql driver
 )
 
 const (
 	thingTableName = "statusthings"
+	// tracingScope is the instrumentation scope for store spans
+	tracingScope = "github.com/lusis/apithings/internal/statusthing/storers/sqlite3"
 )
 
 var (
-	selectStatement      = fmt.Sprintf("SELECT id,name,description,status from %s where id = ?", thingTableName)
-	selectAllStatement   = fmt.Sprintf("SELECT id,name,description,status from %s", thingTableName)
-	insertStatement      = fmt.Sprintf("INSERT INTO %s (id, name, description, status) VALUES (?,?,?,?)", thingTableName)
+	selectStatement      = fmt.Sprintf("SELECT id,name,description,group_name,status,version from %s where id = ?", thingTableName)
+	selectAllStatement   = fmt.Sprintf("SELECT id,name,description,group_name,status,version from %s", thingTableName)
+	insertStatement      = fmt.Sprintf("INSERT INTO %s (id, name, description, group_name, status, version) VALUES (?,?,?,?,?,1)", thingTableName)
+	pingStatement        = fmt.Sprintf("SELECT 1 FROM %s LIMIT 1", thingTableName)
 	deleteStatement      = fmt.Sprintf("DELETE FROM %s where id = ?", thingTableName)
-	createTableStatement = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (`id` VARCHAR(191) PRIMARY KEY, `name` VARCHAR(191) NOT NULL UNIQUE, `description` VARCHAR(191) DEFAULT NULL, `status` INT UNSIGNED NOT NULL)", thingTableName)
+	createTableStatement = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (`id` VARCHAR(191) PRIMARY KEY, `name` VARCHAR(191) NOT NULL UNIQUE, `description` VARCHAR(191) DEFAULT NULL, `status` INT UNSIGNED NOT NULL, `version` INTEGER NOT NULL DEFAULT 1, `group_name` VARCHAR(191) NOT NULL DEFAULT '')", thingTableName)
 )
 
+// columnMigration is a column added to a table after its initial definition
+// they are added to existing tables when [New] is asked to create the tables
+type columnMigration struct {
+	name       string
+	definition string
+}
+
+// columnMigrations are columns added to the things table
+var columnMigrations = []columnMigration{
+	{name: "version", definition: "`version` INTEGER NOT NULL DEFAULT 1"},
+	{name: "group_name", definition: "`group_name` VARCHAR(191) NOT NULL DEFAULT ''"},
+}
+
 // Store is something that can store [types.StatusThing]
 type Store struct {
-	db *sql.DB
+	db     *sql.DB
+	tracer trace.Tracer
+}
+
+// Option is a functional option for a [Store]
+type Option func(*Store) error
+
+// WithTracerProvider traces sql statements with tp instead of the global tracer provider
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(ss *Store) error {
+		if tp == nil {
+			return fmt.Errorf("tracer provider cannot be nil")
+		}
+		ss.tracer = tp.Tracer(tracingScope)
+		return nil
+	}
 }
 
 // statusThingRecord is the sqlite representation of a [types.StatusThing]
@@ -37,7 +75,9 @@ type statusThingRecord struct {
 	id          string
 	name        string
 	description string
+	group       string
 	status      int
+	version     int64
 }
 
 // converts from db representation
@@ -46,7 +86,9 @@ func (s *statusThingRecord) toStatusThing() (*types.StatusThing, error) {
 		ID:          s.id,
 		Name:        s.name,
 		Description: s.description,
+		Group:       s.group,
 		Status:      types.Status(s.status),
+		Version:     s.version,
 	}
 
 	return st, nil
@@ -58,26 +100,97 @@ func toRecord(st *types.StatusThing) (*statusThingRecord, error) { // nolint: un
 		id:          st.ID,
 		description: st.Description,
 		name:        st.Name,
+		group:       st.Group,
 		status:      int(st.Status),
+		version:     st.Version,
 	}
 
 	return res, nil
 }
 
 // New returns a new sqlite3-backed service storer
-func New(db *sql.DB, createTable bool) (*Store, error) {
+func New(db *sql.DB, createTable bool, opts ...Option) (*Store, error) {
+	ss := &Store{db: db, tracer: otel.GetTracerProvider().Tracer(tracingScope)}
+	for _, opt := range opts {
+		if err := opt(ss); err != nil {
+			return nil, err
+		}
+	}
 	if createTable {
 		if _, err := db.ExecContext(context.TODO(), createTableStatement); err != nil {
 			return nil, fmt.Errorf("unable to create table: %w", err)
 		}
+		if err := migrateColumns(context.TODO(), db, thingTableName, columnMigrations); err != nil {
+			return nil, fmt.Errorf("unable to migrate table: %w", err)
+		}
+		if _, err := db.ExecContext(context.TODO(), createSubscriberTableStatement); err != nil {
+			return nil, fmt.Errorf("unable to create subscribers table: %w", err)
+		}
+		if err := migrateColumns(context.TODO(), db, subscriberTableName, subscriberColumnMigrations); err != nil {
+			return nil, fmt.Errorf("unable to migrate subscribers table: %w", err)
+		}
+		if _, err := db.ExecContext(context.TODO(), createHistoryTableStatement); err != nil {
+			return nil, fmt.Errorf("unable to create history table: %w", err)
+		}
+		if err := migrateColumns(context.TODO(), db, historyTableName, historyColumnMigrations); err != nil {
+			return nil, fmt.Errorf("unable to migrate history table: %w", err)
+		}
+		if _, err := db.ExecContext(context.TODO(), createHistoryIndexStatement); err != nil {
+			return nil, fmt.Errorf("unable to create history table: %w", err)
+		}
 	}
-	return &Store{db: db}, nil
+	return ss, nil
+}
+
+// migrateColumns adds any missing migrations to an existing table
+func migrateColumns(ctx context.Context, db *sql.DB, table string, migrations []columnMigration) error {
+	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT name FROM pragma_table_info('%s')", table))
+	if err != nil {
+		return err
+	}
+	existing := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			_ = rows.Close()
+			return err
+		}
+		existing[name] = true
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	for _, col := range migrations {
+		if existing[col.name] {
+			continue
+		}
+		if _, err := db.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, col.definition)); err != nil {
+			return fmt.Errorf("unable to add column %s: %w", col.name, err)
+		}
+	}
+	return nil
+}
+
+// ensure we always satisfy
+var _ storers.Pinger = (*Store)(nil)
+
+// Ping checks the database can be queried
+func (ss *Store) Ping(ctx context.Context) (err error) {
+	ctx, span := ss.startSpan(ctx, "Ping", pingStatement)
+	defer func() { tracing.End(span, err) }()
+	var one int
+	if err := ss.db.QueryRowContext(ctx, pingStatement).Scan(&one); err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("unable to query database: %w", err)
+	}
+	return nil
 }
 
 // Get gets a thing
-func (ss *Store) Get(ctx context.Context, id string) (*types.StatusThing, error) {
+func (ss *Store) Get(ctx context.Context, id string) (_ *types.StatusThing, err error) {
+	ctx, span := ss.startSpan(ctx, "Get", selectStatement)
+	defer func() { tracing.End(span, err) }()
 	st := &statusThingRecord{}
-	if err := ss.db.QueryRowContext(ctx, selectStatement, id).Scan(&st.id, &st.name, &st.description, &st.status); err != nil {
+	if err := ss.db.QueryRowContext(ctx, selectStatement, id).Scan(&st.id, &st.name, &st.description, &st.group, &st.status, &st.version); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, types.ErrNotFound
 		}
@@ -88,7 +201,9 @@ func (ss *Store) Get(ctx context.Context, id string) (*types.StatusThing, error)
 }
 
 // GetAll gets all records from the store
-func (ss *Store) GetAll(ctx context.Context) ([]*types.StatusThing, error) {
+func (ss *Store) GetAll(ctx context.Context) (_ []*types.StatusThing, err error) {
+	ctx, span := ss.startSpan(ctx, "GetAll", selectAllStatement)
+	defer func() { tracing.End(span, err) }()
 	res := []*types.StatusThing{}
 	rows, err := ss.db.QueryContext(ctx, selectAllStatement)
 	if err == sql.ErrNoRows {
@@ -99,7 +214,7 @@ func (ss *Store) GetAll(ctx context.Context) ([]*types.StatusThing, error) {
 	}
 	for rows.Next() {
 		rec := &statusThingRecord{}
-		if err := rows.Scan(&rec.id, &rec.name, &rec.description, &rec.status); err != nil {
+		if err := rows.Scan(&rec.id, &rec.name, &rec.description, &rec.group, &rec.status, &rec.version); err != nil {
 			return nil, fmt.Errorf("unable to read data: %w", err)
 		}
 		r, err := rec.toStatusThing()
@@ -112,7 +227,9 @@ func (ss *Store) GetAll(ctx context.Context) ([]*types.StatusThing, error) {
 }
 
 // Insert adds a thing to the db
-func (ss *Store) Insert(ctx context.Context, thing *types.StatusThing) (*types.StatusThing, error) {
+func (ss *Store) Insert(ctx context.Context, thing *types.StatusThing) (_ *types.StatusThing, err error) {
+	ctx, span := ss.startSpan(ctx, "Insert", insertStatement)
+	defer func() { tracing.End(span, err) }()
 	st, err := toRecord(thing)
 	if err != nil {
 		return nil, err
@@ -123,7 +240,7 @@ func (ss *Store) Insert(ctx context.Context, thing *types.StatusThing) (*types.S
 		return nil, err
 	}
 
-	rows, err := tx.ExecContext(ctx, insertStatement, st.id, st.name, st.description, st.status)
+	rows, err := tx.ExecContext(ctx, insertStatement, st.id, st.name, st.description, st.group, st.status)
 	var sqliteError = &sqlite.Error{}
 	if errors.As(err, &sqliteError) && sqliteError.Code() == 2067 {
 		return nil, types.ErrAlreadyExists
@@ -142,41 +259,100 @@ func (ss *Store) Insert(ctx context.Context, thing *types.StatusThing) (*types.S
 	return ss.Get(ctx, st.id)
 }
 
-// Update updates a thing
-func (ss *Store) Update(ctx context.Context, id string, opts ...dbfilters.Option) (*types.StatusThing, error) {
+// Update updates a thing and returns it as it was before and after the update
+// both are read in the transaction making the change so previous is always the state that was replaced
+func (ss *Store) Update(ctx context.Context, id string, opts ...dbfilters.Option) (_ *types.StatusThing, _ *types.StatusThing, err error) {
+	// the statement depends on the options so it is added once built
+	ctx, span := ss.startSpan(ctx, "Update", "")
+	defer func() { tracing.End(span, err) }()
 	dbopts, err := dbfilters.New(opts...)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
-	if _, err := ss.Get(ctx, id); err != nil {
-		return nil, err
-	}
 	tx, err := ss.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
 	if err != nil {
-		return nil, err
+		return nil, nil, err
+	}
+	rec := &statusThingRecord{}
+	if err := tx.QueryRowContext(ctx, selectStatement, id).Scan(&rec.id, &rec.name, &rec.description, &rec.group, &rec.status, &rec.version); err != nil {
+		if err == sql.ErrNoRows {
+			err = types.ErrNotFound
+		}
+		return nil, nil, ss.rollback(tx, err)
+	}
+	existing, err := rec.toStatusThing()
+	if err != nil {
+		return nil, nil, ss.rollback(tx, err)
 	}
+	if dbopts.Version() != 0 && dbopts.Version() != existing.Version {
+		return nil, nil, ss.rollback(tx, types.ErrVersionMismatch)
+	}
+	sets := []string{}
+	args := []any{}
 	// UnknownValue is not the zero-value for types.Status
 	if dbopts.Status() != types.StatusUnknown {
-		stmt := fmt.Sprintf("UPDATE %s SET status = ?", thingTableName)
-		if _, err := tx.ExecContext(ctx, stmt, dbopts.Status()); err != nil {
-			return nil, ss.rollback(tx, err)
+		sets = append(sets, "status = ?")
+		args = append(args, dbopts.Status())
+	}
+	if dbopts.Description() != "" {
+		sets = append(sets, "description = ?")
+		args = append(args, dbopts.Description())
+	}
+	if group, ok := dbopts.Group(); ok {
+		sets = append(sets, "group_name = ?")
+		args = append(args, group)
+	}
+	if len(sets) == 0 {
+		if err := tx.Rollback(); err != nil {
+			return nil, nil, err
+		}
+		return existing, existing, nil
+	}
+	// the update only applies to the version read above so concurrent writers cannot both succeed
+	// and the thing returned as previous is the one that was replaced
+	stmt := fmt.Sprintf("UPDATE %s SET %s, version = version + 1 WHERE id = ? AND version = ? RETURNING id,name,description,group_name,status,version", thingTableName, strings.Join(sets, ", "))
+	args = append(args, id, existing.Version)
+
+	span.SetAttributes(statementAttribute(stmt))
+
+	rec = &statusThingRecord{}
+	if err := tx.QueryRowContext(ctx, stmt, args...).Scan(&rec.id, &rec.name, &rec.description, &rec.group, &rec.status, &rec.version); err != nil {
+		if err == sql.ErrNoRows {
+			err = types.ErrVersionMismatch
 		}
+		return nil, nil, ss.rollback(tx, err)
+	}
+	updated, err := rec.toStatusThing()
+	if err != nil {
+		return nil, nil, ss.rollback(tx, err)
 	}
 
 	if err := tx.Commit(); err != nil {
-		return nil, fmt.Errorf("unable to save data: %w", err)
+		return nil, nil, fmt.Errorf("unable to save data: %w", err)
 	}
-	return ss.Get(ctx, id)
+	return existing, updated, nil
 }
 
 // Delete removes a thing from the db
-func (ss *Store) Delete(ctx context.Context, id string) error {
+func (ss *Store) Delete(ctx context.Context, id string, opts ...dbfilters.Option) (err error) {
+	ctx, span := ss.startSpan(ctx, "Delete", deleteStatement)
+	defer func() { tracing.End(span, err) }()
+	dbopts, err := dbfilters.New(opts...)
+	if err != nil {
+		return err
+	}
+	stmt := deleteStatement
+	args := []any{id}
+	if dbopts.Version() != 0 {
+		stmt += " AND version = ?"
+		args = append(args, dbopts.Version())
+	}
 	tx, err := ss.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelReadCommitted})
 	if err != nil {
 		return err
 	}
-	res, err := tx.ExecContext(ctx, deleteStatement, id)
+	res, err := tx.ExecContext(ctx, stmt, args...)
 	if err != nil && err != sql.ErrNoRows {
 		return ss.rollback(tx, err)
 	}
@@ -188,6 +364,12 @@ func (ss *Store) Delete(ctx context.Context, id string) error {
 	if err != nil {
 		return ss.rollback(tx, err)
 	}
+	if affected == 0 {
+		if err := tx.Rollback(); err != nil {
+			return err
+		}
+		return ss.missingOrStale(ctx, id)
+	}
 	if affected != 1 {
 		return ss.rollback(tx, fmt.Errorf("more than one row deleted. this should not happen"))
 	}
@@ -197,6 +379,28 @@ func (ss *Store) Delete(ctx context.Context, id string) error {
 	return nil
 }
 
+// missingOrStale determines why a conditional statement did not affect any rows
+func (ss *Store) missingOrStale(ctx context.Context, id string) error {
+	if _, err := ss.Get(ctx, id); err != nil {
+		return err
+	}
+	return types.ErrVersionMismatch
+}
+
+// startSpan starts a span for a call to the store
+func (ss *Store) startSpan(ctx context.Context, name, stmt string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("db.system", "sqlite")}
+	if stmt != "" {
+		attrs = append(attrs, statementAttribute(stmt))
+	}
+	return ss.tracer.Start(ctx, "Store."+name, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+// statementAttribute is the span attribute for a sql statement
+func statementAttribute(stmt string) attribute.KeyValue {
+	return attribute.String("db.statement", stmt)
+}
+
 // codify rollback behaviour centrally
 func (ss *Store) rollback(tx *sql.Tx, err error) error {
 	if rollbackErr := tx.Rollback(); rollbackErr != nil {
@@ -6,9 +6,14 @@ import (
 	"io/ioutil"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
 	"github.com/lusis/apithings/internal/statusthing/storers"
 	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
 	"github.com/lusis/apithings/internal/statusthing/types"
@@ -66,6 +71,18 @@ func TestCreateTable(t *testing.T) {
 	require.NotNil(t, s)
 }
 
+func TestPing(t *testing.T) {
+	t.Parallel()
+	db, cleanup, err := makeTestdb(t, "")
+	defer cleanup()
+	require.NoError(t, err)
+	s, err := New(db, true)
+	require.NoError(t, err)
+	require.NoError(t, s.Ping(context.Background()), "an empty table should be reachable")
+	require.NoError(t, db.Close())
+	require.Error(t, s.Ping(context.Background()), "a closed database should not be reachable")
+}
+
 func TestHappyPath(t *testing.T) {
 	t.Parallel()
 	db, cleanup, err := makeTestdb(t, "")
@@ -87,22 +104,256 @@ func TestHappyPath(t *testing.T) {
 	ires, err := s.Insert(ctx, originalThing)
 	require.NoError(t, err)
 	require.NotNil(t, ires)
+	// new records always start at version 1
+	originalThing.Version = 1
 	require.Equal(t, originalThing, ires)
 
 	// change status
-	ures, err := s.Update(ctx, ires.ID, dbfilters.WithStatus(types.StatusYellow))
+	pres, ures, err := s.Update(ctx, ires.ID, dbfilters.WithStatus(types.StatusYellow))
 	require.NoError(t, err)
+	require.Equal(t, ires, pres, "the thing should be returned as it was before the update")
 	require.NotNil(t, ures)
 	require.Equal(t, ires.ID, ures.ID)
 	require.Equal(t, originalThing.Name, ures.Name)
 	require.Equal(t, originalThing.Description, ures.Description)
+	require.Equal(t, int64(2), ures.Version)
+
+	// conditional change against a stale version
+	_, _, err = s.Update(ctx, ires.ID, dbfilters.WithStatus(types.StatusRed), dbfilters.WithVersion(ires.Version))
+	require.ErrorIs(t, err, types.ErrVersionMismatch)
+
+	// conditional change against the current version
+	pres, cres, err := s.Update(ctx, ires.ID, dbfilters.WithStatus(types.StatusRed), dbfilters.WithVersion(ures.Version))
+	require.NoError(t, err)
+	require.Equal(t, ures, pres)
+	require.Equal(t, types.StatusRed, cres.Status)
+	require.Equal(t, int64(3), cres.Version)
+
+	// change description
+	_, dres, err := s.Update(ctx, ires.ID, dbfilters.WithDescription("new description"))
+	require.NoError(t, err)
+	require.Equal(t, "new description", dres.Description)
+	require.Equal(t, types.StatusRed, dres.Status)
+	require.Equal(t, int64(4), dres.Version)
+
+	// set and then clear the group
+	_, gres, err := s.Update(ctx, ires.ID, dbfilters.WithGroup("core"))
+	require.NoError(t, err)
+	require.Equal(t, "core", gres.Group)
+	_, gres, err = s.Update(ctx, ires.ID, dbfilters.WithGroup(""))
+	require.NoError(t, err)
+	require.Equal(t, "", gres.Group)
+	require.Equal(t, int64(6), gres.Version)
+	cres = gres
+
+	// conditional delete against a stale version
+	err = s.Delete(ctx, ires.ID, dbfilters.WithVersion(ures.Version))
+	require.ErrorIs(t, err, types.ErrVersionMismatch)
 
 	// delete our record
-	err = s.Delete(ctx, ires.ID)
+	err = s.Delete(ctx, ires.ID, dbfilters.WithVersion(cres.Version))
 	require.NoError(t, err)
 
+	// deleting again should not find anything
+	err = s.Delete(ctx, ires.ID)
+	require.ErrorIs(t, err, types.ErrNotFound)
+
 	// validate delete
 	finalCheck, err := s.Get(ctx, t.Name())
 	require.ErrorIs(t, err, types.ErrNotFound)
 	require.Nil(t, finalCheck)
 }
+
+func TestUpdateOnlyTargetsOneThing(t *testing.T) {
+	t.Parallel()
+	db, cleanup, err := makeTestdb(t, "")
+	defer cleanup()
+	require.NoError(t, err)
+	s, err := New(db, false)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	first, err := s.Insert(ctx, &types.StatusThing{ID: "first", Name: "first", Description: "first", Status: types.StatusGreen})
+	require.NoError(t, err)
+	second, err := s.Insert(ctx, &types.StatusThing{ID: "second", Name: "second", Description: "second", Status: types.StatusGreen})
+	require.NoError(t, err)
+
+	_, _, err = s.Update(ctx, first.ID, dbfilters.WithStatus(types.StatusRed))
+	require.NoError(t, err)
+
+	unchanged, err := s.Get(ctx, second.ID)
+	require.NoError(t, err)
+	require.Equal(t, second, unchanged)
+}
+
+func TestMigrateColumns(t *testing.T) {
+	t.Parallel()
+	tempFilename := TempFilename(t)
+	defer func() {
+		if err := os.Remove(tempFilename); err != nil {
+			t.Error("temp file remove error:", err)
+		}
+	}()
+	db, err := sql.Open("sqlite", tempFilename)
+	require.NoError(t, err)
+	// the original table definition without any migrated columns
+	_, err = db.Exec("CREATE TABLE statusthings (`id` VARCHAR(191) PRIMARY KEY, `name` VARCHAR(191) NOT NULL UNIQUE, `description` VARCHAR(191) DEFAULT NULL, `status` INT UNSIGNED NOT NULL)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO statusthings (id, name, description, status) VALUES ('old','old','old',2)")
+	require.NoError(t, err)
+
+	s, err := New(db, true)
+	require.NoError(t, err)
+	res, err := s.Get(context.Background(), "old")
+	require.NoError(t, err)
+	require.Equal(t, int64(1), res.Version, "existing records should start at version 1")
+	require.Equal(t, "", res.Group, "existing records should not be in a group")
+
+	// running again should be a noop
+	_, err = New(db, true)
+	require.NoError(t, err)
+
+	// subscribers from before confirmations were timed have never been sent one
+	_, err = db.Exec("DROP TABLE subscribers")
+	require.NoError(t, err)
+	_, err = db.Exec("CREATE TABLE subscribers (`id` VARCHAR(191) PRIMARY KEY, `email` VARCHAR(191) NOT NULL UNIQUE, `thing_names` TEXT NOT NULL DEFAULT '[]', `group_names` TEXT NOT NULL DEFAULT '[]', `confirmed` INTEGER NOT NULL DEFAULT 0, `confirm_token` VARCHAR(191) NOT NULL UNIQUE, `unsubscribe_token` VARCHAR(191) NOT NULL UNIQUE, `created_at` INTEGER NOT NULL)")
+	require.NoError(t, err)
+	_, err = db.Exec("INSERT INTO subscribers (id, email, confirm_token, unsubscribe_token, created_at) VALUES ('old','old@example.com','c','u',0)")
+	require.NoError(t, err)
+	s, err = New(db, true)
+	require.NoError(t, err)
+	sub, err := s.GetSubscriberByEmail(context.Background(), "old@example.com")
+	require.NoError(t, err)
+	require.Equal(t, int64(0), sub.ConfirmSentAt.Unix())
+}
+
+func TestSubscribers(t *testing.T) {
+	t.Parallel()
+	db, cleanup, err := makeTestdb(t, "")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := New(db, true)
+	require.NoError(t, err)
+	require.Implements(t, (*storers.SubscriberStorer)(nil), store)
+	ctx := context.Background()
+
+	created := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	sub, err := store.InsertSubscriber(ctx, &types.Subscriber{ID: "1", Email: "a@example.com", Groups: []string{"core"}, ConfirmToken: "c1", UnsubscribeToken: "u1", CreatedAt: created})
+	require.NoError(t, err)
+	require.Equal(t, []string{}, sub.Things, "empty lists should round trip")
+	require.Equal(t, []string{"core"}, sub.Groups)
+	require.False(t, sub.Confirmed)
+	require.Equal(t, created, sub.CreatedAt)
+
+	_, err = store.InsertSubscriber(ctx, &types.Subscriber{ID: "2", Email: "a@example.com", ConfirmToken: "c2", UnsubscribeToken: "u2"})
+	require.ErrorIs(t, err, types.ErrAlreadyExists)
+
+	sent := created.Add(time.Hour)
+	sub, err = store.UpdatePendingSubscriber(ctx, &types.Subscriber{ID: "1", Email: "a@example.com", Things: []string{"api"}, ConfirmSentAt: sent})
+	require.NoError(t, err)
+	require.Equal(t, []string{"api"}, sub.Things)
+	require.Equal(t, []string{}, sub.Groups)
+	require.Equal(t, sent, sub.ConfirmSentAt)
+	require.Equal(t, "c1", sub.ConfirmToken, "tokens should not change")
+
+	_, err = store.ConfirmSubscriber(ctx, "nope")
+	require.ErrorIs(t, err, types.ErrNotFound)
+	_, err = store.ConfirmSubscriber(ctx, "")
+	require.ErrorIs(t, err, types.ErrNotFound)
+	sub, err = store.ConfirmSubscriber(ctx, "c1")
+	require.NoError(t, err)
+	require.True(t, sub.Confirmed)
+
+	_, err = store.UpdatePendingSubscriber(ctx, &types.Subscriber{ID: "1", Email: "a@example.com"})
+	require.ErrorIs(t, err, types.ErrNotFound, "confirmed subscribers should not be changed")
+
+	all, err := store.GetSubscribers(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 1)
+	require.True(t, all[0].Confirmed)
+	require.Equal(t, []string{"api"}, all[0].Things)
+
+	require.ErrorIs(t, store.DeleteSubscriber(ctx, "nope"), types.ErrNotFound)
+	require.NoError(t, store.DeleteSubscriber(ctx, "u1"))
+	_, err = store.GetSubscriberByEmail(ctx, "a@example.com")
+	require.ErrorIs(t, err, types.ErrNotFound)
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+	db, cleanup, err := makeTestdb(t, "")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	require.NoError(t, err)
+	defer db.Close()
+	store, err := New(db, true)
+	require.NoError(t, err)
+	require.Implements(t, (*storers.HistoryStorer)(nil), store)
+	ctx := context.Background()
+
+	require.Error(t, store.InsertTransition(ctx, types.Transition{}), "thing is required")
+	start := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	api := &types.StatusThing{ID: "api", Name: "api", Description: "the api", Group: "core", Status: types.StatusRed, Version: 2}
+	web := &types.StatusThing{ID: "web", Name: "web", Description: "the website", Status: types.StatusYellow, Version: 3}
+	require.NoError(t, store.InsertTransition(ctx, types.Transition{Thing: api, Previous: types.StatusGreen, At: start}))
+	require.NoError(t, store.InsertTransition(ctx, types.Transition{Thing: web, Previous: types.StatusGreen, At: start.Add(time.Minute)}))
+	require.NoError(t, store.InsertTransition(ctx, types.Transition{Thing: &types.StatusThing{ID: "api", Name: "api", Group: "core", Status: types.StatusGreen}, Previous: types.StatusRed, At: start.Add(time.Hour)}))
+	require.NoError(t, store.InsertTransition(ctx, types.Transition{Thing: api, Previous: types.StatusGreen, At: start, Published: true}))
+
+	all, err := store.GetTransitions(ctx)
+	require.NoError(t, err)
+	require.Len(t, all, 3, "published changes should only be returned when asked for")
+	require.Equal(t, types.Transition{ID: 1, Thing: api, Previous: types.StatusGreen, At: start}, all[2], "should round trip oldest last")
+	require.Equal(t, types.StatusGreen, all[0].Thing.Status)
+	require.Equal(t, int64(3), all[0].ID)
+
+	published, err := store.GetTransitions(ctx, dbfilters.WithPublished())
+	require.NoError(t, err)
+	require.Equal(t, []types.Transition{{ID: 4, Thing: api, Previous: types.StatusGreen, At: start, Published: true}}, published)
+
+	for name, tc := range map[string]struct {
+		opts []dbfilters.Option
+		len  int
+	}{
+		"id":    {opts: []dbfilters.Option{dbfilters.WithThingID("api")}, len: 2},
+		"name":  {opts: []dbfilters.Option{dbfilters.WithName("web")}, len: 1},
+		"group": {opts: []dbfilters.Option{dbfilters.WithGroup("core")}, len: 2},
+		"since": {opts: []dbfilters.Option{dbfilters.WithSince(start.Add(time.Minute))}, len: 2},
+		"until": {opts: []dbfilters.Option{dbfilters.WithUntil(start.Add(time.Minute))}, len: 1},
+		"limit": {opts: []dbfilters.Option{dbfilters.WithLimit(1)}, len: 1},
+	} {
+		res, err := store.GetTransitions(ctx, tc.opts...)
+		require.NoError(t, err, name)
+		require.Len(t, res, tc.len, name)
+	}
+}
+
+func TestTracing(t *testing.T) {
+	t.Parallel()
+	db, cleanup, err := makeTestdb(t, "")
+	if cleanup != nil {
+		defer cleanup()
+	}
+	require.NoError(t, err)
+	defer db.Close()
+	_, err = New(db, false, WithTracerProvider(nil))
+	require.Error(t, err, "should require a tracer provider")
+
+	sr := tracetest.NewSpanRecorder()
+	store, err := New(db, false, WithTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))))
+	require.NoError(t, err)
+	_, err = store.Get(context.Background(), "missing")
+	require.ErrorIs(t, err, types.ErrNotFound)
+	_, _, err = store.Update(context.Background(), "missing", dbfilters.WithStatus(types.StatusRed))
+	require.ErrorIs(t, err, types.ErrNotFound)
+
+	spans := sr.Ended()
+	require.Len(t, spans, 2, "update reads the existing thing in its own transaction")
+	require.Equal(t, "Store.Get", spans[0].Name())
+	require.Contains(t, spans[0].Attributes(), attribute.String("db.statement", selectStatement))
+	require.Equal(t, "Store.Update", spans[1].Name())
+}
@@ -0,0 +1,190 @@
+package sqlite3
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing/storers"
+	"github.com/lusis/apithings/internal/statusthing/tracing"
+	"github.com/lusis/apithings/internal/statusthing/types"
+
+	"modernc.org/sqlite"
+)
+
+const (
+	subscriberTableName = "subscribers"
+	subscriberColumns   = "id,email,thing_names,group_names,confirmed,confirm_token,unsubscribe_token,created_at,confirm_sent_at"
+)
+
+// subscriberColumnMigrations are columns added to the subscribers table
+var subscriberColumnMigrations = []columnMigration{
+	{name: "confirm_sent_at", definition: "`confirm_sent_at` INTEGER NOT NULL DEFAULT 0"},
+}
+
+var (
+	createSubscriberTableStatement = fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (`id` VARCHAR(191) PRIMARY KEY, `email` VARCHAR(191) NOT NULL UNIQUE, `thing_names` TEXT NOT NULL DEFAULT '[]', `group_names` TEXT NOT NULL DEFAULT '[]', `confirmed` INTEGER NOT NULL DEFAULT 0, `confirm_token` VARCHAR(191) NOT NULL UNIQUE, `unsubscribe_token` VARCHAR(191) NOT NULL UNIQUE, `created_at` INTEGER NOT NULL, `confirm_sent_at` INTEGER NOT NULL DEFAULT 0)", subscriberTableName)
+	insertSubscriberStatement      = fmt.Sprintf("INSERT INTO %s (%s) VALUES (?,?,?,?,?,?,?,?,?)", subscriberTableName, subscriberColumns)
+	selectSubscribersStatement     = fmt.Sprintf("SELECT %s FROM %s", subscriberColumns, subscriberTableName)
+	confirmSubscriberStatement     = fmt.Sprintf("UPDATE %s SET confirmed = 1 WHERE confirm_token = ?", subscriberTableName)
+	updatePendingStatement         = fmt.Sprintf("UPDATE %s SET thing_names = ?, group_names = ?, confirm_sent_at = ? WHERE id = ? AND confirmed = 0", subscriberTableName)
+	deleteSubscriberStatement      = fmt.Sprintf("DELETE FROM %s WHERE unsubscribe_token = ?", subscriberTableName)
+)
+
+// ensure we always satisfy
+var _ storers.SubscriberStorer = (*Store)(nil)
+
+// scanner is implemented by [sql.Row] and [sql.Rows]
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanSubscriber(row scanner) (*types.Subscriber, error) {
+	sub := &types.Subscriber{}
+	var things, groups string
+	var created, confirmSent int64
+	if err := row.Scan(&sub.ID, &sub.Email, &things, &groups, &sub.Confirmed, &sub.ConfirmToken, &sub.UnsubscribeToken, &created, &confirmSent); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal([]byte(things), &sub.Things); err != nil {
+		return nil, fmt.Errorf("unable to read things: %w", err)
+	}
+	if err := json.Unmarshal([]byte(groups), &sub.Groups); err != nil {
+		return nil, fmt.Errorf("unable to read groups: %w", err)
+	}
+	sub.CreatedAt = time.Unix(created, 0).UTC()
+	sub.ConfirmSentAt = time.Unix(confirmSent, 0).UTC()
+	return sub, nil
+}
+
+// InsertSubscriber adds a subscriber
+func (ss *Store) InsertSubscriber(ctx context.Context, sub *types.Subscriber) (_ *types.Subscriber, err error) {
+	ctx, span := ss.startSpan(ctx, "InsertSubscriber", insertSubscriberStatement)
+	defer func() { tracing.End(span, err) }()
+	things, err := json.Marshal(nonNil(sub.Things))
+	if err != nil {
+		return nil, err
+	}
+	groups, err := json.Marshal(nonNil(sub.Groups))
+	if err != nil {
+		return nil, err
+	}
+	_, err = ss.db.ExecContext(ctx, insertSubscriberStatement, sub.ID, sub.Email, string(things), string(groups), sub.Confirmed, sub.ConfirmToken, sub.UnsubscribeToken, sub.CreatedAt.Unix(), sub.ConfirmSentAt.Unix())
+	var sqliteError = &sqlite.Error{}
+	if errors.As(err, &sqliteError) && sqliteError.Code() == 2067 {
+		return nil, types.ErrAlreadyExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to insert subscriber: %w", err)
+	}
+	return ss.GetSubscriberByEmail(ctx, sub.Email)
+}
+
+// GetSubscriberByEmail gets a subscriber by their email
+func (ss *Store) GetSubscriberByEmail(ctx context.Context, email string) (_ *types.Subscriber, err error) {
+	ctx, span := ss.startSpan(ctx, "GetSubscriberByEmail", selectSubscribersStatement)
+	defer func() { tracing.End(span, err) }()
+	sub, err := scanSubscriber(ss.db.QueryRowContext(ctx, selectSubscribersStatement+" WHERE email = ?", email))
+	if err == sql.ErrNoRows {
+		return nil, types.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to query for subscriber: %w", err)
+	}
+	return sub, nil
+}
+
+// GetSubscribers gets all subscribers
+func (ss *Store) GetSubscribers(ctx context.Context) (_ []*types.Subscriber, err error) {
+	ctx, span := ss.startSpan(ctx, "GetSubscribers", selectSubscribersStatement)
+	defer func() { tracing.End(span, err) }()
+	res := []*types.Subscriber{}
+	rows, err := ss.db.QueryContext(ctx, selectSubscribersStatement)
+	if err != nil {
+		return nil, fmt.Errorf("unable to query: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		sub, err := scanSubscriber(rows)
+		if err != nil {
+			return nil, fmt.Errorf("unable to read data: %w", err)
+		}
+		res = append(res, sub)
+	}
+	return res, rows.Err()
+}
+
+// ConfirmSubscriber confirms the subscriber with the confirmation token
+func (ss *Store) ConfirmSubscriber(ctx context.Context, confirmToken string) (_ *types.Subscriber, err error) {
+	ctx, span := ss.startSpan(ctx, "ConfirmSubscriber", confirmSubscriberStatement)
+	defer func() { tracing.End(span, err) }()
+	if confirmToken == "" {
+		return nil, types.ErrNotFound
+	}
+	res, err := ss.db.ExecContext(ctx, confirmSubscriberStatement, confirmToken)
+	if err != nil {
+		return nil, fmt.Errorf("unable to confirm subscriber: %w", err)
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return nil, types.ErrNotFound
+	}
+	sub, err := scanSubscriber(ss.db.QueryRowContext(ctx, selectSubscribersStatement+" WHERE confirm_token = ?", confirmToken))
+	if err != nil {
+		return nil, fmt.Errorf("unable to query for subscriber: %w", err)
+	}
+	return sub, nil
+}
+
+// UpdatePendingSubscriber replaces the things, groups and confirmation time of an unconfirmed subscriber
+func (ss *Store) UpdatePendingSubscriber(ctx context.Context, sub *types.Subscriber) (_ *types.Subscriber, err error) {
+	ctx, span := ss.startSpan(ctx, "UpdatePendingSubscriber", updatePendingStatement)
+	defer func() { tracing.End(span, err) }()
+	things, err := json.Marshal(nonNil(sub.Things))
+	if err != nil {
+		return nil, err
+	}
+	groups, err := json.Marshal(nonNil(sub.Groups))
+	if err != nil {
+		return nil, err
+	}
+	res, err := ss.db.ExecContext(ctx, updatePendingStatement, string(things), string(groups), sub.ConfirmSentAt.Unix(), sub.ID)
+	if err != nil {
+		return nil, fmt.Errorf("unable to update subscriber: %w", err)
+	}
+	if affected, err := res.RowsAffected(); err != nil || affected == 0 {
+		return nil, types.ErrNotFound
+	}
+	return ss.GetSubscriberByEmail(ctx, sub.Email)
+}
+
+// DeleteSubscriber removes the subscriber with the unsubscribe token
+func (ss *Store) DeleteSubscriber(ctx context.Context, unsubscribeToken string) (err error) {
+	ctx, span := ss.startSpan(ctx, "DeleteSubscriber", deleteSubscriberStatement)
+	defer func() { tracing.End(span, err) }()
+	if unsubscribeToken == "" {
+		return types.ErrNotFound
+	}
+	res, err := ss.db.ExecContext(ctx, deleteSubscriberStatement, unsubscribeToken)
+	if err != nil {
+		return fmt.Errorf("unable to delete subscriber: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return types.ErrNotFound
+	}
+	return nil
+}
+
+// nonNil makes sure empty lists are stored as [] rather than null
+func nonNil(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
@@ -15,10 +15,17 @@ type StatusThingStorer interface {
 	GetAll(ctx context.Context) ([]*types.StatusThing, error)
 	// Insert adds a statusthing
 	Insert(ctx context.Context, thing *types.StatusThing) (*types.StatusThing, error)
-	// Update updates a statusthing
-	Update(ctx context.Context, id string, opts ...dbfilters.Option) (*types.StatusThing, error)
+	// Update updates a statusthing and returns it as it was before and after the update
+	// previous must be the state the update replaced, not one read separately
+	Update(ctx context.Context, id string, opts ...dbfilters.Option) (previous *types.StatusThing, updated *types.StatusThing, err error)
 	// Delete deletes a statusthing
-	Delete(ctx context.Context, id string) error
+	Delete(ctx context.Context, id string, opts ...dbfilters.Option) error
+}
+
+// Pinger is implemented by storers that can report if they are reachable
+type Pinger interface {
+	// Ping returns an error if the store cannot currently be used
+	Ping(ctx context.Context) error
 }
 
 // UnimplementedStorer is a [StatusThingStorer] implementation for testing and backwards compatibility
@@ -43,11 +50,11 @@ func (us *UnimplementedStorer) Insert(ctx context.Context, thing *types.StatusTh
 }
 
 // Update updates a statusthing
-func (us *UnimplementedStorer) Update(ctx context.Context, id string, opts ...dbfilters.Option) (*types.StatusThing, error) {
+func (us *UnimplementedStorer) Update(ctx context.Context, id string, opts ...dbfilters.Option) (*types.StatusThing, *types.StatusThing, error) {
 	panic("not implemented")
 }
 
 // Delete deletes a statusthing
-func (us *UnimplementedStorer) Delete(ctx context.Context, id string) error {
+func (us *UnimplementedStorer) Delete(ctx context.Context, id string, opts ...dbfilters.Option) error {
 	panic("not implemented")
 }
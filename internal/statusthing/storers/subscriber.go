@@ -0,0 +1,25 @@
+package storers
+
+import (
+	"context"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// SubscriberStorer stores email subscribers
+type SubscriberStorer interface {
+	// InsertSubscriber adds a subscriber
+	// [types.ErrAlreadyExists] is returned if the email is already subscribed
+	InsertSubscriber(ctx context.Context, sub *types.Subscriber) (*types.Subscriber, error)
+	// GetSubscriberByEmail gets a subscriber by their email
+	GetSubscriberByEmail(ctx context.Context, email string) (*types.Subscriber, error)
+	// GetSubscribers gets all subscribers
+	GetSubscribers(ctx context.Context) ([]*types.Subscriber, error)
+	// ConfirmSubscriber confirms the subscriber with the confirmation token
+	ConfirmSubscriber(ctx context.Context, confirmToken string) (*types.Subscriber, error)
+	// UpdatePendingSubscriber replaces the things, groups and confirmation time of an unconfirmed subscriber
+	// [types.ErrNotFound] is returned if there is no unconfirmed subscriber with the id
+	UpdatePendingSubscriber(ctx context.Context, sub *types.Subscriber) (*types.Subscriber, error)
+	// DeleteSubscriber removes the subscriber with the unsubscribe token
+	DeleteSubscriber(ctx context.Context, unsubscribeToken string) error
+}
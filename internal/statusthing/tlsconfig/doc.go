@@ -0,0 +1,2 @@
+// Package tlsconfig builds tls configs that reload their certificate when it changes on disk
+package tlsconfig
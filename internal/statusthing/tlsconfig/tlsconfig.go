@@ -0,0 +1,156 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"golang.org/x/exp/slog"
+)
+
+// Reloader serves a certificate and key from disk, reloading them when either file changes
+type Reloader struct {
+	certFile string
+	keyFile  string
+
+	lock    sync.RWMutex
+	cert    *tls.Certificate
+	modTime time.Time
+}
+
+// NewReloader returns a new [Reloader] for the certificate and key files
+func NewReloader(certFile, keyFile string) (*Reloader, error) {
+	if certFile == "" || keyFile == "" {
+		return nil, fmt.Errorf("certificate and key files must be provided")
+	}
+	r := &Reloader{certFile: certFile, keyFile: keyFile}
+	modTime, err := r.lastModified()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.load(modTime); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// lastModified returns when the certificate or key was last changed
+func (r *Reloader) lastModified() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("unable to read %s: %w", f, err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// load reads the certificate and key
+func (r *Reloader) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("unable to load certificate: %w", err)
+	}
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return nil
+}
+
+// GetCertificate returns the current certificate
+// it can be used as [tls.Config.GetCertificate]
+//
+// The files are checked on every handshake so renewed certificates are picked up without a restart.
+// If the new files can't be loaded i.e. only one of them has been written yet, the previous certificate is served.
+func (r *Reloader) GetCertificate(_ *tls.ClientHelloInfo) (*tls.Certificate, error) {
+	modTime, err := r.lastModified()
+	switch {
+	case err != nil:
+		slog.Error("unable to check certificate for changes", "err", err)
+	case r.changed(modTime):
+		// concurrent handshakes may both reload which is harmless
+		if err := r.load(modTime); err != nil {
+			slog.Error("unable to reload certificate", "err", err)
+		} else {
+			slog.Info("reloaded certificate", "file", r.certFile)
+		}
+	}
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return r.cert, nil
+}
+
+// changed reports if the files have changed since they were loaded
+func (r *Reloader) changed(modTime time.Time) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	return !modTime.Equal(r.modTime)
+}
+
+// config is what the options build
+type config struct {
+	clientCAs  *x509.CertPool
+	clientAuth tls.ClientAuthType
+}
+
+// Option is a functional option for [New]
+type Option func(*config) error
+
+// WithClientCAs verifies client certificates against the pem encoded CAs in file
+// clients without a certificate are still allowed unless [RequireClientCert] is used as well
+func WithClientCAs(file string) Option {
+	return func(c *config) error {
+		pem, err := os.ReadFile(file)
+		if err != nil {
+			return fmt.Errorf("unable to read client CAs: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("no certificates found in %s", file)
+		}
+		c.clientCAs = pool
+		if c.clientAuth == tls.NoClientCert {
+			c.clientAuth = tls.VerifyClientCertIfGiven
+		}
+		return nil
+	}
+}
+
+// RequireClientCert rejects clients without a certificate signed by the client CAs
+func RequireClientCert() Option {
+	return func(c *config) error {
+		c.clientAuth = tls.RequireAndVerifyClientCert
+		return nil
+	}
+}
+
+// New returns a [tls.Config] serving the certificate and key files
+func New(certFile, keyFile string, opts ...Option) (*tls.Config, error) {
+	c := &config{}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.clientAuth == tls.RequireAndVerifyClientCert && c.clientCAs == nil {
+		return nil, fmt.Errorf("client CAs must be provided to require client certificates")
+	}
+	r, err := NewReloader(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.GetCertificate,
+		ClientCAs:      c.clientCAs,
+		ClientAuth:     c.clientAuth,
+	}, nil
+}
@@ -0,0 +1,84 @@
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lusis/apithings/internal/statusthing/statusthingtest"
+)
+
+// writeCert writes a self signed certificate and key for cn to dir with the mod time set
+func writeCert(t *testing.T, dir, cn string, modTime time.Time) (string, string) {
+	t.Helper()
+	certFile, keyFile := filepath.Join(dir, "tls.crt"), filepath.Join(dir, "tls.key")
+	statusthingtest.WriteCert(t, certFile, keyFile, cn)
+	// filesystems don't all have fine grained mod times so set them explicitly
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+	return certFile, keyFile
+}
+
+func commonName(t *testing.T, cert *tls.Certificate) string {
+	t.Helper()
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestReloader(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	_, err := NewReloader(filepath.Join(dir, "missing.crt"), filepath.Join(dir, "missing.key"))
+	require.Error(t, err)
+
+	now := time.Now()
+	certFile, keyFile := writeCert(t, dir, "first", now.Add(-time.Minute))
+	r, err := NewReloader(certFile, keyFile)
+	require.NoError(t, err)
+	cert, err := r.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "first", commonName(t, cert))
+
+	writeCert(t, dir, "second", now)
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "second", commonName(t, cert), "should reload when the files change")
+
+	// a half written renewal keeps serving the last good certificate
+	require.NoError(t, os.WriteFile(keyFile, []byte("nope"), 0o600))
+	require.NoError(t, os.Chtimes(keyFile, now.Add(time.Minute), now.Add(time.Minute)))
+	cert, err = r.GetCertificate(nil)
+	require.NoError(t, err)
+	require.Equal(t, "second", commonName(t, cert))
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	certFile, keyFile := writeCert(t, dir, "server", time.Now())
+
+	_, err := New(certFile, keyFile, RequireClientCert())
+	require.Error(t, err, "requiring client certs needs CAs")
+	_, err = New(certFile, keyFile, WithClientCAs(keyFile))
+	require.Error(t, err, "should require certificates in the CA bundle")
+
+	cfg, err := New(certFile, keyFile)
+	require.NoError(t, err)
+	require.Equal(t, tls.NoClientCert, cfg.ClientAuth)
+
+	cfg, err = New(certFile, keyFile, WithClientCAs(certFile))
+	require.NoError(t, err)
+	require.Equal(t, tls.VerifyClientCertIfGiven, cfg.ClientAuth)
+	require.NotNil(t, cfg.ClientCAs)
+
+	// option order doesn't matter
+	cfg, err = New(certFile, keyFile, RequireClientCert(), WithClientCAs(certFile))
+	require.NoError(t, err)
+	require.Equal(t, tls.RequireAndVerifyClientCert, cfg.ClientAuth)
+}
@@ -0,0 +1,2 @@
+// Package tracing configures opentelemetry tracing for statusthing
+package tracing
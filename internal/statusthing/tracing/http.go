@@ -0,0 +1,52 @@
+package tracing
+
+import (
+	"fmt"
+	"net/http"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// httpScope is the instrumentation scope for http spans
+const httpScope = "github.com/lusis/apithings/internal/statusthing/handlers"
+
+// Middleware starts a span for each request continuing any trace propagated by the caller
+// the span is named after the chi route once it is known so ids don't create unique span names
+func Middleware(tp trace.TracerProvider) func(http.Handler) http.Handler {
+	tracer := tp.Tracer(httpScope)
+	propagator := propagation.TraceContext{}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := propagator.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := tracer.Start(ctx, r.Method, trace.WithSpanKind(trace.SpanKindServer), trace.WithAttributes(
+				attribute.String("http.method", r.Method),
+				attribute.String("http.target", r.URL.Path),
+			))
+			defer span.End()
+			// let callers correlate responses with traces
+			propagator.Inject(ctx, propagation.HeaderCarrier(w.Header()))
+
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			next.ServeHTTP(ww, r.WithContext(ctx))
+
+			if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+				span.SetName(fmt.Sprintf("%s %s", r.Method, rctx.RoutePattern()))
+				span.SetAttributes(attribute.String("http.route", rctx.RoutePattern()))
+			}
+			code := ww.Status()
+			if code == 0 {
+				code = http.StatusOK
+			}
+			span.SetAttributes(attribute.Int("http.status_code", code))
+			if code >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(code))
+			}
+		})
+	}
+}
@@ -0,0 +1,37 @@
+package tracing
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"golang.org/x/exp/slog"
+)
+
+// LogHandler adds the trace and span ids from the context to log records
+type LogHandler struct {
+	slog.Handler
+}
+
+// NewLogHandler returns a new [LogHandler] wrapping h
+func NewLogHandler(h slog.Handler) *LogHandler {
+	return &LogHandler{Handler: h}
+}
+
+// Handle adds the trace and span ids to the record if the context has a span
+func (lh *LogHandler) Handle(ctx context.Context, r slog.Record) error {
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return lh.Handler.Handle(ctx, r)
+}
+
+// WithAttrs returns a new [LogHandler] with the attributes
+func (lh *LogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &LogHandler{Handler: lh.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup returns a new [LogHandler] with the group
+func (lh *LogHandler) WithGroup(name string) slog.Handler {
+	return &LogHandler{Handler: lh.Handler.WithGroup(name)}
+}
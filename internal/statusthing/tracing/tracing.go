@@ -0,0 +1,66 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+const (
+	// ExporterOTLP exports spans over otlp/http
+	// the endpoint and headers are configured with the standard OTEL_EXPORTER_OTLP_* env vars
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes spans to stdout
+	ExporterStdout = "stdout"
+
+	defaultServiceName = "statusthing"
+)
+
+// NewTracerProvider returns a [sdktrace.TracerProvider] exporting with the named exporter
+// the service name can be overridden with OTEL_SERVICE_NAME
+// callers are responsible for shutting it down so buffered spans are exported
+func NewTracerProvider(ctx context.Context, exporter string) (*sdktrace.TracerProvider, error) {
+	var exp sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case ExporterOTLP:
+		exp, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		exp, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	default:
+		return nil, fmt.Errorf("unknown exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s exporter: %w", exporter, err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(attribute.String("service.name", defaultServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create resource: %w", err)
+	}
+	return sdktrace.NewTracerProvider(sdktrace.WithBatcher(exp), sdktrace.WithResource(res)), nil
+}
+
+// End ends a span recording the error if there was one
+// not found errors are expected and aren't recorded
+func End(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, types.ErrNotFound) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
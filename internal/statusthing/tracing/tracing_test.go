@@ -0,0 +1,98 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	chi "github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/require"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/lusis/apithings/internal/statusthing/types"
+
+	"golang.org/x/exp/slog"
+)
+
+func TestNewTracerProvider(t *testing.T) {
+	t.Parallel()
+	_, err := NewTracerProvider(context.Background(), "carrier-pigeon")
+	require.Error(t, err)
+	tp, err := NewTracerProvider(context.Background(), ExporterStdout)
+	require.NoError(t, err)
+	require.NoError(t, tp.Shutdown(context.Background()))
+}
+
+func TestEnd(t *testing.T) {
+	t.Parallel()
+	sr := tracetest.NewSpanRecorder()
+	tracer := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)).Tracer(t.Name())
+	for _, err := range []error{nil, types.ErrNotFound, fmt.Errorf("kaboom")} {
+		_, span := tracer.Start(context.Background(), "span")
+		End(span, err)
+	}
+	spans := sr.Ended()
+	require.Len(t, spans, 3)
+	require.Equal(t, codes.Unset, spans[0].Status().Code)
+	require.Equal(t, codes.Unset, spans[1].Status().Code, "not found is expected")
+	require.Equal(t, codes.Error, spans[2].Status().Code)
+}
+
+func TestLogHandler(t *testing.T) {
+	t.Parallel()
+	buf := &bytes.Buffer{}
+	logger := slog.New(NewLogHandler(slog.NewJSONHandler(buf)).WithAttrs([]slog.Attr{slog.String("app", "test")}))
+	tracer := sdktrace.NewTracerProvider().Tracer(t.Name())
+	ctx, span := tracer.Start(context.Background(), "span")
+	defer span.End()
+
+	logger.InfoCtx(ctx, "traced")
+	logger.Info("untraced")
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+	var traced, untraced map[string]any
+	require.NoError(t, json.Unmarshal(lines[0], &traced))
+	require.NoError(t, json.Unmarshal(lines[1], &untraced))
+	require.Equal(t, span.SpanContext().TraceID().String(), traced["trace_id"])
+	require.Equal(t, span.SpanContext().SpanID().String(), traced["span_id"])
+	require.Equal(t, "test", traced["app"], "attrs should be kept")
+	require.NotContains(t, untraced, "trace_id")
+}
+
+func TestMiddleware(t *testing.T) {
+	t.Parallel()
+	sr := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr))
+	mux := chi.NewRouter()
+	mux.Use(Middleware(tp))
+	mux.Get("/things/{id}", func(w http.ResponseWriter, r *http.Request) {
+		if chi.URLParam(r, "id") == "broken" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	})
+
+	r := httptest.NewRequest(http.MethodGet, "/things/abc", nil)
+	// continue the caller's trace
+	r.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/things/broken", nil))
+	mux.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/nope", nil))
+
+	spans := sr.Ended()
+	require.Len(t, spans, 3)
+	require.Equal(t, "GET /things/{id}", spans[0].Name())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", spans[0].SpanContext().TraceID().String())
+	require.Contains(t, w.Header().Get("traceparent"), "4bf92f3577b34da6a3ce929d0e0e4736")
+	require.Contains(t, spans[0].Attributes(), attribute.Int("http.status_code", http.StatusOK))
+	require.Equal(t, codes.Error, spans[1].Status().Code)
+	require.Equal(t, "GET", spans[2].Name(), "unmatched routes keep the method as the name")
+}
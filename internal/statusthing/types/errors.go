@@ -9,4 +9,30 @@ var (
 	ErrNotFound = fmt.Errorf("record not found")
 	// ErrRequiredValueMissing is the error when a required param is missing or invalid
 	ErrRequiredValueMissing = fmt.Errorf("invalid value provided")
+	// ErrVersionMismatch is the error when a conditional change was requested against a stale version of a record
+	ErrVersionMismatch = fmt.Errorf("record version mismatch")
 )
+
+// ValidationError is the error when a specific field fails validation
+// It always wraps [ErrRequiredValueMissing] so existing [errors.Is] checks continue to work
+type ValidationError struct {
+	// Field is the name of the offending field
+	Field string
+	// Reason is a human readable explanation of what is wrong with the field
+	Reason string
+}
+
+// NewValidationError returns a new [ValidationError] for the provided field
+func NewValidationError(field, reason string) *ValidationError {
+	return &ValidationError{Field: field, Reason: reason}
+}
+
+// Error returns the string representation of the error
+func (ve *ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s", ve.Reason, ErrRequiredValueMissing.Error())
+}
+
+// Unwrap returns [ErrRequiredValueMissing]
+func (ve *ValidationError) Unwrap() error {
+	return ErrRequiredValueMissing
+}
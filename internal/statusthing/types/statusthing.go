@@ -5,5 +5,9 @@ type StatusThing struct {
 	ID          string `json:"id"`
 	Name        string `json:"name"`
 	Description string `json:"description"`
-	Status      Status `json:"status"`
+	// Group is the optional name of the group the thing belongs to
+	Group  string `json:"group"`
+	Status Status `json:"status"`
+	// Version is incremented every time the thing is changed
+	Version int64 `json:"version"`
 }
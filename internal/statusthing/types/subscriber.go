@@ -0,0 +1,22 @@
+package types
+
+import "time"
+
+// Subscriber is someone who is emailed when things change status
+type Subscriber struct {
+	ID    string
+	Email string
+	// Things and Groups limit the things the subscriber is emailed about
+	// the subscriber is emailed about every thing if both are empty
+	Things []string
+	Groups []string
+	// Confirmed is set once the subscriber has followed the link in their confirmation email
+	Confirmed bool
+	// ConfirmToken is the secret in the confirmation link
+	ConfirmToken string
+	// UnsubscribeToken is the secret in the unsubscribe link
+	UnsubscribeToken string
+	CreatedAt        time.Time
+	// ConfirmSentAt is when the last confirmation email was sent
+	ConfirmSentAt time.Time
+}
@@ -0,0 +1,25 @@
+package types
+
+import "time"
+
+// Transition is a change in the status of a [StatusThing]
+type Transition struct {
+	// Thing is the thing after the change
+	Thing *StatusThing
+	// Previous is the status before the change
+	// it is [StatusUnknown] when the thing was just created
+	// and the same as the status of Thing for recorded description updates
+	Previous Status
+	// At is when the change happened
+	At time.Time
+	// ID identifies a recorded change and is only set on changes read from history
+	ID int64
+	// Published is set on recorded changes that made it through flap detection
+	// every status change is recorded unpublished as well
+	Published bool
+}
+
+// DescriptionUpdate reports if t only records a new description for a thing whose status did not change
+func (t Transition) DescriptionUpdate() bool {
+	return t.Previous != StatusUnknown && t.Thing != nil && t.Previous == t.Thing.Status
+}
@@ -0,0 +1,2 @@
+// Package uptime calculates the availability of things from their status history
+package uptime
@@ -0,0 +1,208 @@
+package uptime
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// History provides the history of status changes
+type History interface {
+	// GetTransitions gets recorded status changes newest first
+	GetTransitions(ctx context.Context, opts ...dbfilters.Option) ([]types.Transition, error)
+}
+
+// Calculator calculates uptime from the status history
+type Calculator struct {
+	history History
+	weights map[types.Status]float64
+}
+
+// Option is a functional option for a [Calculator]
+type Option func(*Calculator) error
+
+// WithYellowWeight sets how much time spent yellow counts as up
+// 1 means degraded is up and 0 means degraded is down. The default is 1.
+func WithYellowWeight(w float64) Option {
+	return func(c *Calculator) error {
+		if w < 0 || w > 1 {
+			return fmt.Errorf("yellow weight must be between 0 and 1")
+		}
+		c.weights[types.StatusYellow] = w
+		return nil
+	}
+}
+
+// New returns a new [Calculator] using the history
+func New(history History, opts ...Option) (*Calculator, error) {
+	if history == nil {
+		return nil, fmt.Errorf("history cannot be nil")
+	}
+	c := &Calculator{
+		history: history,
+		weights: map[types.Status]float64{
+			types.StatusGreen:  1,
+			types.StatusYellow: 1,
+			types.StatusRed:    0,
+		},
+	}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// Report is the uptime of a thing over a window
+type Report struct {
+	From time.Time
+	To   time.Time
+	// Durations is how long the thing spent in each status
+	// time before the thing existed or was recorded is not included
+	Durations map[types.Status]time.Duration
+	// Uptime is the weighted percentage of known time the thing was up
+	// it is only meaningful if Known is not zero
+	Uptime float64
+	// Known is how much of the window we have a status for
+	Known time.Duration
+}
+
+// segment is a period of time spent in a single status
+type segment struct {
+	from   time.Time
+	to     time.Time
+	status types.Status
+}
+
+// Calculate returns the uptime of the thing between from and to
+func (c *Calculator) Calculate(ctx context.Context, thing *types.StatusThing, from, to time.Time) (*Report, error) {
+	segments, err := c.timeline(ctx, thing, from, to)
+	if err != nil {
+		return nil, err
+	}
+	return c.report(segments, from, to), nil
+}
+
+// Buckets splits the window between from and to into consecutive reports of size
+// the last report is shorter if the window isn't a multiple of size
+func (c *Calculator) Buckets(ctx context.Context, thing *types.StatusThing, from, to time.Time, size time.Duration) ([]*Report, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("bucket size must be positive")
+	}
+	segments, err := c.timeline(ctx, thing, from, to)
+	if err != nil {
+		return nil, err
+	}
+	reports := []*Report{}
+	for start := from; start.Before(to); start = start.Add(size) {
+		end := start.Add(size)
+		if end.After(to) {
+			end = to
+		}
+		reports = append(reports, c.report(segments, start, end))
+	}
+	return reports, nil
+}
+
+// timeline returns the statuses of the thing between from and to oldest first
+func (c *Calculator) timeline(ctx context.Context, thing *types.StatusThing, from, to time.Time) ([]segment, error) {
+	if thing == nil {
+		return nil, fmt.Errorf("thing cannot be nil")
+	}
+	if !from.Before(to) {
+		return nil, types.NewValidationError("from", "from must be before to")
+	}
+	within, err := c.history.GetTransitions(ctx, dbfilters.WithThingID(thing.ID), dbfilters.WithSince(from), dbfilters.WithUntil(to))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get history: %w", err)
+	}
+	before, err := c.history.GetTransitions(ctx, dbfilters.WithThingID(thing.ID), dbfilters.WithUntil(from), dbfilters.WithLimit(1))
+	if err != nil {
+		return nil, fmt.Errorf("unable to get history: %w", err)
+	}
+	// work out the status at the start of the window
+	var current types.Status
+	switch {
+	case len(before) > 0:
+		current = before[0].Thing.Status
+	case len(within) > 0:
+		// this is unknown if the thing was created within the window
+		current = within[len(within)-1].Previous
+	default:
+		// without any history the window is before the thing existed or was recorded
+		current = types.StatusUnknown
+	}
+
+	segments := []segment{}
+	start := from
+	// history is newest first
+	for i := len(within) - 1; i >= 0; i-- {
+		t := within[i]
+		if t.At.After(start) {
+			segments = append(segments, segment{from: start, to: t.At, status: current})
+			start = t.At
+		}
+		current = t.Thing.Status
+	}
+	segments = append(segments, segment{from: start, to: to, status: current})
+	return segments, nil
+}
+
+// report summarises the segments that fall between from and to
+func (c *Calculator) report(segments []segment, from, to time.Time) *Report {
+	r := &Report{From: from, To: to, Durations: map[types.Status]time.Duration{}}
+	var weighted float64
+	for _, s := range segments {
+		start, end := s.from, s.to
+		if start.Before(from) {
+			start = from
+		}
+		if end.After(to) {
+			end = to
+		}
+		if !start.Before(end) {
+			continue
+		}
+		weight, ok := c.weights[s.status]
+		if !ok {
+			continue
+		}
+		d := end.Sub(start)
+		r.Durations[s.status] += d
+		r.Known += d
+		weighted += weight * float64(d)
+	}
+	if r.Known > 0 {
+		r.Uptime = weighted / float64(r.Known) * 100
+	}
+	return r
+}
+
+// ParseWindow parses a window like 24h, 7d or 90d
+// days aren't supported by [time.ParseDuration] so they are handled here
+func ParseWindow(s string) (time.Duration, error) {
+	var d time.Duration
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+		d = time.Duration(n) * 24 * time.Hour
+	} else {
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return 0, fmt.Errorf("invalid window %q", s)
+		}
+		d = parsed
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("window must be positive")
+	}
+	return d, nil
+}
@@ -0,0 +1,150 @@
+package uptime
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lusis/apithings/internal/statusthing/storers/dbfilters"
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// testHistory filters transitions the same way the sqlite store does
+type testHistory []types.Transition
+
+func (th testHistory) GetTransitions(_ context.Context, opts ...dbfilters.Option) ([]types.Transition, error) {
+	f, err := dbfilters.New(opts...)
+	if err != nil {
+		return nil, err
+	}
+	res := []types.Transition{}
+	// stored oldest first but returned newest first
+	for i := len(th) - 1; i >= 0; i-- {
+		t := th[i]
+		if f.ThingID() != "" && t.Thing.ID != f.ThingID() {
+			continue
+		}
+		if !f.Since().IsZero() && t.At.Before(f.Since()) {
+			continue
+		}
+		if !f.Until().IsZero() && !t.At.Before(f.Until()) {
+			continue
+		}
+		res = append(res, t)
+		if f.Limit() > 0 && len(res) == f.Limit() {
+			break
+		}
+	}
+	return res, nil
+}
+
+var start = time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)
+
+func change(hours int, previous, status types.Status) types.Transition {
+	return types.Transition{
+		Thing:    &types.StatusThing{ID: "api", Name: "api", Status: status},
+		Previous: previous,
+		At:       start.Add(time.Duration(hours) * time.Hour),
+	}
+}
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+	_, err := New(nil)
+	require.Error(t, err)
+	_, err = New(testHistory{}, WithYellowWeight(2))
+	require.Error(t, err)
+}
+
+func TestCalculate(t *testing.T) {
+	t.Parallel()
+	history := testHistory{
+		// created partway through the first day
+		change(6, types.StatusUnknown, types.StatusGreen),
+		change(12, types.StatusGreen, types.StatusRed),
+		change(18, types.StatusRed, types.StatusYellow),
+		change(30, types.StatusYellow, types.StatusGreen),
+	}
+	thing := &types.StatusThing{ID: "api", Status: types.StatusGreen}
+	ctx := context.Background()
+
+	c, err := New(history)
+	require.NoError(t, err)
+	_, err = c.Calculate(ctx, thing, start, start)
+	require.ErrorIs(t, err, types.ErrRequiredValueMissing, "empty windows are invalid")
+
+	r, err := c.Calculate(ctx, thing, start, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 18*time.Hour, r.Known, "time before the thing existed is unknown")
+	require.Equal(t, 6*time.Hour, r.Durations[types.StatusRed])
+	require.InDelta(t, 66.666, r.Uptime, 0.001)
+
+	// yellow counts as half up
+	half, err := New(history, WithYellowWeight(0.5))
+	require.NoError(t, err)
+	r, err = half.Calculate(ctx, thing, start, start.Add(24*time.Hour))
+	require.NoError(t, err)
+	require.InDelta(t, 50, r.Uptime, 0.001)
+
+	// the status at the start of the window comes from earlier history
+	r, err = c.Calculate(ctx, thing, start.Add(15*time.Hour), start.Add(21*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 3*time.Hour, r.Durations[types.StatusRed])
+	require.Equal(t, 3*time.Hour, r.Durations[types.StatusYellow])
+	require.InDelta(t, 50, r.Uptime, 0.001)
+
+	// no changes in or before the window means it is before the thing was created
+	r, err = c.Calculate(ctx, thing, start.Add(-24*time.Hour), start.Add(6*time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, r.Known, "time before the creation change is unknown")
+	require.Empty(t, r.Durations)
+	r, err = c.Calculate(ctx, &types.StatusThing{ID: "web", Status: types.StatusRed}, start, start.Add(time.Hour))
+	require.NoError(t, err)
+	require.Zero(t, r.Known, "things without history have no known status")
+
+	// the status after the last change comes from the history rather than the thing
+	r, err = c.Calculate(ctx, thing, start.Add(48*time.Hour), start.Add(72*time.Hour))
+	require.NoError(t, err)
+	require.Equal(t, 24*time.Hour, r.Durations[types.StatusGreen])
+}
+
+func TestBuckets(t *testing.T) {
+	t.Parallel()
+	history := testHistory{
+		change(0, types.StatusUnknown, types.StatusGreen),
+		change(36, types.StatusGreen, types.StatusRed),
+	}
+	c, err := New(history)
+	require.NoError(t, err)
+	thing := &types.StatusThing{ID: "api", Status: types.StatusRed}
+	_, err = c.Buckets(context.Background(), thing, start, start.Add(time.Hour), 0)
+	require.Error(t, err)
+
+	days, err := c.Buckets(context.Background(), thing, start, start.Add(60*time.Hour), 24*time.Hour)
+	require.NoError(t, err)
+	require.Len(t, days, 3)
+	require.Equal(t, float64(100), days[0].Uptime)
+	require.InDelta(t, 50, days[1].Uptime, 0.001)
+	require.Equal(t, float64(0), days[2].Uptime)
+	require.Equal(t, 12*time.Hour, days[2].Known, "the last bucket is cut short")
+}
+
+func TestParseWindow(t *testing.T) {
+	t.Parallel()
+	for in, want := range map[string]time.Duration{
+		"24h": 24 * time.Hour,
+		"7d":  7 * 24 * time.Hour,
+		"90d": 90 * 24 * time.Hour,
+		"90m": 90 * time.Minute,
+	} {
+		got, err := ParseWindow(in)
+		require.NoError(t, err, in)
+		require.Equal(t, want, got, in)
+	}
+	for _, in := range []string{"", "d", "xd", "-1d", "0h", "soon"} {
+		_, err := ParseWindow(in)
+		require.Error(t, err, in)
+	}
+}
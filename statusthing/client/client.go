@@ -0,0 +1,234 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	apiKeyHeader    = "X-STATUSTHING-KEY"
+	requestIDHeader = "X-Request-ID"
+	applicationJSON = "application/json"
+)
+
+// Client is a client for the statusthing api
+type Client struct {
+	// apiURL is the url of the api under the statusthing base path
+	apiURL     *url.URL
+	apiKey     string
+	httpClient *http.Client
+}
+
+// Option is a functional option for customizing a [Client]
+type Option func(*Client) error
+
+// WithAPIKey sets the api key sent with every request
+func WithAPIKey(key string) Option {
+	return func(c *Client) error {
+		if key == "" {
+			return fmt.Errorf("apikey cannot be empty")
+		}
+		c.apiKey = key
+		return nil
+	}
+}
+
+// WithHTTPClient provides a custom [http.Client] to make requests with
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) error {
+		if hc == nil {
+			return fmt.Errorf("http client cannot be nil")
+		}
+		c.httpClient = hc
+		return nil
+	}
+}
+
+// New returns a new [Client] for the statusthing serving at baseURL
+// baseURL should include the base path statusthing is served from i.e. http://localhost:9000/statusthings
+func New(baseURL string, opts ...Option) (*Client, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("base url cannot be empty")
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid base url: %w", err)
+	}
+	if u.Scheme == "" || u.Host == "" {
+		return nil, fmt.Errorf("base url must be absolute: %s", baseURL)
+	}
+	c := &Client{
+		apiURL:     u.JoinPath("api"),
+		httpClient: http.DefaultClient,
+	}
+	for _, o := range opts {
+		if err := o(c); err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+// RequestOption customizes a single request
+type RequestOption func(*http.Request)
+
+// IfVersion makes a change conditional on the thing still being at the provided version
+// [ErrVersionMismatch] is returned if the thing has changed
+func IfVersion(version int64) RequestOption {
+	return func(r *http.Request) {
+		r.Header.Set("If-Match", strconv.Quote(strconv.FormatInt(version, 10)))
+	}
+}
+
+// List returns all things
+func (c *Client) List(ctx context.Context) ([]*StatusThing, error) {
+	things, _, err := c.list(ctx, "")
+	return things, err
+}
+
+// list returns all things and the etag of the collection
+// if etag matches the current collection nil things are returned
+func (c *Client) list(ctx context.Context, etag string) ([]*StatusThing, string, error) {
+	opts := []RequestOption{}
+	if etag != "" {
+		opts = append(opts, func(r *http.Request) { r.Header.Set("If-None-Match", etag) })
+	}
+	res, err := c.do(ctx, http.MethodGet, "", nil, opts...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusNotModified {
+		return nil, etag, nil
+	}
+	things := []*thing{}
+	if err := json.NewDecoder(res.Body).Decode(&things); err != nil {
+		return nil, "", fmt.Errorf("unable to decode response: %w", err)
+	}
+	return toStatusThings(things), res.Header.Get("ETag"), nil
+}
+
+// Get returns the thing with the provided id
+func (c *Client) Get(ctx context.Context, id string) (*StatusThing, error) {
+	if id == "" {
+		return nil, fmt.Errorf("id cannot be empty: %w", ErrRequiredValueMissing)
+	}
+	res, err := c.do(ctx, http.MethodGet, id, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return decodeThing(res.Body)
+}
+
+// Create creates a new thing
+func (c *Client) Create(ctx context.Context, params Params) (*StatusThing, error) {
+	res, err := c.do(ctx, http.MethodPost, "", &thing{Name: params.Name, Description: params.Description, Group: params.Group, Status: params.Status.String()})
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return decodeThing(res.Body)
+}
+
+// SetStatus sets the status of the thing with the provided id
+func (c *Client) SetStatus(ctx context.Context, id string, status Status, opts ...RequestOption) error {
+	return c.Update(ctx, id, Params{Status: status}, opts...)
+}
+
+// Update updates the thing with the provided id
+// the name of a thing cannot be changed so params.Name is ignored
+func (c *Client) Update(ctx context.Context, id string, params Params, opts ...RequestOption) error {
+	if id == "" {
+		return fmt.Errorf("id cannot be empty: %w", ErrRequiredValueMissing)
+	}
+	res, err := c.do(ctx, http.MethodPut, id, &thing{Status: params.Status.String(), Description: params.Description, Group: params.Group}, opts...)
+	if err != nil {
+		return err
+	}
+	return res.Body.Close()
+}
+
+// Delete deletes the thing with the provided id returning the thing as it was before deletion
+func (c *Client) Delete(ctx context.Context, id string, opts ...RequestOption) (*StatusThing, error) {
+	if id == "" {
+		return nil, fmt.Errorf("id cannot be empty: %w", ErrRequiredValueMissing)
+	}
+	res, err := c.do(ctx, http.MethodDelete, id, nil, opts...)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	return decodeThing(res.Body)
+}
+
+// do performs a request against the api returning an [APIError] for unsuccessful responses
+// callers are responsible for closing the body of the returned response
+func (c *Client) do(ctx context.Context, method, id string, body any, opts ...RequestOption) (*http.Response, error) {
+	u := c.apiURL.JoinPath("/")
+	if id != "" {
+		u = c.apiURL.JoinPath(url.PathEscape(id))
+	}
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode request: %w", err)
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), reader)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", applicationJSON)
+	}
+	req.Header.Set("Accept", applicationJSON)
+	if c.apiKey != "" {
+		req.Header.Set(apiKeyHeader, c.apiKey)
+	}
+	for _, o := range opts {
+		o(req)
+	}
+	res, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusNotModified {
+		return res, nil
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		defer res.Body.Close()
+		return nil, errorFromResponse(res)
+	}
+	return res, nil
+}
+
+func decodeThing(r io.Reader) (*StatusThing, error) {
+	t := &thing{}
+	if err := json.NewDecoder(r).Decode(t); err != nil {
+		return nil, fmt.Errorf("unable to decode response: %w", err)
+	}
+	return t.toStatusThing(), nil
+}
+
+func toStatusThings(things []*thing) []*StatusThing {
+	res := make([]*StatusThing, 0, len(things))
+	for _, t := range things {
+		res = append(res, t.toStatusThing())
+	}
+	return res
+}
+
+// trimmedBody is used for non-problem error responses
+func trimmedBody(b []byte) string {
+	return strings.TrimSpace(string(b))
+}
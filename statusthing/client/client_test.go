@@ -0,0 +1,201 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/lusis/apithings/internal/statusthing/handlers"
+	"github.com/lusis/apithings/internal/statusthing/statusthingtest"
+)
+
+const testAPIKey = "sekret"
+
+func TestConstructor(t *testing.T) {
+	t.Parallel()
+	testCases := map[string]struct {
+		baseURL   string
+		opts      []Option
+		shouldErr bool
+	}{
+		"good":             {baseURL: "http://localhost:9000/statusthings", opts: []Option{WithAPIKey("foo"), WithHTTPClient(&http.Client{})}},
+		"empty-url":        {baseURL: "", shouldErr: true},
+		"relative-url":     {baseURL: "/statusthings", shouldErr: true},
+		"empty-key":        {baseURL: "http://localhost:9000", opts: []Option{WithAPIKey("")}, shouldErr: true},
+		"nil-client":       {baseURL: "http://localhost:9000", opts: []Option{WithHTTPClient(nil)}, shouldErr: true},
+		"unparseable-url":  {baseURL: "http://[::1", shouldErr: true},
+		"trailing-slash":   {baseURL: "http://localhost:9000/statusthings/"},
+		"no-path-base-url": {baseURL: "http://localhost:9000"},
+	}
+	for n, tc := range testCases {
+		t.Run(n, func(t *testing.T) {
+			c, err := New(tc.baseURL, tc.opts...)
+			if tc.shouldErr {
+				require.Error(t, err, "should error")
+				require.Nil(t, c, "should be nil")
+			} else {
+				require.NoError(t, err, "should not error")
+				require.NotNil(t, c, "should not be nil")
+			}
+		})
+	}
+}
+
+func TestHappyPath(t *testing.T) {
+	t.Parallel()
+	srv := statusthingtest.NewServer(t, testAPIKey)
+	c, err := New(srv.URL+handlers.DefaultBasePath, WithAPIKey(testAPIKey), WithHTTPClient(srv.Client()))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	all, err := c.List(ctx)
+	require.NoError(t, err, "list should not error")
+	require.Empty(t, all, "should start empty")
+
+	created, err := c.Create(ctx, Params{Name: "my service", Description: "my description", Group: String("core"), Status: StatusGreen})
+	require.NoError(t, err, "create should not error")
+	require.NotEmpty(t, created.ID, "should have an id")
+	require.Equal(t, StatusGreen, created.Status)
+	require.Equal(t, "core", created.Group)
+	require.Equal(t, int64(1), created.Version)
+
+	require.NoError(t, c.SetStatus(ctx, created.ID, StatusYellow, IfVersion(created.Version)), "set status should not error")
+
+	got, err := c.Get(ctx, created.ID)
+	require.NoError(t, err, "get should not error")
+	require.Equal(t, StatusYellow, got.Status)
+	require.Equal(t, int64(2), got.Version)
+
+	require.Equal(t, "core", got.Group, "group should be unchanged by setting the status")
+
+	require.NoError(t, c.Update(ctx, created.ID, Params{Status: StatusRed, Description: "on fire", Group: String("")}, IfVersion(got.Version)), "update should not error")
+	got, err = c.Get(ctx, created.ID)
+	require.NoError(t, err, "get should not error")
+	require.Equal(t, StatusRed, got.Status)
+	require.Equal(t, "on fire", got.Description)
+	require.Equal(t, "", got.Group, "group should be removed")
+	require.Equal(t, int64(3), got.Version)
+
+	all, err = c.List(ctx)
+	require.NoError(t, err, "list should not error")
+	require.Len(t, all, 1, "should have one thing")
+	require.Equal(t, got, all[0])
+
+	deleted, err := c.Delete(ctx, created.ID, IfVersion(got.Version))
+	require.NoError(t, err, "delete should not error")
+	require.Equal(t, got, deleted)
+}
+
+func TestErrors(t *testing.T) {
+	t.Parallel()
+	srv := statusthingtest.NewServer(t, testAPIKey)
+	c, err := New(srv.URL+handlers.DefaultBasePath, WithAPIKey(testAPIKey), WithHTTPClient(srv.Client()))
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	created, err := c.Create(ctx, Params{Name: t.Name(), Description: t.Name(), Status: StatusGreen})
+	require.NoError(t, err)
+
+	t.Run("not-found", func(t *testing.T) {
+		_, err := c.Get(ctx, "nope")
+		require.ErrorIs(t, err, ErrNotFound)
+		_, err = c.Delete(ctx, "nope")
+		require.ErrorIs(t, err, ErrNotFound)
+		require.ErrorIs(t, c.SetStatus(ctx, "nope", StatusRed), ErrNotFound)
+	})
+
+	t.Run("already-exists", func(t *testing.T) {
+		_, err := c.Create(ctx, Params{Name: t.Name(), Description: t.Name(), Status: StatusGreen})
+		require.NoError(t, err)
+		_, err = c.Create(ctx, Params{Name: t.Name(), Description: t.Name(), Status: StatusGreen})
+		require.ErrorIs(t, err, ErrAlreadyExists)
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		_, err := c.Create(ctx, Params{Description: "desc", Status: StatusGreen})
+		require.ErrorIs(t, err, ErrRequiredValueMissing)
+		apiErr := &APIError{}
+		require.True(t, errors.As(err, &apiErr), "should be an api error")
+		require.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+		require.Equal(t, "name", apiErr.Field)
+		require.NotEmpty(t, apiErr.RequestID)
+	})
+
+	t.Run("version-mismatch", func(t *testing.T) {
+		require.ErrorIs(t, c.SetStatus(ctx, created.ID, StatusRed, IfVersion(created.Version+10)), ErrVersionMismatch)
+		_, err := c.Delete(ctx, created.ID, IfVersion(created.Version+10))
+		require.ErrorIs(t, err, ErrVersionMismatch)
+	})
+
+	t.Run("permission-denied", func(t *testing.T) {
+		noKey, err := New(srv.URL+handlers.DefaultBasePath, WithHTTPClient(srv.Client()))
+		require.NoError(t, err)
+		_, err = noKey.List(ctx)
+		apiErr := &APIError{}
+		require.True(t, errors.As(err, &apiErr), "should be an api error")
+		require.Equal(t, http.StatusForbidden, apiErr.StatusCode)
+		require.Equal(t, "permission_denied", apiErr.Code)
+	})
+
+	t.Run("empty-id", func(t *testing.T) {
+		_, err := c.Get(ctx, "")
+		require.ErrorIs(t, err, ErrRequiredValueMissing)
+	})
+}
+
+func TestWatch(t *testing.T) {
+	t.Parallel()
+	srv := statusthingtest.NewServer(t, testAPIKey)
+	c, err := New(srv.URL+handlers.DefaultBasePath, WithAPIKey(testAPIKey), WithHTTPClient(srv.Client()))
+	require.NoError(t, err)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	existing, err := c.Create(ctx, Params{Name: "existing", Description: "existing", Status: StatusGreen})
+	require.NoError(t, err)
+
+	var lock sync.Mutex
+	events := []Event{}
+	done := make(chan error)
+	go func() {
+		done <- c.Watch(ctx, 10*time.Millisecond, func(e Event) {
+			lock.Lock()
+			defer lock.Unlock()
+			events = append(events, e)
+		})
+	}()
+	waitForEvents := func(n int) []Event {
+		require.Eventually(t, func() bool {
+			lock.Lock()
+			defer lock.Unlock()
+			return len(events) >= n
+		}, 2*time.Second, 5*time.Millisecond)
+		lock.Lock()
+		defer lock.Unlock()
+		return append([]Event{}, events...)
+	}
+
+	seen := waitForEvents(1)
+	require.Equal(t, EventAdded, seen[0].Type)
+	require.Equal(t, existing.ID, seen[0].Thing.ID)
+
+	require.NoError(t, c.SetStatus(ctx, existing.ID, StatusRed))
+	seen = waitForEvents(2)
+	require.Equal(t, EventChanged, seen[1].Type)
+	require.Equal(t, StatusRed, seen[1].Thing.Status)
+	require.Equal(t, StatusGreen, seen[1].Previous.Status)
+
+	_, err = c.Delete(ctx, existing.ID)
+	require.NoError(t, err)
+	seen = waitForEvents(3)
+	require.Equal(t, EventRemoved, seen[2].Type)
+	require.Equal(t, existing.ID, seen[2].Thing.ID)
+
+	cancel()
+	require.ErrorIs(t, <-done, context.Canceled)
+}
@@ -0,0 +1,2 @@
+// Package client contains a go client for the statusthing api
+package client
@@ -0,0 +1,72 @@
+package client
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// APIError is the error returned when the api responds with an error
+// [errors.Is] can be used to compare it against the Err* values in this package
+type APIError struct {
+	// StatusCode is the http status code of the response
+	StatusCode int
+	// Code is the machine readable error code returned by the api
+	Code string `json:"code"`
+	// Detail is the human readable explanation of the error
+	Detail string `json:"detail"`
+	// Field is the offending field for validation errors
+	Field string `json:"field"`
+	// RequestID is the id of the failed request
+	RequestID string `json:"request_id"`
+}
+
+// Error returns the string representation of the error
+func (ae *APIError) Error() string {
+	msg := ae.Detail
+	if msg == "" {
+		msg = http.StatusText(ae.StatusCode)
+	}
+	if ae.Field != "" {
+		msg = fmt.Sprintf("%s (field: %s)", msg, ae.Field)
+	}
+	if ae.RequestID != "" {
+		msg = fmt.Sprintf("%s (request id: %s)", msg, ae.RequestID)
+	}
+	return fmt.Sprintf("statusthing api returned %d: %s", ae.StatusCode, msg)
+}
+
+// Unwrap maps the error back to the matching sentinel error
+func (ae *APIError) Unwrap() error {
+	switch ae.StatusCode {
+	case http.StatusNotFound:
+		return ErrNotFound
+	case http.StatusConflict:
+		return ErrAlreadyExists
+	case http.StatusPreconditionFailed:
+		return ErrVersionMismatch
+	}
+	if ae.Code == "validation_failed" {
+		return ErrRequiredValueMissing
+	}
+	return nil
+}
+
+// errorFromResponse builds an [APIError] from a non-successful response
+func errorFromResponse(res *http.Response) error {
+	apiErr := &APIError{StatusCode: res.StatusCode}
+	body, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return fmt.Errorf("unable to read error response: %w", err)
+	}
+	// not every error (i.e. from a proxy) will be a problem document so we don't fail on decoding
+	if jerr := json.Unmarshal(body, apiErr); jerr != nil {
+		apiErr.Detail = trimmedBody(body)
+	}
+	apiErr.StatusCode = res.StatusCode
+	if apiErr.RequestID == "" {
+		apiErr.RequestID = res.Header.Get(requestIDHeader)
+	}
+	return apiErr
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"github.com/lusis/apithings/internal/statusthing/types"
+)
+
+// StatusThing is a "thing" that can have a status
+type StatusThing = types.StatusThing
+
+// Status represents a status
+type Status = types.Status
+
+const (
+	// StatusUnknown is the default status code
+	StatusUnknown = types.StatusUnknown
+	// StatusRed is generally the bad status
+	StatusRed = types.StatusRed
+	// StatusGreen is generally the good status
+	StatusGreen = types.StatusGreen
+	// StatusYellow is generally the warning/remediation status
+	StatusYellow = types.StatusYellow
+)
+
+// StatusFromString returns a [Status] from its string representation
+func StatusFromString(statusString string) Status {
+	return types.StatusFromString(statusString)
+}
+
+var (
+	// ErrAlreadyExists is returned when creating a thing with a name that is already in use
+	ErrAlreadyExists = types.ErrAlreadyExists
+	// ErrNotFound is returned when a thing does not exist
+	ErrNotFound = types.ErrNotFound
+	// ErrRequiredValueMissing is returned when the api rejects a request as invalid
+	ErrRequiredValueMissing = types.ErrRequiredValueMissing
+	// ErrVersionMismatch is returned when a conditional request was made against a stale version
+	ErrVersionMismatch = types.ErrVersionMismatch
+)
+
+// Params are the values used to create or update a thing
+type Params struct {
+	// Name is the unique name of the thing. It is only used when creating
+	Name string
+	// Description describes the thing. An empty description is left unchanged on update
+	Description string
+	// Group is the optional group of the thing. A nil group is left unchanged on update
+	// and an empty group removes the thing from its group
+	Group *string
+	// Status is the status of the thing
+	Status Status
+}
+
+// String returns a pointer to the provided string for use with [Params]
+func String(s string) *string {
+	return &s
+}
+
+// thing is the api representation of a [StatusThing]
+type thing struct {
+	ID          string  `json:"id,omitempty"`
+	Name        string  `json:"name,omitempty"`
+	Description string  `json:"description,omitempty"`
+	Group       *string `json:"group,omitempty"`
+	Status      string  `json:"status"`
+	Version     int64   `json:"version,omitempty"`
+}
+
+func (t *thing) toStatusThing() *StatusThing {
+	st := &StatusThing{
+		ID:          t.ID,
+		Name:        t.Name,
+		Description: t.Description,
+		Status:      types.StatusFromString(t.Status),
+		Version:     t.Version,
+	}
+	if t.Group != nil {
+		st.Group = *t.Group
+	}
+	return st
+}
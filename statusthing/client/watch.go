@@ -0,0 +1,100 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// EventType is the type of change observed by [Client.Watch]
+type EventType int
+
+const (
+	// EventAdded is a thing that was not previously known
+	EventAdded EventType = iota + 1
+	// EventChanged is a known thing that has changed
+	EventChanged
+	// EventRemoved is a known thing that no longer exists
+	EventRemoved
+)
+
+// String returns the string representation of an event type
+func (et EventType) String() string {
+	switch et {
+	case EventAdded:
+		return "added"
+	case EventChanged:
+		return "changed"
+	case EventRemoved:
+		return "removed"
+	default:
+		return "unknown"
+	}
+}
+
+// Event is a change observed by [Client.Watch]
+type Event struct {
+	Type EventType
+	// Thing is the current state of the thing or the last known state if it was removed
+	Thing *StatusThing
+	// Previous is the previously known state of a changed thing
+	Previous *StatusThing
+}
+
+// Watch polls the api every interval and calls fn for every change until ctx is done
+// Every existing thing is reported as added on the first poll.
+// Polling uses conditional requests so an unchanged collection is not transferred again.
+// The error from ctx is returned when ctx is done, otherwise the first error from the api is returned
+func (c *Client) Watch(ctx context.Context, interval time.Duration, fn func(Event)) error {
+	if interval <= 0 {
+		return fmt.Errorf("interval must be greater than zero")
+	}
+	if fn == nil {
+		return fmt.Errorf("fn cannot be nil")
+	}
+	known := map[string]*StatusThing{}
+	etag := ""
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		things, newEtag, err := c.list(ctx, etag)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		// nil means the collection has not changed since the last poll
+		if things != nil {
+			known = diff(known, things, fn)
+			etag = newEtag
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// diff calls fn for every difference between known and current and returns current indexed by id
+func diff(known map[string]*StatusThing, current []*StatusThing, fn func(Event)) map[string]*StatusThing {
+	next := make(map[string]*StatusThing, len(current))
+	for _, t := range current {
+		next[t.ID] = t
+		prev, ok := known[t.ID]
+		if !ok {
+			fn(Event{Type: EventAdded, Thing: t})
+			continue
+		}
+		if *prev != *t {
+			fn(Event{Type: EventChanged, Thing: t, Previous: prev})
+		}
+	}
+	for id, t := range known {
+		if _, ok := next[id]; !ok {
+			fn(Event{Type: EventRemoved, Thing: t})
+		}
+	}
+	return next
+}